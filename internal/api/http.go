@@ -1,7 +1,9 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -14,6 +16,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 
 	"mindy/internal/blob"
+	"mindy/internal/crypt"
 	"mindy/internal/dataman"
 	"mindy/internal/graph"
 	"mindy/internal/indexer"
@@ -786,18 +789,20 @@ const legacyWebUIHTML = `
 
 type Server struct {
 	port          int
-	blobStore     *blob.Store
+	blobStore     blob.BlobStore
 	vectorIndex   *vector.Index
 	graphStore    *graph.Store
+	analytics     *graph.Analytics
 	indexer       *indexer.Indexer
 	embedder      embedder.Embedder
 	dataManager   *dataman.DataManager
 	searchHistory *dataman.SearchHistory
 	savedSearches *dataman.SavedSearches
+	dataDir       string
 	httpServer    *http.Server
 }
 
-func NewServer(port int, blobStore *blob.Store, vectorIndex *vector.Index, graphStore *graph.Store, idx *indexer.Indexer, dataDir string) *Server {
+func NewServer(port int, blobStore blob.BlobStore, vectorIndex *vector.Index, graphStore *graph.Store, idx *indexer.Indexer, dataDir string) *Server {
 	var tfidf *embedder.TFIDF
 	if idx != nil {
 		tfidf = idx.GetEmbedder()
@@ -809,16 +814,23 @@ func NewServer(port int, blobStore *blob.Store, vectorIndex *vector.Index, graph
 	ss := dataman.NewSavedSearches(dataDir)
 	ss.Load()
 
+	var analytics *graph.Analytics
+	if graphStore != nil {
+		analytics = graph.NewAnalytics(graphStore)
+	}
+
 	return &Server{
 		port:          port,
 		blobStore:     blobStore,
 		vectorIndex:   vectorIndex,
 		graphStore:    graphStore,
+		analytics:     analytics,
 		indexer:       idx,
 		embedder:      tfidf,
 		dataManager:   dm,
 		searchHistory: sh,
 		savedSearches: ss,
+		dataDir:       dataDir,
 	}
 }
 
@@ -838,9 +850,34 @@ func (s *Server) Start() error {
 		r.Get("/search", s.search)
 		r.Get("/stats", s.stats)
 		r.Get("/graph/node/{id}", s.getNode)
+		r.Get("/graph/node/{id}/history", s.nodeHistory)
+		r.Get("/graph/schema", s.getSchema)
+		r.Post("/graph/schema/nodes", s.defineNodeType)
+		r.Delete("/graph/schema/nodes/{name}", s.deleteNodeType)
+		r.Post("/graph/schema/edges", s.defineEdgeType)
+		r.Delete("/graph/schema/edges/{name}", s.deleteEdgeType)
+		r.Post("/graph/nodes", s.createNode)
+		r.Patch("/graph/nodes/{id}", s.updateNode)
+		r.Delete("/graph/nodes/{id}", s.deleteNode)
+		r.Post("/graph/edges", s.createEdge)
+		r.Patch("/graph/edges", s.updateEdge)
+		r.Delete("/graph/edges", s.deleteEdge)
 		r.Get("/graph/traverse", s.traverse)
 		r.Get("/graph/search", s.searchNodes)
+		r.Post("/graph/query", s.graphQuery)
+		r.Get("/graph/export", s.graphExport)
+		r.Get("/graph/related", s.relatedEntities)
+		r.Post("/graph/entities/merge", s.mergeEntities)
+		r.Get("/graph/entities/candidates", s.mergeCandidates)
+		r.Get("/graph/entities/aliases", s.entityAliases)
+		r.Post("/graph/analytics", s.startAnalytics)
+		r.Get("/graph/analytics", s.getAnalytics)
 		r.Get("/blob/{hash}", s.getBlob)
+		r.Post("/blob/gc", s.blobGC)
+		r.Post("/blob/fsck", s.startFsck)
+		r.Get("/blob/fsck", s.getFsck)
+		r.Get("/encryption", s.getEncryption)
+		r.Post("/encryption/rewrap", s.rewrapKey)
 
 		// Export/Import
 		r.Post("/export", s.exportData)
@@ -1068,6 +1105,19 @@ func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
 	stats["indexer"] = map[string]interface{}{
 		"files_indexed": s.indexer.GetFileCount(),
 	}
+
+	if s.graphStore != nil {
+		stats["graph"] = map[string]interface{}{
+			"nodes": s.graphStore.CountNodes(""),
+			"types": s.graphStore.TypeCounts(),
+		}
+	}
+
+	if s.blobStore != nil {
+		if blobStats, err := s.blobStore.Stats(); err == nil {
+			stats["blobs"] = blobStats
+		}
+	}
 	
 	json.NewEncoder(w).Encode(stats)
 }
@@ -1084,9 +1134,10 @@ func (s *Server) searchNodes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	typeFilter := map[string]string{
-		"document": "Document",
-		"chunk":    "Chunk",
-		"entity":   "Entity",
+		"document": graph.NodeDocument,
+		"chunk":    graph.NodeChunk,
+		"entity":   graph.NodeEntity,
+		"symbol":   graph.NodeSymbol,
 	}
 	
 	if nodeType != "" {
@@ -1095,7 +1146,30 @@ func (s *Server) searchNodes(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	nodes := s.graphStore.SearchNodes(nodeType, query, limit)
+	asOf, hasAsOf, err := parseAsOf(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sortKey := r.URL.Query().Get("sort")
+	var nodes []*graph.Node
+	if hasAsOf {
+		if sortKey != "" {
+			http.Error(w, "sort is not supported with as_of", http.StatusBadRequest)
+			return
+		}
+		nodes = s.graphStore.SearchNodesAsOf(nodeType, query, asOf, limit)
+	} else if sortKey != "" {
+		if !graph.IsRankProp(sortKey) {
+			http.Error(w, "sort must be one of: "+strings.Join(graph.RankProps, ", "), http.StatusBadRequest)
+			return
+		}
+		ascending := r.URL.Query().Get("order") == "asc"
+		nodes = s.graphStore.SearchNodesSorted(nodeType, query, sortKey, ascending, limit)
+	} else {
+		nodes = s.graphStore.SearchNodes(nodeType, query, limit)
+	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"query": query,
@@ -1111,7 +1185,18 @@ func (s *Server) getNode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	node, err := s.graphStore.GetNode(id)
+	asOf, hasAsOf, err := parseAsOf(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var node *graph.Node
+	if hasAsOf {
+		node, err = s.graphStore.GetNodeAsOf(id, asOf)
+	} else {
+		node, err = s.graphStore.GetNode(id)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -1120,6 +1205,234 @@ func (s *Server) getNode(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(node)
 }
 
+func (s *Server) nodeHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := s.graphStore.NodeHistory(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "node not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       id,
+		"versions": versions,
+		"count":    len(versions),
+	})
+}
+
+// parseAsOf reads the as_of query parameter as Unix seconds, an RFC 3339
+// timestamp or a YYYY-MM-DD date (start of day, UTC).
+func parseAsOf(r *http.Request) (int64, bool, error) {
+	v := r.URL.Query().Get("as_of")
+	if v == "" {
+		return 0, false, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return secs, true, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Unix(), true, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t.Unix(), true, nil
+	}
+	return 0, false, fmt.Errorf("invalid as_of %q: use Unix seconds, RFC 3339 or YYYY-MM-DD", v)
+}
+
+func (s *Server) getSchema(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(s.graphStore.Schema())
+}
+
+func (s *Server) defineNodeType(w http.ResponseWriter, r *http.Request) {
+	var spec graph.NodeTypeSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.graphStore.DefineNodeType(spec); err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	defined, _ := s.graphStore.NodeType(spec.Name)
+	json.NewEncoder(w).Encode(defined)
+}
+
+func (s *Server) deleteNodeType(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := s.graphStore.DeleteNodeType(name); err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": name,
+	})
+}
+
+func (s *Server) defineEdgeType(w http.ResponseWriter, r *http.Request) {
+	var spec graph.EdgeTypeSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.graphStore.DefineEdgeType(spec); err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	defined, _ := s.graphStore.EdgeType(spec.Name)
+	json.NewEncoder(w).Encode(defined)
+}
+
+func (s *Server) deleteEdgeType(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := s.graphStore.DeleteEdgeType(name); err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": name,
+	})
+}
+
+func (s *Server) createNode(w http.ResponseWriter, r *http.Request) {
+	var node graph.Node
+	if err := json.NewDecoder(r.Body).Decode(&node); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := s.graphStore.CreateUserNode(&node)
+	if err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) updateNode(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req struct {
+		Label string                 `json:"label"`
+		Props map[string]interface{} `json:"props"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	node, err := s.graphStore.UpdateUserNode(id, req.Label, req.Props)
+	if err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(node)
+}
+
+func (s *Server) deleteNode(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := s.graphStore.DeleteUserNode(id); err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": id,
+	})
+}
+
+func (s *Server) createEdge(w http.ResponseWriter, r *http.Request) {
+	var edge graph.Edge
+	if err := json.NewDecoder(r.Body).Decode(&edge); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := s.graphStore.CreateUserEdge(&edge)
+	if err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (s *Server) updateEdge(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From   string                 `json:"from"`
+		Type   string                 `json:"type"`
+		To     string                 `json:"to"`
+		Label  string                 `json:"label"`
+		Weight *float32               `json:"weight"`
+		Props  map[string]interface{} `json:"props"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	edge, err := s.graphStore.UpdateUserEdge(req.From, req.Type, req.To, req.Label, req.Weight, req.Props)
+	if err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(edge)
+}
+
+func (s *Server) deleteEdge(w http.ResponseWriter, r *http.Request) {
+	from := r.URL.Query().Get("from")
+	edgeType := r.URL.Query().Get("type")
+	to := r.URL.Query().Get("to")
+	if from == "" || edgeType == "" || to == "" {
+		http.Error(w, "from, type and to are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.graphStore.DeleteUserEdge(from, edgeType, to); err != nil {
+		http.Error(w, err.Error(), graphErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": map[string]string{"from": from, "type": edgeType, "to": to},
+	})
+}
+
+// graphErrorStatus maps errors from the user node/edge API to HTTP codes.
+func graphErrorStatus(err error) int {
+	var invalid *graph.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest
+	case errors.Is(err, graph.ErrNodeNotFound), errors.Is(err, graph.ErrEdgeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, graph.ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, graph.ErrDerived):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
 func (s *Server) traverse(w http.ResponseWriter, r *http.Request) {
 	start := r.URL.Query().Get("start")
 	if start == "" {
@@ -1135,7 +1448,18 @@ func (s *Server) traverse(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	nodes, err := s.graphStore.Traverse(start, edgeType, depth)
+	asOf, hasAsOf, err := parseAsOf(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var nodes []*graph.Node
+	if hasAsOf {
+		nodes, err = s.graphStore.TraverseAsOf(start, edgeType, depth, asOf)
+	} else {
+		nodes, err = s.graphStore.Traverse(start, edgeType, depth)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1148,6 +1472,413 @@ func (s *Server) traverse(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) graphQuery(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == "" {
+		http.Error(w, "query required", http.StatusBadRequest)
+		return
+	}
+
+	q, err := graph.ParseQuery(req.Query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Limit > 0 && (q.Limit == graph.NoLimit || req.Limit < q.Limit) {
+		q.Limit = req.Limit
+	}
+	if q.Limit == graph.NoLimit {
+		q.Limit = 100
+	}
+	if q.Limit > 1000 {
+		q.Limit = 1000
+	}
+
+	result, err := s.graphStore.Query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   req.Query,
+		"columns": result.Columns,
+		"rows":    result.Rows,
+		"count":   len(result.Rows),
+		"plan":    result.Plan,
+	})
+}
+
+func (s *Server) graphExport(w http.ResponseWriter, r *http.Request) {
+	formatStr := r.URL.Query().Get("format")
+	if formatStr == "" {
+		formatStr = "graphml"
+	}
+
+	format, err := graph.ParseExportFormat(formatStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := &graph.ExportOptions{
+		Format: format,
+		Seed:   r.URL.Query().Get("seed"),
+		Depth:  2,
+	}
+
+	if dStr := r.URL.Query().Get("depth"); dStr != "" {
+		if parsed, err := strconv.Atoi(dStr); err == nil && parsed > 0 && parsed <= 10 {
+			opts.Depth = parsed
+		}
+	}
+
+	if types := r.URL.Query().Get("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				opts.NodeTypes = append(opts.NodeTypes, t)
+			}
+		}
+	}
+
+	sub, err := s.graphStore.CollectSubgraph(opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := sub.Write(&buf, format); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"mindy_graph.%s\"", format.Extension()))
+	buf.WriteTo(w)
+}
+
+func (s *Server) relatedEntities(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	if s.indexer == nil {
+		http.Error(w, "indexer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := 20
+	if lStr := r.URL.Query().Get("limit"); lStr != "" {
+		if parsed, err := strconv.Atoi(lStr); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	rank := r.URL.Query().Get("rank")
+	if rank == "" {
+		rank = "count"
+	}
+	if rank != "count" && rank != "pmi" {
+		http.Error(w, "rank must be count or pmi", http.StatusBadRequest)
+		return
+	}
+
+	related, err := s.indexer.RelatedEntities(id, limit, rank)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      id,
+		"rank":    rank,
+		"related": related,
+		"count":   len(related),
+	})
+}
+
+func (s *Server) mergeEntities(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		http.Error(w, "indexer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Canonical  string   `json:"canonical"`
+		Duplicates []string `json:"duplicates"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.Canonical == "" || len(req.Duplicates) == 0 {
+		http.Error(w, "canonical and duplicates are required", http.StatusBadRequest)
+		return
+	}
+
+	node, err := s.indexer.MergeEntities(req.Canonical, req.Duplicates)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"canonical": node,
+		"merged":    req.Duplicates,
+	})
+}
+
+func (s *Server) mergeCandidates(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		http.Error(w, "indexer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := 20
+	if lStr := r.URL.Query().Get("limit"); lStr != "" {
+		if parsed, err := strconv.Atoi(lStr); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	candidates := s.indexer.MergeCandidates(limit)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"candidates": candidates,
+		"count":      len(candidates),
+	})
+}
+
+func (s *Server) entityAliases(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		http.Error(w, "indexer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	aliases := s.indexer.EntityAliases()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"aliases": aliases,
+		"count":   len(aliases),
+	})
+}
+
+func (s *Server) startAnalytics(w http.ResponseWriter, r *http.Request) {
+	if s.analytics == nil {
+		http.Error(w, "graph store not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var opts graph.AnalyticsOptions
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, err := s.analytics.Start(opts)
+	if err == graph.ErrAnalyticsRunning {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (s *Server) getAnalytics(w http.ResponseWriter, r *http.Request) {
+	if s.analytics == nil {
+		http.Error(w, "graph store not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		job := s.analytics.Job(id)
+		if job == nil {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(job)
+		return
+	}
+
+	jobs := s.analytics.Jobs()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
+
+func (s *Server) blobGC(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		http.Error(w, "indexer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	opts := blob.GCOptions{
+		GracePeriod: blob.DefaultGracePeriod,
+		DryRun:      r.URL.Query().Get("dry_run") == "true",
+	}
+	if g := r.URL.Query().Get("grace"); g != "" {
+		grace, err := time.ParseDuration(g)
+		if err != nil || grace < 0 {
+			http.Error(w, "invalid grace duration", http.StatusBadRequest)
+			return
+		}
+		if grace < blob.MinGracePeriod {
+			http.Error(w, fmt.Sprintf("grace must be at least %s", blob.MinGracePeriod), http.StatusBadRequest)
+			return
+		}
+		opts.GracePeriod = grace
+	}
+
+	report, err := s.indexer.CollectGarbage(opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) startFsck(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		http.Error(w, "indexer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	report, err := s.indexer.StartFsck(indexer.FsckOptions{
+		Repair: r.URL.Query().Get("repair") == "true",
+	})
+	if err == indexer.ErrFsckRunning {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) getFsck(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		http.Error(w, "indexer not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	report := s.indexer.FsckStatus()
+	if report == nil {
+		http.Error(w, "no integrity check has run", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) getEncryption(w http.ResponseWriter, r *http.Request) {
+	status := map[string]interface{}{
+		"enabled": crypt.ActiveKey() != nil,
+	}
+	if info, err := crypt.ReadKeyringInfo(s.dataDir); err == nil {
+		status["kdf"] = info.KDF
+		status["rewrapped_at"] = info.RewrappedAt
+	}
+	if stats, err := s.blobStore.Stats(); err == nil {
+		status["blobs"] = stats.Blobs
+		status["encrypted_blobs"] = stats.Encrypted
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// rewrapKey seals the data key under a new master key of the same kind.
+// The caller must give the current passphrase or key. Only the keyring
+// changes: the data key stays the same and no data is re-encrypted. Keys
+// are given as 64 hex characters, never as a path on the server; put the
+// new passphrase or key file in place before the next restart.
+func (s *Server) rewrapKey(w http.ResponseWriter, r *http.Request) {
+	if crypt.ActiveKey() == nil {
+		http.Error(w, "encryption is not enabled", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		Passphrase    string `json:"passphrase"`
+		Key           string `json:"key"`
+		NewPassphrase string `json:"new_passphrase"`
+		NewKey        string `json:"new_key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	current, err := keySource(req.Passphrase, req.Key, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	next, err := keySource(req.NewPassphrase, req.NewKey, "new_")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch err := crypt.Rewrap(s.dataDir, current, next); {
+	case errors.Is(err, crypt.ErrWrongKey):
+		http.Error(w, "wrong passphrase or key", http.StatusForbidden)
+		return
+	case errors.Is(err, crypt.ErrSourceChange):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	info, err := crypt.ReadKeyringInfo(s.dataDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "ok",
+		"kdf":          info.KDF,
+		"rewrapped_at": info.RewrappedAt,
+	})
+}
+
+// keySource reads a master key given in a request as either a passphrase
+// or a hex key, in the fields named with prefix.
+func keySource(passphrase, key, prefix string) (crypt.Source, error) {
+	if (passphrase == "") == (key == "") {
+		return crypt.Source{}, fmt.Errorf("exactly one of %spassphrase or %skey is required", prefix, prefix)
+	}
+	if passphrase != "" {
+		return crypt.Source{Passphrase: passphrase}, nil
+	}
+	master, err := crypt.ParseKey([]byte(key))
+	if err != nil {
+		return crypt.Source{}, fmt.Errorf("%skey: %w", prefix, err)
+	}
+	return crypt.Source{Key: master}, nil
+}
+
 func (s *Server) getBlob(w http.ResponseWriter, r *http.Request) {
 	hash := chi.URLParam(r, "hash")
 	if hash == "" {
@@ -1155,14 +1886,36 @@ func (s *Server) getBlob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := s.blobStore.Get(hash)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	rc, err := s.blobStore.Open(hash)
+	switch {
+	case errors.Is(err, blob.ErrInvalidHash):
+		http.Error(w, "invalid blob hash", http.StatusBadRequest)
+		return
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "blob not found", http.StatusNotFound)
+		return
+	case err != nil:
+		fmt.Printf("Error opening blob %s: %v\n", hash, err)
+		http.Error(w, "failed to read blob", http.StatusInternalServerError)
 		return
 	}
-
-	w.Header().Set("Content-Type", "text/plain")
-	w.Write(data)
+	defer rc.Close()
+
+	// Blobs are content-addressed, so the hash is a strong ETag. The content
+	// type comes from the document stored under this blob; without one,
+	// ServeContent sniffs it.
+	name := ""
+	if s.graphStore != nil {
+		if doc, err := s.graphStore.GetNode("doc:" + hash); err == nil {
+			name = doc.Label
+			if ct, ok := doc.Props["content_type"].(string); ok && ct != "" && ct != "application/octet-stream" {
+				w.Header().Set("Content-Type", ct)
+			}
+		}
+	}
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(w, r, name, time.Time{}, rc)
 }
 
 // Export/Import handlers
@@ -1253,7 +2006,21 @@ func (s *Server) batchDelete(w http.ResponseWriter, r *http.Request) {
 		DryRun:        dryRun,
 	}
 
-	count, err := s.dataManager.BatchDelete(opts)
+	var count int
+	var err error
+	if s.indexer != nil && !dryRun {
+		// Go through the indexer so its tracker stays in sync and the
+		// documents leave the graph, leaving their blobs to GC.
+		var paths []string
+		paths, err = s.dataManager.MatchFiles(opts)
+		for _, path := range paths {
+			if s.indexer.RemoveFile(path) {
+				count++
+			}
+		}
+	} else {
+		count, err = s.dataManager.BatchDelete(opts)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
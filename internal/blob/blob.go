@@ -0,0 +1,111 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// BlobStore is a content-addressed store keyed by the SHA256 of the
+// uncompressed content. Store keeps blobs on the local filesystem and
+// S3Store in an S3-compatible bucket.
+type BlobStore interface {
+	Put(content []byte) (string, error)
+	PutReader(r io.Reader) (string, error)
+	Get(hash string) ([]byte, error)
+	Open(hash string) (io.ReadSeekCloser, error)
+	Has(hash string) (bool, error)
+	Delete(hash string) error
+	Walk(fn func(hash string, info ObjectInfo) error) error
+	Verify(hash string) error
+	Restore(hash string, r io.Reader) error
+	GC(live func(hash string) bool, opts GCOptions) (*GCReport, error)
+	Stats() (*Stats, error)
+	Close() error
+}
+
+// ErrInvalidHash is returned for a blob name that is not a SHA256 digest
+// in lowercase hex.
+var ErrInvalidHash = errors.New("invalid blob hash")
+
+// validHash reports whether hash can name a blob. Only such names are
+// turned into paths or object keys.
+func validHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func checkHash(hash string) error {
+	if !validHash(hash) {
+		return fmt.Errorf("%w %q", ErrInvalidHash, hash)
+	}
+	return nil
+}
+
+// ObjectInfo describes a stored blob. Size is the physical, possibly
+// compressed, size.
+type ObjectInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+const (
+	BackendFS = "fs"
+	BackendS3 = "s3"
+)
+
+type Options struct {
+	Compression Compression
+	Backend     string
+	S3          S3Options
+}
+
+type Stats struct {
+	Backend       string      `json:"backend"`
+	Blobs         int         `json:"blobs"`
+	Compressed    int         `json:"compressed"`
+	Encrypted     int         `json:"encrypted"`
+	Unreadable    int         `json:"unreadable,omitempty"`
+	LogicalBytes  int64       `json:"logical_bytes"`
+	PhysicalBytes int64       `json:"physical_bytes"`
+	Compression   Compression `json:"compression"`
+	Encryption    bool        `json:"encryption"`
+}
+
+// add counts one blob with the given logical size, and whether it is
+// stored compressed and encrypted. A non-nil err from reading its header
+// counts it as unreadable instead.
+func (s *Stats) add(logical int64, compressed, encrypted bool, err error) {
+	s.Blobs++
+	if encrypted {
+		s.Encrypted++
+	}
+	if err != nil {
+		s.Unreadable++
+		return
+	}
+	s.LogicalBytes += logical
+	if compressed {
+		s.Compressed++
+	}
+}
+
+// New opens the backend selected by opts.Backend. The filesystem backend
+// is the default; local scratch files always live under dataDir.
+func New(dataDir string, opts Options) (BlobStore, error) {
+	switch opts.Backend {
+	case "", BackendFS:
+		return NewStoreWithOptions(dataDir, opts)
+	case BackendS3:
+		return NewS3Store(dataDir, opts)
+	}
+	return nil, fmt.Errorf("unknown blob backend %q", opts.Backend)
+}
@@ -0,0 +1,148 @@
+package blob
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"mindy/internal/crypt"
+)
+
+// Compression selects how Put encodes new blobs. Blobs are always hashed
+// over their uncompressed content.
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// Encoded blobs start with a header: magic, codec byte and the logical
+// size as a big-endian uint64. Files without the magic are raw content
+// written before compression existed, or content that did not shrink.
+var headerMagic = []byte{0x89, 'M', 'B', 'Z'}
+
+const headerSize = 4 + 1 + 8
+
+const (
+	codecNone byte = iota
+	codecGzip
+	codecZstd
+)
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil)
+}
+
+func ParseCompression(s string) (Compression, error) {
+	switch Compression(s) {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip, CompressionZstd:
+		return Compression(s), nil
+	}
+	return "", fmt.Errorf("unknown blob compression %q", s)
+}
+
+// encode returns the bytes to store for content. Compressed output is
+// only used when it is smaller than the raw content.
+func encode(content []byte, c Compression) ([]byte, error) {
+	var codec byte
+	var payload []byte
+	switch c {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(content); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		codec, payload = codecGzip, buf.Bytes()
+	case CompressionZstd:
+		zstdOnce.Do(initZstd)
+		codec, payload = codecZstd, zstdEncoder.EncodeAll(content, nil)
+	}
+
+	if payload != nil && len(payload)+headerSize < len(content) {
+		return withHeader(codec, uint64(len(content)), payload), nil
+	}
+	if needsWrap(content) {
+		// Raw content that looks like a header must be wrapped to stay
+		// unambiguous.
+		return withHeader(codecNone, uint64(len(content)), content), nil
+	}
+	return content, nil
+}
+
+// needsWrap reports whether raw content starts like an encoded or
+// encrypted blob.
+func needsWrap(content []byte) bool {
+	return bytes.HasPrefix(content, headerMagic) || crypt.IsEncrypted(content)
+}
+
+func withHeader(codec byte, size uint64, payload []byte) []byte {
+	out := make([]byte, headerSize, headerSize+len(payload))
+	copy(out, headerMagic)
+	out[4] = codec
+	binary.BigEndian.PutUint64(out[5:], size)
+	return append(out, payload...)
+}
+
+func decode(data []byte) ([]byte, error) {
+	codec, size, ok := parseHeader(data)
+	if !ok {
+		return data, nil
+	}
+	payload := data[headerSize:]
+	var content []byte
+	switch codec {
+	case codecNone:
+		content = payload
+	case codecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, zr); err != nil {
+			return nil, err
+		}
+		content = buf.Bytes()
+	case codecZstd:
+		zstdOnce.Do(initZstd)
+		var err error
+		content, err = zstdDecoder.DecodeAll(payload, nil)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown blob codec %d", codec)
+	}
+	if uint64(len(content)) != size {
+		return nil, fmt.Errorf("blob size mismatch: header says %d, got %d", size, len(content))
+	}
+	return content, nil
+}
+
+func parseHeader(data []byte) (codec byte, size uint64, ok bool) {
+	if len(data) < headerSize || !bytes.HasPrefix(data, headerMagic) {
+		return 0, 0, false
+	}
+	return data[4], binary.BigEndian.Uint64(data[5:headerSize]), true
+}
@@ -0,0 +1,133 @@
+package blob
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"mindy/internal/crypt"
+)
+
+// Blobs are encrypted after encoding, so the stored bytes are either an
+// encoded blob or an encrypted one. Blobs written before encryption was
+// enabled stay readable.
+
+func seal(key crypt.Key, data []byte) ([]byte, error) {
+	if key == nil {
+		return data, nil
+	}
+	return crypt.Encrypt(key, data)
+}
+
+func unseal(key crypt.Key, data []byte) ([]byte, error) {
+	if !crypt.IsEncrypted(data) {
+		return data, nil
+	}
+	if key == nil {
+		return nil, crypt.ErrNoKey
+	}
+	return crypt.Decrypt(key, data)
+}
+
+// sealFile returns the path of an encrypted copy of the file at path, or
+// path itself when there is no key.
+func sealFile(key crypt.Key, path string, tempFile func() (*os.File, error)) (string, error) {
+	if key == nil {
+		return path, nil
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := tempFile()
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	w, err := crypt.NewWriter(key, out)
+	if err == nil {
+		if _, err = io.Copy(w, in); err == nil {
+			err = w.Close()
+		}
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// unsealReader returns a reader over the encoded blob stored in r and its
+// size, decrypting on the fly if needed.
+func unsealReader(key crypt.Key, r io.ReaderAt, size int64) (io.ReaderAt, int64, bool, error) {
+	head := make([]byte, len(crypt.Magic()))
+	n, _ := r.ReadAt(head, 0)
+	if !crypt.IsEncrypted(head[:n]) {
+		return r, size, false, nil
+	}
+	if key == nil {
+		return nil, 0, true, crypt.ErrNoKey
+	}
+	cr, err := crypt.NewReader(key, r, size)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	return cr, cr.Size(), true, nil
+}
+
+// openStored returns a reader over the content of the blob stored in r.
+// Raw blobs are read in place; compressed ones are decoded into a
+// temporary file. c is closed with the returned reader.
+func openStored(key crypt.Key, r io.ReaderAt, size int64, c io.Closer, tempFile func() (*os.File, error)) (io.ReadSeekCloser, error) {
+	r, size, _, err := unsealReader(key, r, size)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	head := make([]byte, headerSize)
+	n, _ := r.ReadAt(head, 0)
+	codec, logical, ok := parseHeader(head[:n])
+	if !ok {
+		return &sectionCloser{SectionReader: io.NewSectionReader(r, 0, size), c: c}, nil
+	}
+	if codec == codecNone {
+		return &sectionCloser{SectionReader: io.NewSectionReader(r, headerSize, int64(logical)), c: c}, nil
+	}
+	defer c.Close()
+	return decodeToTemp(io.NewSectionReader(r, headerSize, size-headerSize), codec, tempFile)
+}
+
+// describe reads the logical size of the blob stored in r from its
+// header, falling back to the stored size for raw blobs.
+func describe(key crypt.Key, r io.ReaderAt, physical int64) (logical int64, compressed, encrypted bool, err error) {
+	r, size, encrypted, err := unsealReader(key, r, physical)
+	if err != nil {
+		return 0, false, encrypted, err
+	}
+	head := make([]byte, headerSize)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return 0, false, encrypted, fmt.Errorf("reading blob header: %w", err)
+	}
+	codec, lsize, ok := parseHeader(head[:n])
+	if !ok {
+		return size, false, encrypted, nil
+	}
+	return int64(lsize), codec != codecNone, encrypted, nil
+}
+
+type sectionCloser struct {
+	*io.SectionReader
+	c io.Closer
+}
+
+func (s *sectionCloser) Close() error {
+	return s.c.Close()
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
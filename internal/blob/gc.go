@@ -0,0 +1,153 @@
+package blob
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultGracePeriod is the grace period used by the API when none is
+// given. It keeps blobs stored just before their document is recorded.
+const DefaultGracePeriod = 24 * time.Hour
+
+// MinGracePeriod is the least grace period GC applies, to blobs and
+// temporary files alike. A blob is stored before the graph node that
+// references it is written, so a shorter grace period would let a GC
+// running alongside the indexer delete it.
+const MinGracePeriod = time.Hour
+
+type GCOptions struct {
+	GracePeriod time.Duration
+	DryRun      bool
+}
+
+type GCReport struct {
+	Scanned          int      `json:"scanned"`
+	ScannedBytes     int64    `json:"scanned_bytes"`
+	Referenced       int      `json:"referenced"`
+	Recent           int      `json:"recent"`
+	Reclaimable      int      `json:"reclaimable"`
+	ReclaimableBytes int64    `json:"reclaimable_bytes"`
+	Deleted          int      `json:"deleted"`
+	DeletedBytes     int64    `json:"deleted_bytes"`
+	DryRun           bool     `json:"dry_run"`
+	Errors           []string `json:"errors,omitempty"`
+}
+
+// Walk calls fn for every stored blob.
+func (s *Store) Walk(fn func(hash string, info ObjectInfo) error) error {
+	shards, err := os.ReadDir(s.baseDir)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() || len(shard.Name()) != 2 {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.baseDir, shard.Name()))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !validHash(shard.Name()+entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if err := fn(shard.Name()+entry.Name(), ObjectInfo{Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) Delete(hash string) error {
+	if err := checkHash(hash); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteLocked(hash)
+}
+
+func (s *Store) deleteLocked(hash string) error {
+	dir := filepath.Join(s.baseDir, hash[:2])
+	if err := os.Remove(filepath.Join(dir, hash[2:])); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Drop the shard directory once it is empty; Remove fails otherwise.
+	os.Remove(dir)
+	return nil
+}
+
+// GC sweeps blobs that live does not report as referenced. Callers mark
+// first by collecting references from everything that points at blobs.
+// Unreferenced blobs modified within the grace period are kept.
+func (s *Store) GC(live func(hash string) bool, opts GCOptions) (*GCReport, error) {
+	return sweep(s.Walk, s.deleteStale, live, opts, filepath.Join(s.baseDir, "tmp"))
+}
+
+// deleteStale removes a blob unless Put refreshed it after cutoff.
+func (s *Store) deleteStale(hash string, cutoff time.Time) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.Path(hash))
+	if err != nil || !info.ModTime().Before(cutoff) {
+		return 0, false, nil
+	}
+	if err := s.deleteLocked(hash); err != nil {
+		return 0, false, err
+	}
+	return info.Size(), true, nil
+}
+
+func sweep(walk func(func(string, ObjectInfo) error) error, deleteStale func(string, time.Time) (int64, bool, error),
+	live func(hash string) bool, opts GCOptions, tmpDir string) (*GCReport, error) {
+	cutoff := time.Now().Add(-max(opts.GracePeriod, MinGracePeriod))
+	report := &GCReport{DryRun: opts.DryRun}
+
+	var garbage []string
+	err := walk(func(hash string, info ObjectInfo) error {
+		report.Scanned++
+		report.ScannedBytes += info.Size
+		switch {
+		case live(hash):
+			report.Referenced++
+		case info.ModTime.After(cutoff):
+			report.Recent++
+		default:
+			report.Reclaimable++
+			report.ReclaimableBytes += info.Size
+			garbage = append(garbage, hash)
+		}
+		return nil
+	})
+	if err != nil || opts.DryRun {
+		return report, err
+	}
+
+	// Temporary files older than the grace period are left over from
+	// interrupted PutReader calls.
+	if entries, err := os.ReadDir(tmpDir); err == nil {
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(filepath.Join(tmpDir, entry.Name()))
+			}
+		}
+	}
+
+	for _, hash := range garbage {
+		// Put may have re-added the blob since the scan.
+		size, deleted, err := deleteStale(hash, cutoff)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else if deleted {
+			report.Deleted++
+			report.DeletedBytes += size
+		}
+	}
+	return report, nil
+}
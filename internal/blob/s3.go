@@ -0,0 +1,570 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mindy/internal/crypt"
+)
+
+// S3Options configure an S3-compatible bucket. Requests use path-style
+// URLs (<endpoint>/<bucket>/<key>), which AWS, MinIO and most other
+// implementations accept.
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Store keeps blobs in a bucket under <prefix><hash[:2]>/<hash[2:]>, the
+// same layout and encoding as the filesystem store. Uploads and decoding
+// are staged in a local scratch directory.
+type S3Store struct {
+	endpoint    *url.URL
+	opts        S3Options
+	compression Compression
+	key         crypt.Key
+	tmpDir      string
+	client      *http.Client
+}
+
+const (
+	emptyPayloadHash    = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	unsignedPayloadHash = "UNSIGNED-PAYLOAD"
+	s3ReadChunk         = 1 << 20
+)
+
+func NewS3Store(dataDir string, opts Options) (*S3Store, error) {
+	compression, err := ParseCompression(string(opts.Compression))
+	if err != nil {
+		return nil, err
+	}
+	o := opts.S3
+	if o.Endpoint == "" || o.Bucket == "" {
+		return nil, fmt.Errorf("s3 backend needs an endpoint and a bucket")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(o.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", o.Endpoint)
+	}
+	if o.Region == "" {
+		o.Region = "us-east-1"
+	}
+	if o.AccessKey == "" {
+		o.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if o.SecretKey == "" {
+		o.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if o.Prefix = strings.Trim(o.Prefix, "/"); o.Prefix != "" {
+		o.Prefix += "/"
+	}
+	return &S3Store{
+		endpoint:    endpoint,
+		opts:        o,
+		compression: compression,
+		key:         crypt.ActiveKey(),
+		tmpDir:      filepath.Join(dataDir, "blobs", "tmp"),
+		client:      &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+func (s *S3Store) objectKey(hash string) string {
+	return s.opts.Prefix + hash[:2] + "/" + hash[2:]
+}
+
+func (s *S3Store) tempFile() (*os.File, error) {
+	return newTempFile(s.tmpDir)
+}
+
+func (s *S3Store) Put(content []byte) (string, error) {
+	hash := sha256.Sum256(content)
+	hashStr := hex.EncodeToString(hash[:])
+	if s.stored(hashStr) {
+		return hashStr, nil
+	}
+
+	data, err := encode(content, s.compression)
+	if err != nil {
+		return "", err
+	}
+	if data, err = seal(s.key, data); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hashStr, s.upload(hashStr, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]))
+}
+
+func (s *S3Store) PutReader(r io.Reader) (string, error) {
+	return s.putReader(r, "")
+}
+
+func (s *S3Store) Restore(hash string, r io.Reader) error {
+	if err := checkHash(hash); err != nil {
+		return err
+	}
+	_, err := s.putReader(r, hash)
+	return err
+}
+
+func (s *S3Store) putReader(r io.Reader, expect string) (string, error) {
+	raw, hashStr, size, err := spool(r, s.tempFile)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(raw.Name())
+	defer raw.Close()
+	if expect != "" && hashStr != expect {
+		return "", fmt.Errorf("content hashes to %s, want %s: %w", hashStr, expect, ErrCorrupt)
+	}
+	if expect == "" && s.stored(hashStr) {
+		return hashStr, nil
+	}
+
+	final, err := encodeFile(raw, size, s.compression, s.tempFile)
+	if err != nil {
+		return "", err
+	}
+	if final != raw.Name() {
+		defer os.Remove(final)
+	}
+	sealed, err := sealFile(s.key, final, s.tempFile)
+	if err != nil {
+		return "", err
+	}
+	if sealed != final {
+		defer os.Remove(sealed)
+	}
+	f, err := os.Open(sealed)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return hashStr, s.upload(hashStr, f, info.Size(), unsignedPayloadHash)
+}
+
+// stored reports whether a blob is already in the bucket, so Put can skip
+// uploading it. A stored blob is copied onto itself, which refreshes its
+// Last-Modified like a re-upload would and keeps it out of a concurrent
+// GC sweep. On any error it reports false and the blob is uploaded.
+func (s *S3Store) stored(hash string) bool {
+	if ok, err := s.Has(hash); err != nil || !ok {
+		return false
+	}
+	key := s.objectKey(hash)
+	resp, err := s.do(http.MethodPut, key, nil, nil, 0, emptyPayloadHash, http.Header{
+		"X-Amz-Copy-Source":        {s3EscapePath("/" + s.opts.Bucket + "/" + key)},
+		"X-Amz-Metadata-Directive": {"REPLACE"},
+	})
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (s *S3Store) upload(hash string, body io.Reader, size int64, payloadHash string) error {
+	resp, err := s.do(http.MethodPut, s.objectKey(hash), nil, body, size, payloadHash, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(http.MethodPut, s.objectKey(hash), resp)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(hash string) ([]byte, error) {
+	if err := checkHash(hash); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(http.MethodGet, s.objectKey(hash), nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(http.MethodGet, s.objectKey(hash), resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = unseal(s.key, data); err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// Open returns a reader that fetches the blob with ranged GETs as it is
+// read, so serving a range of a large raw blob only downloads that range.
+// Compressed blobs are decoded into a scratch file.
+func (s *S3Store) Open(hash string) (io.ReadSeekCloser, error) {
+	if err := checkHash(hash); err != nil {
+		return nil, err
+	}
+	key := s.objectKey(hash)
+	resp, err := s.do(http.MethodHead, key, nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(http.MethodHead, key, resp)
+	}
+	obj := &s3Object{s: s, key: key, size: resp.ContentLength, chunk: s3ReadChunk}
+	return openStored(s.key, obj, obj.size, nopCloser{}, s.tempFile)
+}
+
+func (s *S3Store) getRange(key string, off, n int64) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil, 0, emptyPayloadHash, http.Header{
+		"Range": {fmt.Sprintf("bytes=%d-%d", off, off+n-1)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return io.ReadAll(resp.Body)
+	case http.StatusOK:
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return nil, err
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, n))
+	}
+	return nil, s3Error(http.MethodGet, key, resp)
+}
+
+// s3Object reads an object with ranged GETs of at least chunk bytes,
+// keeping the last one.
+type s3Object struct {
+	s      *S3Store
+	key    string
+	size   int64
+	chunk  int64
+	mu     sync.Mutex
+	buf    []byte
+	bufOff int64
+}
+
+func (o *s3Object) ReadAt(p []byte, off int64) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		if off >= o.size {
+			return n, io.EOF
+		}
+		if off < o.bufOff || off >= o.bufOff+int64(len(o.buf)) {
+			length := max(o.chunk, int64(len(p)-n))
+			if off+length > o.size {
+				length = o.size - off
+			}
+			data, err := o.s.getRange(o.key, off, length)
+			if err != nil {
+				return n, err
+			}
+			if len(data) == 0 {
+				return n, io.ErrUnexpectedEOF
+			}
+			o.buf, o.bufOff = data, off
+		}
+		c := copy(p[n:], o.buf[off-o.bufOff:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+func (s *S3Store) Has(hash string) (bool, error) {
+	if err := checkHash(hash); err != nil {
+		return false, err
+	}
+	resp, err := s.do(http.MethodHead, s.objectKey(hash), nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, s3Error(http.MethodHead, s.objectKey(hash), resp)
+}
+
+func (s *S3Store) Delete(hash string) error {
+	if err := checkHash(hash); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodDelete, s.objectKey(hash), nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return s3Error(http.MethodDelete, s.objectKey(hash), resp)
+}
+
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Walk lists the bucket prefix with ListObjectsV2 and calls fn for every
+// key laid out like a blob.
+func (s *S3Store) Walk(fn func(hash string, info ObjectInfo) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if s.opts.Prefix != "" {
+			query.Set("prefix", s.opts.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil, 0, emptyPayloadHash, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error("LIST", s.opts.Prefix, resp)
+			resp.Body.Close()
+			return err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range result.Contents {
+			rest := strings.TrimPrefix(obj.Key, s.opts.Prefix)
+			if len(rest) < 4 || rest[2] != '/' || !validHash(rest[:2]+rest[3:]) {
+				continue
+			}
+			if err := fn(rest[:2]+rest[3:], ObjectInfo{Size: obj.Size, ModTime: obj.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Store) Verify(hash string) error {
+	return verifyBlob(s, hash)
+}
+
+func (s *S3Store) GC(live func(hash string) bool, opts GCOptions) (*GCReport, error) {
+	return sweep(s.Walk, s.deleteStale, live, opts, s.tmpDir)
+}
+
+// deleteStale deletes a blob unless it was re-uploaded after cutoff. S3
+// has no conditional delete, so a Put racing between the HEAD and the
+// DELETE can still lose its blob; fsck with repair restores it.
+func (s *S3Store) deleteStale(hash string, cutoff time.Time) (int64, bool, error) {
+	resp, err := s.do(http.MethodHead, s.objectKey(hash), nil, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, nil
+	}
+	modified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil || !modified.Before(cutoff) {
+		return 0, false, nil
+	}
+	if err := s.Delete(hash); err != nil {
+		return 0, false, err
+	}
+	return resp.ContentLength, true, nil
+}
+
+// Stats reads the header of every object to find its logical size.
+func (s *S3Store) Stats() (*Stats, error) {
+	stats := &Stats{Backend: BackendS3, Compression: s.compression, Encryption: s.key != nil}
+	err := s.Walk(func(hash string, info ObjectInfo) error {
+		// The first chunk covers an encoding header and, when encrypted,
+		// the first segment holding it.
+		obj := &s3Object{s: s, key: s.objectKey(hash), size: info.Size, chunk: 80 << 10}
+		stats.add(describe(s.key, obj, info.Size))
+		stats.PhysicalBytes += info.Size
+		return nil
+	})
+	return stats, err
+}
+
+func (s *S3Store) Close() error {
+	return nil
+}
+
+func (s *S3Store) do(method, key string, query url.Values, body io.Reader, size int64, payloadHash string, header http.Header) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + s.opts.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	signV4(req, s.opts.AccessKey, s.opts.SecretKey, s.opts.Region, payloadHash, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+func s3Error(op, key string, resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	if resp.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: "s3 " + strings.ToLower(op), Path: key, Err: fs.ErrNotExist}
+	}
+	if body.Code != "" {
+		return fmt.Errorf("s3 %s %s: %s: %s %s", op, key, resp.Status, body.Code, body.Message)
+	}
+	return fmt.Errorf("s3 %s %s: %s", op, key, resp.Status)
+}
+
+// signV4 adds AWS Signature Version 4 headers to req. It signs the host,
+// Range and all x-amz-* headers.
+func signV4(req *http.Request, accessKey, secretKey, region, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" || lower == "content-md5" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but unreserved characters, as
+// SigV4 canonicalization requires.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = s3Escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
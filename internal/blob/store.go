@@ -3,30 +3,45 @@ package blob
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
+
+	"mindy/internal/crypt"
 )
 
 type Store struct {
-	baseDir string
-	mu      sync.RWMutex
+	baseDir     string
+	compression Compression
+	key         crypt.Key
+	mu          sync.RWMutex
 }
 
 func NewStore(dataDir string) (*Store, error) {
+	return NewStoreWithOptions(dataDir, Options{})
+}
+
+func NewStoreWithOptions(dataDir string, opts Options) (*Store, error) {
+	compression, err := ParseCompression(string(opts.Compression))
+	if err != nil {
+		return nil, err
+	}
 	baseDir := filepath.Join(dataDir, "blobs")
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, err
 	}
-	return &Store{baseDir: baseDir}, nil
+	return &Store{baseDir: baseDir, compression: compression, key: crypt.ActiveKey()}, nil
 }
 
 func (s *Store) Put(content []byte) (string, error) {
 	hash := sha256.Sum256(content)
 	hashStr := hex.EncodeToString(hash[:])
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	dir := filepath.Join(s.baseDir, hashStr[:2])
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", err
@@ -39,35 +54,76 @@ func (s *Store) Put(content []byte) (string, error) {
 	}
 
 	if !exists {
-		if err := os.WriteFile(path, content, 0644); err != nil {
+		data, err := encode(content, s.compression)
+		if err != nil {
+			return "", err
+		}
+		if data, err = seal(s.key, data); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
 			return "", err
 		}
+	} else {
+		// Refresh the mtime so a concurrent GC treats the blob as new.
+		now := time.Now()
+		os.Chtimes(path, now, now)
 	}
 
 	return hashStr, nil
 }
 
 func (s *Store) Get(hash string) ([]byte, error) {
-	if len(hash) < 2 {
-		return nil, fmt.Errorf("invalid hash length")
+	if err := checkHash(hash); err != nil {
+		return nil, err
 	}
 
 	path := filepath.Join(s.baseDir, hash[:2], hash[2:])
-	return os.ReadFile(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = unseal(s.key, data); err != nil {
+		return nil, err
+	}
+	return decode(data)
 }
 
+// Path returns the on-disk location of a blob, which may hold encoded or
+// encrypted bytes; use Get for the content. It is empty for an invalid
+// hash.
 func (s *Store) Path(hash string) string {
+	if !validHash(hash) {
+		return ""
+	}
 	return filepath.Join(s.baseDir, hash[:2], hash[2:])
 }
 
 func (s *Store) Has(hash string) (bool, error) {
-	if len(hash) < 2 {
-		return false, nil
+	if err := checkHash(hash); err != nil {
+		return false, err
 	}
 	path := filepath.Join(s.baseDir, hash[:2], hash[2:])
 	return exists(path)
 }
 
+// Stats reports blob counts and sizes: logical bytes are the original
+// content, physical bytes what is on disk.
+func (s *Store) Stats() (*Stats, error) {
+	stats := &Stats{Backend: BackendFS, Compression: s.compression, Encryption: s.key != nil}
+	err := s.Walk(func(hash string, info ObjectInfo) error {
+		f, err := os.Open(s.Path(hash))
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		stats.add(describe(s.key, f, info.Size))
+		stats.PhysicalBytes += info.Size
+		return nil
+	})
+	return stats, err
+}
+
 func (s *Store) Close() error {
 	return nil
 }
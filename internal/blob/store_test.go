@@ -1,8 +1,16 @@
 package blob
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"mindy/internal/crypt"
 )
 
 func TestStore_PutAndGet(t *testing.T) {
@@ -97,3 +105,317 @@ func TestStore_Path(t *testing.T) {
 		t.Error("expected absolute path")
 	}
 }
+
+func TestStore_InvalidHash(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	os.WriteFile(filepath.Join(tmpDir, "secret"), []byte("outside"), 0644)
+	hash, _ := store.Put([]byte("test"))
+	for _, bad := range []string{"", "a", "../../secret", strings.ToUpper(hash), hash[:63] + "g", hash + "0"} {
+		if store.Path(bad) != "" {
+			t.Errorf("Path(%q) = %q", bad, store.Path(bad))
+		}
+		if _, err := store.Get(bad); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Get(%q) error = %v", bad, err)
+		}
+		if _, err := store.Open(bad); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Open(%q) error = %v", bad, err)
+		}
+		if ok, err := store.Has(bad); ok || !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Has(%q) = %v, %v", bad, ok, err)
+		}
+		if err := store.Delete(bad); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Delete(%q) error = %v", bad, err)
+		}
+		if err := store.Restore(bad, strings.NewReader("test")); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Restore(%q) error = %v", bad, err)
+		}
+	}
+}
+
+func TestStore_GC(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	store, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	live, _ := store.Put([]byte("still referenced"))
+	dead, _ := store.Put([]byte("orphaned content"))
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(store.Path(live), old, old)
+	os.Chtimes(store.Path(dead), old, old)
+	recent, _ := store.Put([]byte("just written"))
+
+	isLive := func(hash string) bool { return hash == live }
+
+	report, err := store.GC(isLive, GCOptions{GracePeriod: time.Hour, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if report.Scanned != 3 || report.Referenced != 1 || report.Recent != 1 || report.Reclaimable != 1 {
+		t.Errorf("unexpected dry run report: %+v", report)
+	}
+	if report.ReclaimableBytes != int64(len("orphaned content")) || report.Deleted != 0 {
+		t.Errorf("unexpected dry run report: %+v", report)
+	}
+	if ok, _ := store.Has(dead); !ok {
+		t.Error("dry run should not delete")
+	}
+
+	report, err = store.GC(isLive, GCOptions{GracePeriod: time.Hour})
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if report.Deleted != 1 {
+		t.Errorf("expected 1 deleted blob, got %+v", report)
+	}
+	if ok, _ := store.Has(dead); ok {
+		t.Error("unreferenced blob should be deleted")
+	}
+	for _, hash := range []string{live, recent} {
+		if ok, _ := store.Has(hash); !ok {
+			t.Errorf("blob %s should be kept", hash)
+		}
+	}
+
+	os.Chtimes(store.Path(live), old, old)
+	store.Put([]byte("still referenced"))
+	report, _ = store.GC(func(string) bool { return false }, GCOptions{GracePeriod: time.Hour, DryRun: true})
+	if report.Recent != 2 {
+		t.Errorf("re-put blob should count as recent, got %+v", report)
+	}
+
+	// Blobs and temporary files are kept for MinGracePeriod even with no
+	// grace period.
+	tmp := filepath.Join(tmpDir, "blobs", "tmp")
+	os.MkdirAll(tmp, 0755)
+	spool, stale := filepath.Join(tmp, "spool"), filepath.Join(tmp, "stale")
+	os.WriteFile(spool, []byte("uploading"), 0644)
+	os.WriteFile(stale, []byte("interrupted"), 0644)
+	os.Chtimes(stale, old, old)
+	store.GC(isLive, GCOptions{GracePeriod: 0})
+	if ok, _ := store.Has(recent); !ok {
+		t.Error("recent blob should be kept with no grace period")
+	}
+	if _, err := os.Stat(spool); err != nil {
+		t.Errorf("recent temporary file should be kept: %v", err)
+	}
+	if _, err := os.Stat(stale); err == nil {
+		t.Error("old temporary file should be removed")
+	}
+}
+
+func TestStore_Compression(t *testing.T) {
+	content := []byte(strings.Repeat("2024-01-01 INFO request served in 12ms\n", 200))
+	small := []byte("tiny")
+	tricky := append([]byte{0x89, 'M', 'B', 'Z', 0}, []byte("raw bytes that look like a header")...)
+
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(string(c), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			store, err := NewStoreWithOptions(tmpDir, Options{Compression: c})
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+
+			hash, _ := store.Put(content)
+			if want, _ := HashReader(bytes.NewReader(content)); hash != want {
+				t.Errorf("hash should cover uncompressed content: %s != %s", hash, want)
+			}
+			for _, data := range [][]byte{content, small, tricky} {
+				h, _ := store.Put(data)
+				got, err := store.Get(h)
+				if err != nil {
+					t.Fatalf("failed to get: %v", err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("round trip mismatch for %q", data[:4])
+				}
+			}
+
+			stats, err := store.Stats()
+			if err != nil {
+				t.Fatalf("failed to get stats: %v", err)
+			}
+			logical := int64(len(content) + len(small) + len(tricky))
+			if stats.Blobs != 3 || stats.LogicalBytes != logical {
+				t.Errorf("unexpected stats: %+v", stats)
+			}
+			if c == CompressionNone && stats.Compressed != 0 {
+				t.Errorf("uncompressed store reported compressed blobs: %+v", stats)
+			}
+			if c != CompressionNone && (stats.Compressed != 1 || stats.PhysicalBytes*5 > stats.LogicalBytes) {
+				t.Errorf("expected the log blob to compress well: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestStore_ReadsLegacyBlobs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	plain, _ := NewStore(tmpDir)
+	hash, _ := plain.Put([]byte("written before compression"))
+
+	store, err := NewStoreWithOptions(tmpDir, Options{Compression: CompressionZstd})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	got, err := store.Get(hash)
+	if err != nil || string(got) != "written before compression" {
+		t.Errorf("legacy blob = %q, %v", got, err)
+	}
+
+	if _, err := NewStoreWithOptions(tmpDir, Options{Compression: "lz4"}); err == nil {
+		t.Error("unknown compression should be rejected")
+	}
+}
+
+func TestStore_PutReaderAndOpen(t *testing.T) {
+	content := []byte(strings.Repeat("streamed line of a large log file\n", 1000))
+	tricky := append([]byte{0x89, 'M', 'B', 'Z', 2}, []byte("not really zstd")...)
+
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(string(c), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			store, err := NewStoreWithOptions(tmpDir, Options{Compression: c})
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+
+			for _, data := range [][]byte{content, tricky} {
+				hash, err := store.PutReader(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("PutReader() error = %v", err)
+				}
+				if put, _ := store.Put(data); put != hash {
+					t.Errorf("PutReader and Put disagree: %s != %s", hash, put)
+				}
+				if got, _ := store.Get(hash); !bytes.Equal(got, data) {
+					t.Errorf("Get after PutReader mismatch")
+				}
+
+				rc, err := store.Open(hash)
+				if err != nil {
+					t.Fatalf("Open() error = %v", err)
+				}
+				rc.Seek(5, io.SeekStart)
+				rest, _ := io.ReadAll(rc)
+				rc.Close()
+				if !bytes.Equal(rest, data[5:]) {
+					t.Errorf("Open() after seek mismatch")
+				}
+			}
+
+			if entries, _ := os.ReadDir(filepath.Join(tmpDir, "blobs", "tmp")); len(entries) != 0 {
+				t.Errorf("expected no leftover temp files, got %d", len(entries))
+			}
+		})
+	}
+}
+
+func TestStore_VerifyAndRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	store, err := NewStoreWithOptions(tmpDir, Options{Compression: CompressionGzip})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	content := []byte(strings.Repeat("verify me ", 100))
+	hash, _ := store.Put(content)
+	if err := store.Verify(hash); err != nil {
+		t.Fatalf("Verify() on a fresh blob = %v", err)
+	}
+
+	os.WriteFile(store.Path(hash), []byte("bit rot"), 0644)
+	if err := store.Verify(hash); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Verify() on a damaged blob = %v, want ErrCorrupt", err)
+	}
+
+	if err := store.Restore(hash, strings.NewReader("something else")); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Restore() with wrong content = %v, want ErrCorrupt", err)
+	}
+	if err := store.Restore(hash, bytes.NewReader(content)); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if err := store.Verify(hash); err != nil {
+		t.Errorf("Verify() after restore = %v", err)
+	}
+}
+
+func TestStore_Encryption(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	plain, _ := NewStore(tmpDir)
+	legacy, err := plain.Put([]byte("written before encryption"))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	crypt.SetKey(bytes.Repeat([]byte{7}, crypt.KeySize))
+	defer crypt.SetKey(nil)
+	store, err := NewStoreWithOptions(tmpDir, Options{Compression: CompressionZstd})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	secret := []byte(strings.Repeat("top secret note ", 5000))
+	hash, err := store.Put(secret)
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	streamed, err := store.PutReader(strings.NewReader("streamed secret"))
+	if err != nil {
+		t.Fatalf("put reader: %v", err)
+	}
+	for _, h := range []string{hash, streamed} {
+		raw, _ := os.ReadFile(store.Path(h))
+		if !crypt.IsEncrypted(raw) || bytes.Contains(raw, []byte("secret")) {
+			t.Errorf("blob %s is not encrypted on disk", h[:8])
+		}
+		if err := store.Verify(h); err != nil {
+			t.Errorf("verify %s: %v", h[:8], err)
+		}
+	}
+
+	if got, err := store.Get(hash); err != nil || !bytes.Equal(got, secret) {
+		t.Fatalf("get: %v", err)
+	}
+	rc, err := store.Open(hash)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	rc.Seek(16*1000, io.SeekStart)
+	part := make([]byte, 16)
+	io.ReadFull(rc, part)
+	rc.Close()
+	if string(part) != "top secret note " {
+		t.Errorf("seek into encrypted blob read %q", part)
+	}
+	if got, err := store.Get(legacy); err != nil || string(got) != "written before encryption" {
+		t.Errorf("legacy blob unreadable: %q, %v", got, err)
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Blobs != 3 || stats.Encrypted != 2 || stats.Compressed != 1 || !stats.Encryption {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	crypt.SetKey(nil)
+	locked, _ := NewStore(tmpDir)
+	if _, err := locked.Get(hash); !errors.Is(err, crypt.ErrNoKey) {
+		t.Errorf("get without key: got %v, want ErrNoKey", err)
+	}
+}
@@ -0,0 +1,298 @@
+package blob
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// PutReader stores the content read from r without holding it in memory.
+// The content is hashed while it is written to a temporary file, encoded
+// like Put would and then renamed into place.
+func (s *Store) PutReader(r io.Reader) (string, error) {
+	return s.putReader(r, "")
+}
+
+// Restore rewrites the blob named hash from r, replacing a corrupt copy.
+// It fails without touching the store if r does not hash to hash.
+func (s *Store) Restore(hash string, r io.Reader) error {
+	if err := checkHash(hash); err != nil {
+		return err
+	}
+	_, err := s.putReader(r, hash)
+	return err
+}
+
+func (s *Store) putReader(r io.Reader, expect string) (string, error) {
+	raw, hashStr, size, err := spool(r, s.tempFile)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(raw.Name())
+	defer raw.Close()
+	if expect != "" && hashStr != expect {
+		return "", fmt.Errorf("content hashes to %s, want %s: %w", hashStr, expect, ErrCorrupt)
+	}
+
+	final, err := encodeFile(raw, size, s.compression, s.tempFile)
+	if err != nil {
+		return "", err
+	}
+	if final != raw.Name() {
+		defer os.Remove(final)
+	}
+	raw.Close()
+	sealed, err := sealFile(s.key, final, s.tempFile)
+	if err != nil {
+		return "", err
+	}
+	if sealed != final {
+		defer os.Remove(sealed)
+		final = sealed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.baseDir, hashStr[:2])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, hashStr[2:])
+	exists, err := exists(path)
+	if err != nil {
+		return "", err
+	}
+	if exists && expect == "" {
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return hashStr, nil
+	}
+	if err := os.Rename(final, path); err != nil {
+		return "", err
+	}
+	return hashStr, nil
+}
+
+// spool copies r into a scratch file, hashing it on the way. The caller
+// closes and removes the returned file.
+func spool(r io.Reader, tempFile func() (*os.File, error)) (*os.File, string, int64, error) {
+	raw, err := tempFile()
+	if err != nil {
+		return nil, "", 0, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(raw, io.TeeReader(r, h))
+	if err != nil {
+		raw.Close()
+		os.Remove(raw.Name())
+		return nil, "", 0, err
+	}
+	return raw, hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+func (s *Store) tempFile() (*os.File, error) {
+	return newTempFile(filepath.Join(s.baseDir, "tmp"))
+}
+
+func newTempFile(dir string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, "put-*")
+}
+
+// encodeFile returns the path of the file to store for the raw content in
+// f: f itself, or a temporary file holding the compressed or wrapped form.
+func encodeFile(f *os.File, size int64, c Compression, tempFile func() (*os.File, error)) (string, error) {
+	head := make([]byte, len(headerMagic))
+	n, _ := f.ReadAt(head, 0)
+	wrap := needsWrap(head[:n])
+
+	codec := codecNone
+	switch c {
+	case CompressionGzip:
+		codec = codecGzip
+	case CompressionZstd:
+		codec = codecZstd
+	}
+	if codec == codecNone && !wrap {
+		return f.Name(), nil
+	}
+
+	out, err := tempFile()
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if codec != codecNone {
+		written, err := writeEncoded(out, io.NewSectionReader(f, 0, size), size, codec)
+		if err != nil {
+			os.Remove(out.Name())
+			return "", err
+		}
+		if written < size {
+			return out.Name(), nil
+		}
+		if !wrap {
+			os.Remove(out.Name())
+			return f.Name(), nil
+		}
+		if err := out.Truncate(0); err != nil {
+			os.Remove(out.Name())
+			return "", err
+		}
+		out.Seek(0, io.SeekStart)
+	}
+	// Raw content that looks like a header must be wrapped to stay
+	// unambiguous.
+	if _, err := writeEncoded(out, io.NewSectionReader(f, 0, size), size, codecNone); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// writeEncoded writes the header and the encoded payload to out and
+// returns the resulting file size.
+func writeEncoded(out *os.File, r io.Reader, size int64, codec byte) (int64, error) {
+	if _, err := out.Write(withHeader(codec, uint64(size), nil)); err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(out)
+	var err error
+	switch codec {
+	case codecGzip:
+		zw := gzip.NewWriter(bw)
+		if _, err = io.Copy(zw, r); err == nil {
+			err = zw.Close()
+		}
+	case codecZstd:
+		var zw *zstd.Encoder
+		if zw, err = zstd.NewWriter(bw); err == nil {
+			if _, err = io.Copy(zw, r); err == nil {
+				err = zw.Close()
+			}
+		}
+	default:
+		_, err = io.Copy(bw, r)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Open returns a reader over the content of a blob. Raw blobs are read in
+// place; compressed ones are decoded into a temporary file that is removed
+// on Close.
+func (s *Store) Open(hash string) (io.ReadSeekCloser, error) {
+	if err := checkHash(hash); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.Path(hash))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return openStored(s.key, f, info.Size(), f, s.tempFile)
+}
+
+// decodeToTemp decompresses an encoded payload into a temporary file that
+// is removed when the returned reader is closed.
+func decodeToTemp(r io.Reader, codec byte, tempFile func() (*os.File, error)) (io.ReadSeekCloser, error) {
+	var dec io.Reader
+	switch codec {
+	case codecGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		dec = zr
+	case codecZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		dec = zr
+	default:
+		return nil, fmt.Errorf("unknown blob codec %d", codec)
+	}
+
+	tmp, err := tempFile()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, dec); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &tempReader{File: tmp}, nil
+}
+
+type tempReader struct {
+	*os.File
+}
+
+func (t *tempReader) Close() error {
+	err := t.File.Close()
+	os.Remove(t.File.Name())
+	return err
+}
+
+var ErrCorrupt = errors.New("blob content does not match its hash")
+
+// Verify reads a blob back and checks that it hashes to its name.
+func (s *Store) Verify(hash string) error {
+	return verifyBlob(s, hash)
+}
+
+func verifyBlob(bs BlobStore, hash string) error {
+	rc, err := bs.Open(hash)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return fmt.Errorf("%v: %w", err, ErrCorrupt)
+	}
+	defer rc.Close()
+
+	got, err := HashReader(rc)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, ErrCorrupt)
+	}
+	if got != hash {
+		return fmt.Errorf("content hashes to %s: %w", got, ErrCorrupt)
+	}
+	return nil
+}
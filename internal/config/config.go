@@ -1,16 +1,37 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"gopkg.in/yaml.v3"
+
+	"mindy/internal/blob"
+	"mindy/internal/crypt"
+	"mindy/internal/extractor"
 )
 
 type Config struct {
-	WatchPaths []string `yaml:"watch_paths"`
-	HttpPort   int      `yaml:"http_port"`
-	DataDir    string   `yaml:"data_dir"`
+	WatchPaths      []string         `yaml:"watch_paths"`
+	HttpPort        int              `yaml:"http_port"`
+	DataDir         string           `yaml:"data_dir"`
+	BlobCompression string           `yaml:"blob_compression"`
+	BlobBackend     string           `yaml:"blob_backend"`
+	S3              S3Config         `yaml:"s3"`
+	Encryption      EncryptionConfig `yaml:"encryption"`
+	CSV             CSVConfig        `yaml:"csv"`
+}
+
+// S3Config locates the bucket used when blob_backend is s3. Empty keys
+// fall back to AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
 }
 
 func Default() *Config {
@@ -44,3 +65,76 @@ func Load(path string) (*Config, error) {
 func (c *Config) EnsureDataDir() error {
 	return os.MkdirAll(c.DataDir, 0755)
 }
+
+// EncryptionConfig enables encryption at rest. The master key comes from
+// KeyFile if set, otherwise from the passphrase in the PassphraseEnv
+// environment variable (MINDY_PASSPHRASE by default).
+type EncryptionConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	KeyFile       string `yaml:"key_file"`
+	PassphraseEnv string `yaml:"passphrase_env"`
+}
+
+// KeySource returns where the master key comes from.
+func (c *Config) KeySource() (crypt.Source, error) {
+	if c.Encryption.KeyFile != "" {
+		return crypt.Source{KeyFile: c.Encryption.KeyFile}, nil
+	}
+	env := c.Encryption.PassphraseEnv
+	if env == "" {
+		env = "MINDY_PASSPHRASE"
+	}
+	if pass := os.Getenv(env); pass != "" {
+		return crypt.Source{Passphrase: pass}, nil
+	}
+	return crypt.Source{}, fmt.Errorf("encryption is enabled but neither key_file nor $%s is set", env)
+}
+
+// SetupEncryption unlocks the data key and makes it active. It must run
+// before any store is opened.
+func (c *Config) SetupEncryption() error {
+	if !c.Encryption.Enabled {
+		return nil
+	}
+	src, err := c.KeySource()
+	if err != nil {
+		return err
+	}
+	if err := c.EnsureDataDir(); err != nil {
+		return err
+	}
+	key, err := crypt.Unlock(c.DataDir, src)
+	if err != nil {
+		return err
+	}
+	crypt.SetKey(key)
+	return nil
+}
+
+// BlobOptions returns the options for blob.New.
+func (c *Config) BlobOptions() blob.Options {
+	return blob.Options{
+		Compression: blob.Compression(c.BlobCompression),
+		Backend:     c.BlobBackend,
+		S3: blob.S3Options{
+			Endpoint:  c.S3.Endpoint,
+			Region:    c.S3.Region,
+			Bucket:    c.S3.Bucket,
+			Prefix:    c.S3.Prefix,
+			AccessKey: c.S3.AccessKey,
+			SecretKey: c.S3.SecretKey,
+		},
+	}
+}
+
+// CSVConfig controls how CSV and TSV files are indexed. With Rows set,
+// each row of a file with a header is indexed as "header: value" lines.
+type CSVConfig struct {
+	Rows bool `yaml:"rows"`
+}
+
+// SetupExtractor applies the extraction options. It must run before files
+// are indexed.
+func (c *Config) SetupExtractor() {
+	extractor.SetCSVOptions(extractor.CSVOptions{Rows: c.CSV.Rows})
+}
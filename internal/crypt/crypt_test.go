@@ -0,0 +1,197 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(b byte) Key {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, 32))
+		if got != tt.want {
+			t.Errorf("pbkdf2(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := testKey(1)
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 5} {
+		plain := make([]byte, size)
+		for i := range plain {
+			plain[i] = byte(i * 7)
+		}
+		sealed, err := Encrypt(key, plain)
+		if err != nil {
+			t.Fatalf("size %d: encrypt: %v", size, err)
+		}
+		if !IsEncrypted(sealed) {
+			t.Fatalf("size %d: missing header", size)
+		}
+		if size > 16 && bytes.Contains(sealed, plain[:16]) {
+			t.Errorf("size %d: plaintext visible in output", size)
+		}
+
+		got, err := Decrypt(key, sealed)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: decrypt mismatch: %v", size, err)
+		}
+
+		r, err := NewReader(key, bytes.NewReader(sealed), int64(len(sealed)))
+		if err != nil {
+			t.Fatalf("size %d: reader: %v", size, err)
+		}
+		if r.Size() != int64(size) {
+			t.Errorf("size %d: reader size %d", size, r.Size())
+		}
+		if size > 10 {
+			off := int64(size / 2)
+			part, err := io.ReadAll(io.NewSectionReader(r, off, int64(size)-off))
+			if err != nil || !bytes.Equal(part, plain[off:]) {
+				t.Errorf("size %d: read from %d mismatch: %v", size, off, err)
+			}
+		}
+	}
+}
+
+func TestDecrypt_Rejects(t *testing.T) {
+	key := testKey(1)
+	plain := bytes.Repeat([]byte("secret "), segmentSize/3)
+	sealed, err := Encrypt(key, plain)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	if _, err := Decrypt(testKey(2), sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong key: got %v, want ErrDecrypt", err)
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[HeaderSize+10] ^= 1
+	if _, err := Decrypt(key, tampered); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("tampered: got %v, want ErrDecrypt", err)
+	}
+
+	// Dropping the final segment leaves a valid-looking prefix.
+	truncated := sealed[:HeaderSize+segmentSize+tagSize]
+	if _, err := Decrypt(key, truncated); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("truncated: got %v, want ErrDecrypt", err)
+	}
+	if _, err := Decrypt(key, sealed[:HeaderSize+5]); err == nil {
+		t.Error("short data should fail")
+	}
+}
+
+func TestUnlockAndRewrap(t *testing.T) {
+	defer func(n int) { kdfIterations = n }(kdfIterations)
+	kdfIterations = 1000
+
+	dir := t.TempDir()
+	first, err := Unlock(dir, Source{Passphrase: "correct horse"})
+	if err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if len(first) != KeySize {
+		t.Fatalf("data key is %d bytes", len(first))
+	}
+	again, err := Unlock(dir, Source{Passphrase: "correct horse"})
+	if err != nil || !bytes.Equal(again, first) {
+		t.Fatalf("second unlock returned a different key: %v", err)
+	}
+	if _, err := Unlock(dir, Source{Passphrase: "battery staple"}); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong passphrase: got %v, want ErrWrongKey", err)
+	}
+
+	// A rewrap needs the current passphrase and keeps the kind of key.
+	keyFile := filepath.Join(dir, "master.key")
+	if err := GenerateKeyFile(keyFile); err != nil {
+		t.Fatalf("generate key file: %v", err)
+	}
+	if err := Rewrap(dir, Source{Passphrase: "wrong"}, Source{Passphrase: "battery staple"}); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("rewrap with a wrong passphrase: got %v, want ErrWrongKey", err)
+	}
+	if err := Rewrap(dir, Source{Passphrase: "correct horse"}, Source{KeyFile: keyFile}); !errors.Is(err, ErrSourceChange) {
+		t.Errorf("rewrap to a key file: got %v, want ErrSourceChange", err)
+	}
+	if err := Rewrap(dir, Source{Passphrase: "correct horse"}, Source{Passphrase: "battery staple"}); err != nil {
+		t.Fatalf("rewrap: %v", err)
+	}
+	if _, err := Unlock(dir, Source{Passphrase: "correct horse"}); err == nil {
+		t.Error("old passphrase still unlocks after rewrap")
+	}
+	rewrapped, err := Unlock(dir, Source{Passphrase: "battery staple"})
+	if err != nil || !bytes.Equal(rewrapped, first) {
+		t.Fatalf("rewrap must keep the data key: %v", err)
+	}
+
+	// A key given directly is read like a key file.
+	keyDir := t.TempDir()
+	if _, err := Unlock(keyDir, Source{KeyFile: keyFile}); err != nil {
+		t.Fatalf("unlock with key file: %v", err)
+	}
+	newKey := make([]byte, KeySize)
+	newKey[0] = 1
+	if err := Rewrap(keyDir, Source{KeyFile: keyFile}, Source{Passphrase: "battery staple"}); !errors.Is(err, ErrSourceChange) {
+		t.Errorf("rewrap to a passphrase: got %v, want ErrSourceChange", err)
+	}
+	if err := Rewrap(keyDir, Source{KeyFile: keyFile}, Source{Key: newKey}); err != nil {
+		t.Fatalf("rewrap to inline key: %v", err)
+	}
+	os.WriteFile(keyFile, newKey, 0600)
+	if _, err := Unlock(keyDir, Source{KeyFile: keyFile}); err != nil {
+		t.Errorf("key file should unlock a keyring sealed under its key: %v", err)
+	}
+	info, err := ReadKeyringInfo(keyDir)
+	if err != nil || info.KDF != kdfKeyFile || info.RewrappedAt.IsZero() {
+		t.Errorf("keyring info = %+v, %v", info, err)
+	}
+	if _, err := Unlock(keyDir, Source{Key: Key("too short")}); err == nil {
+		t.Error("malformed key should not unlock")
+	}
+}
+
+func TestReadWriteFile(t *testing.T) {
+	defer SetKey(nil)
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	if err := WriteFile(path, []byte(`{"plain":true}`), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	SetKey(testKey(3))
+	if data, err := ReadFile(path); err != nil || string(data) != `{"plain":true}` {
+		t.Fatalf("plaintext file not readable with a key: %q, %v", data, err)
+	}
+
+	if err := WriteFile(path, []byte(`{"secret":true}`), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, []byte("secret")) {
+		t.Error("file written in plaintext")
+	}
+	if data, err := ReadFile(path); err != nil || string(data) != `{"secret":true}` {
+		t.Errorf("read back %q, %v", data, err)
+	}
+
+	SetKey(nil)
+	if _, err := ReadFile(path); !errors.Is(err, ErrNoKey) {
+		t.Errorf("read without key: got %v, want ErrNoKey", err)
+	}
+}
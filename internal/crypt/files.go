@@ -0,0 +1,56 @@
+package crypt
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+var active struct {
+	sync.RWMutex
+	key Key
+}
+
+// SetKey sets the data key used for everything written from now on. It
+// must be called before the stores are opened; nil turns encryption off.
+func SetKey(key Key) {
+	active.Lock()
+	defer active.Unlock()
+	active.key = key
+}
+
+// ActiveKey returns the key set by SetKey, or nil.
+func ActiveKey() Key {
+	active.RLock()
+	defer active.RUnlock()
+	return active.key
+}
+
+// ReadFile reads a state file, decrypting it if it was written encrypted.
+// Plaintext files from before encryption was enabled are returned as is.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !IsEncrypted(data) {
+		return data, err
+	}
+	key := ActiveKey()
+	if key == nil {
+		return nil, fmt.Errorf("%s: %w", path, ErrNoKey)
+	}
+	plain, err := Decrypt(key, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return plain, nil
+}
+
+// WriteFile writes a state file, encrypted when a key is set.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	if key := ActiveKey(); key != nil {
+		var err error
+		if data, err = Encrypt(key, data); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, perm)
+}
@@ -0,0 +1,246 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const KeySize = 32
+
+// Key is an AES-256 key.
+type Key []byte
+
+// Source says where the master key comes from: a passphrase stretched with
+// PBKDF2, a key file holding 32 raw bytes or 64 hex characters, or Key
+// given directly. A keyring sealed under Key opens with a key file holding
+// the same key.
+type Source struct {
+	Passphrase string
+	KeyFile    string
+	Key        Key
+}
+
+const (
+	keyringFile = "keyring.json"
+	kdfPBKDF2   = "pbkdf2-sha256"
+	kdfKeyFile  = "keyfile"
+)
+
+// kdfIterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256.
+var kdfIterations = 600000
+
+var (
+	ErrNoKey        = errors.New("data is encrypted but no key is configured")
+	ErrWrongKey     = errors.New("wrong passphrase or key file")
+	ErrSourceChange = errors.New("a rewrap keeps the kind of master key: passphrase or key file")
+)
+
+// keyring holds the data key sealed under the master key. Everything at
+// rest is encrypted with the data key, so changing the master key only
+// rewrites this file.
+type keyring struct {
+	Version     int       `json:"version"`
+	KDF         string    `json:"kdf"`
+	Salt        []byte    `json:"salt,omitempty"`
+	Iterations  int       `json:"iterations,omitempty"`
+	DataKey     []byte    `json:"data_key"`
+	RewrappedAt time.Time `json:"rewrapped_at"`
+}
+
+// Initialized reports whether dataDir has a keyring.
+func Initialized(dataDir string) bool {
+	_, err := os.Stat(filepath.Join(dataDir, keyringFile))
+	return err == nil
+}
+
+// Unlock returns the data key for dataDir, creating a keyring with a new
+// random data key on first use.
+func Unlock(dataDir string, src Source) (Key, error) {
+	path := filepath.Join(dataDir, keyringFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		dataKey := make(Key, KeySize)
+		if _, err := rand.Read(dataKey); err != nil {
+			return nil, err
+		}
+		if err := writeKeyring(path, dataKey, src); err != nil {
+			return nil, err
+		}
+		return dataKey, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ring keyring
+	if err := json.Unmarshal(data, &ring); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", keyringFile, err)
+	}
+	master, err := src.master(&ring)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := Decrypt(master, ring.DataKey)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return dataKey, nil
+}
+
+// Rewrap re-seals the data key of dataDir, unlocked with current, under
+// the master key from next. The data key stays the same and no data is
+// re-encrypted. next must be of the same kind as the keyring's master key,
+// so the key source configured for the next start still applies; a new
+// key file's key is given in next.Key.
+func Rewrap(dataDir string, current, next Source) error {
+	info, err := ReadKeyringInfo(dataDir)
+	if err != nil {
+		return fmt.Errorf("no keyring in %s: %w", dataDir, err)
+	}
+	if (info.KDF == kdfKeyFile) != (next.KeyFile != "" || next.Key != nil) {
+		return ErrSourceChange
+	}
+	dataKey, err := Unlock(dataDir, current)
+	if err != nil {
+		return err
+	}
+	return writeKeyring(filepath.Join(dataDir, keyringFile), dataKey, next)
+}
+
+// KeyringInfo describes a keyring without unlocking it.
+type KeyringInfo struct {
+	KDF         string    `json:"kdf"`
+	RewrappedAt time.Time `json:"rewrapped_at"`
+}
+
+func ReadKeyringInfo(dataDir string) (*KeyringInfo, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, keyringFile))
+	if err != nil {
+		return nil, err
+	}
+	var ring keyring
+	if err := json.Unmarshal(data, &ring); err != nil {
+		return nil, err
+	}
+	return &KeyringInfo{KDF: ring.KDF, RewrappedAt: ring.RewrappedAt}, nil
+}
+
+func writeKeyring(path string, dataKey Key, src Source) error {
+	ring := &keyring{Version: 1, RewrappedAt: time.Now().UTC()}
+	if src.KeyFile == "" && src.Key == nil {
+		ring.KDF = kdfPBKDF2
+		ring.Iterations = kdfIterations
+		ring.Salt = make([]byte, 16)
+		if _, err := rand.Read(ring.Salt); err != nil {
+			return err
+		}
+	} else {
+		ring.KDF = kdfKeyFile
+	}
+	master, err := src.master(ring)
+	if err != nil {
+		return err
+	}
+	if ring.DataKey, err = Encrypt(master, dataKey); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(ring, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (src Source) master(ring *keyring) (Key, error) {
+	switch ring.KDF {
+	case kdfKeyFile:
+		if src.Key != nil {
+			return ParseKey(src.Key)
+		}
+		if src.KeyFile == "" {
+			return nil, fmt.Errorf("keyring expects a key file: %w", ErrWrongKey)
+		}
+		return ReadKeyFile(src.KeyFile)
+	case kdfPBKDF2:
+		if src.Passphrase == "" {
+			return nil, fmt.Errorf("keyring expects a passphrase: %w", ErrWrongKey)
+		}
+		return pbkdf2SHA256([]byte(src.Passphrase), ring.Salt, ring.Iterations, KeySize), nil
+	}
+	return nil, fmt.Errorf("unknown key derivation %q", ring.KDF)
+}
+
+// ReadKeyFile reads a master key stored as 32 raw bytes or 64 hex
+// characters.
+func ReadKeyFile(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ParseKey reads a master key given as 32 raw bytes or 64 hex characters.
+func ParseKey(data []byte) (Key, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 2*KeySize {
+		if key, err := hex.DecodeString(string(trimmed)); err == nil {
+			return key, nil
+		}
+	}
+	if len(data) == KeySize {
+		return Key(data), nil
+	}
+	return nil, fmt.Errorf("master key must be %d bytes or %d hex characters", KeySize, 2*KeySize)
+}
+
+// GenerateKeyFile writes a new random key, hex encoded, readable only by
+// its owner.
+func GenerateKeyFile(path string) error {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600)
+}
+
+// pbkdf2SHA256 implements PBKDF2 (RFC 8018) with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var out []byte
+	for block := uint32(1); len(out) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
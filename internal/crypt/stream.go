@@ -0,0 +1,273 @@
+// Package crypt encrypts Mindy's data at rest. Content is sealed with
+// AES-256-GCM in fixed-size segments so that large files can be written
+// as a stream and read back at arbitrary offsets.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted data starts with a header: magic, format version and a random
+// salt. The salt derives a per-file subkey, so GCM nonces can be a plain
+// segment counter. Each segment holds up to segmentSize bytes of plaintext
+// followed by its tag; the last segment's nonce is flagged, which detects
+// truncation.
+var magic = []byte{0x89, 'M', 'B', 'E'}
+
+const (
+	version     = 1
+	saltSize    = 16
+	HeaderSize  = 4 + 1 + saltSize
+	segmentSize = 64 << 10
+	tagSize     = 16
+)
+
+var (
+	ErrDecrypt      = errors.New("decryption failed: wrong key or corrupt data")
+	errWriterClosed = errors.New("crypt: write to closed writer")
+)
+
+// IsEncrypted reports whether data starts with an encryption header.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Magic returns the prefix of encrypted data.
+func Magic() []byte {
+	return append([]byte(nil), magic...)
+}
+
+func newAEAD(key Key, salt []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes", KeySize)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(index uint64, last bool) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n, index)
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+// Encrypt seals data in memory.
+func Encrypt(key Key, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(HeaderSize + len(data) + (len(data)/segmentSize+1)*tagSize)
+	w, err := NewWriter(key, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decrypt opens data sealed by Encrypt or a Writer.
+func Decrypt(key Key, data []byte) ([]byte, error) {
+	r, err := NewReader(key, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if r.Size() == 0 {
+		_, err := r.segment(0)
+		return []byte{}, err
+	}
+	out := make([]byte, r.Size())
+	if _, err := r.ReadAt(out, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Writer encrypts a stream. Close must be called to seal the final
+// segment.
+type Writer struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+	err   error
+}
+
+func NewWriter(key Key, w io.Writer) (*Writer, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append(Magic(), version), salt...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, aead: aead, buf: make([]byte, 0, segmentSize)}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		// A full segment is only sealed once more data arrives, since
+		// the final segment must be flagged as such.
+		if len(w.buf) == segmentSize {
+			if w.err = w.flush(false); w.err != nil {
+				return written, w.err
+			}
+		}
+		n := copy(w.buf[len(w.buf):segmentSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *Writer) flush(last bool) error {
+	sealed := w.aead.Seal(nil, nonce(w.index, last), w.buf, nil)
+	w.index++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.flush(true); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = errWriterClosed
+	return nil
+}
+
+// Reader decrypts data sealed by a Writer with random access.
+type Reader struct {
+	r        io.ReaderAt
+	aead     cipher.AEAD
+	size     int64
+	segments int64
+	cached   int64
+	plain    []byte
+}
+
+// NewReader reads the header of the encrypted data in r, which is size
+// bytes long.
+func NewReader(key Key, r io.ReaderAt, size int64) (*Reader, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("reading encryption header: %w", err)
+	}
+	if !IsEncrypted(header) {
+		return nil, errors.New("data is not encrypted")
+	}
+	if header[4] != version {
+		return nil, fmt.Errorf("unsupported encryption format %d", header[4])
+	}
+	aead, err := newAEAD(key, header[5:])
+	if err != nil {
+		return nil, err
+	}
+	plain, segments, err := PlainSize(size)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: r, aead: aead, size: plain, segments: segments, cached: -1}, nil
+}
+
+// PlainSize returns the plaintext size and segment count of encrypted
+// data that is physical bytes long.
+func PlainSize(physical int64) (int64, int64, error) {
+	body := physical - HeaderSize
+	if body < tagSize {
+		return 0, 0, fmt.Errorf("encrypted data truncated: %w", ErrDecrypt)
+	}
+	segments := (body + segmentSize + tagSize - 1) / (segmentSize + tagSize)
+	if body-(segments-1)*(segmentSize+tagSize) < tagSize {
+		return 0, 0, fmt.Errorf("encrypted data truncated: %w", ErrDecrypt)
+	}
+	return body - segments*tagSize, segments, nil
+}
+
+// Size returns the plaintext size.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) segment(index int64) ([]byte, error) {
+	if index == r.cached {
+		return r.plain, nil
+	}
+	start := HeaderSize + index*(segmentSize+tagSize)
+	n := int64(segmentSize + tagSize)
+	last := index == r.segments-1
+	if last {
+		n = r.size - index*segmentSize + tagSize
+	}
+	sealed := make([]byte, n)
+	if _, err := r.r.ReadAt(sealed, start); err != nil && err != io.EOF {
+		return nil, err
+	}
+	plain, err := r.aead.Open(sealed[:0], nonce(uint64(index), last), sealed, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	r.cached, r.plain = index, plain
+	return plain, nil
+}
+
+// ReadAt implements io.ReaderAt over the plaintext. It is not safe for
+// concurrent use.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			// An empty file still has a final segment to authenticate.
+			if r.size == 0 {
+				if _, err := r.segment(0); err != nil {
+					return 0, err
+				}
+			}
+			return n, io.EOF
+		}
+		plain, err := r.segment(off / segmentSize)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], plain[off%segmentSize:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"mindy/internal/crypt"
 )
 
 type DataManager struct {
@@ -87,6 +89,14 @@ func (dm *DataManager) Export(opts *ExportOptions) error {
 		}
 	}
 
+	// Encrypted data is unreadable without the keyring, which stays sealed
+	// under the master key.
+	if err := dm.addFileToZip(writer, filepath.Join(dm.dataDir, "keyring.json"), "keyring.json"); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to export keyring: %w", err)
+		}
+	}
+
 	if opts.IncludeHistory {
 		if err := dm.addFileToZip(writer, filepath.Join(dm.dataDir, "search_history.json"), "search_history.json"); err != nil {
 			if !os.IsNotExist(err) {
@@ -130,23 +140,60 @@ func (dm *DataManager) Import(opts *ImportOptions) error {
 }
 
 func (dm *DataManager) BatchDelete(opts *BatchDeleteOptions) (int, error) {
+	toDelete, err := dm.MatchFiles(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if opts.DryRun {
+		return len(toDelete), nil
+	}
+
+	trackerPath := filepath.Join(dm.dataDir, "file_tracker.json")
+	tracker, err := dm.readTracker()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, path := range toDelete {
+		delete(tracker, path)
+	}
+
+	if len(toDelete) > 0 {
+		newData, _ := json.Marshal(map[string]interface{}{"files": tracker})
+		crypt.WriteFile(trackerPath, newData, 0644)
+	}
+
+	return len(toDelete), nil
+}
+
+func (dm *DataManager) readTracker() (map[string]interface{}, error) {
 	trackerPath := filepath.Join(dm.dataDir, "file_tracker.json")
-	data, err := os.ReadFile(trackerPath)
+	data, err := crypt.ReadFile(trackerPath)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read file tracker: %w", err)
+		return nil, fmt.Errorf("failed to read file tracker: %w", err)
 	}
 
 	var tracker struct {
 		Files map[string]interface{} `json:"files"`
 	}
 	if err := json.Unmarshal(data, &tracker); err != nil {
-		return 0, fmt.Errorf("failed to parse file tracker: %w", err)
+		return nil, fmt.Errorf("failed to parse file tracker: %w", err)
+	}
+	return tracker.Files, nil
+}
+
+// MatchFiles lists the tracked files selected by the batch delete filters.
+func (dm *DataManager) MatchFiles(opts *BatchDeleteOptions) ([]string, error) {
+	files, err := dm.readTracker()
+	if err != nil {
+		return nil, err
 	}
 
 	var toDelete []string
 	cutoffTime := time.Now().AddDate(0, 0, -opts.OlderThanDays).Unix()
 
-	for path, info := range tracker.Files {
+	for path, info := range files {
 		infoMap, ok := info.(map[string]interface{})
 		if !ok {
 			continue
@@ -175,25 +222,12 @@ func (dm *DataManager) BatchDelete(opts *BatchDeleteOptions) (int, error) {
 		toDelete = append(toDelete, path)
 	}
 
-	if opts.DryRun {
-		return len(toDelete), nil
-	}
-
-	for _, path := range toDelete {
-		delete(tracker.Files, path)
-	}
-
-	if len(toDelete) > 0 {
-		newData, _ := json.Marshal(tracker)
-		os.WriteFile(trackerPath, newData, 0644)
-	}
-
-	return len(toDelete), nil
+	return toDelete, nil
 }
 
 func (dm *DataManager) BatchReindex(opts *BatchReindexOptions) ([]string, error) {
 	trackerPath := filepath.Join(dm.dataDir, "file_tracker.json")
-	data, err := os.ReadFile(trackerPath)
+	data, err := crypt.ReadFile(trackerPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file tracker: %w", err)
 	}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"mindy/internal/crypt"
 )
 
 type SearchHistory struct {
@@ -40,7 +42,7 @@ func NewSearchHistory(dataDir string, maxItems int) *SearchHistory {
 
 func (sh *SearchHistory) Load() error {
 	path := filepath.Join(sh.dataDir, "search_history.json")
-	data, err := os.ReadFile(path)
+	data, err := crypt.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -56,7 +58,7 @@ func (sh *SearchHistory) Save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	return crypt.WriteFile(path, data, 0644)
 }
 
 func (sh *SearchHistory) Add(query string, results int) {
@@ -112,7 +114,7 @@ func NewSavedSearches(dataDir string) *SavedSearches {
 
 func (ss *SavedSearches) Load() error {
 	path := filepath.Join(ss.dataDir, "saved_searches.json")
-	data, err := os.ReadFile(path)
+	data, err := crypt.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -128,7 +130,7 @@ func (ss *SavedSearches) Save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	return crypt.WriteFile(path, data, 0644)
 }
 
 func (ss *SavedSearches) Add(name, query string) (*SavedSearch, error) {
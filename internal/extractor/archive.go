@@ -0,0 +1,223 @@
+package extractor
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Limits on unpacking archives, against zip bombs. Archives nested deeper
+// than maxArchiveDepth are kept as members but not opened; members larger
+// than maxArchiveMember are skipped; and unpacking stops after
+// maxArchiveMembers files or maxArchiveSize decompressed bytes across an
+// archive and everything nested in it.
+const (
+	maxArchiveDepth   = 3
+	maxArchiveMembers = 10000
+	maxArchiveMember  = 64 << 20
+	maxArchiveSize    = 512 << 20
+)
+
+// errArchiveLimit stops unpacking once a limit is reached.
+var errArchiveLimit = errors.New("archive limit reached")
+
+// archiveFormats are the formats unpacked into parts.
+var archiveFormats = map[string]bool{"zip": true, "tar": true, "gzip": true, "zstd": true}
+
+// unpacker extracts the members of an archive and of the archives nested
+// in it, sharing one budget of members and bytes.
+type unpacker struct {
+	e         *Extractor
+	members   int
+	remaining int64
+	truncated bool
+}
+
+// archiveDocument extracts an archive of the named format. Each supported
+// member becomes a Part named by its path inside the archive; the text is
+// the list of those paths.
+func archiveDocument(e *Extractor, format, path string, content []byte) (*Document, error) {
+	u := &unpacker{e: e, remaining: maxArchiveSize}
+	return u.unpack(format, path, content, 1)
+}
+
+func (u *unpacker) unpack(format, name string, content []byte, depth int) (*Document, error) {
+	doc := &Document{Props: map[string]interface{}{}}
+	add := func(member string, r io.Reader, size int64) error {
+		return u.member(doc, member, r, size, depth)
+	}
+	// A compressed file that is not a tarball holds a single member,
+	// named like the archive without its extension.
+	single := strings.TrimSuffix(path.Base(strings.ReplaceAll(name, `\`, "/")), path.Ext(name))
+
+	var err error
+	switch format {
+	case "zip":
+		err = zipMembers(content, add)
+	case "tar":
+		err = tarMembers(bytes.NewReader(content), add)
+	case "gzip":
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(content)); err == nil {
+			if zr.Name != "" {
+				single = zr.Name
+			}
+			err = streamMembers(zr, single, add)
+		}
+	case "zstd":
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(bytes.NewReader(content), zstd.WithDecoderConcurrency(1)); err == nil {
+			err = streamMembers(zr, single, add)
+			zr.Close()
+		}
+	default:
+		err = fmt.Errorf("unknown archive format %s", format)
+	}
+	if errors.Is(err, errArchiveLimit) {
+		err = nil
+	}
+	// A damaged archive keeps the members read before the damage.
+	if err != nil && len(doc.Parts) == 0 {
+		return nil, err
+	}
+
+	names := make([]string, len(doc.Parts))
+	for n, part := range doc.Parts {
+		names[n] = part.Name
+	}
+	doc.Text = strings.Join(names, "\n")
+	doc.Props["members"] = len(doc.Parts)
+	if u.truncated || err != nil {
+		doc.Props["truncated"] = true
+	}
+	return doc, nil
+}
+
+// member reads one file of an archive and adds it as a part if its format
+// can be extracted. Archives inside are unpacked in turn.
+func (u *unpacker) member(doc *Document, name string, r io.Reader, size int64, depth int) error {
+	name = archiveName(name)
+	if name == "" {
+		return nil
+	}
+	if u.members >= maxArchiveMembers || u.remaining <= 0 {
+		u.truncated = true
+		return errArchiveLimit
+	}
+	u.members++
+	if size > maxArchiveMember {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, min(maxArchiveMember, u.remaining)+1))
+	u.remaining -= int64(len(data))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxArchiveMember {
+		return nil
+	}
+	if u.remaining < 0 {
+		u.truncated = true
+		return errArchiveLimit
+	}
+
+	f, ok := Detect(name, data)
+	if !ok || f.Extract == nil {
+		return nil
+	}
+	var part *Document
+	switch {
+	case archiveFormats[f.Name] && depth < maxArchiveDepth:
+		part, err = u.unpack(f.Name, name, data, depth+1)
+	case archiveFormats[f.Name]:
+		part = &Document{Props: map[string]interface{}{"truncated": true}}
+	default:
+		part, err = u.e.ExtractDocument(name, data)
+	}
+	if err != nil {
+		return nil
+	}
+	doc.Parts = append(doc.Parts, Part{Name: name, Content: data, Document: part})
+	return nil
+}
+
+// archiveName cleans a member's path, or returns "" for members that are
+// not worth indexing: directories, dotfiles and macOS resource forks.
+func archiveName(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	name = strings.TrimLeft(path.Clean("/"+name), "/")
+	if name == "" || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+		return ""
+	}
+	return name
+}
+
+func zipMembers(content []byte, add func(string, io.Reader, int64) error) error {
+	zr, err := openZip(content)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		err = add(f.Name, rc, int64(min(f.UncompressedSize64, 1<<62)))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tarMembers(r io.Reader, add func(string, io.Reader, int64) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := add(hdr.Name, tr, hdr.Size); err != nil {
+			return err
+		}
+	}
+}
+
+// streamMembers reads a compressed stream: a tarball's members, or else
+// the single file it compresses.
+func streamMembers(r io.Reader, name string, add func(string, io.Reader, int64) error) error {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+	r = io.MultiReader(bytes.NewReader(head), r)
+	if sniffTar(head) {
+		return tarMembers(r, add)
+	}
+	return add(name, r, -1)
+}
+
+// sniffTar recognises a POSIX or GNU tar header.
+func sniffTar(content []byte) bool {
+	return len(content) >= 262 && string(content[257:262]) == "ustar"
+}
@@ -0,0 +1,149 @@
+package extractor
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// testTar builds a tarball of name/content pairs in order.
+func testTar(t *testing.T, parts ...string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for n := 0; n+1 < len(parts); n += 2 {
+		if err := tw.WriteHeader(&tar.Header{Name: parts[n], Mode: 0644, Size: int64(len(parts[n+1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(parts[n+1]))
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func partNames(doc *Document) []string {
+	var names []string
+	for _, part := range doc.Parts {
+		names = append(names, part.Name)
+	}
+	return names
+}
+
+func TestArchiveDocument(t *testing.T) {
+	e := New()
+	tarball := testTar(t, "docs/guide.md", "# Guide\n\nRead me.", "bin/tool", "\x7fELF\x00\x00\x00\x00", "notes.txt", "plain notes")
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(tarball)
+	gw.Close()
+	zw, _ := zstd.NewWriter(nil)
+	zst := zw.EncodeAll(tarball, nil)
+	zw.Close()
+
+	for _, tc := range []struct {
+		path    string
+		content []byte
+		format  string
+	}{
+		{"site.zip", testZip(t, "docs/guide.md", "# Guide\n\nRead me.", "__MACOSX/docs/._guide.md", "junk", "../notes.txt", "plain notes", "empty/", ""), "zip"},
+		{"site.tar", tarball, "tar"},
+		{"site.tar.gz", gz.Bytes(), "gzip"},
+		{"site.tar.zst", zst, "zstd"},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			if f, ok := Detect("upload", tc.content); !ok || f.Name != tc.format {
+				t.Errorf("sniffed format = %q", f.Name)
+			}
+			doc, err := e.ExtractDocument(tc.path, tc.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := partNames(doc), []string{"docs/guide.md", "notes.txt"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("parts = %v, want %v", got, want)
+			}
+			guide := doc.Parts[0]
+			if string(guide.Content) != "# Guide\n\nRead me." || guide.Document.Structure == nil || guide.Document.Structure.Title != "Guide" {
+				t.Errorf("guide = %q, %+v", guide.Content, guide.Document.Structure)
+			}
+			if doc.Text != "docs/guide.md\nnotes.txt" || doc.Props["members"] != 2 || doc.Props["truncated"] != nil {
+				t.Errorf("text = %q, props = %v", doc.Text, doc.Props)
+			}
+		})
+	}
+
+	// A single compressed file is one member named after the archive.
+	var single bytes.Buffer
+	gw = gzip.NewWriter(&single)
+	gw.Write([]byte("2024-01-01 started\n"))
+	gw.Close()
+	doc, err := e.ExtractDocument("logs/app.log.gz", single.Bytes())
+	if err != nil || !reflect.DeepEqual(partNames(doc), []string{"app.log"}) {
+		t.Errorf("gzip parts = %v, %v", doc, err)
+	}
+
+	// Office documents are not mistaken for archives.
+	docx := testZip(t, "[Content_Types].xml", "<Types/>", "word/document.xml", "<w:document/>")
+	if f, _ := Detect("upload", docx); f.Name != "word" {
+		t.Errorf("docx sniffed as %q", f.Name)
+	}
+
+	if _, err := e.ExtractDocument("broken.zip", []byte("PK\x03\x04 not really")); err == nil {
+		t.Error("expected an error for a damaged zip")
+	}
+}
+
+func TestArchiveLimits(t *testing.T) {
+	e := New()
+
+	// Nesting is followed to maxArchiveDepth; deeper archives are kept
+	// unopened.
+	archive := testZip(t, "deep.txt", "bottom")
+	for n := 0; n < maxArchiveDepth; n++ {
+		archive = testZip(t, "inner.zip", string(archive))
+	}
+	doc, err := e.ExtractDocument("outer.zip", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var path []string
+	for depth := 1; ; depth++ {
+		if len(doc.Parts) != 1 {
+			t.Fatalf("depth %d: parts = %v", depth, partNames(doc))
+		}
+		path = append(path, doc.Parts[0].Name)
+		doc = doc.Parts[0].Document
+		if doc.Props["truncated"] == true {
+			break
+		}
+	}
+	if len(path) != maxArchiveDepth || len(doc.Parts) != 0 {
+		t.Errorf("unpacked %v", path)
+	}
+
+	// Unpacking stops at maxArchiveMembers files.
+	parts := make([]string, 0, 2*(maxArchiveMembers+5))
+	for n := 0; n < maxArchiveMembers+5; n++ {
+		parts = append(parts, "f"+strings.Repeat("x", n%7)+".txt", "x")
+	}
+	doc, err = e.ExtractDocument("many.tar", testTar(t, parts...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Parts) != maxArchiveMembers || doc.Props["truncated"] != true {
+		t.Errorf("parts = %d, props = %v", len(doc.Parts), doc.Props["truncated"])
+	}
+
+	// A bomb stops at maxArchiveMember bytes per member.
+	var bomb bytes.Buffer
+	gw := gzip.NewWriter(&bomb)
+	gw.Write(make([]byte, maxArchiveMember+1))
+	gw.Close()
+	doc, err = e.ExtractDocument("zeros.txt.gz", bomb.Bytes())
+	if err != nil || len(doc.Parts) != 0 {
+		t.Errorf("bomb parts = %v, %v", doc, err)
+	}
+}
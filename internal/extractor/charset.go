@@ -0,0 +1,154 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf8"
+)
+
+// DecodeText converts text to UTF-8 and returns the charset it was
+// detected as. A byte order mark selects UTF-8, UTF-16 or UTF-32 and is
+// dropped. Without one, valid UTF-8 is kept, UTF-16 is recognised from
+// its zero bytes, and anything else is read as Windows-1252 if it uses
+// that charset's 0x80-0x9F punctuation, else as Latin-1.
+func DecodeText(content []byte) (string, string) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xef, 0xbb, 0xbf}):
+		return strings.ToValidUTF8(string(content[3:]), "\uFFFD"), "utf-8"
+	case bytes.HasPrefix(content, []byte{0xff, 0xfe, 0, 0}):
+		return decodeUTF32(content[4:], binary.LittleEndian), "utf-32le"
+	case bytes.HasPrefix(content, []byte{0, 0, 0xfe, 0xff}):
+		return decodeUTF32(content[4:], binary.BigEndian), "utf-32be"
+	case bytes.HasPrefix(content, []byte{0xff, 0xfe}):
+		return decodeUTF16(content[2:], false), "utf-16le"
+	case bytes.HasPrefix(content, []byte{0xfe, 0xff}):
+		return decodeUTF16(content[2:], true), "utf-16be"
+	}
+	if utf8.Valid(content) {
+		return string(content), "utf-8"
+	}
+	if le, ok := looksUTF16(content); ok {
+		if le {
+			return decodeUTF16(content, false), "utf-16le"
+		}
+		return decodeUTF16(content, true), "utf-16be"
+	}
+
+	charset := "iso-8859-1"
+	for _, c := range content {
+		if c >= 0x80 && c <= 0x9f {
+			charset = "windows-1252"
+			break
+		}
+	}
+	return decodeSingleByte(content, charset == "windows-1252"), charset
+}
+
+// DecodeCharset converts text in a declared charset, such as that of a
+// MIME part, to UTF-8. Charsets other than UTF-8, UTF-16, Latin-1 and
+// Windows-1252 are detected as by DecodeText.
+func DecodeCharset(content []byte, charset string) string {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if utf8.Valid(content) {
+			return string(content)
+		}
+	case "iso-8859-1", "iso8859-1", "latin1", "l1":
+		return decodeSingleByte(content, false)
+	case "windows-1252", "cp1252":
+		return decodeSingleByte(content, true)
+	case "utf-16le":
+		return decodeUTF16(content, false)
+	case "utf-16be":
+		return decodeUTF16(content, true)
+	}
+	text, _ := DecodeText(content)
+	return text
+}
+
+func decodeSingleByte(content []byte, windows1252 bool) string {
+	var b strings.Builder
+	b.Grow(len(content) + len(content)/8)
+	for _, c := range content {
+		r := rune(c)
+		// Codes Windows-1252 leaves undefined keep their Latin-1 value.
+		if windows1252 && c >= 0x80 && winAnsiEncoding[c] != 0 {
+			r = winAnsiEncoding[c]
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// looksUTF16 recognises BOM-less UTF-16 from mostly-ASCII text, where
+// every other byte is zero.
+func looksUTF16(content []byte) (littleEndian, ok bool) {
+	head := content[:min(len(content), 1024)]
+	pairs := len(head) / 2
+	if pairs < 2 {
+		return false, false
+	}
+	var even, odd int
+	for i := 0; i+1 < len(head); i += 2 {
+		if head[i] == 0 {
+			even++
+		}
+		if head[i+1] == 0 {
+			odd++
+		}
+	}
+	switch {
+	case odd*10 > pairs*4 && even*20 < pairs:
+		return true, true
+	case even*10 > pairs*4 && odd*20 < pairs:
+		return false, true
+	}
+	return false, false
+}
+
+func decodeUTF32(s []byte, order binary.ByteOrder) string {
+	var b strings.Builder
+	for i := 0; i+3 < len(s); i += 4 {
+		r := rune(order.Uint32(s[i:]))
+		if !utf8.ValidRune(r) {
+			r = utf8.RuneError
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// IsBinary reports whether content looks like binary data rather than
+// text: its first 8KB hold NUL bytes or many other control characters,
+// and it is not UTF-16 or UTF-32 text.
+func IsBinary(content []byte) bool {
+	head := content[:min(len(content), 8192)]
+	if bytes.HasPrefix(head, []byte{0xff, 0xfe}) || bytes.HasPrefix(head, []byte{0xfe, 0xff}) ||
+		bytes.HasPrefix(head, []byte{0, 0, 0xfe, 0xff}) {
+		return false
+	}
+	if _, ok := looksUTF16(head); ok {
+		return false
+	}
+	controls := 0
+	for _, c := range head {
+		switch {
+		case c == 0:
+			return true
+		case c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' && c != 0x1b:
+			controls++
+		}
+	}
+	return controls*10 > len(head)
+}
+
+// decodedText wraps DecodeText for extraction functions, noting the
+// charset on the document when it was not UTF-8.
+func decodedText(content []byte) (string, map[string]interface{}) {
+	text, charset := DecodeText(content)
+	if charset == "utf-8" {
+		return text, nil
+	}
+	return text, map[string]interface{}{"charset": charset}
+}
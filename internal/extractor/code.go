@@ -0,0 +1,170 @@
+package extractor
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Code is the outline of a source file.
+type Code struct {
+	Language string
+	// Package is the file's package or namespace where the language
+	// declares one, else its module name: the file name without its
+	// extension.
+	Package string
+	Imports []Import
+	Symbols []Symbol
+}
+
+// Import is a package or module a source file imports.
+type Import struct {
+	Path string
+	// Name is the local name the file binds it to, if it renames it.
+	Name string
+}
+
+// Symbol is a declaration in a source file.
+type Symbol struct {
+	// Name is qualified by the enclosing type, as in "Server.Start".
+	Name string
+	// Kind is function, method, type, struct, interface, class, enum,
+	// trait, impl, namespace, module, const or var.
+	Kind string
+	// Parent names the type a method or member belongs to.
+	Parent    string
+	Signature string
+	Doc       string
+	// Start is the first line of the symbol's doc comment or decorators,
+	// Line that of the declaration and EndLine its last. Lines count
+	// from 1.
+	Start, Line, EndLine int
+	// Calls are the callees in the body as written, with "::" and "->"
+	// read as ".": "helper", "fmt.Println", "Server.stop". A call on the
+	// result of an expression keeps only the leading dot: ".Close".
+	Calls []string
+}
+
+// maxSymbols caps the declarations kept from one file, so generated code
+// does not flood the graph.
+const maxSymbols = 5000
+
+// maxCalls caps the callees recorded for one symbol.
+const maxCalls = 200
+
+// outlined reports whether a symbol gets a heading of its own; constants
+// and variables stay in the code around them.
+func (sym *Symbol) outlined() bool {
+	return sym.Kind != "const" && sym.Kind != "var"
+}
+
+// Structure lays the source out along its declarations: each outlined
+// symbol is a heading over its source, members nested in a type are
+// subheadings, and everything else is code in the section it falls in.
+func (c *Code) Structure(src string) *Structure {
+	lines := strings.SplitAfter(src, "\n")
+	offsets := make([]int, len(lines)+1)
+	for n, line := range lines {
+		offsets[n+1] = offsets[n] + len(line)
+	}
+
+	s := &Structure{}
+	code := func(from, to int) {
+		to = min(to, len(lines))
+		if from > to {
+			return
+		}
+		text := strings.TrimRight(strings.Join(lines[from-1:to], ""), " \t\r\n")
+		text = strings.TrimLeft(text, "\r\n")
+		if strings.Trim(text, " \t\r\n{}();") == "" {
+			return
+		}
+		s.Blocks = append(s.Blocks, Block{Kind: BlockCode, Text: text, Lang: c.Language, Offset: offsets[from-1], End: offsets[to]})
+	}
+
+	var outline []*Symbol
+	for n := range c.Symbols {
+		if sym := &c.Symbols[n]; sym.outlined() && sym.Start > 0 {
+			outline = append(outline, sym)
+		}
+	}
+	sort.SliceStable(outline, func(a, b int) bool { return outline[a].Start < outline[b].Start })
+
+	cursor := 1
+	var top *Symbol
+	for _, sym := range outline {
+		if sym.Start < cursor {
+			continue
+		}
+		code(cursor, sym.Start-1)
+		heading := Block{Kind: BlockHeading, Level: 1, Text: sym.Name, Offset: offsets[min(sym.Line, len(lines))-1]}
+		heading.End = heading.Offset
+		if top != nil && sym.Parent != "" && sym.Start > top.Line && sym.EndLine <= top.EndLine {
+			heading.Level = 2
+			heading.Text = strings.TrimPrefix(sym.Name, sym.Parent+".")
+		} else {
+			top = sym
+		}
+		s.Blocks = append(s.Blocks, heading)
+		cursor = sym.Start
+	}
+	code(cursor, len(lines))
+	return s
+}
+
+// Props returns the outline's Document props.
+func (c *Code) Props() map[string]interface{} {
+	props := map[string]interface{}{
+		"language": c.Language,
+		"symbols":  len(c.Symbols),
+	}
+	if c.Package != "" {
+		props["package"] = c.Package
+	}
+	if len(c.Imports) > 0 {
+		paths := make([]string, len(c.Imports))
+		for n, imp := range c.Imports {
+			paths[n] = imp.Path
+		}
+		props["imports"] = paths
+	}
+	return props
+}
+
+// moduleName is the module a file defines in languages without package
+// declarations: its name without the extension.
+func moduleName(path string) string {
+	base := filepath.Base(filepath.FromSlash(path))
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// addCall records a callee once, up to maxCalls.
+func (sym *Symbol) addCall(name string) {
+	if name == "" || len(sym.Calls) >= maxCalls {
+		return
+	}
+	for _, c := range sym.Calls {
+		if c == name {
+			return
+		}
+	}
+	sym.Calls = append(sym.Calls, name)
+}
+
+// codeDocument extracts a source file, as plain text when the language
+// has no outline or the file cannot be parsed.
+func codeDocument(language, path string, content []byte) *Document {
+	text, props := decodedText(content)
+	if props == nil {
+		props = map[string]interface{}{}
+	}
+	c := ParseCode(language, path, text)
+	if c == nil {
+		props["language"] = language
+		return &Document{Text: text, Props: props}
+	}
+	for k, v := range c.Props() {
+		props[k] = v
+	}
+	return &Document{Text: text, Props: props, Structure: c.Structure(text), Code: c}
+}
@@ -0,0 +1,230 @@
+package extractor
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// goBuiltins are predeclared functions and types, left out of Calls.
+var goBuiltins = toSet("append cap clear close complex copy delete imag len make max min new panic print println real recover " +
+	"any bool byte comparable complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr")
+
+func toSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// ParseGo outlines a Go source file. A file with syntax errors yields
+// what the parser recovered; nil means not even the package clause was
+// readable.
+func ParseGo(path, src string) *Code {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if f == nil || !f.Package.IsValid() {
+		return nil
+	}
+	c := &Code{Language: "go", Package: f.Name.Name}
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		i := Import{Path: path}
+		if imp.Name != nil {
+			i.Name = imp.Name.Name
+		}
+		c.Imports = append(c.Imports, i)
+	}
+
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+	start := func(doc *ast.CommentGroup, pos token.Pos) int {
+		if doc != nil {
+			return line(doc.Pos())
+		}
+		return line(pos)
+	}
+	add := func(sym Symbol) {
+		if len(c.Symbols) < maxSymbols && sym.Name != "_" {
+			c.Symbols = append(c.Symbols, sym)
+		}
+	}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			sym := Symbol{
+				Name:      d.Name.Name,
+				Kind:      "function",
+				Doc:       strings.TrimSpace(d.Doc.Text()),
+				Signature: goNode(fset, &ast.FuncDecl{Recv: d.Recv, Name: d.Name, Type: d.Type}),
+				Start:     start(d.Doc, d.Pos()),
+				Line:      line(d.Pos()),
+				EndLine:   line(d.End()),
+			}
+			receiver := ""
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				field := d.Recv.List[0]
+				sym.Parent = goReceiverType(field.Type)
+				sym.Name = sym.Parent + "." + sym.Name
+				sym.Kind = "method"
+				if len(field.Names) > 0 {
+					receiver = field.Names[0].Name
+				}
+			}
+			if d.Body != nil {
+				goCalls(&sym, d.Body, receiver)
+			}
+			add(sym)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				// A lone spec's doc comment sits on the declaration.
+				doc, pos := d.Doc, d.Pos()
+				if d.Lparen.IsValid() {
+					doc, pos = nil, spec.Pos()
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Doc != nil {
+						doc = s.Doc
+					}
+					sym := Symbol{
+						Name:      s.Name.Name,
+						Kind:      "type",
+						Doc:       strings.TrimSpace(doc.Text()),
+						Signature: "type " + s.Name.Name + " " + goTypeSummary(fset, s),
+						Start:     start(doc, pos),
+						Line:      line(s.Pos()),
+						EndLine:   line(s.End()),
+					}
+					switch s.Type.(type) {
+					case *ast.StructType:
+						sym.Kind = "struct"
+					case *ast.InterfaceType:
+						sym.Kind = "interface"
+					}
+					add(sym)
+				case *ast.ValueSpec:
+					if s.Doc != nil {
+						doc = s.Doc
+					}
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range s.Names {
+						add(Symbol{
+							Name:    name.Name,
+							Kind:    kind,
+							Doc:     strings.TrimSpace(doc.Text()),
+							Start:   start(doc, pos),
+							Line:    line(name.Pos()),
+							EndLine: line(s.End()),
+						})
+					}
+				}
+			}
+		}
+	}
+	return c
+}
+
+// goNode prints a node on one line.
+func goNode(fset *token.FileSet, node interface{}) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// goTypeSummary describes a type declaration without listing fields or
+// methods.
+func goTypeSummary(fset *token.FileSet, s *ast.TypeSpec) string {
+	prefix := ""
+	if s.Assign.IsValid() {
+		prefix = "= "
+	}
+	switch s.Type.(type) {
+	case *ast.StructType:
+		return prefix + "struct"
+	case *ast.InterfaceType:
+		return prefix + "interface"
+	}
+	summary := goNode(fset, s.Type)
+	if len(summary) > 200 {
+		summary = summary[:200] + "…"
+	}
+	return prefix + summary
+}
+
+// goReceiverType names a method's receiver type without pointer or type
+// parameters.
+func goReceiverType(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// goCalls records the calls in a function body. Calls through the
+// receiver are named by its type, so "s.run()" in a method of Server is
+// "Server.run".
+func goCalls(sym *Symbol, body *ast.BlockStmt, receiver string) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		switch fn := call.Fun.(type) {
+		case *ast.Ident:
+			if !goBuiltins[fn.Name] {
+				sym.addCall(fn.Name)
+			}
+		case *ast.SelectorExpr:
+			x := goDotted(fn.X)
+			switch {
+			case x == "":
+				sym.addCall("." + fn.Sel.Name)
+			case receiver != "" && x == receiver:
+				sym.addCall(sym.Parent + "." + fn.Sel.Name)
+			default:
+				sym.addCall(x + "." + fn.Sel.Name)
+			}
+		}
+		return true
+	})
+}
+
+// goDotted renders a chain of selectors such as "s.store", or returns ""
+// for anything else.
+func goDotted(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		if x := goDotted(e.X); x != "" {
+			return x + "." + e.Sel.Name
+		}
+	}
+	return ""
+}
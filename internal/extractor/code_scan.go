@@ -0,0 +1,748 @@
+package extractor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sourceLang describes how the scanner outlines a language without a
+// parser of its own: its comment and string syntax and line patterns
+// for its declarations.
+type sourceLang struct {
+	lineComments []string
+	blockComment [2]string
+	// quotes are the string delimiters. With charQuotes, ' only
+	// delimits character literals, so Rust lifetimes are left alone.
+	quotes       string
+	charQuotes   bool
+	tripleQuotes bool
+	// indented languages delimit bodies by indentation, not braces.
+	indented bool
+	decls    []declRule
+	// imports match whole lines; group "path" may list several paths
+	// separated by commas, each optionally followed by "as name".
+	imports []*regexp.Regexp
+	pkg     *regexp.Regexp
+	// attrs prefix the annotation lines between a doc comment and its
+	// declaration.
+	attrs []string
+	// keywords are never callees.
+	keywords map[string]bool
+}
+
+// declRule matches the first line of a declaration. Its regexp has a
+// "name" group and may have a "kind" group overriding kind.
+type declRule struct {
+	re   *regexp.Regexp
+	kind string
+	// member rules only apply directly inside a type.
+	member bool
+	// bodyless declarations, such as type aliases, are kept; for other
+	// rules a line without a body is a prototype or a call and skipped.
+	bodyless bool
+}
+
+// containerKinds are the symbol kinds whose bodies hold members.
+var containerKinds = toSet("class interface struct enum trait impl object record union")
+
+// controlWords look like declarations in some patterns, as in
+// "while (x) {", but never name one.
+var controlWords = toSet("if else for foreach while do switch case catch return throw sizeof typeof elif except with")
+
+// declWords introduce declarations; a name after one is not a call.
+var declWords = toSet("function def fn fun func class struct interface enum trait impl")
+
+var commonKeywords = "if else for foreach while do switch case catch return throw new delete typeof sizeof " +
+	"function def fn fun func class struct enum interface trait impl match when in is not and or await yield super assert lambda with using lock"
+
+var (
+	callPattern   = regexp.MustCompile(`[A-Za-z_$][\w$]*(?:\s*(?:\?\.|\.|::|->)\s*[A-Za-z_$][\w$]*)*\s*\(`)
+	callSeparator = regexp.MustCompile(`\s*(?:\?\.|\.|::|->)\s*`)
+	prevWord      = regexp.MustCompile(`([\w$]+)\s*$`)
+	pyDocstring   = regexp.MustCompile(`^\s*[rRuUbB]{0,2}("""|'''|"|')`)
+)
+
+const (
+	jsIdent   = `[A-Za-z_$][\w$]*`
+	javaMods  = `(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|protected|static|final|abstract|sealed|non-sealed|strictfp|default|synchronized|native)\s+)*`
+	csMods    = `(?:\[[^\]]*\]\s*)*(?:(?:public|private|protected|internal|static|sealed|abstract|partial|virtual|override|async|unsafe|extern|new|readonly|file|required)\s+)*`
+	kotlinMod = `(?:(?:public|private|protected|internal|open|override|abstract|final|sealed|data|enum|annotation|inner|value|companion|suspend|inline|operator|infix|tailrec|external|actual|expect)\s+)*`
+	rustPub   = `(?:pub(?:\s*\([^)]*\))?\s+)?`
+)
+
+func rx(pattern string) *regexp.Regexp { return regexp.MustCompile(pattern) }
+
+var cLang = &sourceLang{
+	lineComments: []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes:       `"'`,
+	charQuotes:   true,
+	decls: []declRule{
+		{re: rx(`^\s*(?:typedef\s+)?(?:template\s*<[^>]*>\s*)?(?P<kind>struct|class|union|enum)(?:\s+class)?\s+(?:\w+\s+)*?(?P<name>[A-Za-z_]\w*)\s*(?:final\s*)?(?::[^;{]*)?(?:\{|$)`)},
+		{re: rx(`^\s*(?:template\s*<[^>]*>\s*)?(?:(?:static|inline|extern|virtual|explicit|constexpr|friend|unsigned|signed|const|volatile|struct|enum|long|short)\s+)*(?:[\w:<>,]+[\s*&]+)?[*&]*(?P<name>~?[A-Za-z_]\w*(?:::~?[A-Za-z_]\w*)*)\s*\(`), kind: "function"},
+	},
+	imports:  []*regexp.Regexp{rx(`^\s*#\s*include\s*[<"](?P<path>[^>"]+)[>"]`)},
+	keywords: toSet(commonKeywords + " defined alignof decltype static_assert typeid"),
+}
+
+var jsLang = &sourceLang{
+	lineComments: []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes:       "\"'`",
+	decls: []declRule{
+		{re: rx(`^\s*(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:abstract\s+)?(?:const\s+)?(?P<kind>class|interface|enum)\s+(?P<name>` + jsIdent + `)`)},
+		{re: rx(`^\s*(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:async\s+)?function\s*\*?\s*(?P<name>` + jsIdent + `)`), kind: "function"},
+		{re: rx(`^\s*(?:export\s+)?(?:declare\s+)?type\s+(?P<name>` + jsIdent + `)\s*(?:<[^=]*>)?\s*=`), kind: "type", bodyless: true},
+		{re: rx(`^\s*(?:export\s+)?(?:const|let|var)\s+(?P<name>` + jsIdent + `)\s*(?::[^=]*)?=\s*(?:async\s+)?(?:function\b|(?:\([^)]*\)|` + jsIdent + `)\s*(?::[^=]*)?=>)`), kind: "function", bodyless: true},
+		{re: rx(`^\s*(?:(?:public|private|protected|static|readonly|abstract|override|async|get|set|declare)\s+)*\*?\s*(?P<name>#?` + jsIdent + `)\s*(?:<[^>]*>)?\s*\(`), kind: "method", member: true},
+	},
+	imports: []*regexp.Regexp{
+		rx(`^\s*import\s+(?:type\s+)?(?:(?:\*\s+as\s+)?(?P<name>` + jsIdent + `)\s*,?\s*)?(?:\{[^}]*\}\s*)?(?:from\s+)?['"](?P<path>[^'"]+)['"]`),
+		rx(`^\s*\}\s*from\s+['"](?P<path>[^'"]+)['"]`),
+		rx(`^\s*(?:const|let|var)\s+(?P<name>` + jsIdent + `)\s*=\s*require\(\s*['"](?P<path>[^'"]+)['"]\s*\)`),
+	},
+	attrs:    []string{"@"},
+	keywords: toSet(commonKeywords + " import require"),
+}
+
+var sourceLangs = map[string]*sourceLang{
+	"c":          cLang,
+	"cpp":        cLang,
+	"javascript": jsLang,
+	"typescript": jsLang,
+	"python": {
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		tripleQuotes: true,
+		indented:     true,
+		decls: []declRule{
+			{re: rx(`^\s*class\s+(?P<name>\w+)`), kind: "class"},
+			{re: rx(`^\s*(?:async\s+)?def\s+(?P<name>\w+)`), kind: "function"},
+		},
+		imports: []*regexp.Regexp{
+			rx(`^\s*import\s+(?P<path>[\w.]+(?:\s+as\s+\w+)?(?:\s*,\s*[\w.]+(?:\s+as\s+\w+)?)*)`),
+			rx(`^\s*from\s+(?P<path>[\w.]+)\s+import\b`),
+		},
+		attrs:    []string{"@"},
+		keywords: toSet(commonKeywords + " elif except print"),
+	},
+	"java": {
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		charQuotes:   true,
+		decls: []declRule{
+			{re: rx(`^\s*` + javaMods + `(?P<kind>class|interface|enum|record)\s+(?P<name>\w+)`)},
+			{re: rx(`^\s*` + javaMods + `(?:<[^>]+>\s+)?[\w.$]+(?:<[^()]*>)?(?:\[\])*\s+(?P<name>\w+)\s*\(`), kind: "method", member: true},
+			{re: rx(`^\s*` + javaMods + `(?P<name>[A-Z]\w*)\s*\(`), kind: "method", member: true},
+		},
+		imports:  []*regexp.Regexp{rx(`^\s*import\s+(?:static\s+)?(?P<path>[\w.]+(?:\.\*)?)\s*;`)},
+		pkg:      rx(`^\s*package\s+([\w.]+)\s*;`),
+		attrs:    []string{"@"},
+		keywords: toSet(commonKeywords + " this"),
+	},
+	"kotlin": {
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		charQuotes:   true,
+		decls: []declRule{
+			{re: rx(`^\s*` + kotlinMod + `(?P<kind>class|interface|object)\s+(?P<name>\w+)`), bodyless: true},
+			{re: rx(`^\s*` + kotlinMod + `fun\s+(?:<[^>]+>\s*)?(?:[\w.<>?]+\.)?(?P<name>\w+)\s*\(`), kind: "function", bodyless: true},
+		},
+		imports:  []*regexp.Regexp{rx(`^\s*import\s+(?P<path>[\w.]+(?:\.\*)?)(?:\s+as\s+(?P<name>\w+))?`)},
+		pkg:      rx(`^\s*package\s+([\w.]+)`),
+		attrs:    []string{"@"},
+		keywords: toSet(commonKeywords + " this"),
+	},
+	"csharp": {
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		charQuotes:   true,
+		decls: []declRule{
+			{re: rx(`^\s*` + csMods + `(?:ref\s+)?(?P<kind>class|interface|struct|enum|record)\s+(?P<name>\w+)`)},
+			{re: rx(`^\s*` + csMods + `[\w.]+(?:<[^()]*>)?(?:\[\])*\??\s+(?P<name>\w+)\s*(?:<[^>]*>)?\s*\(`), kind: "method", member: true},
+			{re: rx(`^\s*` + csMods + `(?P<name>[A-Z]\w*)\s*\(`), kind: "method", member: true},
+		},
+		imports:  []*regexp.Regexp{rx(`^\s*using\s+(?:static\s+)?(?:(?P<name>\w+)\s*=\s*)?(?P<path>[\w.]+)\s*;`)},
+		pkg:      rx(`^\s*namespace\s+([\w.]+)`),
+		attrs:    []string{"["},
+		keywords: toSet(commonKeywords + " this nameof"),
+	},
+	"rust": {
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		charQuotes:   true,
+		decls: []declRule{
+			{re: rx(`^\s*` + rustPub + `(?:(?:const|async|unsafe|default|extern\s*(?:"[^"]*")?)\s+)*fn\s+(?P<name>\w+)`), kind: "function"},
+			{re: rx(`^\s*` + rustPub + `(?P<kind>struct|enum|trait|union)\s+(?P<name>\w+)`), bodyless: true},
+			{re: rx(`^\s*` + rustPub + `type\s+(?P<name>\w+)`), kind: "type", bodyless: true},
+			{re: rx(`^\s*(?:unsafe\s+)?impl(?:\s*<[^{]*?>)?\s+(?:[!\w:<>, ]+?\s+for\s+)?(?P<name>\w+)`), kind: "impl"},
+		},
+		imports: []*regexp.Regexp{
+			rx(`^\s*(?:pub(?:\s*\([^)]*\))?\s+)?use\s+(?P<path>[\w:]+)(?:\s+as\s+(?P<name>\w+))?`),
+			rx(`^\s*extern\s+crate\s+(?P<path>\w+)(?:\s+as\s+(?P<name>\w+))?`),
+		},
+		attrs:    []string{"#["},
+		keywords: toSet(commonKeywords + " loop Some None Ok Err"),
+	},
+	"php": {
+		lineComments: []string{"//", "#"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		decls: []declRule{
+			{re: rx(`^\s*(?:(?:abstract|final|readonly)\s+)*(?P<kind>class|interface|trait|enum)\s+(?P<name>\w+)`)},
+			{re: rx(`^\s*(?:(?:public|private|protected|static|abstract|final)\s+)*function\s+&?\s*(?P<name>\w+)\s*\(`), kind: "function"},
+		},
+		imports: []*regexp.Regexp{
+			rx(`^\s*use\s+(?P<path>[\w\\]+)(?:\s+as\s+(?P<name>\w+))?\s*;`),
+			rx(`^\s*(?:require|include)(?:_once)?\s*\(?\s*['"](?P<path>[^'"]+)['"]`),
+		},
+		pkg:      rx(`^\s*namespace\s+([\w\\]+)`),
+		keywords: toSet(commonKeywords + " array isset unset empty list echo"),
+	},
+}
+
+// ParseCode outlines a source file in one of the languages the extractor
+// knows, named as in the registry. It returns nil for languages it only
+// indexes as text.
+func ParseCode(language, path, src string) *Code {
+	if language == "go" {
+		return ParseGo(path, src)
+	}
+	l, ok := sourceLangs[language]
+	if !ok {
+		return nil
+	}
+	return l.parse(language, path, src)
+}
+
+// scanner holds a file being outlined: its lines and a copy with
+// comments and string contents blanked out, so patterns only see code.
+type scanner struct {
+	*sourceLang
+	lines   []string
+	masked  []string
+	maskSrc string
+	offsets []int
+	braces  map[int]int
+}
+
+func (l *sourceLang) parse(language, path, src string) *Code {
+	maskSrc := l.mask(src)
+	sc := &scanner{
+		sourceLang: l,
+		lines:      strings.Split(src, "\n"),
+		masked:     strings.Split(maskSrc, "\n"),
+		maskSrc:    maskSrc,
+		braces:     matchBraces(maskSrc),
+	}
+	sc.offsets = make([]int, len(sc.masked)+1)
+	for n, line := range sc.masked {
+		sc.offsets[n+1] = sc.offsets[n] + len(line) + 1
+	}
+
+	c := &Code{Language: language, Package: moduleName(path)}
+	pkgSeen := false
+	for n, line := range sc.lines {
+		if strings.TrimSpace(sc.masked[n]) == "" {
+			continue
+		}
+		if l.pkg != nil && !pkgSeen {
+			if m := l.pkg.FindStringSubmatch(line); m != nil {
+				c.Package, pkgSeen = m[1], true
+			}
+		}
+		for _, pattern := range l.imports {
+			if m := pattern.FindStringSubmatch(line); m != nil {
+				c.Imports = append(c.Imports, importsOf(pattern, m)...)
+				break
+			}
+		}
+	}
+
+	// open holds the symbols whose bodies enclose the current line.
+	type open struct {
+		sym *Symbol
+		end int
+	}
+	var stack []open
+	for n := 0; n < len(sc.masked) && len(c.Symbols) < maxSymbols; n++ {
+		for len(stack) > 0 && stack[len(stack)-1].end <= n {
+			stack = stack[:len(stack)-1]
+		}
+		var parent *Symbol
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1].sym
+			if !containerKinds[parent.Kind] {
+				continue
+			}
+		}
+		sym, end := sc.declaration(n, parent)
+		if sym == nil {
+			continue
+		}
+		c.Symbols = append(c.Symbols, *sym)
+		if end > n+1 {
+			stack = append(stack, open{sym, end})
+		}
+	}
+	return c
+}
+
+// declaration matches a declaration on line n, returning it and the
+// index of the line after its body.
+func (sc *scanner) declaration(n int, parent *Symbol) (*Symbol, int) {
+	line := sc.masked[n]
+	for _, rule := range sc.decls {
+		if rule.member && parent == nil {
+			continue
+		}
+		m := rule.re.FindStringSubmatchIndex(line)
+		if m == nil {
+			continue
+		}
+		name := group(rule.re, line, m, "name")
+		kind := rule.kind
+		if k := group(rule.re, line, m, "kind"); k != "" {
+			kind = k
+		}
+		if controlWords[name] {
+			continue
+		}
+
+		from := sc.offsets[n] + m[1]
+		if c := line[m[1]-1]; c == '(' || c == '{' {
+			from--
+		}
+		bodyStart, bodyEnd, ok := sc.extent(n, from)
+		if !ok && !rule.bodyless {
+			return nil, 0
+		}
+		if bodyEnd < 0 {
+			bodyEnd = len(sc.maskSrc)
+		}
+		endLine := sc.lineAt(bodyEnd)
+
+		sym := &Symbol{Name: strings.ReplaceAll(name, "::", "."), Kind: kind, Line: n + 1, EndLine: endLine + 1}
+		if i := strings.LastIndexByte(sym.Name, '.'); i >= 0 {
+			sym.Parent = sym.Name[:i]
+		}
+		if parent != nil {
+			sym.Parent = parent.Name
+			sym.Name = parent.Name + "." + sym.Name
+		}
+		if sym.Parent != "" && (sym.Kind == "function" || sym.Kind == "method") {
+			sym.Kind = "method"
+		}
+		sym.Signature = signature(sc.lines[n:endLine+1], bodyStart-sc.offsets[n])
+		sym.Start, sym.Doc = sc.docComment(n)
+		if sc.indented && ok {
+			if doc := sc.docstring(sc.lineAt(bodyStart-1), endLine); doc != "" {
+				sym.Doc = doc
+			}
+		}
+		if !containerKinds[sym.Kind] {
+			if !ok {
+				bodyStart = from
+			}
+			sc.calls(sym, bodyStart, bodyEnd)
+		}
+		return sym, endLine + 1
+	}
+	return nil, 0
+}
+
+// extent finds the body of a declaration whose header continues at
+// offset from in line n. It returns the offsets where the body starts
+// and ends and whether there is one; a declaration without a body ends
+// at its semicolon or last line.
+func (sc *scanner) extent(n, from int) (start, end int, ok bool) {
+	if sc.indented {
+		return sc.indentExtent(n, from)
+	}
+	src := sc.maskSrc
+	depth := 0
+	for i := from; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case '{':
+			if depth <= 0 {
+				if close, found := sc.braces[i]; found {
+					return i, close, true
+				}
+				return i, -1, true
+			}
+		case ';':
+			if depth <= 0 {
+				return i, i, false
+			}
+		case '\n':
+			if depth <= 0 && !sc.continues(sc.lineAt(i)) {
+				return i, i, false
+			}
+		}
+	}
+	return len(src), len(src), false
+}
+
+var (
+	continuedBy  = []string{",", "(", "=>", "->", ":", "=", "&&", "||", "extends", "implements"}
+	continuation = []string{"{", "throws", "where", ":", "->", "=>", "extends", "implements", "const", "noexcept", "override", "requires", "."}
+)
+
+// continues reports whether a declaration header goes on past line n,
+// as in a brace on the next line or a base class list.
+func (sc *scanner) continues(n int) bool {
+	cur := strings.TrimSpace(sc.masked[n])
+	for _, suffix := range continuedBy {
+		if strings.HasSuffix(cur, suffix) {
+			return true
+		}
+	}
+	for k := n + 1; k < len(sc.masked) && k <= n+20; k++ {
+		next := strings.TrimSpace(sc.masked[k])
+		if next == "" {
+			continue
+		}
+		for _, prefix := range continuation {
+			if strings.HasPrefix(next, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// indentExtent finds an indented body: from the colon ending the header
+// to the last line indented deeper than the declaration.
+func (sc *scanner) indentExtent(n, from int) (start, end int, ok bool) {
+	src := sc.maskSrc
+	depth := 0
+	colon := -1
+	for i := from; i < len(src) && colon < 0; i++ {
+		switch src[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ':':
+			if depth <= 0 {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return len(src), len(src), false
+	}
+	header := sc.lineAt(colon)
+	if strings.TrimSpace(src[colon+1:sc.offsets[header+1]-1]) != "" {
+		return colon + 1, sc.offsets[header+1] - 1, true
+	}
+	indent := indentOf(sc.lines[n])
+	last := header
+	for k := header + 1; k < len(sc.masked); k++ {
+		if strings.TrimSpace(sc.masked[k]) == "" {
+			continue
+		}
+		if indentOf(sc.lines[k]) <= indent {
+			break
+		}
+		last = k
+	}
+	return colon + 1, sc.offsets[last+1] - 1, true
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// lineAt returns the index of the line holding offset i.
+func (sc *scanner) lineAt(i int) int {
+	lo, hi := 0, len(sc.masked)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if sc.offsets[mid] <= i {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// docComment collects the comment lines above line n, skipping
+// annotations, and returns the first line they start on.
+func (sc *scanner) docComment(n int) (int, string) {
+	start := n
+	var doc []string
+	for k := n - 1; k >= 0; k-- {
+		trimmed := strings.TrimSpace(sc.lines[k])
+		if sc.isAttr(trimmed) {
+			start = k
+			continue
+		}
+		if sc.blockComment[1] != "" && strings.HasSuffix(trimmed, sc.blockComment[1]) {
+			j := k
+			for j > 0 && !strings.Contains(sc.lines[j], sc.blockComment[0]) {
+				j--
+			}
+			block := make([]string, 0, k-j+1)
+			for _, line := range sc.lines[j : k+1] {
+				block = append(block, cleanComment(line, sc.blockComment))
+			}
+			doc = append(block, doc...)
+			start, k = j, j
+			continue
+		}
+		isComment := false
+		for _, prefix := range sc.lineComments {
+			if strings.HasPrefix(trimmed, prefix) {
+				isComment = true
+			}
+		}
+		if !isComment {
+			break
+		}
+		doc = append([]string{cleanComment(trimmed, sc.blockComment, sc.lineComments...)}, doc...)
+		start = k
+	}
+	return start + 1, strings.TrimSpace(strings.Join(doc, "\n"))
+}
+
+func (sc *scanner) isAttr(trimmed string) bool {
+	for _, prefix := range sc.attrs {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanComment strips comment markers from a line.
+func cleanComment(line string, block [2]string, prefixes ...string) string {
+	line = strings.TrimSpace(line)
+	if block[0] != "" {
+		line = strings.TrimPrefix(line, block[0])
+		line = strings.TrimSuffix(line, block[1])
+		line = strings.TrimLeft(line, "*!")
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(line, prefix) {
+			line = strings.TrimLeft(strings.TrimPrefix(line, prefix), "/!#")
+			break
+		}
+	}
+	return strings.TrimSpace(line)
+}
+
+// docstring returns the string literal opening a body that starts
+// after line n, if there is one.
+func (sc *scanner) docstring(n, end int) string {
+	for k := n + 1; k <= end && k < len(sc.lines); k++ {
+		line := sc.lines[k]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m := pyDocstring.FindStringSubmatchIndex(line)
+		if m == nil {
+			return ""
+		}
+		quote := line[m[2]:m[3]]
+		rest := strings.Join(sc.lines[k:end+1], "\n")[m[1]:]
+		close := strings.Index(rest, quote)
+		if close < 0 {
+			return ""
+		}
+		var doc []string
+		for _, l := range strings.Split(rest[:close], "\n") {
+			doc = append(doc, strings.TrimSpace(l))
+		}
+		return strings.TrimSpace(strings.Join(doc, "\n"))
+	}
+	return ""
+}
+
+// signature renders the declaration's header, up to its body, on one
+// line.
+func signature(lines []string, bodyStart int) string {
+	text := strings.Join(lines, "\n")
+	if bodyStart >= 0 && bodyStart < len(text) {
+		text = text[:bodyStart]
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	text = strings.TrimRight(text, " {:;=")
+	if len(text) > 200 {
+		text = text[:200] + "…"
+	}
+	return text
+}
+
+// calls records the calls between offsets from and to.
+func (sc *scanner) calls(sym *Symbol, from, to int) {
+	if from >= to || from >= len(sc.maskSrc) {
+		return
+	}
+	to = min(to, len(sc.maskSrc))
+	body := sc.maskSrc[from:to]
+	for _, m := range callPattern.FindAllStringIndex(body, -1) {
+		name := strings.TrimRight(body[m[0]:m[1]-1], " \t\r\n")
+		parts := callSeparator.Split(name, -1)
+		if len(parts) == 1 && sc.keywords[name] {
+			continue
+		}
+		before := strings.TrimRight(body[:m[0]], " \t\r\n")
+		if w := prevWord.FindStringSubmatch(before); w != nil && declWords[w[1]] {
+			// A nested declaration, such as "function helper(".
+			continue
+		}
+		for _, sep := range []string{".", "->", "::", "?."} {
+			if strings.HasSuffix(before, sep) {
+				parts = parts[len(parts)-1:]
+				parts[0] = "." + parts[0]
+				break
+			}
+		}
+		if len(parts) > 1 && sym.Parent != "" {
+			switch parts[0] {
+			case "this", "self", "$this", "Self", "static":
+				parts[0] = sym.Parent
+			}
+		}
+		sym.addCall(strings.Join(parts, "."))
+	}
+}
+
+// group returns a named submatch, or "".
+func group(re *regexp.Regexp, s string, m []int, name string) string {
+	i := re.SubexpIndex(name)
+	if i < 0 || m[2*i] < 0 {
+		return ""
+	}
+	return s[m[2*i]:m[2*i+1]]
+}
+
+// importsOf reads the imports of a matched import line.
+func importsOf(re *regexp.Regexp, m []string) []Import {
+	name := ""
+	if i := re.SubexpIndex("name"); i >= 0 {
+		name = m[i]
+	}
+	var imports []Import
+	for _, path := range strings.Split(m[re.SubexpIndex("path")], ",") {
+		imp := Import{Path: strings.TrimSpace(path), Name: name}
+		if p, alias, ok := strings.Cut(imp.Path, " as "); ok {
+			imp.Path, imp.Name = strings.TrimSpace(p), strings.TrimSpace(alias)
+		}
+		imp.Path = strings.TrimRight(imp.Path, ":")
+		if imp.Path != "" {
+			imports = append(imports, imp)
+		}
+	}
+	return imports
+}
+
+// matchBraces pairs each opening brace with its closing one.
+func matchBraces(src string) map[int]int {
+	pairs := map[int]int{}
+	var stack []int
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '{':
+			stack = append(stack, i)
+		case '}':
+			if len(stack) > 0 {
+				pairs[stack[len(stack)-1]] = i
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return pairs
+}
+
+// mask blanks out comments and the contents of string literals,
+// keeping line breaks so offsets and line numbers still match.
+func (l *sourceLang) mask(src string) string {
+	out := []byte(src)
+	blank := func(from, to int) {
+		for k := from; k < to && k < len(out); k++ {
+			if out[k] != '\n' {
+				out[k] = ' '
+			}
+		}
+	}
+	i := 0
+next:
+	for i < len(src) {
+		for _, prefix := range l.lineComments {
+			if strings.HasPrefix(src[i:], prefix) {
+				end := strings.IndexByte(src[i:], '\n')
+				if end < 0 {
+					end = len(src) - i
+				}
+				blank(i, i+end)
+				i += end
+				continue next
+			}
+		}
+		if open := l.blockComment[0]; open != "" && strings.HasPrefix(src[i:], open) {
+			end := strings.Index(src[i+len(open):], l.blockComment[1])
+			if end < 0 {
+				end = len(src)
+			} else {
+				end = i + len(open) + end + len(l.blockComment[1])
+			}
+			blank(i, end)
+			i = end
+			continue
+		}
+		c := src[i]
+		if strings.IndexByte(l.quotes, c) < 0 {
+			i++
+			continue
+		}
+		if l.tripleQuotes && strings.HasPrefix(src[i:], strings.Repeat(string(c), 3)) {
+			end := strings.Index(src[i+3:], src[i:i+3])
+			if end < 0 {
+				end = len(src) - i - 3
+			}
+			blank(i+3, i+3+end)
+			i += end + 6
+			continue
+		}
+		if c == '\'' && l.charQuotes {
+			end := -1
+			switch {
+			case i+1 < len(src) && src[i+1] == '\\':
+				if k := strings.IndexByte(src[i+2:], '\''); k >= 0 && k < 10 {
+					end = i + 2 + k
+				}
+			case i+2 < len(src) && src[i+2] == '\'':
+				end = i + 2
+			}
+			if end < 0 {
+				i++
+				continue
+			}
+			blank(i+1, end)
+			i = end + 1
+			continue
+		}
+		j := i + 1
+		for j < len(src) && src[j] != c && (src[j] != '\n' || c == '`') {
+			if src[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		blank(i+1, j)
+		i = j + 1
+	}
+	return string(out)
+}
@@ -0,0 +1,198 @@
+package extractor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGo(t *testing.T) {
+	src := `package store
+
+import (
+	"fmt"
+	bs "mindy/internal/blob"
+)
+
+// Limit caps results.
+const Limit = 10
+
+// Store keeps things.
+type Store struct {
+	blobs bs.BlobStore
+}
+
+// Get returns a thing.
+func (s *Store) Get(key string) (string, error) {
+	if err := s.check(key); err != nil {
+		return "", fmt.Errorf("get: %w", err)
+	}
+	return s.blobs.Get(key), nil
+}
+
+func (s *Store) check(key string) error { return validate(len(key)) }
+
+func validate(n int) error {
+	return nil
+}
+`
+	c := ParseGo("store.go", src)
+	if c == nil {
+		t.Fatal("ParseGo() = nil")
+	}
+	if c.Package != "store" || !reflect.DeepEqual(c.Imports, []Import{{Path: "fmt"}, {Path: "mindy/internal/blob", Name: "bs"}}) {
+		t.Errorf("Package = %q, Imports = %v", c.Package, c.Imports)
+	}
+	var names []string
+	for _, sym := range c.Symbols {
+		names = append(names, sym.Kind+" "+sym.Name)
+	}
+	want := []string{"const Limit", "struct Store", "method Store.Get", "method Store.check", "function validate"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("Symbols = %q, want %q", names, want)
+	}
+	get := c.Symbols[2]
+	if get.Doc != "Get returns a thing." || get.Signature != "func (s *Store) Get(key string) (string, error)" || get.Start != 16 || get.Line != 17 || get.EndLine != 22 {
+		t.Errorf("Get = %+v", get)
+	}
+	if want := []string{"Store.check", "fmt.Errorf", "s.blobs.Get"}; !reflect.DeepEqual(get.Calls, want) {
+		t.Errorf("Get calls = %q, want %q", get.Calls, want)
+	}
+	if want := []string{"validate"}; !reflect.DeepEqual(c.Symbols[3].Calls, want) {
+		t.Errorf("check calls = %q, want %q", c.Symbols[3].Calls, want)
+	}
+
+	var headings []string
+	for _, sec := range c.Structure(src).Sections() {
+		headings = append(headings, strings.Join(sec.Breadcrumb, "/"))
+	}
+	if want := []string{"", "Store", "Store.Get", "Store.check", "validate"}; !reflect.DeepEqual(headings, want) {
+		t.Errorf("sections = %q, want %q", headings, want)
+	}
+
+	if ParseGo("broken.go", "not go at all") != nil {
+		t.Error("ParseGo(garbage) != nil")
+	}
+}
+
+func TestParseCode(t *testing.T) {
+	tests := []struct {
+		lang, path, src string
+		imports         []Import
+		symbols         []string
+		calls           map[string][]string
+		docs            map[string]string
+	}{
+		{
+			lang: "python", path: "pkg/store.py",
+			src: "import os, sys as system\nfrom .util import helper\n\n" +
+				"# Not a doc: a blank line follows.\n\n" +
+				"@dataclass\nclass Store(Base):\n    \"\"\"Keeps things.\"\"\"\n\n" +
+				"    def get(self, key):\n        \"\"\"Returns a thing.\n\n        Or None.\"\"\"\n" +
+				"        if check(key):\n            return self.load(key)\n        def inner():\n            pass\n\n" +
+				"    async def load(self, key): return system.exit(os.getpid())\n\n" +
+				"def check(k):\n    return \"def fake(\" in k\n",
+			imports: []Import{{Path: "os"}, {Path: "sys", Name: "system"}, {Path: ".util"}},
+			symbols: []string{"class Store", "method Store.get", "method Store.load", "function check"},
+			calls:   map[string][]string{"Store.get": {"check", "Store.load"}, "Store.load": {"system.exit", "os.getpid"}},
+			docs:    map[string]string{"Store": "Keeps things.", "Store.get": "Returns a thing.\n\nOr None."},
+		},
+		{
+			lang: "typescript", path: "shapes.ts",
+			src: "import * as util from './util';\nimport {\n  a,\n} from \"./ab\";\n\n" +
+				"/**\n * Adds numbers.\n */\nexport function add(a: number, b: number): number {\n  return util.sum(a, b);\n}\n\n" +
+				"export const twice = (n: number) => add(n, n);\n\n" +
+				"export class Circle extends Base {\n  constructor(private r: number) {\n    super(r);\n  }\n\n" +
+				"  area(): number {\n    return Math.PI * this.square(this.r); // area()\n  }\n}\n\n" +
+				"type ID = string | number;\n",
+			imports: []Import{{Path: "./util", Name: "util"}, {Path: "./ab"}},
+			symbols: []string{"function add", "function twice", "class Circle", "method Circle.constructor", "method Circle.area", "type ID"},
+			calls:   map[string][]string{"add": {"util.sum"}, "twice": {"add"}, "Circle.area": {"Circle.square"}},
+			docs:    map[string]string{"add": "Adds numbers."},
+		},
+		{
+			lang: "rust", path: "point.rs",
+			src: "use std::fmt;\n\n/// A point.\n#[derive(Debug)]\npub struct Point<'a> {\n    x: &'a str,\n}\n\n" +
+				"impl<'a> Point<'a> {\n    pub fn new(x: &'a str) -> Self {\n        let c = '{';\n        Self::check(x);\n        Point { x }\n    }\n\n" +
+				"    fn check(x: &str) -> bool;\n}\n\nfn main() {\n    println!(\"{}\", Point::new(\"a\").x);\n}\n",
+			imports: []Import{{Path: "std::fmt"}},
+			symbols: []string{"struct Point", "impl Point", "method Point.new", "function main"},
+			calls:   map[string][]string{"Point.new": {"Point.check"}, "main": {"Point.new"}},
+			docs:    map[string]string{"Point": "A point."},
+		},
+		{
+			lang: "java", path: "App.java",
+			src: "package com.example;\n\nimport java.util.List;\n\n/** The app. */\npublic class App {\n" +
+				"    private final List<String> items = new ArrayList<>();\n\n" +
+				"    @Override\n    public void run(String[] args) throws IOException {\n        process(args[0]);\n    }\n\n" +
+				"    private static List<String> process(String a) {\n        return List.of(a);\n    }\n}\n",
+			imports: []Import{{Path: "java.util.List"}},
+			symbols: []string{"class App", "method App.run", "method App.process"},
+			calls:   map[string][]string{"App.run": {"process"}, "App.process": {"List.of"}},
+			docs:    map[string]string{"App": "The app."},
+		},
+		{
+			lang: "c", path: "count.c",
+			src: "#include <stdio.h>\n\n/* Counts\n * letters. */\nstatic int count(const char *s)\n{\n    return isalpha(*s);\n}\n\n" +
+				"int proto(int x);\n\nint main(void) {\n    printf(\"%d\\n\", count(\"}\"));\n}\n",
+			imports: []Import{{Path: "stdio.h"}},
+			symbols: []string{"function count", "function main"},
+			calls:   map[string][]string{"main": {"printf", "count"}},
+			docs:    map[string]string{"count": "Counts\nletters."},
+		},
+	}
+	for _, tt := range tests {
+		c := ParseCode(tt.lang, tt.path, tt.src)
+		if c == nil {
+			t.Errorf("%s: ParseCode() = nil", tt.lang)
+			continue
+		}
+		if !reflect.DeepEqual(c.Imports, tt.imports) {
+			t.Errorf("%s: Imports = %v, want %v", tt.lang, c.Imports, tt.imports)
+		}
+		var names []string
+		byName := map[string]Symbol{}
+		for _, sym := range c.Symbols {
+			names = append(names, sym.Kind+" "+sym.Name)
+			if _, ok := byName[sym.Name]; !ok {
+				byName[sym.Name] = sym
+			}
+		}
+		if !reflect.DeepEqual(names, tt.symbols) {
+			t.Errorf("%s: Symbols = %q, want %q", tt.lang, names, tt.symbols)
+		}
+		for name, calls := range tt.calls {
+			if got := byName[name].Calls; !reflect.DeepEqual(got, calls) {
+				t.Errorf("%s: %s calls = %q, want %q", tt.lang, name, got, calls)
+			}
+		}
+		for name, doc := range tt.docs {
+			if got := byName[name].Doc; got != doc {
+				t.Errorf("%s: %s doc = %q, want %q", tt.lang, name, got, doc)
+			}
+		}
+	}
+}
+
+func TestCodeDocument(t *testing.T) {
+	src := "class Greeter:\n    def hello(self):\n        return 'hi'\n\n    def bye(self):\n        return 'bye'\n"
+	doc, err := New().ExtractDocument("greet.py", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Text != src || doc.Code == nil || doc.Props["language"] != "python" || doc.Props["package"] != "greet" || doc.Props["symbols"] != 3 {
+		t.Errorf("ExtractDocument() = %+v", doc)
+	}
+	var crumbs []string
+	for _, sec := range doc.Structure.Sections() {
+		crumbs = append(crumbs, strings.Join(sec.Breadcrumb, "/"))
+	}
+	if want := []string{"Greeter", "Greeter/hello", "Greeter/bye"}; !reflect.DeepEqual(crumbs, want) {
+		t.Errorf("sections = %q, want %q", crumbs, want)
+	}
+
+	doc, err = New().ExtractDocument("run.sh", []byte("#!/bin/sh\necho hi\n"))
+	if err != nil || doc.Code != nil || doc.Props["language"] != "shell" {
+		t.Errorf("ExtractDocument(shell) = %+v, %v", doc, err)
+	}
+}
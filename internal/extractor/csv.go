@@ -0,0 +1,287 @@
+package extractor
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sampling of large delimited files: the first maxCSVColumns columns are
+// kept, and of the rows the first csvHeadRows plus up to csvSampleRows
+// evenly spaced through the rest.
+const (
+	maxCSVColumns = 64
+	csvHeadRows   = 1000
+	csvSampleRows = 1000
+)
+
+// csvDelimiters are the separators detected, preferred in this order.
+var csvDelimiters = []rune{',', '\t', ';'}
+
+// CSVOptions configure how delimited files are indexed.
+type CSVOptions struct {
+	// Rows indexes each row of a file with a header as "header: value"
+	// lines, one paragraph per row, instead of as a table.
+	Rows bool
+}
+
+var csvOptions struct {
+	sync.RWMutex
+	opts CSVOptions
+}
+
+// SetCSVOptions sets the options for CSV and TSV files extracted from now
+// on.
+func SetCSVOptions(opts CSVOptions) {
+	csvOptions.Lock()
+	defer csvOptions.Unlock()
+	csvOptions.opts = opts
+}
+
+func currentCSVOptions() CSVOptions {
+	csvOptions.RLock()
+	defer csvOptions.RUnlock()
+	return csvOptions.opts
+}
+
+// Table is the content of a delimited file.
+type Table struct {
+	Delimiter rune
+	// Header is the first row when it names the columns, else nil.
+	Header []string
+	// Rows are the data rows read, or a sample of them if Sampled.
+	Rows [][]string
+	// TotalRows counts the non-empty data rows, Columns the fields of the
+	// widest row.
+	TotalRows, Columns int
+	Sampled            bool
+}
+
+// ParseCSV reads comma-, tab- or semicolon-separated text, whichever
+// delimiter the first lines agree on. Quoted fields may hold delimiters
+// and line breaks; whitespace inside a field is collapsed.
+func ParseCSV(text string) (*Table, error) {
+	t := &Table{Delimiter: detectDelimiter(text)}
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = t.Delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	// Trimming leading space would swallow empty fields between tabs.
+	r.TrimLeadingSpace = t.Delimiter != '\t'
+
+	var first []string
+	var tail [][]string
+	stride, skipped := 1, 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := csvRow(record)
+		if row == nil {
+			continue
+		}
+		t.Columns = max(t.Columns, len(record))
+		if len(row) > maxCSVColumns {
+			row = row[:maxCSVColumns]
+			t.Sampled = true
+		}
+		if first == nil {
+			first = row
+			continue
+		}
+		t.TotalRows++
+		if len(t.Rows) < csvHeadRows {
+			t.Rows = append(t.Rows, row)
+			continue
+		}
+		// The rest is sampled every stride rows; when the sample fills
+		// up, every other row is dropped and the stride doubled.
+		if skipped%stride == 0 {
+			tail = append(tail, row)
+			if len(tail) > csvSampleRows {
+				for n := range (len(tail) + 1) / 2 {
+					tail[n] = tail[2*n]
+				}
+				tail = tail[:(len(tail)+1)/2]
+				stride *= 2
+			}
+		}
+		skipped++
+	}
+	if first == nil {
+		return t, nil
+	}
+	if len(tail) < skipped {
+		t.Sampled = true
+	}
+	t.Rows = append(t.Rows, tail...)
+	if csvHeader(first) {
+		t.Header = first
+	} else {
+		t.Rows = append([][]string{first}, t.Rows...)
+		t.TotalRows++
+	}
+	return t, nil
+}
+
+// csvRow tidies a record's fields, or returns nil if all are empty.
+func csvRow(record []string) []string {
+	row := make([]string, len(record))
+	empty := true
+	for n, field := range record {
+		row[n] = strings.Join(strings.Fields(field), " ")
+		empty = empty && row[n] == ""
+	}
+	if empty {
+		return nil
+	}
+	return row
+}
+
+// csvHeader guesses whether the first row names the columns: all of its
+// fields are filled in, distinct and not numbers.
+func csvHeader(row []string) bool {
+	seen := map[string]bool{}
+	for _, field := range row {
+		key := strings.ToLower(field)
+		if field == "" || seen[key] {
+			return false
+		}
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(field, ",", ""), 64); err == nil {
+			return false
+		}
+		seen[key] = true
+	}
+	return true
+}
+
+// detectDelimiter picks the delimiter that splits the first lines into
+// the same number of fields most consistently, favouring more fields on
+// a tie. Delimiters inside quotes are not counted.
+func detectDelimiter(text string) rune {
+	sample := text[:min(len(text), 64<<10)]
+	best, bestScore := csvDelimiters[0], 0
+	for _, d := range csvDelimiters {
+		counts := delimiterCounts(sample, d, 20)
+		if len(sample) < len(text) && len(counts) > 1 {
+			counts = counts[:len(counts)-1]
+		}
+		if len(counts) == 0 || counts[0] == 0 {
+			continue
+		}
+		agree := 0
+		for _, c := range counts {
+			if c == counts[0] {
+				agree++
+			}
+		}
+		if score := agree*1000 + min(counts[0], 999); score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+	return best
+}
+
+// delimiterCounts counts d outside quotes on each of the first lines of
+// text, skipping blank lines.
+func delimiterCounts(text string, d rune, lines int) []int {
+	var counts []int
+	count, quoted, blank := 0, false, true
+	for _, c := range text {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\n' && !quoted:
+			if !blank {
+				counts = append(counts, count)
+				if len(counts) == lines {
+					return counts
+				}
+			}
+			count, blank = 0, true
+			continue
+		case c == d && !quoted:
+			count++
+		}
+		if c != '\r' && c != ' ' {
+			blank = false
+		}
+	}
+	if !blank {
+		counts = append(counts, count)
+	}
+	return counts
+}
+
+// Structure presents the table as one table block, header first, or with
+// rows set and a header present, each row as a paragraph of
+// "header: value" lines.
+func (t *Table) Structure(rows bool) *Structure {
+	s := &Structure{}
+	if rows && t.Header != nil {
+		for _, row := range t.Rows {
+			var lines []string
+			for n, field := range row {
+				if field != "" && n < len(t.Header) {
+					lines = append(lines, t.Header[n]+": "+field)
+				}
+			}
+			if len(lines) > 0 {
+				s.Blocks = append(s.Blocks, Block{Kind: BlockParagraph, Text: strings.Join(lines, "\n")})
+			}
+		}
+		return s
+	}
+	table := t.Rows
+	if t.Header != nil {
+		table = append([][]string{t.Header}, t.Rows...)
+	}
+	if len(table) > 0 {
+		s.Blocks = append(s.Blocks, Block{Kind: BlockTable, Rows: table})
+	}
+	return s
+}
+
+// Props returns the delimiter, the column names if there is a header,
+// and the row and column counts.
+func (t *Table) Props() map[string]interface{} {
+	props := map[string]interface{}{
+		"delimiter":    string(t.Delimiter),
+		"rows":         t.TotalRows,
+		"column_count": t.Columns,
+	}
+	if t.Header != nil {
+		props["columns"] = t.Header
+	}
+	if t.Sampled {
+		props["sampled"] = true
+	}
+	return props
+}
+
+// csvDocument extracts a delimited file as configured by SetCSVOptions.
+func csvDocument(content []byte) (*Document, error) {
+	text, props := decodedText(content)
+	t, err := ParseCSV(text)
+	if err != nil {
+		return nil, err
+	}
+	if props == nil {
+		props = map[string]interface{}{}
+	}
+	for k, v := range t.Props() {
+		props[k] = v
+	}
+	return structuredDocument(t.Structure(currentCSVOptions().Rows), props), nil
+}
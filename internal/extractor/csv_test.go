@@ -0,0 +1,138 @@
+package extractor
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		delimiter rune
+		header    []string
+		rows      [][]string
+	}{
+		{
+			name:      "quoted",
+			text:      "name,note\r\nAda,\"Loves maths, engines\"\r\n\"Bob\",\"Line one\nline two\"\r\n\r\n",
+			delimiter: ',',
+			header:    []string{"name", "note"},
+			rows:      [][]string{{"Ada", "Loves maths, engines"}, {"Bob", "Line one line two"}},
+		},
+		{
+			name:      "tab",
+			text:      "id\tcity\tnote\n1\tParis\t\n2\t\tsemi; colon",
+			delimiter: '\t',
+			header:    []string{"id", "city", "note"},
+			rows:      [][]string{{"1", "Paris", ""}, {"2", "", "semi; colon"}},
+		},
+		{
+			name:      "semicolon",
+			text:      "product;price\nTea;3,50\nCake;4,20\n",
+			delimiter: ';',
+			header:    []string{"product", "price"},
+			rows:      [][]string{{"Tea", "3,50"}, {"Cake", "4,20"}},
+		},
+		{
+			name:      "no header",
+			text:      "2024,10.5\n2025,11\n",
+			delimiter: ',',
+			rows:      [][]string{{"2024", "10.5"}, {"2025", "11"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := ParseCSV(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if table.Delimiter != tt.delimiter {
+				t.Errorf("delimiter = %q, want %q", table.Delimiter, tt.delimiter)
+			}
+			if !reflect.DeepEqual(table.Header, tt.header) {
+				t.Errorf("header = %q, want %q", table.Header, tt.header)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.rows) || table.TotalRows != len(tt.rows) || table.Sampled {
+				t.Errorf("rows = %q (%d, sampled %v), want %q", table.Rows, table.TotalRows, table.Sampled, tt.rows)
+			}
+		})
+	}
+}
+
+func TestParseCSV_Sampling(t *testing.T) {
+	var b strings.Builder
+	for c := 0; c < maxCSVColumns+10; c++ {
+		fmt.Fprintf(&b, "col%d,", c)
+	}
+	b.WriteString("last\n")
+	total := csvHeadRows + 10*csvSampleRows
+	for r := 0; r < total; r++ {
+		fmt.Fprintf(&b, "%d%s\n", r, strings.Repeat(",x", maxCSVColumns+10))
+	}
+
+	table, err := ParseCSV(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.TotalRows != total || table.Columns != maxCSVColumns+11 || !table.Sampled {
+		t.Fatalf("rows = %d, columns = %d, sampled = %v", table.TotalRows, table.Columns, table.Sampled)
+	}
+	if len(table.Header) != maxCSVColumns || len(table.Rows[0]) != maxCSVColumns {
+		t.Errorf("kept %d columns", len(table.Header))
+	}
+	n := len(table.Rows)
+	if n <= csvHeadRows || n > csvHeadRows+csvSampleRows {
+		t.Fatalf("kept %d rows", n)
+	}
+	if table.Rows[csvHeadRows-1][0] != fmt.Sprint(csvHeadRows-1) {
+		t.Errorf("head ends at row %s", table.Rows[csvHeadRows-1][0])
+	}
+	// The sample is evenly spaced and reaches into the last part of the
+	// file.
+	stride := atoi(table.Rows[csvHeadRows+1][0]) - atoi(table.Rows[csvHeadRows][0])
+	for k := csvHeadRows + 1; k < n; k++ {
+		if atoi(table.Rows[k][0])-atoi(table.Rows[k-1][0]) != stride {
+			t.Fatalf("uneven sample at %d: %s after %s", k, table.Rows[k][0], table.Rows[k-1][0])
+		}
+	}
+	if last := atoi(table.Rows[n-1][0]); last < total-stride {
+		t.Errorf("sample stops at row %d of %d", last, total)
+	}
+}
+
+func atoi(s string) int {
+	var n int
+	fmt.Sscan(s, &n)
+	return n
+}
+
+func TestCSVDocument(t *testing.T) {
+	content := []byte("name,email\nAda Lovelace,ada@example.com\nBob,\n")
+
+	doc, err := New().ExtractDocument("people.csv", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name | email\nAda Lovelace | ada@example.com\nBob | "; doc.Text != want {
+		t.Errorf("text = %q, want %q", doc.Text, want)
+	}
+	if !reflect.DeepEqual(doc.Props["columns"], []string{"name", "email"}) || doc.Props["rows"] != 2 || doc.Props["delimiter"] != "," {
+		t.Errorf("props = %v", doc.Props)
+	}
+
+	SetCSVOptions(CSVOptions{Rows: true})
+	defer SetCSVOptions(CSVOptions{})
+	doc, err = New().ExtractDocument("people.csv", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "name: Ada Lovelace\nemail: ada@example.com\n\nname: Bob"; doc.Text != want {
+		t.Errorf("row text = %q, want %q", doc.Text, want)
+	}
+	if len(doc.Structure.Blocks) != 2 {
+		t.Errorf("blocks = %+v", doc.Structure.Blocks)
+	}
+}
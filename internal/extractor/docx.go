@@ -0,0 +1,286 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxOOXMLPart caps the decompressed size of a single part read from an
+// Office document.
+const maxOOXMLPart = 64 << 20
+
+// readZipPart returns the named member of a zip archive, or nil if it is
+// missing.
+func readZipPart(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxOOXMLPart+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxOOXMLPart {
+			return nil, fmt.Errorf("%s is larger than %d bytes", name, maxOOXMLPart)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// docxStyles maps style IDs to their lower-cased names, such as
+// "Heading1" to "heading 1", and records outline levels set by styles.
+type docxStyles struct {
+	names   map[string]string
+	outline map[string]int
+}
+
+func parseDOCXStyles(data []byte) docxStyles {
+	st := docxStyles{names: map[string]string{}, outline: map[string]int{}}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	id := ""
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return st
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			switch se.Name.Local {
+			case "style":
+				id = xmlAttr(se, "styleId")
+			case "name":
+				if id != "" {
+					st.names[id] = strings.ToLower(xmlAttr(se, "val"))
+				}
+			case "outlineLvl":
+				if lvl, err := strconv.Atoi(xmlAttr(se, "val")); err == nil && id != "" {
+					st.outline[id] = lvl + 1
+				}
+			}
+		}
+	}
+}
+
+func xmlAttr(se xml.StartElement, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// headingLevel returns the heading level of a paragraph style, or 0.
+// Styles are matched by name, which stays English in localised Word,
+// and by outline level.
+func (st docxStyles) headingLevel(id string) int {
+	name := st.names[id]
+	if name == "" {
+		name = strings.ToLower(id)
+	}
+	if name == "title" {
+		return 1
+	}
+	if n, ok := strings.CutPrefix(strings.ReplaceAll(name, " ", ""), "heading"); ok {
+		if level, err := strconv.Atoi(n); err == nil && level > 0 {
+			return min(level, 6)
+		}
+	}
+	if level := st.outline[id]; level > 0 && level <= 9 {
+		return min(level, 6)
+	}
+	return 0
+}
+
+func (st docxStyles) isCode(id string) bool {
+	name := st.names[id]
+	if name == "" {
+		name = strings.ToLower(id)
+	}
+	return strings.Contains(name, "code") || strings.Contains(name, "preformatted") || strings.Contains(name, "source")
+}
+
+func (st docxStyles) isList(id string) bool {
+	name := st.names[id]
+	if name == "" {
+		name = strings.ToLower(id)
+	}
+	return strings.HasPrefix(name, "list")
+}
+
+// ParseDOCX builds the document model of a Word document from its
+// paragraph styles: Title and Heading 1-6 become headings, numbered and
+// list-styled paragraphs lists, code-styled paragraphs code blocks, and
+// tables keep their cells. Block offsets are into word/document.xml.
+func ParseDOCX(content []byte) (*Structure, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	body, err := readZipPart(zr, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, fmt.Errorf("word/document.xml not found")
+	}
+	stylesXML, err := readZipPart(zr, "word/styles.xml")
+	if err != nil {
+		return nil, err
+	}
+	styles := parseDOCXStyles(stylesXML)
+
+	s := &Structure{}
+	d := xml.NewDecoder(bytes.NewReader(body))
+	var (
+		text       strings.Builder
+		inText     bool
+		style      string
+		numbered   bool
+		outline    int
+		paraStart  int
+		paraDepth  int
+		tableDepth int
+		table      *Block
+		row        []string
+		cell       []string
+	)
+	for {
+		offset := int(d.InputOffset())
+		tok, err := d.Token()
+		if err != nil {
+			// Keep what was read before a damaged part.
+			if err != io.EOF && len(s.Blocks) == 0 {
+				return nil, err
+			}
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				// Text boxes nest paragraphs inside a paragraph's runs.
+				paraDepth++
+				if paraDepth == 1 {
+					text.Reset()
+					style, numbered, outline = "", false, 0
+					paraStart = offset
+				}
+			case "pStyle":
+				style = xmlAttr(t, "val")
+			case "numPr":
+				numbered = true
+			case "outlineLvl":
+				if lvl, err := strconv.Atoi(xmlAttr(t, "val")); err == nil {
+					outline = lvl + 1
+				}
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br", "cr":
+				text.WriteByte('\n')
+			case "tbl":
+				tableDepth++
+				if tableDepth == 1 {
+					table = &Block{Kind: BlockTable, Offset: offset}
+				}
+			case "tr":
+				if tableDepth == 1 {
+					row = nil
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cell = nil
+				}
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			end := int(d.InputOffset())
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				paraDepth--
+				if paraDepth > 0 {
+					text.WriteByte('\n')
+					continue
+				}
+				para := strings.TrimRight(text.String(), " \t\n")
+				if tableDepth > 0 {
+					if para != "" {
+						cell = append(cell, strings.TrimSpace(para))
+					}
+					continue
+				}
+				level := styles.headingLevel(style)
+				if outline > 0 && outline <= 6 && level == 0 {
+					level = outline
+				}
+				last := len(s.Blocks) - 1
+				switch {
+				case level > 0 && strings.TrimSpace(para) != "":
+					para = strings.Join(strings.Fields(para), " ")
+					if strings.EqualFold(styles.names[style], "title") || strings.EqualFold(style, "title") {
+						if s.Title == "" {
+							s.Title = para
+						}
+					}
+					s.Blocks = append(s.Blocks, Block{Kind: BlockHeading, Level: level, Text: para, Offset: paraStart, End: end})
+				case style != "" && styles.isCode(style):
+					if last >= 0 && s.Blocks[last].Kind == BlockCode {
+						s.Blocks[last].Text += "\n" + para
+						s.Blocks[last].End = end
+					} else if para != "" {
+						s.Blocks = append(s.Blocks, Block{Kind: BlockCode, Text: para, Offset: paraStart, End: end})
+					}
+				case strings.TrimSpace(para) == "":
+				case numbered || styles.isList(style):
+					if last >= 0 && s.Blocks[last].Kind == BlockList {
+						s.Blocks[last].Items = append(s.Blocks[last].Items, strings.TrimSpace(para))
+						s.Blocks[last].End = end
+					} else {
+						s.Blocks = append(s.Blocks, Block{Kind: BlockList, Items: []string{strings.TrimSpace(para)}, Offset: paraStart, End: end})
+					}
+				default:
+					s.Blocks = append(s.Blocks, Block{Kind: BlockParagraph, Text: strings.TrimSpace(para), Offset: paraStart, End: end})
+				}
+			case "tc":
+				if tableDepth == 1 {
+					row = append(row, strings.Join(cell, " "))
+				}
+			case "tr":
+				if tableDepth == 1 && len(row) > 0 {
+					table.Rows = append(table.Rows, row)
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 {
+					if len(table.Rows) > 0 {
+						table.End = end
+						s.Blocks = append(s.Blocks, *table)
+					}
+					table = nil
+				}
+			}
+		}
+	}
+
+	if s.Title == "" {
+		s.Title = titleFromHeadings(s.Blocks)
+	}
+	return s, nil
+}
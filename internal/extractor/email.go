@@ -0,0 +1,488 @@
+package extractor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMIMEDepth caps the nesting of multipart bodies, and maxMIMEPart the
+// decoded size of a single part.
+const (
+	maxMIMEDepth = 16
+	maxMIMEPart  = 32 << 20
+)
+
+// Email is a parsed RFC 5322 message.
+type Email struct {
+	From, To, Cc, Bcc []*mail.Address
+	Subject           string
+	Date              time.Time
+	// MessageID, InReplyTo and References hold message IDs without their
+	// angle brackets.
+	MessageID  string
+	InReplyTo  string
+	References []string
+	// Attachments are the file names of parts that are not body text.
+	Attachments []string
+	// Body holds the message text: its text/plain parts, or its HTML
+	// parts if it has no plain ones.
+	Body  []Block
+	Links []Link
+}
+
+// ThreadID identifies the conversation a message belongs to: the first
+// message it references, or its own ID if it starts one.
+func (e *Email) ThreadID() string {
+	switch {
+	case len(e.References) > 0:
+		return e.References[0]
+	case e.InReplyTo != "":
+		return e.InReplyTo
+	}
+	return e.MessageID
+}
+
+// Parent returns the ID of the message this one replies to.
+func (e *Email) Parent() string {
+	if e.InReplyTo != "" {
+		return e.InReplyTo
+	}
+	if len(e.References) > 0 {
+		return e.References[len(e.References)-1]
+	}
+	return ""
+}
+
+// Structure presents the message as a heading of its subject, a
+// paragraph of its address headers and date, and the body.
+func (e *Email) Structure() *Structure {
+	s := &Structure{Title: e.Subject}
+	if e.Subject != "" {
+		s.Blocks = append(s.Blocks, Block{Kind: BlockHeading, Level: 1, Text: e.Subject})
+	}
+	var head []string
+	for _, h := range []struct {
+		name  string
+		addrs []*mail.Address
+	}{{"From", e.From}, {"To", e.To}, {"Cc", e.Cc}} {
+		if len(h.addrs) > 0 {
+			head = append(head, h.name+": "+formatAddresses(h.addrs))
+		}
+	}
+	if !e.Date.IsZero() {
+		head = append(head, "Date: "+e.Date.Format(time.RFC1123Z))
+	}
+	if len(e.Attachments) > 0 {
+		head = append(head, "Attachments: "+strings.Join(e.Attachments, ", "))
+	}
+	if len(head) > 0 {
+		s.Blocks = append(s.Blocks, Block{Kind: BlockParagraph, Text: strings.Join(head, "\n")})
+	}
+	s.Blocks = append(s.Blocks, e.Body...)
+	return s
+}
+
+// Props returns the envelope as Document node props. Addresses are
+// stored lower-cased, without display names.
+func (e *Email) Props() map[string]interface{} {
+	props := map[string]interface{}{}
+	if e.Subject != "" {
+		props["subject"] = e.Subject
+	}
+	if len(e.From) > 0 {
+		props["author"] = e.From[0].Name
+		if e.From[0].Name == "" {
+			props["author"] = e.From[0].Address
+		}
+	}
+	for key, addrs := range map[string][]*mail.Address{"from": e.From, "to": e.To, "cc": e.Cc, "bcc": e.Bcc} {
+		if len(addrs) > 0 {
+			list := make([]string, len(addrs))
+			for n, a := range addrs {
+				list[n] = strings.ToLower(a.Address)
+			}
+			props[key] = list
+		}
+	}
+	if !e.Date.IsZero() {
+		props["date"] = e.Date.Unix()
+	}
+	for key, val := range map[string]string{"message_id": e.MessageID, "in_reply_to": e.Parent(), "thread_id": e.ThreadID()} {
+		if val != "" {
+			props[key] = val
+		}
+	}
+	if len(e.Attachments) > 0 {
+		props["attachments"] = e.Attachments
+	}
+	return props
+}
+
+func formatAddresses(addrs []*mail.Address) string {
+	list := make([]string, len(addrs))
+	for n, a := range addrs {
+		if a.Name != "" {
+			list[n] = a.Name + " <" + a.Address + ">"
+		} else {
+			list[n] = a.Address
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// headerDecoder decodes RFC 2047 encoded words in any charset
+// DecodeCharset handles.
+var headerDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(DecodeCharset(data, charset)), nil
+	},
+}
+
+// ParseEmail reads an RFC 5322 message and its MIME body, decoding
+// quoted-printable and base64 parts and converting them to UTF-8.
+func ParseEmail(content []byte) (*Email, error) {
+	msg, err := mail.ReadMessage(bufio.NewReader(bytes.NewReader(content)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	h := msg.Header
+	e := &Email{
+		From:       parseAddresses(h.Get("From")),
+		To:         parseAddresses(h.Get("To")),
+		Cc:         parseAddresses(h.Get("Cc")),
+		Bcc:        parseAddresses(h.Get("Bcc")),
+		MessageID:  firstMessageID(h.Get("Message-Id")),
+		InReplyTo:  firstMessageID(h.Get("In-Reply-To")),
+		References: messageIDs(h.Get("References")),
+	}
+	if subject, err := headerDecoder.DecodeHeader(h.Get("Subject")); err == nil {
+		e.Subject = strings.Join(strings.Fields(subject), " ")
+	} else {
+		e.Subject = strings.TrimSpace(h.Get("Subject"))
+	}
+	if date, err := h.Date(); err == nil {
+		e.Date = date
+	}
+
+	parts := e.walk(h.Get("Content-Type"), h.Get("Content-Transfer-Encoding"), h.Get("Content-Disposition"), msg.Body, 0)
+	html := true
+	for _, p := range parts {
+		if !p.html {
+			html = false
+		}
+	}
+	for _, p := range parts {
+		if p.html != html {
+			continue
+		}
+		if p.html {
+			page := ParseHTMLPage(p.text)
+			e.Body = append(e.Body, page.Blocks...)
+			e.Links = append(e.Links, page.Links...)
+		} else {
+			e.Body = append(e.Body, plainBlocks(p.text)...)
+		}
+	}
+	for n := range e.Body {
+		e.Body[n].Offset, e.Body[n].End = 0, 0
+	}
+	return e, nil
+}
+
+type bodyText struct {
+	text string
+	html bool
+}
+
+// walk collects the text parts of a MIME entity. Of the alternatives in
+// multipart/alternative, the plain text one is kept if there is one.
+func (e *Email) walk(contentType, encoding, disposition string, body io.Reader, depth int) []bodyText {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || contentType == "" {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	disp, dispParams, _ := mime.ParseMediaType(disposition)
+	name := dispParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if name != "" {
+		if decoded, err := headerDecoder.DecodeHeader(name); err == nil {
+			name = decoded
+		}
+	}
+	if disp == "attachment" {
+		e.Attachments = append(e.Attachments, attachmentName(name, mediaType))
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if depth >= maxMIMEDepth || params["boundary"] == "" {
+			return nil
+		}
+		var parts []bodyText
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err != nil {
+				break
+			}
+			sub := e.walk(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p.Header.Get("Content-Disposition"), p, depth+1)
+			if mediaType == "multipart/alternative" && len(parts) > 0 {
+				// Keep the first plain text alternative, or else the first.
+				if parts[0].html && len(sub) > 0 && !sub[0].html {
+					parts = sub
+				}
+				continue
+			}
+			parts = append(parts, sub...)
+		}
+		return parts
+	case mediaType == "text/plain" || mediaType == "text/html":
+		data := readMIMEBody(body, encoding)
+		text := strings.TrimSpace(DecodeCharset(data, params["charset"]))
+		if text == "" {
+			return nil
+		}
+		return []bodyText{{text: text, html: mediaType == "text/html"}}
+	}
+	e.Attachments = append(e.Attachments, attachmentName(name, mediaType))
+	return nil
+}
+
+func attachmentName(name, mediaType string) string {
+	if name != "" {
+		return name
+	}
+	return mediaType
+}
+
+// readMIMEBody undoes a part's content transfer encoding. Damaged
+// encodings yield what could be decoded.
+func readMIMEBody(body io.Reader, encoding string) []byte {
+	limited := io.LimitReader(body, maxMIMEPart)
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		data, _ := io.ReadAll(quotedprintable.NewReader(limited))
+		return data
+	case "base64":
+		raw, _ := io.ReadAll(limited)
+		clean := bytes.Map(func(r rune) rune {
+			if r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '+' || r == '/' {
+				return r
+			}
+			return -1
+		}, raw)
+		if len(clean)%4 == 1 {
+			clean = clean[:len(clean)-1]
+		}
+		data := make([]byte, base64.RawStdEncoding.DecodedLen(len(clean)))
+		n, _ := base64.RawStdEncoding.Decode(data, clean)
+		return data[:n]
+	}
+	data, _ := io.ReadAll(limited)
+	return data
+}
+
+// plainBlocks splits plain text into paragraphs at blank lines.
+func plainBlocks(text string) []Block {
+	var blocks []Block
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if para = strings.TrimSpace(para); para != "" {
+			blocks = append(blocks, Block{Kind: BlockParagraph, Text: para})
+		}
+	}
+	return blocks
+}
+
+// parseAddresses reads an address list, skipping entries it cannot
+// parse rather than dropping the whole header.
+func parseAddresses(header string) []*mail.Address {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+	parser := mail.AddressParser{WordDecoder: headerDecoder}
+	if addrs, err := parser.ParseList(header); err == nil {
+		return addrs
+	}
+	var addrs []*mail.Address
+	for _, entry := range splitAddressList(header) {
+		if a, err := parser.Parse(entry); err == nil {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// splitAddressList splits a header at the commas between addresses,
+// leaving those in quoted names and angle brackets alone.
+func splitAddressList(header string) []string {
+	var entries []string
+	quoted, angle, start := false, false, 0
+	for n := 0; n < len(header); n++ {
+		switch c := header[n]; {
+		case c == '\\' && quoted:
+			n++
+		case c == '"':
+			quoted = !quoted
+		case c == '<' && !quoted:
+			angle = true
+		case c == '>' && !quoted:
+			angle = false
+		case c == ',' && !quoted && !angle:
+			entries = append(entries, header[start:n])
+			start = n + 1
+		}
+	}
+	return append(entries, header[start:])
+}
+
+// messageIDs returns the IDs in a Message-ID, In-Reply-To or References
+// header without their angle brackets.
+func messageIDs(header string) []string {
+	var ids []string
+	for {
+		start := strings.IndexByte(header, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(header[start:], '>')
+		if end < 0 {
+			break
+		}
+		if id := strings.TrimSpace(header[start+1 : start+end]); id != "" {
+			ids = append(ids, id)
+		}
+		header = header[start+end+1:]
+	}
+	if len(ids) == 0 {
+		ids = strings.Fields(header)
+	}
+	return ids
+}
+
+func firstMessageID(header string) string {
+	if ids := messageIDs(header); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+// emailDocument extracts a message as a Document.
+func emailDocument(content []byte) (*Document, error) {
+	e, err := ParseEmail(content)
+	if err != nil {
+		return nil, err
+	}
+	doc := structuredDocument(e.Structure(), e.Props())
+	doc.Email = e
+	doc.Links = e.Links
+	return doc, nil
+}
+
+// SplitMbox splits a mailbox file into its messages. Messages start
+// with a "From " line at the start of the file or after a blank line;
+// the line is dropped and ">From " escapes in the body are undone.
+func SplitMbox(content []byte) [][]byte {
+	var msgs [][]byte
+	var cur []byte
+	inMsg, blank := false, true
+	for len(content) > 0 {
+		line := content
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			line = content[:i+1]
+		}
+		content = content[len(line):]
+		if blank && bytes.HasPrefix(line, []byte("From ")) {
+			if inMsg {
+				msgs = append(msgs, cur)
+			}
+			cur, inMsg, blank = nil, true, false
+			continue
+		}
+		blank = len(bytes.TrimRight(line, "\r\n")) == 0
+		if !inMsg {
+			continue
+		}
+		if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+			line = line[1:]
+		}
+		cur = append(cur, line...)
+	}
+	if inMsg {
+		msgs = append(msgs, cur)
+	}
+	return msgs
+}
+
+// mboxDocument extracts a mailbox as a Document whose parts are its
+// messages, named by their position in it. Messages that cannot be
+// parsed are skipped.
+func mboxDocument(content []byte) *Document {
+	doc := &Document{Props: map[string]interface{}{}}
+	for n, msg := range SplitMbox(content) {
+		part, err := emailDocument(msg)
+		if err != nil {
+			continue
+		}
+		doc.Parts = append(doc.Parts, Part{Name: strconv.Itoa(n + 1), Content: msg, Document: part})
+	}
+	doc.Props["messages"] = len(doc.Parts)
+	return doc
+}
+
+// sniffEmail recognises a message by its header block: header fields up
+// to the first blank line, including From and one of Date, Message-ID,
+// Subject or Received.
+func sniffEmail(content []byte) bool {
+	head := content[:min(len(content), 8192)]
+	var from, other bool
+	lines := strings.Split(strings.ReplaceAll(string(head), "\r\n", "\n"), "\n")
+	for n, line := range lines {
+		if line == "" {
+			return n > 0 && from && other
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if n == 0 {
+				return false
+			}
+			continue
+		}
+		name, _, ok := strings.Cut(line, ":")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return false
+		}
+		switch strings.ToLower(name) {
+		case "from":
+			from = true
+		case "date", "message-id", "subject", "received":
+			other = true
+		}
+	}
+	return false
+}
+
+// sniffMbox recognises a mailbox by its leading "From " line followed by
+// a message.
+func sniffMbox(content []byte) bool {
+	if !bytes.HasPrefix(content, []byte("From ")) {
+		return false
+	}
+	i := bytes.IndexByte(content, '\n')
+	return i > 0 && sniffEmail(content[i+1:])
+}
@@ -0,0 +1,105 @@
+package extractor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEmail(t *testing.T) {
+	msg := "From: =?utf-8?q?Jos=C3=A9?= <Jose@Example.com>\r\n" +
+		"To: a@example.com, \"B, Team\" <b@example.com>, not an address\r\n" +
+		"Subject: =?iso-8859-1?q?R=E9sum=E9?= for\r\n review\r\n" +
+		"Date: Tue, 2 Jan 2024 15:04:05 +0100\r\n" +
+		"Message-ID: <m2@example.com>\r\n" +
+		"References: <m0@example.com> <m1@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+		"<p>HTML version</p>\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"Caf=E9 at noon, with a long line that is so=\r\n" +
+		" long it wraps.\r\n\r\nSecond paragraph.\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf; name=\"cv.pdf\"\r\n" +
+		"Content-Disposition: attachment; filename=\"cv.pdf\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"JVBERi0=\r\n" +
+		"--outer--\r\n"
+	e, err := ParseEmail([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != "Résumé for review" || e.From[0].Name != "José" || len(e.To) != 2 || e.To[1].Name != "B, Team" {
+		t.Errorf("envelope = %q from %v to %v", e.Subject, e.From, e.To)
+	}
+	if e.MessageID != "m2@example.com" || e.Parent() != "m1@example.com" || e.ThreadID() != "m0@example.com" {
+		t.Errorf("IDs = %q %q %q", e.MessageID, e.Parent(), e.ThreadID())
+	}
+	want := []Block{
+		{Kind: BlockParagraph, Text: "Café at noon, with a long line that is so long it wraps."},
+		{Kind: BlockParagraph, Text: "Second paragraph."},
+	}
+	if !reflect.DeepEqual(e.Body, want) || !reflect.DeepEqual(e.Attachments, []string{"cv.pdf"}) {
+		t.Errorf("Body = %+v, Attachments = %v", e.Body, e.Attachments)
+	}
+
+	doc, err := New().ExtractDocument("msg.eml", []byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.Text, "Résumé for review\n\nFrom: José <Jose@Example.com>\nTo: a@example.com, B, Team <b@example.com>\nDate: Tue, 02 Jan 2024 15:04:05 +0100\nAttachments: cv.pdf\n\nCafé") {
+		t.Errorf("Text = %q", doc.Text)
+	}
+	if doc.Props["title"] != "Résumé for review" || doc.Props["author"] != "José" || doc.Props["thread_id"] != "m0@example.com" ||
+		!reflect.DeepEqual(doc.Props["to"], []string{"a@example.com", "b@example.com"}) {
+		t.Errorf("Props = %v", doc.Props)
+	}
+}
+
+func TestParseEmail_HTMLFallback(t *testing.T) {
+	msg := "From: news@example.com\nSubject: News\nContent-Type: text/html; charset=utf-8\n" +
+		"Content-Transfer-Encoding: base64\n\n" +
+		"PGgxPkhlYWRsaW5lPC9oMT48cD5SZWFkIDxhIGhyZWY9Imh0dHBzOi8vZXhhbXBsZS5jb20v\nIj5tb3JlPC9hPjwvcD4\n"
+	doc, err := New().ExtractDocument("news.eml", []byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "News\n\nFrom: news@example.com\n\nHeadline\n\nRead more"; doc.Text != want {
+		t.Errorf("Text = %q, want %q", doc.Text, want)
+	}
+	if len(doc.Links) != 1 || doc.Links[0].URL != "https://example.com/" {
+		t.Errorf("Links = %+v", doc.Links)
+	}
+}
+
+func TestSplitMbox(t *testing.T) {
+	mbox := "From a@example.com Mon Jan  1 00:00:00 2024\n" +
+		"From: a@example.com\nSubject: One\n\nHello\n>From here on\n>>From there\nFrom the start\n\n" +
+		"From b@example.com Mon Jan  1 00:00:00 2024\n" +
+		"From: b@example.com\nSubject: Two\n\nBye\n"
+	msgs := SplitMbox([]byte(mbox))
+	if len(msgs) != 2 {
+		t.Fatalf("SplitMbox() = %q", msgs)
+	}
+	if want := "From: a@example.com\nSubject: One\n\nHello\nFrom here on\n>From there\nFrom the start\n\n"; string(msgs[0]) != want {
+		t.Errorf("first message = %q, want %q", msgs[0], want)
+	}
+
+	if f, ok := Detect("Inbox", []byte(mbox)); !ok || f.Name != "mbox" {
+		t.Errorf("Detect(mbox) = %q, %v", f.Name, ok)
+	}
+	if f, ok := Detect("message", msgs[1]); !ok || f.Name != "email" {
+		t.Errorf("Detect(email) = %q, %v", f.Name, ok)
+	}
+	doc, err := New().ExtractDocument("inbox.mbox", []byte(mbox))
+	if err != nil || len(doc.Parts) != 2 || doc.Parts[1].Name != "2" || doc.Parts[1].Document.Email.Subject != "Two" {
+		t.Errorf("ExtractDocument() = %+v, %v", doc, err)
+	}
+}
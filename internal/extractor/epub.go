@@ -0,0 +1,153 @@
+package extractor
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Book is the content of an EPUB: its chapters in reading order.
+type Book struct {
+	Chapters []*HTMLPage
+	Info     DocInfo
+}
+
+// Structure joins the chapters into one document.
+func (bk *Book) Structure() *Structure {
+	s := &Structure{Title: bk.Info.Title}
+	for _, ch := range bk.Chapters {
+		for _, b := range ch.Blocks {
+			b.Offset, b.End = 0, 0
+			s.Blocks = append(s.Blocks, b)
+		}
+	}
+	if s.Title == "" {
+		s.Title = titleFromHeadings(s.Blocks)
+	}
+	return s
+}
+
+// Props returns the book metadata and chapter count.
+func (bk *Book) Props() map[string]interface{} {
+	props := bk.Info.Props()
+	props["chapters"] = len(bk.Chapters)
+	return props
+}
+
+// Links returns the links of the book's chapters that lead out of it;
+// links between chapters are left out.
+func (bk *Book) Links() []Link {
+	var links []Link
+	for _, ch := range bk.Chapters {
+		for _, l := range ch.Links {
+			if strings.HasPrefix(l.URL, "http://") || strings.HasPrefix(l.URL, "https://") || strings.HasPrefix(l.URL, "mailto:") {
+				links = append(links, l)
+			}
+		}
+	}
+	return links
+}
+
+// ParseEPUB reads the chapters of an EPUB 2 or 3 book in spine order.
+// Chapters are XHTML and parsed as HTML pages; chapters the spine marks
+// as non-linear, such as footnote pages, are included too.
+func ParseEPUB(content []byte) (*Book, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	container, err := readZipPart(zr, "META-INF/container.xml")
+	if err != nil {
+		return nil, err
+	}
+	var opfPath string
+	xmlElements(container, func(name string, attrs []xml.Attr, _ string) {
+		if name == "rootfile" && opfPath == "" {
+			for _, a := range attrs {
+				if a.Name.Local == "full-path" {
+					opfPath = a.Value
+				}
+			}
+		}
+	})
+	if opfPath == "" {
+		return nil, fmt.Errorf("no package document in META-INF/container.xml")
+	}
+	opf, err := readZipPart(zr, opfPath)
+	if err != nil {
+		return nil, err
+	}
+	if opf == nil {
+		return nil, fmt.Errorf("%s not found", opfPath)
+	}
+
+	bk := &Book{}
+	manifest := map[string]string{}
+	var spine []string
+	xmlElements(opf, func(name string, attrs []xml.Attr, text string) {
+		attr := func(local string) string {
+			for _, a := range attrs {
+				if a.Name.Local == local {
+					return a.Value
+				}
+			}
+			return ""
+		}
+		switch name {
+		case "title":
+			if bk.Info.Title == "" {
+				bk.Info.Title = text
+			}
+		case "creator":
+			if bk.Info.Author == "" {
+				bk.Info.Author = text
+			}
+		case "subject":
+			if bk.Info.Keywords != "" {
+				text = bk.Info.Keywords + ", " + text
+			}
+			bk.Info.Keywords = text
+		case "description":
+			bk.Info.Description = text
+		case "language":
+			bk.Info.Language = text
+		case "date":
+			// EPUB 2 qualifies dates with opf:event; unqualified ones
+			// are the publication date.
+			if event := attr("event"); event == "" || event == "publication" || event == "creation" {
+				bk.Info.Created = parseW3CDate(text)
+			}
+		case "meta":
+			if attr("property") == "dcterms:modified" {
+				bk.Info.Modified = parseW3CDate(text)
+			}
+		case "item":
+			href := attr("href")
+			if unescaped, err := url.PathUnescape(href); err == nil {
+				href = unescaped
+			}
+			manifest[attr("id")] = path.Join(path.Dir(opfPath), href)
+		case "itemref":
+			spine = append(spine, attr("idref"))
+		}
+	})
+
+	for _, id := range spine {
+		href, ok := manifest[id]
+		if !ok {
+			continue
+		}
+		data, err := readZipPart(zr, href)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		text, _ := DecodeText(data)
+		bk.Chapters = append(bk.Chapters, ParseHTMLPage(text))
+	}
+	return bk, nil
+}
@@ -1,11 +1,7 @@
 package extractor
 
 import (
-	"archive/zip"
-	"bytes"
-	"encoding/xml"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,240 +13,90 @@ func New() *Extractor {
 	return &Extractor{}
 }
 
+// Extract returns the text of a file, using the format registered for
+// its extension or recognised from its content. Unknown formats are
+// treated as plain text, and binary content is rejected with ErrBinary.
 func (e *Extractor) Extract(path string, content []byte) (string, error) {
-	ext := strings.ToLower(filepath.Ext(path))
-	
-	switch ext {
-	case ".pdf":
-		return e.ExtractPDF(content)
-	case ".docx":
-		return e.ExtractDOCX(content)
-	case ".doc":
-		return e.ExtractDOC(content)
-	case ".txt", ".md", ".markdown":
-		return string(content), nil
-	case ".html", ".htm":
-		return e.StripHTML(string(content)), nil
-	case ".json":
-		return string(content), nil
-	case ".xml":
-		return string(content), nil
-	case ".csv":
-		return e.ExtractCSV(content)
-	case ".log":
-		return string(content), nil
-	default:
-		return string(content), nil
-	}
-}
-
-func (e *Extractor) ExtractPDF(content []byte) (string, error) {
-	text := extractPDFText(content)
-	if text == "" {
-		return string(content), nil
+	doc, err := e.ExtractDocument(path, content)
+	if err != nil {
+		return "", err
 	}
-	return text, nil
+	return doc.Text, nil
 }
 
-func extractPDFText(content []byte) string {
-	var text strings.Builder
-	reader := bytes.NewReader(content)
-	
-	buf := make([]byte, 1024)
-	for {
-		n, err := reader.Read(buf)
-		if n == 0 {
-			break
-		}
-		if err != nil && err != io.EOF {
-			break
-		}
-		
-		chunk := string(buf[:n])
-		lines := strings.Split(chunk, "\n")
-		for _, line := range lines {
-			cleaned := cleanPDFLine(line)
-			if len(cleaned) > 2 {
-				text.WriteString(cleaned)
-				text.WriteString("\n")
-			}
-		}
-		
-		if err == io.EOF {
-			break
+// ExtractDocument is Extract plus metadata for the Document node, such as
+// the title and page count of a PDF.
+func (e *Extractor) ExtractDocument(path string, content []byte) (*Document, error) {
+	f, ok := Detect(path, content)
+	if !ok || f.Text {
+		if IsBinary(content) {
+			return nil, ErrBinary
 		}
 	}
-	
-	return text.String()
+	if !ok {
+		text, props := decodedText(content)
+		return &Document{Text: text, Props: props}, nil
+	}
+	if f.Extract == nil {
+		return nil, fmt.Errorf("text extraction from %s files is not supported", f.Name)
+	}
+	doc, err := f.Extract(path, content)
+	if err != nil {
+		return nil, err
+	}
+	// Everything headed for the tokenizer is valid UTF-8.
+	doc.Text = strings.ToValidUTF8(doc.Text, "\uFFFD")
+	return doc, nil
 }
 
-func cleanPDFLine(line string) string {
-	var result strings.Builder
-	for _, c := range line {
-		if c >= 32 && c < 127 {
-			result.WriteRune(c)
-		} else if c == '\n' || c == '\r' || c == '\t' {
-			result.WriteRune(' ')
-		}
+// ExtractPDF returns the text of a PDF with pages separated by PageBreak.
+func (e *Extractor) ExtractPDF(content []byte) (string, error) {
+	doc, err := ParsePDF(content)
+	if err != nil {
+		return "", err
 	}
-	return strings.TrimSpace(result.String())
+	return doc.Text(), nil
 }
 
+// ExtractDOCX returns the text of a Word document, one block per
+// paragraph, list or table.
 func (e *Extractor) ExtractDOCX(content []byte) (string, error) {
-	reader := bytes.NewReader(content)
-	zipReader, err := zip.NewReader(reader, int64(len(content)))
+	s, err := ParseDOCX(content)
 	if err != nil {
-		return string(content), err
-	}
-
-	var text strings.Builder
-	
-	for _, file := range zipReader.File {
-		if file.Name == "word/document.xml" {
-			rc, err := file.Open()
-			if err != nil {
-				continue
-			}
-			defer rc.Close()
-			
-			data, err := io.ReadAll(rc)
-			if err != nil {
-				continue
-			}
-			
-			decoder := xml.NewDecoder(bytes.NewReader(data))
-			inText := false
-			var currentTag string
-			
-			for {
-				token, err := decoder.Token()
-				if err != nil {
-					break
-				}
-				
-				switch t := token.(type) {
-				case xml.StartElement:
-					currentTag = t.Name.Local
-					if currentTag == "t" || currentTag == "p" {
-						inText = true
-					}
-				case xml.EndElement:
-					if t.Name.Local == "p" {
-						text.WriteString("\n")
-					}
-					inText = false
-				case xml.CharData:
-					if inText && currentTag == "t" {
-						text.WriteString(string(t))
-					}
-				}
-			}
-			break
-		}
-	}
-	
-	if text.Len() == 0 {
-		return string(content), nil
+		return "", err
 	}
-	
-	return text.String(), nil
+	return s.Text(), nil
 }
 
 func (e *Extractor) ExtractDOC(content []byte) (string, error) {
 	return string(content), fmt.Errorf("DOC format not fully supported, raw content returned")
 }
 
+// ExtractCSV returns the text of a delimited file as a table, one row per
+// line with fields separated by " | ".
 func (e *Extractor) ExtractCSV(content []byte) (string, error) {
-	lines := strings.Split(string(content), "\n")
-	var text strings.Builder
-	
-	for _, line := range lines {
-		fields := strings.Split(line, ",")
-		for _, field := range fields {
-			cleaned := strings.TrimSpace(field)
-			if len(cleaned) > 0 {
-				text.WriteString(cleaned)
-				text.WriteString(" ")
-			}
-		}
-		text.WriteString("\n")
+	t, err := ParseCSV(string(content))
+	if err != nil {
+		return "", err
 	}
-	
-	return text.String(), nil
+	return t.Structure(false).Text(), nil
 }
 
+// StripHTML returns the text of an HTML document without markup,
+// scripts or styles, with character references decoded.
 func (e *Extractor) StripHTML(html string) string {
-	var buf bytes.Buffer
-	inTag := false
-	for _, c := range html {
-		if c == '<' {
-			inTag = true
-		} else if c == '>' {
-			inTag = false
-		} else if !inTag {
-			buf.WriteRune(c)
-		}
-	}
-	
-	text := buf.String()
-	text = strings.ReplaceAll(text, "\n ", "\n")
-	text = strings.ReplaceAll(text, "  ", " ")
-	
-	return text
+	return ParseHTML(html).Text()
 }
 
 func (e *Extractor) GetContentType(path string) string {
-	ext := strings.ToLower(filepath.Ext(path))
-	
-	switch ext {
-	case ".txt":
-		return "text/plain"
-	case ".md", ".markdown":
-		return "text/markdown"
-	case ".html", ".htm":
-		return "text/html"
-	case ".json":
-		return "application/json"
-	case ".xml":
-		return "application/xml"
-	case ".csv":
-		return "text/csv"
-	case ".pdf":
-		return "application/pdf"
-	case ".docx":
-		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
-	case ".doc":
-		return "application/msword"
-	case ".log":
-		return "text/plain"
-	default:
-		return "application/octet-stream"
+	if f, ok := ForPath(path); ok && len(f.MIMETypes) > 0 {
+		return f.MIMETypes[0]
 	}
+	return "application/octet-stream"
 }
 
 func (e *Extractor) GetFileType(path string) string {
-	ext := strings.ToLower(filepath.Ext(path))
-	
-	switch ext {
-	case ".txt", ".md", ".markdown":
-		return "text"
-	case ".html", ".htm":
-		return "html"
-	case ".json":
-		return "json"
-	case ".xml":
-		return "xml"
-	case ".csv":
-		return "csv"
-	case ".pdf":
-		return "pdf"
-	case ".docx", ".doc":
-		return "word"
-	case ".log":
-		return "log"
-	default:
-		return "unknown"
-	}
+	return GetFileTypeSimple(path)
 }
 
 func ExtractMetadata(path string, content []byte) (map[string]interface{}, error) {
@@ -281,25 +127,8 @@ func ExtractMetadata(path string, content []byte) (map[string]interface{}, error
 }
 
 func GetFileTypeSimple(path string) string {
-	ext := strings.ToLower(filepath.Ext(path))
-	
-	types := map[string]string{
-		".txt":     "text",
-		".md":      "markdown",
-		".markdown": "markdown",
-		".html":    "html",
-		".htm":     "html",
-		".json":    "json",
-		".xml":     "xml",
-		".csv":     "csv",
-		".pdf":     "pdf",
-		".docx":    "word",
-		".doc":     "word",
-		".log":     "log",
-	}
-	
-	if t, ok := types[ext]; ok {
-		return t
+	if f, ok := ForPath(path); ok {
+		return f.Name
 	}
 	return "unknown"
 }
@@ -0,0 +1,262 @@
+package extractor
+
+import (
+	"bytes"
+)
+
+// The built-in formats.
+func init() {
+	e := New()
+	plain := func(path string, content []byte) (*Document, error) {
+		text, props := decodedText(content)
+		return &Document{Text: text, Props: props}, nil
+	}
+
+	// Logs are plain text too; registering them first leaves text/plain
+	// mapped to "text".
+	Register(Format{Name: "log", Extensions: []string{".log"}, MIMETypes: []string{"text/plain"}, Text: true, Extract: plain})
+	Register(Format{Name: "text", Extensions: []string{".txt"}, MIMETypes: []string{"text/plain"}, Text: true, Extract: plain})
+	Register(Format{
+		Name:       "markdown",
+		Extensions: []string{".md", ".markdown"},
+		MIMETypes:  []string{"text/markdown"},
+		Text:       true,
+		Extract: func(path string, content []byte) (*Document, error) {
+			text, props := decodedText(content)
+			return structuredDocument(ParseMarkdown(text), props), nil
+		},
+	})
+	Register(Format{Name: "json", Extensions: []string{".json"}, MIMETypes: []string{"application/json"}, Text: true, Extract: plain})
+	Register(Format{
+		Name:       "xml",
+		Extensions: []string{".xml"},
+		MIMETypes:  []string{"application/xml", "text/xml"},
+		Text:       true,
+		Sniff:      func(content []byte) bool { return bytes.HasPrefix(content, []byte("<?xml")) },
+		Extract:    plain,
+	})
+	Register(Format{
+		Name:       "html",
+		Extensions: []string{".html", ".htm"},
+		MIMETypes:  []string{"text/html"},
+		Text:       true,
+		Sniff:      sniffHTML,
+		Extract: func(path string, content []byte) (*Document, error) {
+			text, props := decodedText(content)
+			page := ParseHTMLPage(text)
+			doc := structuredDocument(page.Structure, props)
+			if doc.Props == nil {
+				doc.Props = map[string]interface{}{}
+			}
+			for k, v := range page.Props() {
+				doc.Props[k] = v
+			}
+			doc.Links = page.Links
+			return doc, nil
+		},
+	})
+	Register(Format{
+		Name:       "csv",
+		Extensions: []string{".csv"},
+		MIMETypes:  []string{"text/csv"},
+		Text:       true,
+		Extract: func(path string, content []byte) (*Document, error) {
+			return csvDocument(content)
+		},
+	})
+	Register(Format{
+		Name:       "tsv",
+		Extensions: []string{".tsv", ".tab"},
+		MIMETypes:  []string{"text/tab-separated-values"},
+		Text:       true,
+		Extract: func(path string, content []byte) (*Document, error) {
+			return csvDocument(content)
+		},
+	})
+	Register(Format{
+		Name:       "pdf",
+		Extensions: []string{".pdf"},
+		MIMETypes:  []string{"application/pdf"},
+		Sniff:      func(content []byte) bool { return bytes.HasPrefix(content, []byte("%PDF-")) },
+		Extract: func(path string, content []byte) (*Document, error) {
+			doc, err := ParsePDF(content)
+			if err != nil {
+				return nil, err
+			}
+			return &Document{Text: doc.Text(), Props: doc.Props()}, nil
+		},
+	})
+	// Archives come before the Office formats, whose sniffers pick out
+	// their zip packages and are tried first.
+	for _, archive := range []struct {
+		name  string
+		exts  []string
+		mime  string
+		sniff func([]byte) bool
+	}{
+		{"zip", []string{".zip"}, "application/zip", func(content []byte) bool {
+			return bytes.HasPrefix(content, []byte("PK\x03\x04")) || bytes.HasPrefix(content, []byte("PK\x05\x06"))
+		}},
+		{"tar", []string{".tar"}, "application/x-tar", sniffTar},
+		{"gzip", []string{".gz", ".tgz"}, "application/gzip", func(content []byte) bool {
+			return bytes.HasPrefix(content, []byte{0x1f, 0x8b})
+		}},
+		{"zstd", []string{".zst", ".tzst"}, "application/zstd", func(content []byte) bool {
+			return bytes.HasPrefix(content, []byte{0x28, 0xb5, 0x2f, 0xfd})
+		}},
+	} {
+		name := archive.name
+		Register(Format{
+			Name:       name,
+			Extensions: archive.exts,
+			MIMETypes:  []string{archive.mime},
+			Sniff:      archive.sniff,
+			Extract: func(path string, content []byte) (*Document, error) {
+				return archiveDocument(e, name, path, content)
+			},
+		})
+	}
+	Register(Format{
+		Name:       "word",
+		Extensions: []string{".docx"},
+		MIMETypes:  []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		Sniff:      func(content []byte) bool { return sniffZip(content, "word/document.xml") },
+		Extract: func(path string, content []byte) (*Document, error) {
+			s, err := ParseDOCX(content)
+			if err != nil {
+				return nil, err
+			}
+			zr, err := openZip(content)
+			if err != nil {
+				return nil, err
+			}
+			info := ooxmlInfo(zr)
+			if s.Title == "" {
+				s.Title = info.Title
+			}
+			return structuredDocument(s, info.Props()), nil
+		},
+	})
+	Register(Format{
+		Name:       "excel",
+		Extensions: []string{".xlsx"},
+		MIMETypes:  []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		Sniff:      func(content []byte) bool { return sniffZip(content, "xl/workbook.xml") },
+		Extract: func(path string, content []byte) (*Document, error) {
+			wb, err := ParseXLSX(content)
+			if err != nil {
+				return nil, err
+			}
+			return structuredDocument(wb.Structure(), wb.Props()), nil
+		},
+	})
+	Register(Format{
+		Name:       "powerpoint",
+		Extensions: []string{".pptx"},
+		MIMETypes:  []string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		Sniff:      func(content []byte) bool { return sniffZip(content, "ppt/presentation.xml") },
+		Extract: func(path string, content []byte) (*Document, error) {
+			p, err := ParsePPTX(content)
+			if err != nil {
+				return nil, err
+			}
+			return structuredDocument(p.Structure(), p.Props()), nil
+		},
+	})
+	for _, odf := range []struct{ name, ext, mime string }{
+		{"odt", ".odt", "application/vnd.oasis.opendocument.text"},
+		{"ods", ".ods", "application/vnd.oasis.opendocument.spreadsheet"},
+		{"odp", ".odp", "application/vnd.oasis.opendocument.presentation"},
+	} {
+		mime := odf.mime
+		Register(Format{
+			Name:       odf.name,
+			Extensions: []string{odf.ext},
+			MIMETypes:  []string{mime},
+			Sniff:      func(content []byte) bool { return sniffODF(content, mime) },
+			Extract: func(path string, content []byte) (*Document, error) {
+				s, info, err := ParseODF(content)
+				if err != nil {
+					return nil, err
+				}
+				return structuredDocument(s, info.Props()), nil
+			},
+		})
+	}
+	Register(Format{
+		Name:       "epub",
+		Extensions: []string{".epub"},
+		MIMETypes:  []string{"application/epub+zip"},
+		Sniff:      func(content []byte) bool { return sniffODF(content, "application/epub+zip") },
+		Extract: func(path string, content []byte) (*Document, error) {
+			bk, err := ParseEPUB(content)
+			if err != nil {
+				return nil, err
+			}
+			doc := structuredDocument(bk.Structure(), bk.Props())
+			doc.Links = bk.Links()
+			return doc, nil
+		},
+	})
+	Register(Format{
+		Name:       "email",
+		Extensions: []string{".eml"},
+		MIMETypes:  []string{"message/rfc822"},
+		Text:       true,
+		Sniff:      sniffEmail,
+		Extract: func(path string, content []byte) (*Document, error) {
+			return emailDocument(content)
+		},
+	})
+	Register(Format{
+		Name:       "mbox",
+		Extensions: []string{".mbox"},
+		MIMETypes:  []string{"application/mbox"},
+		Text:       true,
+		Sniff:      sniffMbox,
+		Extract: func(path string, content []byte) (*Document, error) {
+			return mboxDocument(content), nil
+		},
+	})
+	// Source files are outlined where ParseCode knows the language, and
+	// indexed as text otherwise.
+	for _, lang := range []struct {
+		name  string
+		exts  []string
+		mimes []string
+	}{
+		{"go", []string{".go"}, []string{"text/x-go"}},
+		{"python", []string{".py", ".pyi"}, []string{"text/x-python"}},
+		{"javascript", []string{".js", ".jsx", ".mjs", ".cjs"}, []string{"text/javascript", "application/javascript"}},
+		{"typescript", []string{".ts", ".tsx", ".mts", ".cts"}, []string{"application/typescript"}},
+		{"java", []string{".java"}, []string{"text/x-java"}},
+		{"kotlin", []string{".kt", ".kts"}, []string{"text/x-kotlin"}},
+		{"csharp", []string{".cs"}, []string{"text/x-csharp"}},
+		{"c", []string{".c", ".h"}, []string{"text/x-c"}},
+		{"cpp", []string{".cpp", ".cc", ".cxx", ".hpp", ".hh", ".hxx"}, []string{"text/x-c++"}},
+		{"rust", []string{".rs"}, []string{"text/x-rust"}},
+		{"php", []string{".php"}, []string{"application/x-httpd-php"}},
+		{"ruby", []string{".rb"}, []string{"text/x-ruby"}},
+		{"shell", []string{".sh", ".bash"}, []string{"application/x-sh"}},
+	} {
+		name := lang.name
+		Register(Format{
+			Name:       name,
+			Extensions: lang.exts,
+			MIMETypes:  lang.mimes,
+			Text:       true,
+			Extract: func(path string, content []byte) (*Document, error) {
+				return codeDocument(name, path, content), nil
+			},
+		})
+	}
+	// Legacy .doc files are recognised but not extracted.
+	Register(Format{
+		Name:       "word",
+		Extensions: []string{".doc"},
+		MIMETypes:  []string{"application/msword"},
+		Sniff: func(content []byte) bool {
+			return bytes.HasPrefix(content, []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1})
+		},
+	})
+}
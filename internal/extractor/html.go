@@ -0,0 +1,733 @@
+package extractor
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+type htmlTokenType int
+
+const (
+	htmlText htmlTokenType = iota
+	htmlStartTag
+	htmlEndTag
+)
+
+// htmlToken is a tag or a run of text. Text and attribute values have
+// their character references decoded.
+type htmlToken struct {
+	typ         htmlTokenType
+	name        string
+	attrs       map[string]string
+	text        string
+	selfClosing bool
+	// offset and end delimit the token in the source.
+	offset, end int
+}
+
+// htmlTokenizer splits HTML into tokens. It is forgiving in the way
+// browsers are: a stray "<" is text, comments, doctypes and processing
+// instructions are dropped, and the contents of script and style are
+// returned as undecoded text rather than parsed for tags.
+type htmlTokenizer struct {
+	src string
+	pos int
+	// raw is the element whose text is being read up to its end tag.
+	raw string
+}
+
+func newHTMLTokenizer(src string) *htmlTokenizer {
+	return &htmlTokenizer{src: src}
+}
+
+// rawTextElements hold text that is not parsed for tags. Only textarea
+// and title decode character references.
+var rawTextElements = map[string]bool{"script": true, "style": true, "textarea": true, "title": true, "xmp": true}
+
+func (z *htmlTokenizer) next() (htmlToken, bool) {
+	if z.raw != "" {
+		name := z.raw
+		z.raw = ""
+		start := z.pos
+		end := indexFold(z.src[start:], "</"+name)
+		if end < 0 {
+			z.pos = len(z.src)
+		} else {
+			z.pos = start + end
+		}
+		text := z.src[start:z.pos]
+		if name == "textarea" || name == "title" {
+			text = html.UnescapeString(text)
+		}
+		if text != "" {
+			return htmlToken{typ: htmlText, text: text, offset: start, end: z.pos}, true
+		}
+	}
+
+	for z.pos < len(z.src) {
+		start := z.pos
+		if z.src[start] != '<' {
+			end := start + 1
+			for end < len(z.src) && !(z.src[end] == '<' && z.tagStart(end)) {
+				end++
+			}
+			z.pos = end
+			return htmlToken{typ: htmlText, text: html.UnescapeString(z.src[start:end]), offset: start, end: end}, true
+		}
+		if !z.tagStart(start) {
+			// A "<" that opens nothing is text.
+			end := start + 1
+			for end < len(z.src) && !(z.src[end] == '<' && z.tagStart(end)) {
+				end++
+			}
+			z.pos = end
+			return htmlToken{typ: htmlText, text: html.UnescapeString(z.src[start:end]), offset: start, end: end}, true
+		}
+
+		rest := z.src[start:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			z.pos = skipPast(z.src, start+4, "-->")
+		case strings.HasPrefix(rest, "<![CDATA["):
+			end := strings.Index(rest, "]]>")
+			if end < 0 {
+				end = len(rest)
+				z.pos = len(z.src)
+			} else {
+				z.pos = start + end + 3
+			}
+			if text := rest[9:end]; text != "" {
+				return htmlToken{typ: htmlText, text: text, offset: start, end: z.pos}, true
+			}
+		case rest[1] == '!' || rest[1] == '?':
+			z.pos = skipPast(z.src, start+2, ">")
+		default:
+			return z.tag(), true
+		}
+	}
+	return htmlToken{}, false
+}
+
+// tagStart reports whether the "<" at i opens a tag, end tag, comment
+// or declaration.
+func (z *htmlTokenizer) tagStart(i int) bool {
+	if i+1 >= len(z.src) {
+		return false
+	}
+	c := z.src[i+1]
+	if c == '/' && i+2 < len(z.src) {
+		c = z.src[i+2]
+	} else if c == '!' || c == '?' {
+		return true
+	}
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (z *htmlTokenizer) tag() htmlToken {
+	src := z.src
+	t := htmlToken{typ: htmlStartTag, offset: z.pos}
+	i := z.pos + 1
+	if src[i] == '/' {
+		t.typ = htmlEndTag
+		i++
+	}
+	start := i
+	for i < len(src) && !isHTMLSpace(src[i]) && src[i] != '>' && src[i] != '/' {
+		i++
+	}
+	t.name = strings.ToLower(src[start:i])
+
+	for i < len(src) {
+		for i < len(src) && (isHTMLSpace(src[i]) || src[i] == '/') {
+			if src[i] == '/' && i+1 < len(src) && src[i+1] == '>' {
+				t.selfClosing = true
+			}
+			i++
+		}
+		if i >= len(src) || src[i] == '>' {
+			break
+		}
+		nameStart := i
+		for i < len(src) && !isHTMLSpace(src[i]) && src[i] != '=' && src[i] != '>' && (src[i] != '/' || i == nameStart) {
+			i++
+		}
+		key := strings.ToLower(src[nameStart:i])
+		for i < len(src) && isHTMLSpace(src[i]) {
+			i++
+		}
+		value := ""
+		if i < len(src) && src[i] == '=' {
+			i++
+			for i < len(src) && isHTMLSpace(src[i]) {
+				i++
+			}
+			if i < len(src) && (src[i] == '"' || src[i] == '\'') {
+				q := src[i]
+				end := strings.IndexByte(src[i+1:], q)
+				if end < 0 {
+					end = len(src) - i - 1
+				}
+				value = src[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				vs := i
+				for i < len(src) && !isHTMLSpace(src[i]) && src[i] != '>' {
+					i++
+				}
+				value = src[vs:i]
+			}
+		}
+		if t.typ == htmlStartTag && key != "" {
+			if t.attrs == nil {
+				t.attrs = map[string]string{}
+			}
+			if _, dup := t.attrs[key]; !dup {
+				t.attrs[key] = html.UnescapeString(value)
+			}
+		}
+	}
+	z.pos = min(i+1, len(src))
+	t.end = z.pos
+	if t.typ == htmlStartTag && !t.selfClosing && rawTextElements[t.name] {
+		z.raw = t.name
+	}
+	return t
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func skipPast(s string, from int, marker string) int {
+	if from > len(s) {
+		return len(s)
+	}
+	if i := strings.Index(s[from:], marker); i >= 0 {
+		return from + i + len(marker)
+	}
+	return len(s)
+}
+
+// indexFold is strings.Index ignoring ASCII case.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Elements whose content is not document text.
+var htmlSkipElements = map[string]bool{"script": true, "style": true, "template": true, "noscript": true, "svg": true, "math": true}
+
+// Elements that start a new paragraph.
+var htmlBlockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "header": true, "footer": true,
+	"main": true, "aside": true, "nav": true, "blockquote": true, "figure": true, "figcaption": true,
+	"form": true, "fieldset": true, "address": true, "dl": true, "dt": true, "dd": true, "hr": true,
+	"details": true, "summary": true, "body": true,
+}
+
+// htmlBuilder turns tokens into blocks. Text collects in buf until the
+// enclosing block ends; headings are recognised outside lists and
+// tables, and nested lists and tables are flattened into the outer one.
+type htmlBuilder struct {
+	s     *Structure
+	title strings.Builder
+
+	buf   strings.Builder
+	start int
+
+	skip, heading int
+	inHead        bool
+	inTitle       bool
+
+	list      *Block
+	listDepth int
+
+	table      *Block
+	tableDepth int
+	row        []string
+	inCell     bool
+
+	pre      *Block
+	preDepth int
+
+	page   *HTMLPage
+	base   *url.URL
+	anchor *Link
+	seen   map[string]int
+}
+
+// HTMLPage is an HTML document: its structure plus what the head and
+// links say about it.
+type HTMLPage struct {
+	*Structure
+	// Lang is the lang attribute of the html element.
+	Lang string
+	// Meta maps the name, property or http-equiv of each meta element,
+	// lower-cased, to its content. The first of duplicates wins.
+	Meta map[string]string
+	// Canonical is the href of <link rel="canonical">.
+	Canonical string
+	// Links are the page's hyperlinks in order of first appearance,
+	// resolved against <base href> if the page has one. Fragment-only,
+	// javascript: and data: links are left out.
+	Links []Link
+}
+
+// ParseHTML builds the document model of an HTML page: the title and
+// the headings, paragraphs, lists, tables and preformatted blocks of its
+// body. Scripts, styles and other non-content elements are skipped.
+func ParseHTML(src string) *Structure {
+	return ParseHTMLPage(src).Structure
+}
+
+// ParseHTMLPage is ParseHTML plus the page's language, meta tags and
+// links.
+func ParseHTMLPage(src string) *HTMLPage {
+	b := &htmlBuilder{s: &Structure{}, start: -1, page: &HTMLPage{Meta: map[string]string{}}, seen: map[string]int{}}
+	z := newHTMLTokenizer(src)
+	for {
+		t, ok := z.next()
+		if !ok {
+			break
+		}
+		switch t.typ {
+		case htmlText:
+			b.text(t)
+		case htmlStartTag:
+			b.startTag(t)
+		case htmlEndTag:
+			b.endTag(t)
+		}
+	}
+	b.closeAll(len(src))
+
+	b.endAnchor()
+
+	b.s.Title = strings.Join(strings.Fields(b.title.String()), " ")
+	if b.s.Title == "" {
+		b.s.Title = b.page.Meta["og:title"]
+	}
+	if b.s.Title == "" {
+		b.s.Title = titleFromHeadings(b.s.Blocks)
+	}
+	b.page.Structure = b.s
+	return b.page
+}
+
+func (b *htmlBuilder) text(t htmlToken) {
+	switch {
+	case b.inTitle:
+		b.title.WriteString(t.text)
+	case b.skip > 0 || b.inHead:
+	default:
+		if b.start < 0 && (b.pre != nil || strings.TrimSpace(t.text) != "") {
+			b.start = t.offset
+		}
+		if b.anchor != nil {
+			b.anchor.Text += t.text
+		}
+		if b.pre != nil {
+			b.buf.WriteString(t.text)
+		} else {
+			// Only <br> breaks lines outside <pre>.
+			b.buf.WriteString(strings.ReplaceAll(t.text, "\n", " "))
+		}
+	}
+}
+
+// take returns the buffered text with whitespace collapsed, keeping the
+// line breaks of <br>.
+func (b *htmlBuilder) take() string {
+	lines := strings.Split(b.buf.String(), "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			out = append(out, line)
+		}
+	}
+	b.buf.Reset()
+	return strings.Join(out, "\n")
+}
+
+// inContainer reports whether text belongs to a heading, list, table or
+// preformatted block rather than a paragraph.
+func (b *htmlBuilder) inContainer() bool {
+	return b.heading > 0 || b.list != nil || b.table != nil || b.pre != nil
+}
+
+func (b *htmlBuilder) paragraph(end int) {
+	if b.inContainer() {
+		return
+	}
+	if text := b.take(); text != "" {
+		b.s.Blocks = append(b.s.Blocks, Block{Kind: BlockParagraph, Text: text, Offset: b.start, End: end})
+	}
+	b.start = -1
+}
+
+func (b *htmlBuilder) startTag(t htmlToken) {
+	if htmlSkipElements[t.name] {
+		if !t.selfClosing {
+			b.skip++
+		}
+		return
+	}
+	switch t.name {
+	case "head":
+		b.inHead = true
+	case "body":
+		b.inHead = false
+	case "title":
+		// SVG has titles of its own.
+		b.inTitle = b.skip == 0 && !t.selfClosing
+		return
+	}
+	if b.skip > 0 {
+		return
+	}
+	switch t.name {
+	case "html":
+		b.page.Lang = strings.TrimSpace(t.attrs["lang"])
+	case "meta":
+		b.meta(t.attrs)
+	case "base":
+		if u, err := url.Parse(strings.TrimSpace(t.attrs["href"])); err == nil && b.base == nil && u.IsAbs() {
+			b.base = u
+		}
+	case "link":
+		for _, rel := range strings.Fields(strings.ToLower(t.attrs["rel"])) {
+			if rel == "canonical" && b.page.Canonical == "" {
+				b.page.Canonical = b.resolve(t.attrs["href"])
+			}
+		}
+	case "a", "area":
+		b.endAnchor()
+		if href := b.resolve(t.attrs["href"]); href != "" {
+			b.anchor = &Link{URL: href}
+			if t.name == "area" || t.selfClosing {
+				b.anchor.Text = t.attrs["alt"]
+				b.endAnchor()
+			}
+		}
+	}
+	if b.inHead {
+		return
+	}
+
+	switch name := t.name; {
+	case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6' && b.list == nil && b.table == nil && b.pre == nil:
+		b.paragraph(t.offset)
+		b.heading = int(name[1] - '0')
+		b.start = t.offset
+
+	case name == "ul" || name == "ol":
+		if b.listDepth == 0 && b.table == nil && b.pre == nil {
+			b.paragraph(t.offset)
+			b.list = &Block{Kind: BlockList, Ordered: name == "ol", Offset: t.offset}
+		}
+		b.item()
+		b.listDepth++
+
+	case name == "li":
+		b.item()
+
+	case name == "table":
+		if b.tableDepth == 0 && b.list == nil && b.pre == nil {
+			b.paragraph(t.offset)
+			b.table = &Block{Kind: BlockTable, Offset: t.offset}
+		}
+		b.tableDepth++
+
+	case name == "tr" && b.table != nil && b.tableDepth == 1:
+		b.endRow()
+
+	case (name == "td" || name == "th") && b.table != nil && b.tableDepth == 1:
+		b.endCell()
+		b.inCell = true
+
+	case name == "pre":
+		if b.preDepth == 0 && !b.inContainer() {
+			b.paragraph(t.offset)
+			b.pre = &Block{Kind: BlockCode, Offset: t.offset, Lang: codeLang(t.attrs["class"])}
+			b.start = t.offset
+		}
+		b.preDepth++
+
+	case name == "code" && b.pre != nil && b.pre.Lang == "":
+		b.pre.Lang = codeLang(t.attrs["class"])
+
+	case name == "br":
+		b.buf.WriteByte('\n')
+
+	case name == "img" && t.attrs["alt"] != "":
+		b.buf.WriteString(" " + t.attrs["alt"] + " ")
+		if b.anchor != nil {
+			b.anchor.Text += " " + t.attrs["alt"]
+		}
+
+	case htmlBlockElements[name]:
+		b.paragraph(t.offset)
+		if b.inContainer() {
+			b.buf.WriteByte(' ')
+		}
+
+	case name == "td" || name == "th" || name == "tr":
+		b.buf.WriteByte(' ')
+	}
+}
+
+func (b *htmlBuilder) endTag(t htmlToken) {
+	if htmlSkipElements[t.name] {
+		if b.skip > 0 {
+			b.skip--
+		}
+		return
+	}
+	switch t.name {
+	case "head":
+		b.inHead = false
+		return
+	case "title":
+		b.inTitle = false
+		return
+	case "a":
+		b.endAnchor()
+	}
+	if b.skip > 0 || b.inHead {
+		return
+	}
+
+	switch name := t.name; {
+	case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6' && b.heading > 0:
+		b.endHeading(t.end)
+
+	case name == "li":
+		b.item()
+
+	case name == "ul" || name == "ol":
+		if b.listDepth > 0 {
+			b.listDepth--
+			if b.listDepth == 0 && b.list != nil {
+				b.endList(t.end)
+			}
+		}
+
+	case (name == "td" || name == "th") && b.tableDepth == 1:
+		b.endCell()
+
+	case name == "tr" && b.tableDepth == 1:
+		b.endRow()
+
+	case name == "table":
+		if b.tableDepth > 0 {
+			b.tableDepth--
+			if b.tableDepth == 0 && b.table != nil {
+				b.endTable(t.end)
+			}
+		}
+
+	case name == "pre":
+		if b.preDepth > 0 {
+			b.preDepth--
+			if b.preDepth == 0 && b.pre != nil {
+				b.endPre(t.end)
+			}
+		}
+
+	case htmlBlockElements[name]:
+		b.paragraph(t.end)
+		if b.inContainer() {
+			b.buf.WriteByte(' ')
+		}
+	}
+}
+
+func (b *htmlBuilder) endHeading(end int) {
+	if text := strings.Join(strings.Fields(b.take()), " "); text != "" {
+		b.s.Blocks = append(b.s.Blocks, Block{Kind: BlockHeading, Level: b.heading, Text: text, Offset: b.start, End: end})
+	}
+	b.heading = 0
+	b.start = -1
+}
+
+// item ends the current list item, if there is text for one.
+func (b *htmlBuilder) item() {
+	if b.list == nil {
+		return
+	}
+	if text := strings.Join(strings.Fields(b.take()), " "); text != "" {
+		b.list.Items = append(b.list.Items, text)
+	}
+}
+
+func (b *htmlBuilder) endList(end int) {
+	b.item()
+	if len(b.list.Items) > 0 {
+		b.list.End = end
+		b.s.Blocks = append(b.s.Blocks, *b.list)
+	}
+	b.list = nil
+	b.start = -1
+}
+
+func (b *htmlBuilder) endCell() {
+	if b.inCell || b.buf.Len() > 0 {
+		b.row = append(b.row, strings.Join(strings.Fields(b.take()), " "))
+	}
+	b.inCell = false
+}
+
+func (b *htmlBuilder) endRow() {
+	b.endCell()
+	if len(b.row) > 0 {
+		b.table.Rows = append(b.table.Rows, b.row)
+	}
+	b.row = nil
+}
+
+func (b *htmlBuilder) endTable(end int) {
+	b.endRow()
+	if len(b.table.Rows) > 0 {
+		b.table.End = end
+		b.s.Blocks = append(b.s.Blocks, *b.table)
+	}
+	b.table = nil
+	b.start = -1
+}
+
+func (b *htmlBuilder) endPre(end int) {
+	text := strings.TrimRight(strings.TrimPrefix(b.buf.String(), "\n"), " \t\r\n")
+	b.buf.Reset()
+	if text != "" {
+		b.pre.Text = text
+		b.pre.End = end
+		b.s.Blocks = append(b.s.Blocks, *b.pre)
+	}
+	b.pre = nil
+	b.start = -1
+}
+
+// closeAll ends whatever is still open at the end of the document.
+func (b *htmlBuilder) closeAll(end int) {
+	if b.pre != nil {
+		b.endPre(end)
+	}
+	if b.heading > 0 {
+		b.endHeading(end)
+	}
+	if b.table != nil {
+		b.endTable(end)
+	}
+	if b.list != nil {
+		b.endList(end)
+	}
+	b.paragraph(end)
+}
+
+// Props returns the metadata stored on the page's Document node: the
+// title, the description, keywords and author meta tags (falling back to
+// their Open Graph and Dublin Core forms), the language and the
+// canonical URL.
+func (p *HTMLPage) Props() map[string]interface{} {
+	props := map[string]interface{}{}
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := p.Meta[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	canonical := p.Canonical
+	if canonical == "" {
+		canonical = p.Meta["og:url"]
+	}
+	for key, val := range map[string]string{
+		"title":         p.Title,
+		"description":   first("description", "og:description", "dc.description"),
+		"keywords":      first("keywords", "dc.subject"),
+		"author":        first("author", "dc.creator", "article:author"),
+		"language":      p.Lang,
+		"canonical_url": canonical,
+	} {
+		if val != "" {
+			props[key] = val
+		}
+	}
+	return props
+}
+
+// meta records a meta element under its name, property or http-equiv.
+func (b *htmlBuilder) meta(attrs map[string]string) {
+	key := attrs["name"]
+	if key == "" {
+		key = attrs["property"]
+	}
+	if key == "" {
+		key = attrs["http-equiv"]
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	content := strings.TrimSpace(attrs["content"])
+	if key == "" || content == "" {
+		return
+	}
+	if _, dup := b.page.Meta[key]; !dup {
+		b.page.Meta[key] = content
+	}
+}
+
+// resolve cleans up an href and resolves it against the page's base.
+// It returns "" for links that lead nowhere else.
+func (b *htmlBuilder) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	lower := strings.ToLower(href)
+	if href == "" || href[0] == '#' || strings.HasPrefix(lower, "javascript:") || strings.HasPrefix(lower, "data:") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if b.base != nil {
+		u = b.base.ResolveReference(u)
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// endAnchor adds the open link, merging it with an earlier link to the
+// same URL.
+func (b *htmlBuilder) endAnchor() {
+	if b.anchor == nil {
+		return
+	}
+	link := *b.anchor
+	b.anchor = nil
+	link.Text = strings.Join(strings.Fields(link.Text), " ")
+	if n, ok := b.seen[link.URL]; ok {
+		if b.page.Links[n].Text == "" {
+			b.page.Links[n].Text = link.Text
+		}
+		return
+	}
+	b.seen[link.URL] = len(b.page.Links)
+	b.page.Links = append(b.page.Links, link)
+}
+
+// codeLang reads the language from a class such as "language-go".
+func codeLang(class string) string {
+	for _, c := range strings.Fields(class) {
+		if lang, ok := strings.CutPrefix(c, "language-"); ok {
+			return lang
+		}
+		if lang, ok := strings.CutPrefix(c, "lang-"); ok {
+			return lang
+		}
+	}
+	return ""
+}
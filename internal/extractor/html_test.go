@@ -0,0 +1,50 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHTMLPage(t *testing.T) {
+	src := `<html lang="en-GB"><head>
+<base href="https://example.com/docs/">
+<meta charset="utf-8"><meta name="Description" content=" Caf&eacute; guide ">
+<meta property="og:title" content="OG title"><meta name="keywords" content="coffee, tea">
+<link rel="canonical" href="/cafe"></head>
+<body><a href="menu.html#drinks">The <b>menu</b></a> <a href="#top">top</a>
+<a href="javascript:void(0)">js</a> <a href="menu.html">again</a>
+<a href='https://other.org/?a=1&amp;b=2'><img src="x.png" alt="Other"></a>
+<map><area href="/map" alt="Map"></map></body></html>`
+	page := ParseHTMLPage(src)
+
+	if page.Lang != "en-GB" || page.Meta["description"] != "Café guide" || page.Meta["og:title"] != "OG title" {
+		t.Errorf("page = lang %q meta %q", page.Lang, page.Meta)
+	}
+	if page.Title != "OG title" || page.Canonical != "https://example.com/cafe" {
+		t.Errorf("Title = %q, Canonical = %q", page.Title, page.Canonical)
+	}
+	want := []Link{
+		{URL: "https://example.com/docs/menu.html", Text: "The menu"},
+		{URL: "https://other.org/?a=1&b=2", Text: "Other"},
+		{URL: "https://example.com/map", Text: "Map"},
+	}
+	if !reflect.DeepEqual(page.Links, want) {
+		t.Errorf("Links = %+v, want %+v", page.Links, want)
+	}
+	props := page.Props()
+	if props["keywords"] != "coffee, tea" || props["language"] != "en-GB" || props["canonical_url"] != "https://example.com/cafe" {
+		t.Errorf("Props() = %v", props)
+	}
+
+	doc, err := New().ExtractDocument("cafe.html", []byte(src))
+	if err != nil || len(doc.Links) != 3 || doc.Props["description"] != "Café guide" {
+		t.Errorf("ExtractDocument() = %+v, %v", doc, err)
+	}
+}
+
+func TestStripHTML_Entities(t *testing.T) {
+	got := New().StripHTML(`<style>b{}</style><p>Tom &amp; Jerry&nbsp;&#8212; &lt;cats&gt;</p><script>alert(1)</script>`)
+	if got != "Tom & Jerry — <cats>" {
+		t.Errorf("StripHTML() = %q", got)
+	}
+}
@@ -0,0 +1,279 @@
+package extractor
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	mdListItem  = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])(\s+|$)`)
+	mdTableRule = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	mdBreak     = regexp.MustCompile(`^ {0,3}[-*_]\s*[-*_]\s*[-*_][-*_\s]*$`)
+)
+
+// mdLine is a source line and its byte offset.
+type mdLine struct {
+	text   string
+	offset int
+}
+
+// ParseMarkdown builds the document model of Markdown source: ATX and
+// setext headings, paragraphs, block quotes, lists, pipe tables and
+// fenced or indented code. Inline markup is kept as written. The title
+// comes from YAML front matter or else the first level-1 heading.
+func ParseMarkdown(src string) *Structure {
+	var lines []mdLine
+	for off := 0; off < len(src); {
+		end := strings.IndexByte(src[off:], '\n')
+		if end < 0 {
+			end = len(src) - off
+		}
+		lines = append(lines, mdLine{strings.TrimRight(src[off:off+end], "\r"), off})
+		off += end + 1
+	}
+
+	s := &Structure{}
+	n := 0
+	if len(lines) > 0 && strings.TrimSpace(lines[0].text) == "---" {
+		for end := 1; end < len(lines); end++ {
+			if t := strings.TrimSpace(lines[end].text); t == "---" || t == "..." {
+				for _, l := range lines[1:end] {
+					if v, ok := strings.CutPrefix(l.text, "title:"); ok {
+						s.Title = strings.Trim(strings.TrimSpace(v), `"'`)
+					}
+				}
+				n = end + 1
+				break
+			}
+		}
+	}
+
+	var para []mdLine
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		texts := make([]string, len(para))
+		for k, l := range para {
+			texts[k] = strings.TrimSpace(l.text)
+		}
+		last := para[len(para)-1]
+		s.Blocks = append(s.Blocks, Block{
+			Kind:   BlockParagraph,
+			Text:   strings.Join(texts, "\n"),
+			Offset: para[0].offset,
+			End:    last.offset + len(last.text),
+		})
+		para = nil
+	}
+
+	for n < len(lines) {
+		line := lines[n]
+		trimmed := strings.TrimSpace(line.text)
+		indent := len(line.text) - len(strings.TrimLeft(line.text, " \t"))
+
+		switch {
+		case trimmed == "":
+			flush()
+			n++
+
+		case indent < 4 && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			flush()
+			n = mdFence(s, lines, n)
+
+		case indent < 4 && strings.HasPrefix(trimmed, "#") && mdHeadingLevel(trimmed) > 0:
+			flush()
+			level := mdHeadingLevel(trimmed)
+			text := strings.TrimSpace(trimmed[level:])
+			if t := strings.TrimRight(text, "#"); t == "" || strings.HasSuffix(t, " ") {
+				text = strings.TrimSpace(t)
+			}
+			s.Blocks = append(s.Blocks, Block{Kind: BlockHeading, Level: level, Text: text, Offset: line.offset, End: line.offset + len(line.text)})
+			n++
+
+		case len(para) > 0 && indent < 4 && mdSetext(trimmed) > 0:
+			// The paragraph so far is the heading's text.
+			texts := make([]string, len(para))
+			for k, l := range para {
+				texts[k] = strings.TrimSpace(l.text)
+			}
+			s.Blocks = append(s.Blocks, Block{Kind: BlockHeading, Level: mdSetext(trimmed), Text: strings.Join(texts, " "), Offset: para[0].offset, End: line.offset + len(line.text)})
+			para = nil
+			n++
+
+		case mdBreak.MatchString(line.text):
+			flush()
+			n++
+
+		case len(para) == 0 && strings.Contains(trimmed, "|") && n+1 < len(lines) && mdTableRule.MatchString(lines[n+1].text) && strings.Contains(lines[n+1].text, "-"):
+			n = mdTable(s, lines, n)
+
+		case indent < 4 && mdListItem.MatchString(line.text):
+			flush()
+			n = mdList(s, lines, n)
+
+		case len(para) == 0 && indent >= 4:
+			n = mdIndentedCode(s, lines, n)
+
+		case strings.HasPrefix(trimmed, ">"):
+			para = append(para, mdLine{strings.TrimLeft(trimmed, "> "), line.offset})
+			n++
+
+		default:
+			para = append(para, line)
+			n++
+		}
+	}
+	flush()
+
+	if s.Title == "" {
+		s.Title = titleFromHeadings(s.Blocks)
+	}
+	return s
+}
+
+// mdHeadingLevel returns the level of an ATX heading line, or 0.
+func mdHeadingLevel(trimmed string) int {
+	level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+	if level > 6 || (level < len(trimmed) && trimmed[level] != ' ' && trimmed[level] != '\t') {
+		return 0
+	}
+	return level
+}
+
+// mdSetext returns the heading level a setext underline gives, or 0.
+func mdSetext(trimmed string) int {
+	switch {
+	case strings.Trim(trimmed, "=") == "":
+		return 1
+	case strings.Trim(trimmed, "-") == "":
+		return 2
+	}
+	return 0
+}
+
+func mdFence(s *Structure, lines []mdLine, n int) int {
+	open := strings.TrimSpace(lines[n].text)
+	fence := open[:len(open)-len(strings.TrimLeft(open, open[:1]))]
+	lang, _, _ := strings.Cut(strings.TrimSpace(open[len(fence):]), " ")
+	start := lines[n]
+	end := start.offset + len(start.text)
+	var body []string
+	for n++; n < len(lines); n++ {
+		l := lines[n]
+		end = l.offset + len(l.text)
+		if t := strings.TrimSpace(l.text); strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+			n++
+			break
+		}
+		body = append(body, l.text)
+	}
+	s.Blocks = append(s.Blocks, Block{Kind: BlockCode, Text: strings.Join(body, "\n"), Lang: lang, Offset: start.offset, End: end})
+	return n
+}
+
+func mdIndentedCode(s *Structure, lines []mdLine, n int) int {
+	start := n
+	var body []string
+	for ; n < len(lines); n++ {
+		l := lines[n].text
+		if strings.TrimSpace(l) != "" && !strings.HasPrefix(l, "    ") && !strings.HasPrefix(l, "\t") {
+			break
+		}
+		if strings.HasPrefix(l, "\t") {
+			l = l[1:]
+		} else if len(l) >= 4 {
+			l = l[4:]
+		}
+		body = append(body, l)
+	}
+	// Trailing blank lines belong to whatever follows.
+	for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+		body = body[:len(body)-1]
+		n--
+	}
+	last := lines[n-1]
+	s.Blocks = append(s.Blocks, Block{Kind: BlockCode, Text: strings.Join(body, "\n"), Offset: lines[start].offset, End: last.offset + len(last.text)})
+	return n
+}
+
+func mdTable(s *Structure, lines []mdLine, n int) int {
+	start := lines[n].offset
+	header := mdCells(lines[n].text)
+	rows := [][]string{header}
+	end := lines[n+1].offset + len(lines[n+1].text)
+	for n += 2; n < len(lines); n++ {
+		l := lines[n]
+		if strings.TrimSpace(l.text) == "" || !strings.Contains(l.text, "|") {
+			break
+		}
+		rows = append(rows, mdCells(l.text))
+		end = l.offset + len(l.text)
+	}
+	s.Blocks = append(s.Blocks, Block{Kind: BlockTable, Rows: rows, Offset: start, End: end})
+	return n
+}
+
+func mdCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// mdList collects a list, including nested items and continuation lines,
+// up to a blank line followed by something that is not part of it.
+func mdList(s *Structure, lines []mdLine, n int) int {
+	first := mdListItem.FindStringSubmatch(lines[n].text)
+	b := Block{Kind: BlockList, Ordered: first[2][0] >= '0' && first[2][0] <= '9', Offset: lines[n].offset}
+	var item []string
+	flush := func() {
+		if len(item) > 0 {
+			b.Items = append(b.Items, strings.Join(item, " "))
+			item = nil
+		}
+	}
+	for ; n < len(lines); n++ {
+		l := lines[n]
+		if strings.TrimSpace(l.text) == "" {
+			next := n + 1
+			if next < len(lines) && (mdListItem.MatchString(lines[next].text) || strings.HasPrefix(lines[next].text, "  ")) {
+				continue
+			}
+			break
+		}
+		if m := mdListItem.FindStringSubmatch(l.text); m != nil {
+			flush()
+			item = append(item, strings.TrimSpace(l.text[len(m[0]):]))
+		} else if strings.HasPrefix(l.text, " ") || strings.HasPrefix(l.text, "\t") || n > 0 && strings.TrimSpace(lines[n-1].text) != "" {
+			// Indented continuation, or a lazy one straight after the item.
+			t := strings.TrimSpace(l.text)
+			if strings.HasPrefix(t, "#") && mdHeadingLevel(t) > 0 || strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+				break
+			}
+			item = append(item, t)
+		} else {
+			break
+		}
+		b.End = l.offset + len(l.text)
+	}
+	flush()
+	s.Blocks = append(s.Blocks, b)
+	return n
+}
@@ -0,0 +1,295 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxODFRepeat caps how many times a repeated table row or cell is
+// expanded; spreadsheets mark their unused area with huge repeat counts.
+const maxODFRepeat = 100
+
+// sniffODF reports whether content is an OpenDocument package of the
+// given media type. The specification requires an uncompressed
+// "mimetype" member first in the archive, holding the type.
+func sniffODF(content []byte, mime string) bool {
+	if !bytes.HasPrefix(content, []byte("PK\x03\x04")) || len(content) < 30 {
+		return false
+	}
+	nameLen := int(content[26]) | int(content[27])<<8
+	extraLen := int(content[28]) | int(content[29])<<8
+	start := 30 + nameLen + extraLen
+	if nameLen != len("mimetype") || start > len(content) || string(content[30:30+nameLen]) != "mimetype" {
+		return false
+	}
+	return bytes.HasPrefix(content[start:], []byte(mime))
+}
+
+// ParseODF reads an OpenDocument text, spreadsheet or presentation.
+// Headings keep their outline level, sheets and slides start with a
+// heading of their name, and speaker notes follow their slide.
+func ParseODF(content []byte) (*Structure, DocInfo, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, DocInfo{}, err
+	}
+	body, err := readZipPart(zr, "content.xml")
+	if err != nil {
+		return nil, DocInfo{}, err
+	}
+	if body == nil {
+		return nil, DocInfo{}, fmt.Errorf("content.xml not found")
+	}
+	meta, err := readZipPart(zr, "meta.xml")
+	if err != nil {
+		return nil, DocInfo{}, err
+	}
+
+	var info DocInfo
+	xmlElements(meta, func(name string, _ []xml.Attr, text string) {
+		switch name {
+		case "title":
+			info.Title = text
+		case "initial-creator":
+			info.Author = text
+		case "creator":
+			if info.Author == "" {
+				info.Author = text
+			}
+		case "subject":
+			info.Subject = text
+		case "keyword":
+			if info.Keywords != "" {
+				text = info.Keywords + ", " + text
+			}
+			info.Keywords = text
+		case "description":
+			info.Description = text
+		case "language":
+			info.Language = text
+		case "creation-date":
+			info.Created = parseW3CDate(text)
+		case "date":
+			info.Modified = parseW3CDate(text)
+		}
+	})
+
+	b := &odfBuilder{}
+	err = b.parse(body)
+	s := &Structure{Title: info.Title, Blocks: b.blocks}
+	if s.Title == "" {
+		s.Title = titleFromHeadings(s.Blocks)
+	}
+	// A damaged content part still yields what was read before it.
+	if err != nil && len(s.Blocks) == 0 {
+		return nil, info, err
+	}
+	return s, info, nil
+}
+
+type odfBuilder struct {
+	blocks []Block
+	text   strings.Builder
+	// skip counts open elements whose text is not content, such as
+	// deleted tracked changes.
+	skip int
+	// para is the depth of open paragraph elements; nested ones, such as
+	// those in frames, are flattened into the outer.
+	para    int
+	heading int
+
+	list     []string
+	lists    int
+	ordered  bool
+	rows     [][]string
+	row      []string
+	tables   int
+	cell     strings.Builder
+	inCell   bool
+	rowRep   int
+	cellRep  int
+	notes    bool
+	sheets   bool
+	slide    int
+	notesBuf []string
+}
+
+func (b *odfBuilder) parse(data []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			b.start(t)
+		case xml.EndElement:
+			b.end(t)
+		case xml.CharData:
+			if b.skip == 0 && b.para > 0 {
+				b.text.Write(t)
+			}
+		}
+	}
+}
+
+func (b *odfBuilder) start(t xml.StartElement) {
+	if b.skip > 0 {
+		b.skip++
+		return
+	}
+	switch t.Name.Local {
+	case "tracked-changes", "annotation", "sequence-decls", "forms":
+		b.skip = 1
+	case "h", "p":
+		if b.para == 0 {
+			b.text.Reset()
+			if t.Name.Local == "h" {
+				b.heading = 1
+				if n, err := strconv.Atoi(xmlAttr(t, "outline-level")); err == nil && n > 0 {
+					b.heading = min(n, 6)
+				}
+			}
+		} else {
+			b.text.WriteByte(' ')
+		}
+		b.para++
+	case "s":
+		if b.para > 0 {
+			n, _ := strconv.Atoi(xmlAttr(t, "c"))
+			b.text.WriteString(strings.Repeat(" ", max(n, 1)))
+		}
+	case "tab":
+		if b.para > 0 {
+			b.text.WriteByte('\t')
+		}
+	case "line-break":
+		if b.para > 0 {
+			b.text.WriteByte('\n')
+		}
+	case "list":
+		if b.lists == 0 {
+			b.list = nil
+			b.ordered = strings.Contains(strings.ToLower(xmlAttr(t, "style-name")), "numbering")
+		}
+		b.lists++
+	case "table":
+		if b.tables == 0 {
+			b.rows = nil
+			if name := xmlAttr(t, "name"); name != "" && b.sheets {
+				b.blocks = append(b.blocks, Block{Kind: BlockHeading, Level: 1, Text: name})
+			}
+		}
+		b.tables++
+	case "table-row":
+		if b.tables == 1 {
+			b.row = nil
+			b.rowRep = odfRepeat(t, "number-rows-repeated")
+		}
+	case "table-cell", "covered-table-cell":
+		if b.tables == 1 {
+			b.cell.Reset()
+			b.inCell = true
+			b.cellRep = odfRepeat(t, "number-columns-repeated")
+		}
+	case "spreadsheet":
+		b.sheets = true
+	case "page":
+		b.slide++
+		heading := "Slide " + strconv.Itoa(b.slide)
+		if name := xmlAttr(t, "name"); name != "" && !strings.HasPrefix(name, "page") {
+			heading += ": " + name
+		}
+		b.blocks = append(b.blocks, Block{Kind: BlockHeading, Level: 1, Text: heading})
+	case "notes":
+		b.notes = true
+		b.notesBuf = nil
+	}
+}
+
+func (b *odfBuilder) end(t xml.EndElement) {
+	if b.skip > 0 {
+		b.skip--
+		return
+	}
+	switch t.Name.Local {
+	case "h", "p":
+		if b.para == 0 {
+			return
+		}
+		b.para--
+		if b.para > 0 {
+			return
+		}
+		text := strings.TrimSpace(b.text.String())
+		heading := b.heading
+		b.heading = 0
+		switch {
+		case text == "":
+		case b.notes:
+			b.notesBuf = append(b.notesBuf, text)
+		case b.inCell:
+			if b.cell.Len() > 0 {
+				b.cell.WriteByte('\n')
+			}
+			b.cell.WriteString(text)
+		case b.lists > 0:
+			b.list = append(b.list, text)
+		case heading > 0:
+			b.blocks = append(b.blocks, Block{Kind: BlockHeading, Level: heading, Text: text})
+		default:
+			b.blocks = append(b.blocks, Block{Kind: BlockParagraph, Text: text})
+		}
+	case "list":
+		b.lists--
+		if b.lists == 0 && len(b.list) > 0 && !b.notes && !b.inCell {
+			b.blocks = append(b.blocks, Block{Kind: BlockList, Items: b.list, Ordered: b.ordered})
+			b.list = nil
+		}
+	case "table-cell", "covered-table-cell":
+		if b.tables == 1 {
+			b.inCell = false
+			for range b.cellRep {
+				b.row = append(b.row, b.cell.String())
+			}
+		}
+	case "table-row":
+		if b.tables == 1 {
+			for len(b.row) > 0 && b.row[len(b.row)-1] == "" {
+				b.row = b.row[:len(b.row)-1]
+			}
+			if len(b.row) > 0 {
+				for range b.rowRep {
+					b.rows = append(b.rows, b.row)
+				}
+			}
+		}
+	case "table":
+		b.tables--
+		if b.tables == 0 && len(b.rows) > 0 {
+			b.blocks = append(b.blocks, Block{Kind: BlockTable, Rows: b.rows})
+		}
+	case "notes":
+		b.notes = false
+		if len(b.notesBuf) > 0 {
+			b.blocks = append(b.blocks, Block{Kind: BlockParagraph, Text: "Notes: " + strings.Join(b.notesBuf, "\n")})
+		}
+	}
+}
+
+// odfRepeat reads a repeat count attribute, capped at maxODFRepeat.
+func odfRepeat(t xml.StartElement, attr string) int {
+	n, err := strconv.Atoi(xmlAttr(t, attr))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return min(n, maxODFRepeat)
+}
@@ -0,0 +1,597 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DocInfo is the descriptive metadata of an office document or ebook.
+type DocInfo struct {
+	Title       string
+	Author      string
+	Subject     string
+	Keywords    string
+	Description string
+	Language    string
+	Created     time.Time
+	Modified    time.Time
+}
+
+// Props returns the metadata as Document node props. Times are Unix
+// seconds; the modification time is stored as "last_modified" because
+// "modified" is the file's own.
+func (d DocInfo) Props() map[string]interface{} {
+	props := map[string]interface{}{}
+	for key, val := range map[string]string{
+		"title":       d.Title,
+		"author":      d.Author,
+		"subject":     d.Subject,
+		"keywords":    d.Keywords,
+		"description": d.Description,
+		"language":    d.Language,
+	} {
+		if val = strings.TrimSpace(val); val != "" {
+			props[key] = val
+		}
+	}
+	if !d.Created.IsZero() {
+		props["created"] = d.Created.Unix()
+	}
+	if !d.Modified.IsZero() {
+		props["last_modified"] = d.Modified.Unix()
+	}
+	return props
+}
+
+// parseW3CDate reads the dates of Dublin Core metadata: RFC 3339, or a
+// prefix of it down to a bare year.
+func parseW3CDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// xmlElements reads an XML document into a flat list of the text of its
+// leaf elements, keyed by local name. It suits small metadata parts.
+func xmlElements(data []byte, fn func(name string, attrs []xml.Attr, text string)) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []xml.StartElement
+	var text strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Copy())
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return
+			}
+			se := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			fn(se.Name.Local, se.Attr, strings.TrimSpace(text.String()))
+			text.Reset()
+		}
+	}
+}
+
+// ooxmlInfo reads docProps/core.xml, the metadata part shared by Word,
+// Excel and PowerPoint files.
+func ooxmlInfo(zr *zip.Reader) DocInfo {
+	var info DocInfo
+	data, _ := readZipPart(zr, "docProps/core.xml")
+	xmlElements(data, func(name string, _ []xml.Attr, text string) {
+		switch name {
+		case "title":
+			info.Title = text
+		case "creator":
+			info.Author = text
+		case "subject":
+			info.Subject = text
+		case "keywords":
+			info.Keywords = text
+		case "description":
+			info.Description = text
+		case "language":
+			info.Language = text
+		case "created":
+			info.Created = parseW3CDate(text)
+		case "modified":
+			info.Modified = parseW3CDate(text)
+		}
+	})
+	return info
+}
+
+// ooxmlRels maps the relationship IDs of a part to the paths of their
+// targets within the package.
+func ooxmlRels(zr *zip.Reader, part string) map[string]string {
+	rels := map[string]string{}
+	data, _ := readZipPart(zr, path.Join(path.Dir(part), "_rels", path.Base(part)+".rels"))
+	xmlElements(data, func(name string, attrs []xml.Attr, _ string) {
+		if name != "Relationship" {
+			return
+		}
+		var id, target, mode string
+		for _, a := range attrs {
+			switch a.Name.Local {
+			case "Id":
+				id = a.Value
+			case "Target":
+				target = a.Value
+			case "TargetMode":
+				mode = a.Value
+			}
+		}
+		if mode == "External" || target == "" {
+			return
+		}
+		if strings.HasPrefix(target, "/") {
+			rels[id] = strings.TrimPrefix(target, "/")
+		} else {
+			rels[id] = path.Join(path.Dir(part), target)
+		}
+	})
+	return rels
+}
+
+func openZip(content []byte) (*zip.Reader, error) {
+	return zip.NewReader(bytes.NewReader(content), int64(len(content)))
+}
+
+// maxSheetCells caps the cells read from a workbook; the rest of a huge
+// export adds little to search.
+const maxSheetCells = 200000
+
+// Workbook is the content of a spreadsheet: its sheets in order.
+type Workbook struct {
+	Sheets []Sheet
+	Info   DocInfo
+	// Truncated is set when the workbook had more than maxSheetCells
+	// non-empty cells and only the first were read.
+	Truncated bool
+}
+
+// Sheet is a named grid of cell texts. Rows are trimmed of trailing
+// empty cells, and empty rows are dropped.
+type Sheet struct {
+	Name string
+	Rows [][]string
+}
+
+// Structure presents each sheet as a heading followed by a table.
+func (w *Workbook) Structure() *Structure {
+	s := &Structure{Title: w.Info.Title}
+	for _, sh := range w.Sheets {
+		s.Blocks = append(s.Blocks, Block{Kind: BlockHeading, Level: 1, Text: sh.Name})
+		if len(sh.Rows) > 0 {
+			s.Blocks = append(s.Blocks, Block{Kind: BlockTable, Rows: sh.Rows})
+		}
+	}
+	return s
+}
+
+// Props returns the workbook metadata, sheet names and the number of
+// non-empty cells.
+func (w *Workbook) Props() map[string]interface{} {
+	props := w.Info.Props()
+	names := make([]string, len(w.Sheets))
+	cells := 0
+	for n, sh := range w.Sheets {
+		names[n] = sh.Name
+		for _, row := range sh.Rows {
+			for _, cell := range row {
+				if cell != "" {
+					cells++
+				}
+			}
+		}
+	}
+	props["sheets"] = names
+	props["cells"] = cells
+	if w.Truncated {
+		props["truncated"] = true
+	}
+	return props
+}
+
+// ParseXLSX reads the sheets of an Excel workbook. Cells hold their
+// displayed string or raw value; formulas are not evaluated, their
+// cached results are used.
+func ParseXLSX(content []byte) (*Workbook, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	wbXML, err := readZipPart(zr, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	if wbXML == nil {
+		return nil, fmt.Errorf("xl/workbook.xml not found")
+	}
+	rels := ooxmlRels(zr, "xl/workbook.xml")
+
+	shared, err := readZipPart(zr, "xl/sharedStrings.xml")
+	if err != nil {
+		return nil, err
+	}
+	strs := xlsxSharedStrings(shared)
+
+	wb := &Workbook{Info: ooxmlInfo(zr)}
+	cells := 0
+	var sheetErr error
+	xmlElements(wbXML, func(name string, attrs []xml.Attr, _ string) {
+		if name != "sheet" || sheetErr != nil {
+			return
+		}
+		var sheetName, rid string
+		for _, a := range attrs {
+			switch {
+			case a.Name.Local == "name":
+				sheetName = a.Value
+			case a.Name.Local == "id" && a.Name.Space != "":
+				rid = a.Value
+			}
+		}
+		data, err := readZipPart(zr, rels[rid])
+		if err != nil {
+			sheetErr = err
+			return
+		}
+		sh := Sheet{Name: sheetName}
+		if !wb.Truncated {
+			sh.Rows, cells, wb.Truncated = xlsxRows(data, strs, cells)
+		}
+		wb.Sheets = append(wb.Sheets, sh)
+	})
+	if sheetErr != nil {
+		return nil, sheetErr
+	}
+	return wb, nil
+}
+
+// xlsxSharedStrings reads the shared string table. Rich text runs are
+// concatenated and phonetic hints left out.
+func xlsxSharedStrings(data []byte) []string {
+	var strs []string
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var cur strings.Builder
+	inT, inPhonetic := false, false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return strs
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				cur.Reset()
+			case "t":
+				inT = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.CharData:
+			if inT && !inPhonetic {
+				cur.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, cur.String())
+			case "t":
+				inT = false
+			case "rPh":
+				inPhonetic = false
+			}
+		}
+	}
+}
+
+// xlsxRows reads the cells of a worksheet into rows, placing each cell
+// in the column its reference names. cells counts non-empty cells read
+// so far across the workbook.
+func xlsxRows(data []byte, strs []string, cells int) (rows [][]string, total int, truncated bool) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		row      []string
+		typ, ref string
+		col      int
+		value    strings.Builder
+		inValue  bool
+	)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = nil
+			case "c":
+				typ, ref = xmlAttr(t, "t"), xmlAttr(t, "r")
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				text := value.String()
+				switch typ {
+				case "s":
+					if n, err := strconv.Atoi(strings.TrimSpace(text)); err == nil && n >= 0 && n < len(strs) {
+						text = strs[n]
+					}
+				case "b":
+					text = map[string]string{"0": "FALSE", "1": "TRUE"}[strings.TrimSpace(text)]
+				}
+				if c := xlsxColumn(ref); c >= 0 {
+					col = c
+				}
+				if strings.TrimSpace(text) != "" {
+					if cells >= maxSheetCells {
+						return trimRows(rows), cells, true
+					}
+					for len(row) < col {
+						row = append(row, "")
+					}
+					row = append(row, strings.TrimSpace(text))
+					cells++
+				}
+				col++
+			case "row":
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+				col = 0
+			}
+		}
+	}
+	return trimRows(rows), cells, false
+}
+
+// xlsxColumn returns the zero-based column of a cell reference such as
+// "AB12", or -1 if there is none.
+func xlsxColumn(ref string) int {
+	col := 0
+	n := 0
+	for n < len(ref) && ref[n] >= 'A' && ref[n] <= 'Z' {
+		col = col*26 + int(ref[n]-'A'+1)
+		n++
+	}
+	if n == 0 || col > 16384 {
+		return -1
+	}
+	return col - 1
+}
+
+func trimRows(rows [][]string) [][]string {
+	for n, row := range rows {
+		for len(row) > 0 && row[len(row)-1] == "" {
+			row = row[:len(row)-1]
+		}
+		rows[n] = row
+	}
+	return rows
+}
+
+// Slide is the text of one slide and its speaker notes.
+type Slide struct {
+	Title string
+	// Paragraphs holds the slide's text other than the title.
+	Paragraphs []string
+	Notes      string
+}
+
+// Presentation is the content of a slide deck.
+type Presentation struct {
+	Slides []Slide
+	Info   DocInfo
+}
+
+// Structure presents each slide as a heading, "Slide N" plus its title,
+// followed by its text and a "Notes:" paragraph.
+func (p *Presentation) Structure() *Structure {
+	s := &Structure{Title: p.Info.Title}
+	for n, sl := range p.Slides {
+		heading := "Slide " + strconv.Itoa(n+1)
+		if sl.Title != "" {
+			heading += ": " + sl.Title
+		}
+		s.Blocks = append(s.Blocks, Block{Kind: BlockHeading, Level: 1, Text: heading})
+		for _, para := range sl.Paragraphs {
+			s.Blocks = append(s.Blocks, Block{Kind: BlockParagraph, Text: para})
+		}
+		if sl.Notes != "" {
+			s.Blocks = append(s.Blocks, Block{Kind: BlockParagraph, Text: "Notes: " + sl.Notes})
+		}
+	}
+	if s.Title == "" && len(p.Slides) > 0 {
+		s.Title = p.Slides[0].Title
+	}
+	return s
+}
+
+// Props returns the presentation metadata and slide count.
+func (p *Presentation) Props() map[string]interface{} {
+	props := p.Info.Props()
+	props["slides"] = len(p.Slides)
+	return props
+}
+
+// ParsePPTX reads the slides of a PowerPoint deck in presentation order,
+// with the text of their shapes and tables and their speaker notes.
+func ParsePPTX(content []byte) (*Presentation, error) {
+	zr, err := openZip(content)
+	if err != nil {
+		return nil, err
+	}
+	presXML, err := readZipPart(zr, "ppt/presentation.xml")
+	if err != nil {
+		return nil, err
+	}
+	if presXML == nil {
+		return nil, fmt.Errorf("ppt/presentation.xml not found")
+	}
+	rels := ooxmlRels(zr, "ppt/presentation.xml")
+
+	var slidePaths []string
+	xmlElements(presXML, func(name string, attrs []xml.Attr, _ string) {
+		if name != "sldId" {
+			return
+		}
+		for _, a := range attrs {
+			if a.Name.Local == "id" && a.Name.Space != "" && rels[a.Value] != "" {
+				slidePaths = append(slidePaths, rels[a.Value])
+			}
+		}
+	})
+	if len(slidePaths) == 0 {
+		// No slide list: fall back to the slide parts in numeric order.
+		for _, f := range zr.File {
+			if strings.HasPrefix(f.Name, "ppt/slides/slide") && strings.HasSuffix(f.Name, ".xml") {
+				slidePaths = append(slidePaths, f.Name)
+			}
+		}
+		sort.Slice(slidePaths, func(a, b int) bool {
+			return len(slidePaths[a]) < len(slidePaths[b]) || len(slidePaths[a]) == len(slidePaths[b]) && slidePaths[a] < slidePaths[b]
+		})
+	}
+
+	p := &Presentation{Info: ooxmlInfo(zr)}
+	for _, sp := range slidePaths {
+		data, err := readZipPart(zr, sp)
+		if err != nil {
+			return nil, err
+		}
+		var sl Slide
+		for _, shape := range pptxShapes(data) {
+			if sl.Title == "" && (shape.placeholder == "title" || shape.placeholder == "ctrTitle") {
+				sl.Title = strings.Join(shape.paragraphs, " ")
+				continue
+			}
+			sl.Paragraphs = append(sl.Paragraphs, shape.paragraphs...)
+		}
+		for _, target := range ooxmlRels(zr, sp) {
+			if !strings.Contains(target, "notesSlide") {
+				continue
+			}
+			notes, err := readZipPart(zr, target)
+			if err != nil {
+				return nil, err
+			}
+			var lines []string
+			for _, shape := range pptxShapes(notes) {
+				if shape.placeholder == "body" || shape.placeholder == "" {
+					lines = append(lines, shape.paragraphs...)
+				}
+			}
+			sl.Notes = strings.Join(lines, "\n")
+		}
+		p.Slides = append(p.Slides, sl)
+	}
+	return p, nil
+}
+
+type pptxShape struct {
+	placeholder string
+	paragraphs  []string
+}
+
+// pptxShapes returns the text of each shape of a slide or notes page.
+// Fields, such as slide numbers, are left out.
+func pptxShapes(data []byte) []pptxShape {
+	var shapes []pptxShape
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		cur     *pptxShape
+		depth   int
+		para    strings.Builder
+		inText  bool
+		inField bool
+	)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return shapes
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sp", "graphicFrame":
+				if cur == nil {
+					cur = &pptxShape{}
+					depth = 0
+				}
+				depth++
+			case "ph":
+				if cur != nil {
+					cur.placeholder = xmlAttr(t, "type")
+					if cur.placeholder == "" {
+						cur.placeholder = "body"
+					}
+				}
+			case "p":
+				para.Reset()
+			case "t":
+				inText = true
+			case "fld":
+				inField = true
+			case "br":
+				para.WriteByte(' ')
+			}
+		case xml.CharData:
+			if inText && !inField {
+				para.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "fld":
+				inField = false
+			case "p":
+				if text := strings.TrimSpace(para.String()); text != "" && cur != nil {
+					cur.paragraphs = append(cur.paragraphs, text)
+				}
+			case "sp", "graphicFrame":
+				if cur != nil {
+					depth--
+					if depth == 0 {
+						if len(cur.paragraphs) > 0 {
+							shapes = append(shapes, *cur)
+						}
+						cur = nil
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testZip builds an archive of name/content pairs in order. A leading
+// "mimetype" member is stored uncompressed, as OpenDocument and EPUB
+// require.
+func testZip(t *testing.T, parts ...string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for n := 0; n+1 < len(parts); n += 2 {
+		method := zip.Deflate
+		if parts[n] == "mimetype" {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: parts[n], Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(parts[n+1]))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+const testCoreXML = `<?xml version="1.0"?><cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/">` +
+	`<dc:title>Budget</dc:title><dc:creator>Ada</dc:creator><dcterms:created>2024-01-02T03:04:05Z</dcterms:created><dcterms:modified>2024-02-01T00:00:00Z</dcterms:modified></cp:coreProperties>`
+
+func TestParseXLSX(t *testing.T) {
+	content := testZip(t,
+		"xl/workbook.xml", `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`+
+			`<sheet name="Costs" sheetId="1" r:id="rId1"/><sheet name="Empty" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels", `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml", `<sst><si><t>Item</t></si><si><r><t>Co</t></r><r><t>st</t></r><rPh><t>x</t></rPh></si><si><t>Rent</t></si></sst>`,
+		"xl/worksheets/sheet1.xml", `<worksheet><sheetData>`+
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>`+
+			`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" t="b"><v>1</v></c><c r="C2"><f>SUM(X)</f><v>1200</v></c></row>`+
+			`<row r="4"><c r="B4" t="inlineStr"><is><t>note</t></is></c><c r="D4"/></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml", `<worksheet><sheetData/></worksheet>`,
+		"docProps/core.xml", testCoreXML,
+	)
+	wb, err := ParseXLSX(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Sheet{
+		{Name: "Costs", Rows: [][]string{{"Item", "", "Cost"}, {"Rent", "TRUE", "1200"}, {"", "note"}}},
+		{Name: "Empty"},
+	}
+	if !reflect.DeepEqual(wb.Sheets, want) {
+		t.Errorf("Sheets = %q, want %q", wb.Sheets, want)
+	}
+
+	doc, err := New().ExtractDocument("budget.xlsx", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc.Text, "Costs\n\nItem |  | Cost\nRent | TRUE | 1200") {
+		t.Errorf("Text = %q", doc.Text)
+	}
+	if doc.Props["title"] != "Budget" || doc.Props["author"] != "Ada" || doc.Props["cells"] != 6 ||
+		doc.Props["created"] != time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Unix() || doc.Props["last_modified"] == nil {
+		t.Errorf("Props = %v", doc.Props)
+	}
+	if !reflect.DeepEqual(doc.Props["sheets"], []string{"Costs", "Empty"}) {
+		t.Errorf("sheets = %v", doc.Props["sheets"])
+	}
+}
+
+func TestParsePPTX(t *testing.T) {
+	slide := func(title, body string) string {
+		return `<p:sld xmlns:a="a" xmlns:p="p"><p:cSld><p:spTree>` +
+			`<p:sp><p:nvSpPr><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>` + title + `</a:t></a:r></a:p></p:txBody></p:sp>` +
+			`<p:sp><p:nvSpPr><p:nvPr><p:ph idx="1"/></p:nvPr></p:nvSpPr><p:txBody>` + body + `</p:txBody></p:sp>` +
+			`</p:spTree></p:cSld></p:sld>`
+	}
+	content := testZip(t,
+		"ppt/presentation.xml", `<p:presentation xmlns:p="p" xmlns:r="r"><p:sldIdLst><p:sldId id="257" r:id="rId3"/><p:sldId id="256" r:id="rId2"/></p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels", `<Relationships><Relationship Id="rId2" Target="slides/slide1.xml"/><Relationship Id="rId3" Target="slides/slide2.xml"/></Relationships>`,
+		"ppt/slides/slide1.xml", slide("Later", `<a:p><a:r><a:t>Second</a:t></a:r></a:p>`),
+		"ppt/slides/slide2.xml", slide("Intro", `<a:p><a:r><a:t>Hello </a:t></a:r><a:r><a:t>world</a:t></a:r></a:p><a:p/><a:p><a:r><a:t>Bye</a:t></a:r></a:p>`),
+		"ppt/slides/_rels/slide2.xml.rels", `<Relationships><Relationship Id="rId1" Target="../notesSlides/notesSlide1.xml"/></Relationships>`,
+		"ppt/notesSlides/notesSlide1.xml", `<p:notes xmlns:a="a" xmlns:p="p"><p:cSld><p:spTree>`+
+			`<p:sp><p:nvSpPr><p:nvPr><p:ph type="sldImg"/></p:nvPr></p:nvSpPr></p:sp>`+
+			`<p:sp><p:nvSpPr><p:nvPr><p:ph type="body" idx="1"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>Speak slowly</a:t></a:r></a:p></p:txBody></p:sp>`+
+			`<p:sp><p:nvSpPr><p:nvPr><p:ph type="sldNum"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:fld type="slidenum"><a:t>1</a:t></a:fld></a:p></p:txBody></p:sp>`+
+			`</p:spTree></p:cSld></p:notes>`,
+	)
+	p, err := ParsePPTX(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Slide{
+		{Title: "Intro", Paragraphs: []string{"Hello world", "Bye"}, Notes: "Speak slowly"},
+		{Title: "Later", Paragraphs: []string{"Second"}},
+	}
+	if !reflect.DeepEqual(p.Slides, want) {
+		t.Errorf("Slides = %+v, want %+v", p.Slides, want)
+	}
+	doc, err := New().ExtractDocument("deck.pptx", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Slide 1: Intro\n\nHello world\n\nBye\n\nNotes: Speak slowly\n\nSlide 2: Later\n\nSecond"; doc.Text != want {
+		t.Errorf("Text = %q, want %q", doc.Text, want)
+	}
+	if doc.Props["slides"] != 2 || doc.Props["title"] != "Intro" {
+		t.Errorf("Props = %v", doc.Props)
+	}
+}
+
+const testODFMeta = `<office:document-meta xmlns:office="o" xmlns:meta="m" xmlns:dc="d"><office:meta>` +
+	`<dc:title>Plan</dc:title><meta:initial-creator>Grace</meta:initial-creator><dc:creator>Linus</dc:creator>` +
+	`<meta:creation-date>2023-05-06T07:08:09</meta:creation-date><dc:date>2023-06-01T00:00:00.5</dc:date>` +
+	`<meta:keyword>a</meta:keyword><meta:keyword>b</meta:keyword></office:meta></office:document-meta>`
+
+func TestParseODF(t *testing.T) {
+	const ns = `xmlns:office="o" xmlns:text="t" xmlns:table="tb" xmlns:draw="d" xmlns:presentation="p"`
+	odt := testZip(t,
+		"mimetype", "application/vnd.oasis.opendocument.text",
+		"content.xml", `<office:document-content `+ns+`><office:body><office:text>`+
+			`<text:sequence-decls><text:sequence-decl text:name="Figure"/></text:sequence-decls>`+
+			`<text:h text:outline-level="2">Goals</text:h>`+
+			`<text:p>Ship<text:s text:c="2"/>it<text:tab/>now<text:tracked-changes>gone</text:tracked-changes></text:p>`+
+			`<text:list><text:list-item><text:p>one</text:p></text:list-item><text:list-item><text:p>two</text:p></text:list-item></text:list>`+
+			`<table:table table:name="Table1"><table:table-row><table:table-cell><text:p>x</text:p></table:table-cell>`+
+			`<table:table-cell table:number-columns-repeated="2"><text:p>y</text:p></table:table-cell></table:table-row></table:table>`+
+			`</office:text></office:body></office:document-content>`,
+		"meta.xml", testODFMeta,
+	)
+	doc, err := New().ExtractDocument("plan.odt", odt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Block{
+		{Kind: BlockHeading, Level: 2, Text: "Goals"},
+		{Kind: BlockParagraph, Text: "Ship  it\tnow"},
+		{Kind: BlockList, Items: []string{"one", "two"}},
+		{Kind: BlockTable, Rows: [][]string{{"x", "y", "y"}}},
+	}
+	if !reflect.DeepEqual(doc.Structure.Blocks, want) {
+		t.Errorf("Blocks = %+v, want %+v", doc.Structure.Blocks, want)
+	}
+	if doc.Props["title"] != "Plan" || doc.Props["author"] != "Grace" || doc.Props["keywords"] != "a, b" ||
+		doc.Props["created"] != time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC).Unix() || doc.Props["last_modified"] == nil {
+		t.Errorf("Props = %v", doc.Props)
+	}
+
+	ods := testZip(t,
+		"mimetype", "application/vnd.oasis.opendocument.spreadsheet",
+		"content.xml", `<office:document-content `+ns+`><office:body><office:spreadsheet>`+
+			`<table:table table:name="Q1"><table:table-row><table:table-cell><text:p>a</text:p></table:table-cell>`+
+			`<table:table-cell table:number-columns-repeated="16000"/></table:table-row>`+
+			`<table:table-row table:number-rows-repeated="1048000"><table:table-cell table:number-columns-repeated="16384"/></table:table-row>`+
+			`</table:table></office:spreadsheet></office:body></office:document-content>`,
+	)
+	if f, ok := Detect("upload.bin", ods); !ok || f.Name != "ods" {
+		t.Errorf("Detect(ods) = %q, %v", f.Name, ok)
+	}
+	doc, err = New().ExtractDocument("q.ods", ods)
+	if err != nil || doc.Text != "Q1\n\na" {
+		t.Errorf("ExtractDocument(ods) = %+v, %v", doc, err)
+	}
+
+	odp := testZip(t,
+		"mimetype", "application/vnd.oasis.opendocument.presentation",
+		"content.xml", `<office:document-content `+ns+`><office:body><office:presentation>`+
+			`<draw:page draw:name="page1"><draw:frame><draw:text-box><text:p>Welcome</text:p></draw:text-box></draw:frame>`+
+			`<presentation:notes><draw:page-thumbnail/><draw:frame><draw:text-box><text:p>Smile</text:p></draw:text-box></draw:frame></presentation:notes></draw:page>`+
+			`<draw:page draw:name="Roadmap"><draw:frame><draw:text-box><text:p>Later</text:p></draw:text-box></draw:frame></draw:page>`+
+			`</office:presentation></office:body></office:document-content>`,
+	)
+	doc, err = New().ExtractDocument("talk.odp", odp)
+	if want := "Slide 1\n\nWelcome\n\nNotes: Smile\n\nSlide 2: Roadmap\n\nLater"; err != nil || doc.Text != want {
+		t.Errorf("ExtractDocument(odp) = %q, %v, want %q", doc.Text, err, want)
+	}
+}
+
+func TestParseEPUB(t *testing.T) {
+	content := testZip(t,
+		"mimetype", "application/epub+zip",
+		"META-INF/container.xml", `<container><rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`,
+		"OEBPS/content.opf", `<package xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf"><metadata>`+
+			`<dc:title>Sea Tales</dc:title><dc:creator>Ishmael</dc:creator><dc:language>en</dc:language>`+
+			`<dc:date opf:event="modification">2020-01-01</dc:date><dc:date>1851-10-18</dc:date>`+
+			`<meta property="dcterms:modified">2021-03-04T05:06:07Z</meta></metadata>`+
+			`<manifest><item id="c1" href="text/ch%201.xhtml"/><item id="c2" href="text/ch2.xhtml"/><item id="css" href="style.css"/></manifest>`+
+			`<spine><itemref idref="c2"/><itemref idref="c1"/></spine></package>`,
+		"OEBPS/text/ch 1.xhtml", `<?xml version="1.0"?><html><body><h1>Loomings</h1><p>Call me <a href="https://example.com/">Ishmael</a>.</p></body></html>`,
+		"OEBPS/text/ch2.xhtml", `<html><body><h1>Preface</h1><p>See <a href="ch%201.xhtml">chapter one</a>.</p></body></html>`,
+	)
+	if f, ok := Detect("book", content); !ok || f.Name != "epub" {
+		t.Errorf("Detect() = %q, %v", f.Name, ok)
+	}
+	doc, err := New().ExtractDocument("tales.epub", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Preface\n\nSee chapter one.\n\nLoomings\n\nCall me Ishmael."; doc.Text != want {
+		t.Errorf("Text = %q, want %q", doc.Text, want)
+	}
+	if doc.Props["title"] != "Sea Tales" || doc.Props["author"] != "Ishmael" || doc.Props["language"] != "en" || doc.Props["chapters"] != 2 ||
+		doc.Props["last_modified"] != time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC).Unix() {
+		t.Errorf("Props = %v", doc.Props)
+	}
+	if want := []Link{{URL: "https://example.com/", Text: "Ishmael"}}; !reflect.DeepEqual(doc.Links, want) {
+		t.Errorf("Links = %+v", doc.Links)
+	}
+	if len(doc.Structure.Sections()) != 2 {
+		t.Errorf("Sections() = %+v", doc.Structure.Sections())
+	}
+}
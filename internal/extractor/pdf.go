@@ -0,0 +1,198 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PDFInfo is the document information dictionary of a PDF.
+type PDFInfo struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	Creator  string
+	Producer string
+	Created  time.Time
+	Modified time.Time
+}
+
+// PDFDocument is the text of a PDF, one string per page, and its
+// metadata.
+type PDFDocument struct {
+	Pages []string
+	Info  PDFInfo
+}
+
+// PageBreak separates pages in extracted PDF text.
+const PageBreak = "\n\f\n"
+
+// ParsePDF reads the text and metadata of a PDF. It follows the cross
+// reference table (rebuilding it if damaged), decodes compressed object
+// and content streams, and maps glyphs to text through each font's
+// ToUnicode map or encoding. Documents that need a user password fail
+// with ErrPDFPassword.
+func ParsePDF(content []byte) (doc *PDFDocument, err error) {
+	defer func() {
+		// Malformed files should fail the one document, not the indexer.
+		if p := recover(); p != nil {
+			doc, err = nil, fmt.Errorf("pdf: malformed document: %v", p)
+		}
+	}()
+
+	r, err := newPDFReader(content)
+	if err != nil {
+		return nil, err
+	}
+	doc = &PDFDocument{Info: r.info()}
+	for _, page := range r.pages() {
+		doc.Pages = append(doc.Pages, r.pageText(page))
+	}
+	return doc, nil
+}
+
+// Text returns the text of all pages separated by PageBreak.
+func (d *PDFDocument) Text() string {
+	return strings.Join(d.Pages, PageBreak)
+}
+
+// Props returns the metadata worth keeping on the Document node.
+func (d *PDFDocument) Props() map[string]interface{} {
+	props := map[string]interface{}{"pages": len(d.Pages)}
+	for key, val := range map[string]string{
+		"title":    d.Info.Title,
+		"author":   d.Info.Author,
+		"subject":  d.Info.Subject,
+		"keywords": d.Info.Keywords,
+		"creator":  d.Info.Creator,
+		"producer": d.Info.Producer,
+	} {
+		if val != "" {
+			props[key] = val
+		}
+	}
+	if !d.Info.Created.IsZero() {
+		props["created"] = d.Info.Created.Unix()
+	}
+	if !d.Info.Modified.IsZero() {
+		props["last_modified"] = d.Info.Modified.Unix()
+	}
+	return props
+}
+
+// pages returns the page dictionaries in order, with inherited
+// attributes copied down from the page tree.
+func (r *pdfReader) pages() []pdfDict {
+	var pages []pdfDict
+	visited := map[pdfRef]bool{}
+	var walk func(v interface{}, inherited pdfDict, depth int)
+	walk = func(v interface{}, inherited pdfDict, depth int) {
+		if ref, ok := v.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		node, ok := r.resolve(v).(pdfDict)
+		if !ok || depth > 64 {
+			return
+		}
+		attrs := pdfDict{}
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+		for _, k := range []pdfName{"Resources", "MediaBox", "CropBox", "Rotate"} {
+			if v, ok := node[k]; ok {
+				attrs[k] = v
+			}
+		}
+		kids, hasKids := r.resolve(node["Kids"]).(pdfArray)
+		if node.name("Type") == "Pages" || (node.name("Type") != "Page" && hasKids) {
+			for _, kid := range kids {
+				walk(kid, attrs, depth+1)
+			}
+			return
+		}
+		page := pdfDict{}
+		for k, v := range node {
+			page[k] = v
+		}
+		for k, v := range attrs {
+			if _, ok := page[k]; !ok {
+				page[k] = v
+			}
+		}
+		pages = append(pages, page)
+	}
+	walk(r.catalog()["Pages"], nil, 0)
+	return pages
+}
+
+func (r *pdfReader) info() PDFInfo {
+	d, _ := r.resolve(r.trailer["Info"]).(pdfDict)
+	text := func(key pdfName) string {
+		s, _ := r.resolve(d[key]).(pdfString)
+		return strings.TrimSpace(decodePDFText(s))
+	}
+	return PDFInfo{
+		Title:    text("Title"),
+		Author:   text("Author"),
+		Subject:  text("Subject"),
+		Keywords: text("Keywords"),
+		Creator:  text("Creator"),
+		Producer: text("Producer"),
+		Created:  parsePDFDate(text("CreationDate")),
+		Modified: parsePDFDate(text("ModDate")),
+	}
+}
+
+// parsePDFDate parses dates of the form D:YYYYMMDDHHmmSSOHH'mm', where
+// everything after the year is optional. It returns the zero time for
+// anything else.
+func parsePDFDate(s string) time.Time {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits < 4 {
+		return time.Time{}
+	}
+	field := func(start, end, def int) int {
+		if end > digits {
+			return def
+		}
+		v, _ := strconv.Atoi(s[start:end])
+		return v
+	}
+	year := field(0, 4, 0)
+	month := field(4, 6, 1)
+	day := field(6, 8, 1)
+	hour := field(8, 10, 0)
+	minute := field(10, 12, 0)
+	sec := field(12, 14, 0)
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || sec > 60 {
+		return time.Time{}
+	}
+
+	loc := time.UTC
+	if rest := s[digits:]; len(rest) > 0 && (rest[0] == '+' || rest[0] == '-') {
+		parts := strings.FieldsFunc(rest[1:], func(r rune) bool { return r == '\'' || r == ':' })
+		var offset int
+		if len(parts) > 0 {
+			h, _ := strconv.Atoi(parts[0])
+			offset = h * 3600
+		}
+		if len(parts) > 1 {
+			m, _ := strconv.Atoi(parts[1])
+			offset += m * 60
+		}
+		if rest[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, sec, 0, loc)
+}
@@ -0,0 +1,263 @@
+package extractor
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// ErrPDFPassword is returned for PDFs that need a user password to open.
+var ErrPDFPassword = errors.New("pdf: document is password protected")
+
+// pdfPadding is the password padding string of the standard security
+// handler.
+var pdfPadding = []byte{
+	0x28, 0xbf, 0x4e, 0x5e, 0x4e, 0x75, 0x8a, 0x41, 0x64, 0x00, 0x4e, 0x56, 0xff, 0xfa, 0x01, 0x08,
+	0x2e, 0x2e, 0x00, 0xb6, 0xd0, 0x68, 0x3e, 0x80, 0x2f, 0x0c, 0xa9, 0xfe, 0x64, 0x53, 0x69, 0x7a,
+}
+
+const (
+	cryptNone = iota
+	cryptRC4
+	cryptAESV2
+	cryptAESV3
+)
+
+// pdfCrypt decrypts documents protected by the standard security handler
+// with an empty user password, which is how most "no copy, no print"
+// PDFs are distributed.
+type pdfCrypt struct {
+	key       []byte
+	strMethod int
+	stmMethod int
+}
+
+func (r *pdfReader) newCrypt(v interface{}) (*pdfCrypt, error) {
+	enc, ok := r.resolve(v).(pdfDict)
+	if !ok {
+		return nil, errors.New("pdf: bad /Encrypt dictionary")
+	}
+	if f := enc.name("Filter"); f != "Standard" {
+		return nil, errors.New("pdf: unsupported security handler " + string(f))
+	}
+	ver, _ := pdfInt(enc["V"])
+	rev, _ := pdfInt(enc["R"])
+	o, _ := r.resolve(enc["O"]).(pdfString)
+	u, _ := r.resolve(enc["U"]).(pdfString)
+	perms, _ := pdfInt(enc["P"])
+
+	c := &pdfCrypt{strMethod: cryptRC4, stmMethod: cryptRC4}
+	if ver >= 4 {
+		cf, _ := r.resolve(enc["CF"]).(pdfDict)
+		method := func(name pdfName) int {
+			if name == "Identity" {
+				return cryptNone
+			}
+			filter, _ := r.resolve(cf[name]).(pdfDict)
+			switch filter.name("CFM") {
+			case "AESV2":
+				return cryptAESV2
+			case "AESV3":
+				return cryptAESV3
+			case "None":
+				return cryptNone
+			}
+			return cryptRC4
+		}
+		c.strMethod = method(enc.name("StrF"))
+		c.stmMethod = method(enc.name("StmF"))
+		if enc["StrF"] == nil {
+			c.strMethod = cryptNone
+		}
+		if enc["StmF"] == nil {
+			c.stmMethod = cryptNone
+		}
+	}
+
+	if rev >= 5 {
+		ue, _ := r.resolve(enc["UE"]).(pdfString)
+		if len(u) < 48 || len(ue) < 32 {
+			return nil, errors.New("pdf: bad AES-256 encryption dictionary")
+		}
+		if !bytes.Equal(hashR6(nil, u[32:40], nil, rev), u[:32]) {
+			return nil, ErrPDFPassword
+		}
+		block, err := aes.NewCipher(hashR6(nil, u[40:48], nil, rev))
+		if err != nil {
+			return nil, err
+		}
+		c.key = make([]byte, 32)
+		cipher.NewCBCDecrypter(block, make([]byte, 16)).CryptBlocks(c.key, ue[:32])
+		return c, nil
+	}
+
+	length := 40
+	if l, ok := pdfInt(enc["Length"]); ok && rev >= 3 {
+		length = l
+	}
+	if length < 40 || length > 128 || length%8 != 0 {
+		length = 128
+	}
+	var id []byte
+	if ids, ok := r.resolve(r.trailer["ID"]).(pdfArray); ok && len(ids) > 0 {
+		id, _ = r.resolve(ids[0]).(pdfString)
+	}
+
+	h := md5.New()
+	h.Write(pdfPadding)
+	h.Write(o)
+	binary.Write(h, binary.LittleEndian, int32(perms))
+	h.Write(id)
+	if meta, ok := enc["EncryptMetadata"].(bool); ok && !meta && rev >= 4 {
+		h.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	}
+	key := h.Sum(nil)
+	n := length / 8
+	if rev >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:n])
+			key = sum[:]
+		}
+	}
+	c.key = key[:n]
+
+	// Check the empty user password before trusting the key.
+	var check []byte
+	if rev == 2 {
+		check = rc4Crypt(c.key, pdfPadding)
+	} else {
+		h := md5.New()
+		h.Write(pdfPadding)
+		h.Write(id)
+		check = h.Sum(nil)
+		for i := 0; i < 20; i++ {
+			k := make([]byte, len(c.key))
+			for j := range k {
+				k[j] = c.key[j] ^ byte(i)
+			}
+			check = rc4Crypt(k, check)
+		}
+		if len(u) >= 16 {
+			u = u[:16]
+		}
+	}
+	if len(u) > len(check) || !bytes.Equal(check[:len(u)], u) {
+		return nil, ErrPDFPassword
+	}
+	return c, nil
+}
+
+// hashR6 is the password hash of revisions 5 and 6 (ISO 32000-2, 7.6.4.3.4).
+func hashR6(password, salt, udata []byte, rev int) []byte {
+	h := sha256.New()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(udata)
+	k := h.Sum(nil)
+	if rev < 6 {
+		return k
+	}
+	for i := 0; ; i++ {
+		var seq []byte
+		for j := 0; j < 64; j++ {
+			seq = append(seq, password...)
+			seq = append(seq, k...)
+			seq = append(seq, udata...)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(seq))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, seq)
+
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+		if i >= 63 && int(e[len(e)-1]) <= i-31 {
+			return k[:32]
+		}
+	}
+}
+
+func rc4Crypt(key, data []byte) []byte {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+func (c *pdfCrypt) objectKey(ref pdfRef, method int) []byte {
+	if method == cryptAESV3 {
+		return c.key
+	}
+	h := md5.New()
+	h.Write(c.key)
+	h.Write([]byte{byte(ref.num), byte(ref.num >> 8), byte(ref.num >> 16), byte(ref.gen), byte(ref.gen >> 8)})
+	if method == cryptAESV2 {
+		h.Write([]byte("sAlT"))
+	}
+	return h.Sum(nil)[:min(len(c.key)+5, 16)]
+}
+
+func (c *pdfCrypt) decrypt(data []byte, ref pdfRef, method int) []byte {
+	switch method {
+	case cryptRC4:
+		return rc4Crypt(c.objectKey(ref, method), data)
+	case cryptAESV2, cryptAESV3:
+		if len(data) < 32 || len(data)%16 != 0 {
+			return data
+		}
+		block, err := aes.NewCipher(c.objectKey(ref, method))
+		if err != nil {
+			return data
+		}
+		out := make([]byte, len(data)-16)
+		cipher.NewCBCDecrypter(block, data[:16]).CryptBlocks(out, data[16:])
+		if pad := int(out[len(out)-1]); pad >= 1 && pad <= 16 {
+			out = out[:len(out)-pad]
+		}
+		return out
+	}
+	return data
+}
+
+func (c *pdfCrypt) decryptStream(s *pdfStream) []byte {
+	return c.decrypt(s.raw, s.ref, c.stmMethod)
+}
+
+// decryptStrings returns obj with every string decrypted.
+func (c *pdfCrypt) decryptStrings(obj interface{}, ref pdfRef) interface{} {
+	switch v := obj.(type) {
+	case pdfString:
+		return pdfString(c.decrypt(v, ref, c.strMethod))
+	case pdfArray:
+		for i := range v {
+			v[i] = c.decryptStrings(v[i], ref)
+		}
+	case pdfDict:
+		for k := range v {
+			v[k] = c.decryptStrings(v[k], ref)
+		}
+	}
+	return obj
+}
@@ -0,0 +1,204 @@
+package extractor
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Glyph names in code order for the ASCII range, the Windows-1252 block
+// at 0x80 and the Latin-1 block at 0xA0. Together with a few extras they
+// cover the names PDF producers put in /Differences arrays.
+var (
+	asciiGlyphs = strings.Fields(`space exclam quotedbl numbersign dollar percent ampersand quotesingle
+		parenleft parenright asterisk plus comma hyphen period slash zero one two three four five six seven
+		eight nine colon semicolon less equal greater question at A B C D E F G H I J K L M N O P Q R S T U V
+		W X Y Z bracketleft backslash bracketright asciicircum underscore grave a b c d e f g h i j k l m n o
+		p q r s t u v w x y z braceleft bar braceright asciitilde`)
+	latin1Glyphs = strings.Fields(`nbspace exclamdown cent sterling currency yen brokenbar section dieresis
+		copyright ordfeminine guillemotleft logicalnot sfthyphen registered macron degree plusminus
+		twosuperior threesuperior acute mu paragraph periodcentered cedilla onesuperior ordmasculine
+		guillemotright onequarter onehalf threequarters questiondown Agrave Aacute Acircumflex Atilde
+		Adieresis Aring AE Ccedilla Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis
+		Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply Oslash Ugrave Uacute Ucircumflex
+		Udieresis Yacute Thorn germandbls agrave aacute acircumflex atilde adieresis aring ae ccedilla
+		egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis eth ntilde ograve oacute
+		ocircumflex otilde odieresis divide oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis`)
+	cp1252Glyphs = map[string]rune{
+		"Euro": '€', "quotesinglbase": '‚', "florin": 'ƒ', "quotedblbase": '„', "ellipsis": '…',
+		"dagger": '†', "daggerdbl": '‡', "circumflex": 'ˆ', "perthousand": '‰', "Scaron": 'Š',
+		"guilsinglleft": '‹', "OE": 'Œ', "Zcaron": 'Ž', "quoteleft": '‘', "quoteright": '’',
+		"quotedblleft": '“', "quotedblright": '”', "bullet": '•', "endash": '–', "emdash": '—',
+		"tilde": '˜', "trademark": '™', "scaron": 'š', "guilsinglright": '›', "oe": 'œ', "zcaron": 'ž',
+		"Ydieresis": 'Ÿ',
+	}
+	extraGlyphs = map[string]rune{
+		"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ', "dotlessi": 'ı', "Lslash": 'Ł',
+		"lslash": 'ł', "minus": '−', "fraction": '⁄', "caron": 'ˇ', "breve": '˘', "dotaccent": '˙',
+		"ring": '˚', "ogonek": '˛', "hungarumlaut": '˝', "Omega": 'Ω', "Delta": '∆', "nonbreakingspace": '\u00a0',
+		"mu1": 'µ', "middot": '·', "arrowright": '→', "arrowleft": '←', "quotereversed": '‛',
+	}
+)
+
+var glyphRunes = func() map[string]rune {
+	m := map[string]rune{}
+	for i, name := range asciiGlyphs {
+		m[name] = rune(0x20 + i)
+	}
+	for i, name := range latin1Glyphs {
+		m[name] = rune(0xa0 + i)
+	}
+	for name, r := range cp1252Glyphs {
+		m[name] = r
+	}
+	for name, r := range extraGlyphs {
+		m[name] = r
+	}
+	return m
+}()
+
+// glyphText maps a glyph name to text, following the Adobe Glyph List
+// conventions for uniXXXX, uXXXX and suffixed names like "a.sc".
+func glyphText(name string) string {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	if i := strings.IndexByte(name, '_'); i > 0 {
+		// Ligatures like f_f_i.
+		var b strings.Builder
+		for _, part := range strings.Split(name, "_") {
+			b.WriteString(glyphText(part))
+		}
+		return b.String()
+	}
+	if r, ok := glyphRunes[name]; ok {
+		return string(r)
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 && (len(name)-3)%4 == 0 {
+		var units []uint16
+		for i := 3; i < len(name); i += 4 {
+			v, err := strconv.ParseUint(name[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			units = append(units, uint16(v))
+		}
+		return string(utf16.Decode(units))
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if v, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+	return ""
+}
+
+type pdfEncoding [256]rune
+
+var (
+	winAnsiEncoding  pdfEncoding
+	macRomanEncoding pdfEncoding
+	standardEncoding pdfEncoding
+	pdfDocEncoding   pdfEncoding
+)
+
+const macRomanHigh = "ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø" +
+	"¿¡¬√ƒ≈∆«»…\u00a0ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔ\uf8ffÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ"
+
+func init() {
+	for c := 0x20; c < 0x7f; c++ {
+		winAnsiEncoding[c] = rune(c)
+		macRomanEncoding[c] = rune(c)
+		standardEncoding[c] = rune(c)
+		pdfDocEncoding[c] = rune(c)
+	}
+	for _, c := range []int{'\t', '\n', '\r'} {
+		pdfDocEncoding[c] = rune(c)
+	}
+	for c := 0xa0; c < 0x100; c++ {
+		winAnsiEncoding[c] = rune(c)
+		pdfDocEncoding[c] = rune(c)
+	}
+	win := []string{"Euro", "", "quotesinglbase", "florin", "quotedblbase", "ellipsis", "dagger", "daggerdbl",
+		"circumflex", "perthousand", "Scaron", "guilsinglleft", "OE", "", "Zcaron", "",
+		"", "quoteleft", "quoteright", "quotedblleft", "quotedblright", "bullet", "endash", "emdash",
+		"tilde", "trademark", "scaron", "guilsinglright", "oe", "", "zcaron", "Ydieresis"}
+	for i, name := range win {
+		winAnsiEncoding[0x80+i] = glyphRunes[name]
+	}
+	for i, r := range []rune(macRomanHigh) {
+		macRomanEncoding[0x80+i] = r
+	}
+
+	standardEncoding['\''] = '’'
+	standardEncoding['`'] = '‘'
+	std := map[int]string{
+		0xa1: "exclamdown", 0xa2: "cent", 0xa3: "sterling", 0xa4: "fraction", 0xa5: "yen", 0xa6: "florin",
+		0xa7: "section", 0xa8: "currency", 0xa9: "quotesingle", 0xaa: "quotedblleft", 0xab: "guillemotleft",
+		0xac: "guilsinglleft", 0xad: "guilsinglright", 0xae: "fi", 0xaf: "fl", 0xb1: "endash", 0xb2: "dagger",
+		0xb3: "daggerdbl", 0xb4: "periodcentered", 0xb6: "paragraph", 0xb7: "bullet", 0xb8: "quotesinglbase",
+		0xb9: "quotedblbase", 0xba: "quotedblright", 0xbb: "guillemotright", 0xbc: "ellipsis",
+		0xbd: "perthousand", 0xbf: "questiondown", 0xc1: "grave", 0xc2: "acute", 0xc3: "circumflex",
+		0xc4: "tilde", 0xc5: "macron", 0xc6: "breve", 0xc7: "dotaccent", 0xc8: "dieresis", 0xca: "ring",
+		0xcb: "cedilla", 0xcd: "hungarumlaut", 0xce: "ogonek", 0xcf: "caron", 0xd0: "emdash", 0xe1: "AE",
+		0xe3: "ordfeminine", 0xe8: "Lslash", 0xe9: "Oslash", 0xea: "OE", 0xeb: "ordmasculine", 0xf1: "ae",
+		0xf5: "dotlessi", 0xf8: "lslash", 0xf9: "oslash", 0xfa: "oe", 0xfb: "germandbls",
+	}
+	for c, name := range std {
+		standardEncoding[c] = glyphRunes[name]
+	}
+
+	doc := []string{"bullet", "dagger", "daggerdbl", "ellipsis", "emdash", "endash", "florin", "fraction",
+		"guilsinglleft", "guilsinglright", "minus", "perthousand", "quotedblbase", "quotedblleft",
+		"quotedblright", "quoteleft", "quoteright", "quotesinglbase", "trademark", "fi", "fl", "Lslash",
+		"OE", "Scaron", "Ydieresis", "Zcaron", "dotlessi", "lslash", "oe", "scaron", "zcaron", "", "Euro"}
+	for i, name := range doc {
+		pdfDocEncoding[0x80+i] = glyphRunes[name]
+	}
+}
+
+func encodingByName(name pdfName) *pdfEncoding {
+	switch name {
+	case "WinAnsiEncoding":
+		return &winAnsiEncoding
+	case "MacRomanEncoding", "MacExpertEncoding":
+		return &macRomanEncoding
+	case "StandardEncoding":
+		return &standardEncoding
+	case "PDFDocEncoding":
+		return &pdfDocEncoding
+	}
+	return nil
+}
+
+// decodePDFText decodes a text string from an info dictionary or
+// similar: UTF-16 or UTF-8 with a byte order mark, else PDFDocEncoding.
+func decodePDFText(s []byte) string {
+	switch {
+	case len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff:
+		return decodeUTF16(s[2:], true)
+	case len(s) >= 2 && s[0] == 0xff && s[1] == 0xfe:
+		return decodeUTF16(s[2:], false)
+	case len(s) >= 3 && s[0] == 0xef && s[1] == 0xbb && s[2] == 0xbf:
+		return strings.ToValidUTF8(string(s[3:]), "")
+	}
+	var b strings.Builder
+	for _, c := range s {
+		if r := pdfDocEncoding[c]; r != 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func decodeUTF16(s []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		} else {
+			units = append(units, uint16(s[i+1])<<8|uint16(s[i]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
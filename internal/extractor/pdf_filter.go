@@ -0,0 +1,332 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// maxPDFStream caps the decoded size of a single stream.
+const maxPDFStream = 64 << 20
+
+// decodeStream applies the stream's filters in order. Image filters are
+// reported as unsupported; text never lives in them.
+func (r *pdfReader) decodeStream(s *pdfStream) ([]byte, error) {
+	data := s.raw
+	filters := r.resolve(s.dict["Filter"])
+	params := r.resolve(s.dict["DecodeParms"])
+	if filters == nil {
+		return data, nil
+	}
+
+	var names []pdfName
+	var parms []pdfDict
+	switch f := filters.(type) {
+	case pdfName:
+		names = []pdfName{f}
+		p, _ := params.(pdfDict)
+		parms = []pdfDict{p}
+	case pdfArray:
+		pa, _ := params.(pdfArray)
+		for i, v := range f {
+			n, _ := r.resolve(v).(pdfName)
+			names = append(names, n)
+			var p pdfDict
+			if i < len(pa) {
+				p, _ = r.resolve(pa[i]).(pdfDict)
+			}
+			parms = append(parms, p)
+		}
+	default:
+		return nil, fmt.Errorf("pdf: bad /Filter")
+	}
+
+	var err error
+	for i, name := range names {
+		switch name {
+		case "FlateDecode", "Fl":
+			data, err = flateDecode(data)
+		case "LZWDecode", "LZW":
+			early := 1
+			if v, ok := pdfInt(r.resolve(parms[i]["EarlyChange"])); ok {
+				early = v
+			}
+			data, err = lzwDecode(data, early == 1)
+		case "ASCIIHexDecode", "AHx":
+			data = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		case "RunLengthDecode", "RL":
+			data = runLengthDecode(data)
+		case "Crypt":
+			// Identity crypt filter; decryption already happened.
+		default:
+			return nil, fmt.Errorf("pdf: unsupported filter %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name == "FlateDecode" || name == "Fl" || name == "LZWDecode" || name == "LZW" {
+			if data, err = r.unpredict(data, parms[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return data, nil
+}
+
+// flateDecode inflates zlib data, keeping whatever decoded before a
+// truncation or bad checksum, which are common in real files.
+func flateDecode(data []byte) ([]byte, error) {
+	var src io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		src = zr
+	} else if len(data) > 2 {
+		src = flate.NewReader(bytes.NewReader(data[2:]))
+	} else {
+		return nil, err
+	}
+	out, err := io.ReadAll(io.LimitReader(src, maxPDFStream))
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("pdf: flate: %w", err)
+	}
+	return out, nil
+}
+
+func (r *pdfReader) unpredict(data []byte, parms pdfDict) ([]byte, error) {
+	if parms == nil {
+		return data, nil
+	}
+	predictor, _ := pdfInt(r.resolve(parms["Predictor"]))
+	if predictor < 2 {
+		return data, nil
+	}
+	colors, bpc, columns := 1, 8, 1
+	if v, ok := pdfInt(r.resolve(parms["Colors"])); ok && v > 0 {
+		colors = v
+	}
+	if v, ok := pdfInt(r.resolve(parms["BitsPerComponent"])); ok && v > 0 {
+		bpc = v
+	}
+	if v, ok := pdfInt(r.resolve(parms["Columns"])); ok && v > 0 {
+		columns = v
+	}
+	bpp := (colors*bpc + 7) / 8
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	if predictor == 2 {
+		if bpc != 8 {
+			return data, nil
+		}
+		for row := 0; row+rowLen <= len(data); row += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				data[row+i] += data[row+i-bpp]
+			}
+		}
+		return data, nil
+	}
+
+	// PNG predictors: each row starts with its own filter type byte.
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos < len(data); pos += rowLen + 1 {
+		end := pos + 1 + rowLen
+		if end > len(data) {
+			break
+		}
+		kind, row := data[pos], append([]byte(nil), data[pos+1:end]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			case 0:
+			default:
+				return nil, fmt.Errorf("pdf: bad PNG predictor %d", kind)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func asciiHexDecode(data []byte) []byte {
+	out := make([]byte, 0, len(data)/2)
+	var hi byte
+	half := false
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		v, ok := hexValue(c)
+		if !ok {
+			continue
+		}
+		if half {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, hi<<4)
+	}
+	return out
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("<~")) {
+		data = bytes.TrimLeft(data, " \t\r\n")[2:]
+	}
+	var out []byte
+	var group [5]byte
+	n := 0
+	for _, c := range data {
+		if isPDFSpace(c) {
+			continue
+		}
+		if c == 'z' && n == 0 {
+			out = append(out, 0, 0, 0, 0)
+			continue
+		}
+		if c < '!' || c > 'u' {
+			return nil, fmt.Errorf("pdf: bad ASCII85 byte %q", c)
+		}
+		group[n] = c - '!'
+		if n++; n == 5 {
+			out = appendBase85(out, group, 4)
+			n = 0
+		}
+	}
+	if n > 1 {
+		for i := n; i < 5; i++ {
+			group[i] = 'u' - '!'
+		}
+		out = appendBase85(out, group, n-1)
+	}
+	return out, nil
+}
+
+func appendBase85(out []byte, g [5]byte, n int) []byte {
+	var v uint32
+	for _, d := range g {
+		v = v*85 + uint32(d)
+	}
+	b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	return append(out, b[:n]...)
+}
+
+func runLengthDecode(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n == 128:
+			return out
+		case n < 128:
+			end := i + n + 1
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[i:end]...)
+			i = end
+		default:
+			if i < len(data) {
+				out = append(out, bytes.Repeat(data[i:i+1], 257-n)...)
+			}
+			i++
+		}
+	}
+	return out
+}
+
+// lzwDecode implements the PDF flavour of LZW. compress/lzw cannot be
+// used because PDF switches code width one code early by default.
+func lzwDecode(data []byte, early bool) ([]byte, error) {
+	const clear, eod = 256, 257
+	var out []byte
+	table := make([][]byte, 258, 4096)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+	width := 9
+	var prev []byte
+	var bits uint32
+	nbits := 0
+	for _, b := range data {
+		bits = bits<<8 | uint32(b)
+		nbits += 8
+		for nbits >= width {
+			code := int(bits>>(nbits-width)) & (1<<width - 1)
+			nbits -= width
+			switch {
+			case code == clear:
+				table, width, prev = table[:258], 9, nil
+				continue
+			case code == eod:
+				return out, nil
+			}
+			var entry []byte
+			if code < len(table) {
+				entry = table[code]
+			} else if code == len(table) && prev != nil {
+				entry = append(append([]byte(nil), prev...), prev[0])
+			} else {
+				return out, fmt.Errorf("pdf: bad LZW code %d", code)
+			}
+			out = append(out, entry...)
+			if len(out) > maxPDFStream {
+				return nil, fmt.Errorf("pdf: LZW stream too large")
+			}
+			if prev != nil && len(table) < 4096 {
+				table = append(table, append(append([]byte(nil), prev...), entry[0]))
+			}
+			prev = entry
+			limit := len(table)
+			if early {
+				limit++
+			}
+			if limit >= 1<<width && width < 12 {
+				width++
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,360 @@
+package extractor
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfCMap is the part of a CMap needed for text: how to split a string
+// into codes, and for ToUnicode maps, the text of each code.
+type pdfCMap struct {
+	space  []codeRange
+	chars  map[string]string
+	ranges []bfRange
+}
+
+type codeRange struct {
+	lo, hi []byte
+}
+
+type bfRange struct {
+	lo, hi []byte
+	dst    []byte      // UTF-16BE of the first code, incremented along the range
+	dsts   []pdfString // or one destination per code
+}
+
+func (c codeRange) contains(code []byte) bool {
+	if len(code) != len(c.lo) {
+		return false
+	}
+	for i, b := range code {
+		if b < c.lo[i] || b > c.hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func codeValue(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+// parseCMap reads codespace ranges and bfchar/bfrange mappings. CID
+// mappings are skipped; only the codespace of an encoding CMap matters.
+func parseCMap(data []byte) *pdfCMap {
+	cm := &pdfCMap{chars: map[string]string{}}
+	l := newPDFLexer(data, 0)
+	l.noRefs = true
+	var operands []interface{}
+	for {
+		obj, err := l.object()
+		if err == errPDFEOF {
+			break
+		}
+		if err != nil {
+			operands = operands[:0]
+			continue
+		}
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					cm.space = append(cm.space, codeRange{lo: lo, hi: hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok := operands[i].(pdfString)
+				if !ok {
+					continue
+				}
+				switch dst := operands[i+1].(type) {
+				case pdfString:
+					cm.chars[string(src)] = decodeUTF16(dst, true)
+				case pdfName:
+					cm.chars[string(src)] = glyphText(string(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) {
+					continue
+				}
+				rng := bfRange{lo: lo, hi: hi}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					rng.dst = dst
+				case pdfArray:
+					for _, d := range dst {
+						s, _ := d.(pdfString)
+						rng.dsts = append(rng.dsts, s)
+					}
+				default:
+					continue
+				}
+				cm.ranges = append(cm.ranges, rng)
+			}
+		}
+		operands = operands[:0]
+	}
+	return cm
+}
+
+// lookup returns the text for code, and whether the CMap maps it.
+func (cm *pdfCMap) lookup(code []byte) (string, bool) {
+	if s, ok := cm.chars[string(code)]; ok {
+		return s, true
+	}
+	for _, r := range cm.ranges {
+		if !(codeRange{lo: r.lo, hi: r.hi}).contains(code) {
+			continue
+		}
+		off := codeValue(code) - codeValue(r.lo)
+		if r.dsts != nil {
+			if off < len(r.dsts) {
+				return decodeUTF16(r.dsts[off], true), true
+			}
+			return "", false
+		}
+		if len(r.dst) < 2 {
+			return "", false
+		}
+		units := make([]uint16, len(r.dst)/2)
+		for i := range units {
+			units[i] = uint16(r.dst[2*i])<<8 | uint16(r.dst[2*i+1])
+		}
+		units[len(units)-1] += uint16(off)
+		return string(utf16.Decode(units)), true
+	}
+	return "", false
+}
+
+// pdfFont decodes the strings shown with one font into text and glyph
+// widths, in thousandths of the font size.
+type pdfFont struct {
+	composite bool
+	space     []codeRange // how to split strings into codes
+	toUnicode *pdfCMap
+	encoding  *pdfEncoding
+	ucs2      bool // composite font whose codes are UTF-16
+	widths    map[int]float64
+	defWidth  float64
+	scale     float64 // glyph space to thousandths, for Type3 fonts
+}
+
+type pdfGlyph struct {
+	text  string
+	width float64
+	space bool // a single byte code 32, which gets word spacing
+}
+
+func (r *pdfReader) loadFont(v interface{}) *pdfFont {
+	d, _ := r.resolve(v).(pdfDict)
+	f := &pdfFont{widths: map[int]float64{}, defWidth: 500, scale: 1}
+	if d == nil {
+		f.encoding = &standardEncoding
+		return f
+	}
+	if s, ok := r.resolve(d["ToUnicode"]).(*pdfStream); ok {
+		if data, err := r.decodeStream(s); err == nil {
+			f.toUnicode = parseCMap(data)
+		}
+	}
+
+	if d.name("Subtype") == "Type0" {
+		f.composite = true
+		f.defWidth = 1000
+		switch enc := r.resolve(d["Encoding"]).(type) {
+		case pdfName:
+			f.ucs2 = strings.Contains(string(enc), "UCS2") || strings.Contains(string(enc), "UTF16")
+		case *pdfStream:
+			if data, err := r.decodeStream(enc); err == nil {
+				f.space = parseCMap(data).space
+			}
+		}
+		if f.space == nil {
+			f.space = []codeRange{{lo: []byte{0, 0}, hi: []byte{0xff, 0xff}}}
+		}
+		if kids, ok := r.resolve(d["DescendantFonts"]).(pdfArray); ok && len(kids) > 0 {
+			if cid, ok := r.resolve(kids[0]).(pdfDict); ok {
+				r.loadCIDWidths(f, cid)
+			}
+		}
+		return f
+	}
+
+	if d.name("Subtype") == "Type1" || d.name("Subtype") == "MMType1" {
+		f.encoding = &standardEncoding
+	} else {
+		f.encoding = &winAnsiEncoding
+	}
+	switch enc := r.resolve(d["Encoding"]).(type) {
+	case pdfName:
+		if e := encodingByName(enc); e != nil {
+			f.encoding = e
+		}
+	case pdfDict:
+		if e := encodingByName(enc.name("BaseEncoding")); e != nil {
+			f.encoding = e
+		}
+		if diffs, ok := r.resolve(enc["Differences"]).(pdfArray); ok {
+			custom := *f.encoding
+			code := 0
+			for _, v := range diffs {
+				switch x := r.resolve(v).(type) {
+				case int64:
+					code = int(x)
+				case pdfName:
+					if code >= 0 && code < 256 {
+						if text := []rune(glyphText(string(x))); len(text) == 1 {
+							custom[code] = text[0]
+						}
+					}
+					code++
+				}
+			}
+			f.encoding = &custom
+		}
+	}
+
+	if d.name("Subtype") == "Type3" {
+		if m, ok := r.resolve(d["FontMatrix"]).(pdfArray); ok && len(m) > 0 {
+			if a, ok := pdfNumber(r.resolve(m[0])); ok && a != 0 {
+				f.scale = a * 1000
+			}
+		}
+	}
+	if desc, ok := r.resolve(d["FontDescriptor"]).(pdfDict); ok {
+		if w, ok := pdfNumber(r.resolve(desc["MissingWidth"])); ok && w > 0 {
+			f.defWidth = w
+		}
+	}
+	first, _ := pdfInt(r.resolve(d["FirstChar"]))
+	if widths, ok := r.resolve(d["Widths"]).(pdfArray); ok {
+		for i, w := range widths {
+			if n, ok := pdfNumber(r.resolve(w)); ok {
+				f.widths[first+i] = n
+			}
+		}
+	}
+	return f
+}
+
+func (r *pdfReader) loadCIDWidths(f *pdfFont, cid pdfDict) {
+	if dw, ok := pdfNumber(r.resolve(cid["DW"])); ok {
+		f.defWidth = dw
+	}
+	w, _ := r.resolve(cid["W"]).(pdfArray)
+	for i := 0; i < len(w); {
+		first, ok := pdfInt(r.resolve(w[i]))
+		if !ok || i+1 >= len(w) {
+			return
+		}
+		if list, ok := r.resolve(w[i+1]).(pdfArray); ok {
+			for j, v := range list {
+				if n, ok := pdfNumber(r.resolve(v)); ok {
+					f.widths[first+j] = n
+				}
+			}
+			i += 2
+			continue
+		}
+		last, ok1 := pdfInt(r.resolve(w[i+1]))
+		if i+2 >= len(w) || !ok1 || last-first > 65535 {
+			return
+		}
+		if n, ok := pdfNumber(r.resolve(w[i+2])); ok {
+			for c := first; c <= last; c++ {
+				f.widths[c] = n
+			}
+		}
+		i += 3
+	}
+}
+
+// decode splits s into glyphs.
+func (f *pdfFont) decode(s []byte) []pdfGlyph {
+	var glyphs []pdfGlyph
+	for i := 0; i < len(s); {
+		n := f.codeLen(s[i:])
+		code := s[i : i+n]
+		i += n
+
+		g := pdfGlyph{width: f.defWidth}
+		v := codeValue(code)
+		if w, ok := f.widths[v]; ok {
+			g.width = w
+		}
+		g.width *= f.scale
+		g.space = n == 1 && v == 32
+
+		if text, ok := f.lookup(code); ok {
+			g.text = text
+		} else if f.composite {
+			if f.ucs2 {
+				g.text = decodeUTF16(code, true)
+			}
+		} else if r := f.encoding[v]; r != 0 {
+			g.text = string(r)
+		}
+		glyphs = append(glyphs, g)
+	}
+	return glyphs
+}
+
+func (f *pdfFont) lookup(code []byte) (string, bool) {
+	if f.toUnicode == nil {
+		return "", false
+	}
+	if text, ok := f.toUnicode.lookup(code); ok {
+		return text, true
+	}
+	// Some producers write two-byte maps for simple fonts.
+	if len(code) == 1 {
+		return f.toUnicode.lookup([]byte{0, code[0]})
+	}
+	return "", false
+}
+
+// codeLen returns the byte length of the code at the start of s. Simple
+// fonts always use single bytes; composite fonts follow their codespace.
+func (f *pdfFont) codeLen(s []byte) int {
+	if !f.composite {
+		return 1
+	}
+	space := f.space
+	shortest := 0
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		for _, r := range space {
+			if len(r.lo) != n {
+				continue
+			}
+			if shortest == 0 {
+				shortest = n
+			}
+			if r.contains(s[:n]) {
+				return n
+			}
+		}
+	}
+	if shortest == 0 {
+		shortest = 1
+		if len(space) > 0 {
+			shortest = len(space[0].lo)
+		}
+	}
+	return min(shortest, len(s))
+}
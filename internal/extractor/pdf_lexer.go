@@ -0,0 +1,396 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// PDF object model. Integers and reals are int64 and float64, booleans are
+// bool and null is nil.
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfKeyword string
+	pdfArray   []interface{}
+	pdfDict    map[pdfName]interface{}
+)
+
+type pdfRef struct {
+	num, gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+	ref  pdfRef
+}
+
+var errPDFSyntax = errors.New("pdf: syntax error")
+
+// pdfLexer reads tokens and objects from PDF bytes. Content streams are
+// read with refs disabled, since "1 0 R" is not an operator there.
+type pdfLexer struct {
+	data   []byte
+	pos    int
+	noRefs bool
+	depth  int
+}
+
+func newPDFLexer(data []byte, pos int) *pdfLexer {
+	return &pdfLexer{data: data, pos: pos}
+}
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// token returns the next token: a number, name, string, keyword, or one
+// of the delimiters "[", "]", "<<", ">>", "{", "}" as a keyword.
+func (l *pdfLexer) token() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFEOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.name(), nil
+	case c == '(':
+		return l.literalString(), nil
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return l.hexString(), nil
+	case c == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		l.pos++
+		return nil, errPDFSyntax
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(c), nil
+	case c == ')':
+		l.pos++
+		return nil, errPDFSyntax
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	word := l.data[start:l.pos]
+	if n, ok := parsePDFNumber(word); ok {
+		return n, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+var errPDFEOF = errors.New("pdf: unexpected end of data")
+
+func parsePDFNumber(b []byte) (interface{}, bool) {
+	if len(b) == 0 {
+		return nil, false
+	}
+	c := b[0]
+	if !(c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.') {
+		return nil, false
+	}
+	if bytes.IndexByte(b, '.') < 0 {
+		if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n, true
+		}
+	}
+	// Producers write things like "--1.5" or "1.5.2"; keep what parses.
+	s := string(bytes.TrimLeft(b, "+-"))
+	if len(s) < len(b) && b[0] == '-' {
+		s = "-" + s
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	for end := len(s); end > 0; end-- {
+		if f, err := strconv.ParseFloat(s[:end], 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func (l *pdfLexer) name() pdfName {
+	l.pos++ // '/'
+	var buf []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) || isPDFDelim(c) {
+			break
+		}
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				buf = append(buf, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		buf = append(buf, c)
+		l.pos++
+	}
+	return pdfName(buf)
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // '('
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return buf
+			}
+		case '\r':
+			// An unescaped end of line is a single newline.
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			c = '\n'
+		case '\\':
+			if l.pos >= len(l.data) {
+				return buf
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++ // '<'
+	var buf []byte
+	var hi byte
+	half := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		v, ok := hexValue(c)
+		if !ok {
+			continue
+		}
+		if half {
+			buf = append(buf, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		buf = append(buf, hi<<4)
+	}
+	return buf
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// object reads a complete object. Arrays and dictionaries are read
+// recursively, and "n g R" becomes a pdfRef unless refs are disabled.
+func (l *pdfLexer) object() (interface{}, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case pdfKeyword:
+		switch t {
+		case "[":
+			return l.array()
+		case "<<":
+			return l.dict()
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t, nil
+	case int64:
+		if l.noRefs || t < 0 {
+			return t, nil
+		}
+		save := l.pos
+		if gen, err := l.token(); err == nil {
+			if g, ok := gen.(int64); ok && g >= 0 {
+				if kw, err := l.token(); err == nil && kw == pdfKeyword("R") {
+					return pdfRef{num: int(t), gen: int(g)}, nil
+				}
+			}
+		}
+		l.pos = save
+		return t, nil
+	}
+	return tok, nil
+}
+
+const maxPDFNesting = 256
+
+func (l *pdfLexer) array() (pdfArray, error) {
+	l.depth++
+	defer func() { l.depth-- }()
+	if l.depth > maxPDFNesting {
+		return nil, fmt.Errorf("pdf: objects nested too deeply")
+	}
+	var arr pdfArray
+	for {
+		obj, err := l.object()
+		if err != nil {
+			return arr, err
+		}
+		if kw, ok := obj.(pdfKeyword); ok {
+			if kw == "]" {
+				return arr, nil
+			}
+			if kw == ">>" || kw == "endobj" {
+				return arr, errPDFSyntax
+			}
+		}
+		arr = append(arr, obj)
+	}
+}
+
+func (l *pdfLexer) dict() (pdfDict, error) {
+	l.depth++
+	defer func() { l.depth-- }()
+	if l.depth > maxPDFNesting {
+		return nil, fmt.Errorf("pdf: objects nested too deeply")
+	}
+	d := pdfDict{}
+	for {
+		key, err := l.object()
+		if err != nil {
+			return d, err
+		}
+		if kw, ok := key.(pdfKeyword); ok {
+			if kw == ">>" {
+				return d, nil
+			}
+			if kw == "]" || kw == "endobj" || kw == "stream" {
+				return d, errPDFSyntax
+			}
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			continue
+		}
+		val, err := l.object()
+		if err != nil {
+			return d, err
+		}
+		if kw, ok := val.(pdfKeyword); ok && kw == ">>" {
+			return d, nil
+		}
+		d[name] = val
+	}
+}
+
+// Typed accessors on dictionaries. None of them resolve references.
+
+func (d pdfDict) name(key pdfName) pdfName {
+	n, _ := d[key].(pdfName)
+	return n
+}
+
+func pdfNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func pdfInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
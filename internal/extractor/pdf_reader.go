@@ -0,0 +1,489 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+type xrefEntry struct {
+	offset   int
+	gen      int
+	inStream bool
+	stream   int // object stream number when inStream
+	index    int
+}
+
+// pdfReader gives access to the objects of a PDF file through its cross
+// reference table, rebuilding the table by scanning when it is damaged.
+type pdfReader struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer pdfDict
+	crypt   *pdfCrypt
+
+	cache     map[int]interface{}
+	objStms   map[int]*objStm
+	resolving map[int]bool
+}
+
+type objStm struct {
+	data    []byte
+	offsets []int
+}
+
+func newPDFReader(data []byte) (*pdfReader, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, errors.New("pdf: missing %PDF header")
+	}
+	r := &pdfReader{
+		data:      data,
+		xref:      map[int]xrefEntry{},
+		cache:     map[int]interface{}{},
+		objStms:   map[int]*objStm{},
+		resolving: map[int]bool{},
+	}
+	if err := r.loadXref(); err != nil || r.catalog() == nil {
+		r.xref = map[int]xrefEntry{}
+		r.trailer = nil
+		r.cache = map[int]interface{}{}
+		if err := r.reconstruct(); err != nil {
+			return nil, err
+		}
+	}
+	if enc := r.trailer["Encrypt"]; enc != nil {
+		c, err := r.newCrypt(enc)
+		if err != nil {
+			return nil, err
+		}
+		r.crypt = c
+		r.cache = map[int]interface{}{}
+		r.objStms = map[int]*objStm{}
+	}
+	return r, nil
+}
+
+func (r *pdfReader) catalog() pdfDict {
+	d, _ := r.resolve(r.trailer["Root"]).(pdfDict)
+	return d
+}
+
+func (r *pdfReader) loadXref() error {
+	tail := r.data[max(0, len(r.data)-2048):]
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return errors.New("pdf: no startxref")
+	}
+	l := newPDFLexer(tail, i+len("startxref"))
+	tok, err := l.token()
+	if err != nil {
+		return err
+	}
+	off, ok := tok.(int64)
+	if !ok {
+		return errors.New("pdf: bad startxref")
+	}
+
+	seen := map[int]bool{}
+	for pos := int(off); pos > 0 && !seen[pos]; {
+		seen[pos] = true
+		trailer, err := r.readXrefSection(pos)
+		if err != nil {
+			return err
+		}
+		if r.trailer == nil {
+			r.trailer = trailer
+		}
+		// Hybrid files keep part of the table in a stream.
+		if stm, ok := pdfInt(trailer["XRefStm"]); ok && !seen[stm] {
+			seen[stm] = true
+			if _, err := r.readXrefSection(stm); err != nil {
+				return err
+			}
+		}
+		prev, ok := pdfInt(trailer["Prev"])
+		if !ok {
+			break
+		}
+		pos = prev
+	}
+	if r.trailer == nil {
+		return errors.New("pdf: no trailer")
+	}
+	return nil
+}
+
+// add records an entry unless a newer section already did.
+func (r *pdfReader) add(num int, e xrefEntry) {
+	if _, ok := r.xref[num]; !ok {
+		r.xref[num] = e
+	}
+}
+
+func (r *pdfReader) readXrefSection(pos int) (pdfDict, error) {
+	if pos >= len(r.data) {
+		return nil, errors.New("pdf: xref offset out of range")
+	}
+	l := newPDFLexer(r.data, pos)
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == pdfKeyword("xref") {
+		return r.readXrefTable(l)
+	}
+
+	l.pos = pos
+	_, obj, err := r.parseIndirect(l)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := obj.(*pdfStream)
+	if !ok || s.dict.name("Type") != "XRef" {
+		return nil, errors.New("pdf: xref offset does not point at a table")
+	}
+	return s.dict, r.readXrefStream(s)
+}
+
+func (r *pdfReader) readXrefTable(l *pdfLexer) (pdfDict, error) {
+	for {
+		tok, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == pdfKeyword("trailer") {
+			obj, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			d, ok := obj.(pdfDict)
+			if !ok {
+				return nil, errors.New("pdf: bad trailer")
+			}
+			return d, nil
+		}
+		start, ok1 := tok.(int64)
+		countTok, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+		count, ok2 := countTok.(int64)
+		if !ok1 || !ok2 || count < 0 {
+			return nil, errors.New("pdf: bad xref subsection")
+		}
+		for i := int64(0); i < count; i++ {
+			offTok, _ := l.token()
+			genTok, _ := l.token()
+			kind, _ := l.token()
+			off, ok1 := offTok.(int64)
+			gen, ok2 := genTok.(int64)
+			if !ok1 || !ok2 {
+				return nil, errors.New("pdf: bad xref entry")
+			}
+			if kind == pdfKeyword("n") {
+				r.add(int(start+i), xrefEntry{offset: int(off), gen: int(gen)})
+			} else {
+				r.add(int(start+i), xrefEntry{offset: -1})
+			}
+		}
+	}
+}
+
+func (r *pdfReader) readXrefStream(s *pdfStream) error {
+	data, err := r.decodeStream(s)
+	if err != nil {
+		return err
+	}
+	w, ok := s.dict["W"].(pdfArray)
+	if !ok || len(w) < 3 {
+		return errors.New("pdf: xref stream without /W")
+	}
+	var widths [3]int
+	for i := range widths {
+		widths[i], _ = pdfInt(w[i])
+		if widths[i] < 0 || widths[i] > 8 {
+			return errors.New("pdf: bad xref stream /W")
+		}
+	}
+	rowLen := widths[0] + widths[1] + widths[2]
+	if rowLen == 0 {
+		return errors.New("pdf: bad xref stream /W")
+	}
+
+	index, _ := s.dict["Index"].(pdfArray)
+	if index == nil {
+		size, _ := pdfInt(s.dict["Size"])
+		index = pdfArray{int64(0), int64(size)}
+	}
+	field := func(b []byte) int {
+		v := 0
+		for _, c := range b {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := pdfInt(index[i])
+		count, _ := pdfInt(index[i+1])
+		for j := 0; j < count && pos+rowLen <= len(data); j++ {
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+			kind := 1
+			if widths[0] > 0 {
+				kind = field(row[:widths[0]])
+			}
+			a := field(row[widths[0] : widths[0]+widths[1]])
+			b := field(row[widths[0]+widths[1]:])
+			switch kind {
+			case 0:
+				r.add(start+j, xrefEntry{offset: -1})
+			case 1:
+				r.add(start+j, xrefEntry{offset: a, gen: b})
+			case 2:
+				r.add(start+j, xrefEntry{inStream: true, stream: a, index: b})
+			}
+		}
+	}
+	return nil
+}
+
+var objHeader = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+
+// reconstruct rebuilds the cross reference table by scanning for object
+// headers, for files whose table is missing or points at the wrong
+// offsets. Later definitions win, as they would after incremental updates.
+func (r *pdfReader) reconstruct() error {
+	for _, m := range objHeader.FindAllSubmatchIndex(r.data, -1) {
+		if m[0] > 0 && !isPDFSpace(r.data[m[0]-1]) && !isPDFDelim(r.data[m[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(r.data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(r.data[m[4]:m[5]]))
+		r.xref[num] = xrefEntry{offset: m[0], gen: gen}
+	}
+	if len(r.xref) == 0 {
+		return errors.New("pdf: no objects found")
+	}
+
+	// Objects inside object streams are only reachable through them.
+	var streams []int
+	for num := range r.xref {
+		if s, ok := r.object(num).(*pdfStream); ok && s.dict.name("Type") == "ObjStm" {
+			streams = append(streams, num)
+		}
+	}
+	for _, num := range streams {
+		stm, err := r.objStm(num)
+		if err != nil {
+			continue
+		}
+		for i, n := range stm.offsets {
+			if i%2 == 0 {
+				if _, ok := r.xref[n]; !ok {
+					r.xref[n] = xrefEntry{inStream: true, stream: num, index: i / 2}
+				}
+			}
+		}
+	}
+
+	r.trailer = pdfDict{}
+	for i := bytes.Index(r.data, []byte("trailer")); i >= 0; {
+		l := newPDFLexer(r.data, i+len("trailer"))
+		if d, err := l.object(); err == nil {
+			if d, ok := d.(pdfDict); ok {
+				for k, v := range d {
+					r.trailer[k] = v
+				}
+			}
+		}
+		next := bytes.Index(r.data[i+1:], []byte("trailer"))
+		if next < 0 {
+			break
+		}
+		i += 1 + next
+	}
+	if r.catalog() == nil {
+		r.cache = map[int]interface{}{}
+		for num := range r.xref {
+			if d, ok := r.object(num).(pdfDict); ok && d.name("Type") == "Catalog" {
+				r.trailer["Root"] = pdfRef{num: num, gen: r.xref[num].gen}
+			}
+			if s, ok := r.object(num).(*pdfStream); ok && s.dict.name("Type") == "XRef" {
+				for _, k := range []pdfName{"Root", "Info", "Encrypt", "ID"} {
+					if v, ok := s.dict[k]; ok {
+						r.trailer[k] = v
+					}
+				}
+			}
+		}
+	}
+	if r.catalog() == nil {
+		return errors.New("pdf: no document catalog")
+	}
+	return nil
+}
+
+// resolve follows references until it reaches a direct object.
+func (r *pdfReader) resolve(v interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = r.object(ref.num)
+	}
+	return nil
+}
+
+func (r *pdfReader) object(num int) interface{} {
+	if v, ok := r.cache[num]; ok {
+		return v
+	}
+	if r.resolving[num] {
+		return nil
+	}
+	r.resolving[num] = true
+	defer delete(r.resolving, num)
+
+	v, err := r.loadObject(num)
+	if err != nil {
+		v = nil
+	}
+	r.cache[num] = v
+	return v
+}
+
+func (r *pdfReader) loadObject(num int) (interface{}, error) {
+	e, ok := r.xref[num]
+	if !ok || (!e.inStream && e.offset < 0) {
+		return nil, nil
+	}
+	if e.inStream {
+		stm, err := r.objStm(e.stream)
+		if err != nil {
+			return nil, err
+		}
+		if 2*e.index+1 >= len(stm.offsets) || stm.offsets[2*e.index] != num {
+			return nil, fmt.Errorf("pdf: object %d missing from object stream %d", num, e.stream)
+		}
+		l := newPDFLexer(stm.data, stm.offsets[2*e.index+1])
+		return l.object()
+	}
+	if e.offset >= len(r.data) {
+		return nil, fmt.Errorf("pdf: object %d offset out of range", num)
+	}
+	ref, obj, err := r.parseIndirect(newPDFLexer(r.data, e.offset))
+	if err != nil {
+		return nil, err
+	}
+	if ref.num != num {
+		return nil, fmt.Errorf("pdf: xref entry for %d points at object %d", num, ref.num)
+	}
+	return obj, nil
+}
+
+// parseIndirect reads "num gen obj ... endobj" at the lexer position.
+func (r *pdfReader) parseIndirect(l *pdfLexer) (pdfRef, interface{}, error) {
+	var ref pdfRef
+	numTok, _ := l.token()
+	genTok, _ := l.token()
+	kw, _ := l.token()
+	n, ok1 := numTok.(int64)
+	g, ok2 := genTok.(int64)
+	if !ok1 || !ok2 || kw != pdfKeyword("obj") {
+		return ref, nil, errors.New("pdf: bad object header")
+	}
+	ref = pdfRef{num: int(n), gen: int(g)}
+
+	obj, err := l.object()
+	if err != nil {
+		return ref, nil, err
+	}
+	if r.crypt != nil && ref.num != 0 {
+		obj = r.crypt.decryptStrings(obj, ref)
+	}
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return ref, obj, nil
+	}
+	save := l.pos
+	if tok, _ := l.token(); tok != pdfKeyword("stream") {
+		l.pos = save
+		return ref, obj, nil
+	}
+
+	// The keyword is followed by CRLF or LF; tolerate a lone CR.
+	start := l.pos
+	if start < len(r.data) && l.data[start] == '\r' {
+		start++
+	}
+	if start < len(l.data) && l.data[start] == '\n' {
+		start++
+	}
+	end := -1
+	if length, ok := pdfInt(r.resolve(dict["Length"])); ok && length >= 0 && start+length <= len(l.data) {
+		rest := bytes.TrimLeft(l.data[start+length:min(len(l.data), start+length+32)], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			end = start + length
+		}
+	}
+	if end < 0 {
+		i := bytes.Index(l.data[start:], []byte("endstream"))
+		if i < 0 {
+			return ref, nil, errors.New("pdf: unterminated stream")
+		}
+		end = start + i
+		for end > start && (l.data[end-1] == '\n' || l.data[end-1] == '\r') {
+			end--
+		}
+	}
+	s := &pdfStream{dict: dict, raw: l.data[start:end], ref: ref}
+	if r.crypt != nil && dict.name("Type") != "XRef" {
+		s.raw = r.crypt.decryptStream(s)
+	}
+	return ref, s, nil
+}
+
+func (r *pdfReader) objStm(num int) (*objStm, error) {
+	if stm, ok := r.objStms[num]; ok {
+		if stm == nil {
+			return nil, fmt.Errorf("pdf: object stream %d unreadable", num)
+		}
+		return stm, nil
+	}
+	r.objStms[num] = nil
+	s, ok := r.object(num).(*pdfStream)
+	if !ok {
+		return nil, fmt.Errorf("pdf: object stream %d missing", num)
+	}
+	data, err := r.decodeStream(s)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := pdfInt(s.dict["N"])
+	first, _ := pdfInt(s.dict["First"])
+	if first < 0 || first > len(data) {
+		return nil, fmt.Errorf("pdf: bad object stream %d", num)
+	}
+	l := newPDFLexer(data[:first], 0)
+	stm := &objStm{data: data}
+	for i := 0; i < 2*n; i++ {
+		tok, err := l.token()
+		if err != nil {
+			break
+		}
+		v, ok := tok.(int64)
+		if !ok {
+			break
+		}
+		if i%2 == 1 {
+			v += int64(first)
+		}
+		stm.offsets = append(stm.offsets, int(v))
+	}
+	r.objStms[num] = stm
+	return stm, nil
+}
@@ -0,0 +1,265 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPDF assembles a PDF from object bodies; object n is objs[n-1].
+type testPDF struct {
+	objs []string
+}
+
+func (p *testPDF) add(body string) int {
+	p.objs = append(p.objs, body)
+	return len(p.objs)
+}
+
+func (p *testPDF) stream(dict string, data []byte) int {
+	return p.add(fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data))
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// bytes writes the file with a classic cross reference table.
+func (p *testPDF) bytes(trailer string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(p.objs))
+	for i, body := range p.objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(p.objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", len(p.objs)+1, trailer, xref)
+	return buf.Bytes()
+}
+
+func simplePDF() *testPDF {
+	p := &testPDF{}
+	p.add("<< /Type /Catalog /Pages 2 0 R >>")
+	p.add("<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R >> >> >>")
+	p.add("<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>")
+	p.add("<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>")
+	p.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	p.stream("", []byte("BT /F1 12 Tf 72 720 Td (Hello) Tj ( World) Tj 0 -14 Td [(Sec) 20 (ond) -300 (line)] TJ ET"))
+	p.stream("/Filter /FlateDecode", deflate([]byte("BT /F1 10 Tf 14 TL 72 720 Td (Page two) Tj (caf\\351) ' ET")))
+	p.add("<< /Title (Quarterly Report) /Author <FEFF004A006F00EB> /CreationDate (D:20240315103000+01'00') >>")
+	return p
+}
+
+func TestParsePDF(t *testing.T) {
+	doc, err := ParsePDF(simplePDF().bytes("/Root 1 0 R /Info 8 0 R"))
+	if err != nil {
+		t.Fatalf("ParsePDF() error = %v", err)
+	}
+	want := []string{"Hello World\nSecond line", "Page two\ncafé"}
+	if len(doc.Pages) != len(want) {
+		t.Fatalf("got %d pages, want %d", len(doc.Pages), len(want))
+	}
+	for i := range want {
+		if doc.Pages[i] != want[i] {
+			t.Errorf("page %d = %q, want %q", i+1, doc.Pages[i], want[i])
+		}
+	}
+	if doc.Info.Title != "Quarterly Report" || doc.Info.Author != "Joë" {
+		t.Errorf("info = %+v", doc.Info)
+	}
+	created := time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC)
+	if !doc.Info.Created.Equal(created) {
+		t.Errorf("created = %v, want %v", doc.Info.Created, created)
+	}
+	if !strings.Contains(doc.Text(), "line"+PageBreak+"Page") {
+		t.Errorf("pages not separated: %q", doc.Text())
+	}
+}
+
+func TestParsePDF_DamagedXref(t *testing.T) {
+	data := simplePDF().bytes("/Root 1 0 R /Info 8 0 R")
+	i := bytes.LastIndex(data, []byte("startxref\n"))
+	broken := append(append([]byte(nil), data[:i]...), []byte("startxref\n99999\n%%EOF\n")...)
+
+	doc, err := ParsePDF(broken)
+	if err != nil {
+		t.Fatalf("ParsePDF() error = %v", err)
+	}
+	if len(doc.Pages) != 2 || doc.Pages[0] != "Hello World\nSecond line" || doc.Info.Title != "Quarterly Report" {
+		t.Errorf("rebuilt document = %q, %+v", doc.Pages, doc.Info)
+	}
+}
+
+// TestParsePDF_ObjectStreams covers PDF 1.5 files: objects packed into a
+// compressed object stream, a cross reference stream with a PNG
+// predictor, and a composite font mapped through a ToUnicode CMap.
+func TestParsePDF_ObjectStreams(t *testing.T) {
+	cmap := `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0003> <0020>
+<0010> <00660069>
+endbfchar
+1 beginbfrange
+<0020> <0039> <0041>
+endbfrange
+endcmap
+end end`
+	content := "BT /F1 12 Tf 72 720 Td <00270024002B002B002E00030010> Tj ET"
+
+	packed := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R /Resources << /Font << /F1 4 0 R >> >> >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Embedded /Encoding /Identity-H /DescendantFonts [5 0 R] /ToUnicode 7 0 R >>",
+		"<< /Type /Font /Subtype /CIDFontType2 /DW 600 >>",
+	}
+	var header, body bytes.Buffer
+	for i, obj := range packed {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	stm := deflate(append(header.Bytes(), body.Bytes()...))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+	offsets := map[int]int{}
+	write := func(num int, dict string, data []byte) {
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n%s\nendstream\nendobj\n", num, dict, len(data), data)
+	}
+	write(6, "/Filter /FlateDecode", deflate([]byte(content)))
+	write(7, "", []byte(cmap))
+	write(8, fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(packed), header.Len()), stm)
+
+	// Rows of type(1) offset-or-stream(2) index(1), PNG Up predicted.
+	var rows, prev []byte
+	prev = make([]byte, 4)
+	entry := func(kind, a, b int) {
+		row := []byte{byte(kind), byte(a >> 8), byte(a), byte(b)}
+		rows = append(rows, 2)
+		for i := range row {
+			rows = append(rows, row[i]-prev[i])
+		}
+		prev = row
+	}
+	entry(0, 0, 255)
+	for i := range packed {
+		entry(2, 8, i)
+	}
+	entry(1, offsets[6], 0)
+	entry(1, offsets[7], 0)
+	entry(1, offsets[8], 0)
+	xref := buf.Len()
+	entry(1, xref, 0)
+	write(9, "/Type /XRef /Size 10 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >>", deflate(rows))
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xref)
+
+	doc, err := ParsePDF(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParsePDF() error = %v", err)
+	}
+	if len(doc.Pages) != 1 || doc.Pages[0] != "HELLO fi" {
+		t.Errorf("pages = %q, want [\"HELLO fi\"]", doc.Pages)
+	}
+}
+
+func TestParsePDF_Differences(t *testing.T) {
+	p := &testPDF{}
+	p.add("<< /Type /Catalog /Pages 2 0 R >>")
+	p.add("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	p.add("<< /Type /Page /Parent 2 0 R /Contents 5 0 R /Resources << /Font << /F1 4 0 R >> >> >>")
+	p.add("<< /Type /Font /Subtype /Type1 /Encoding << /BaseEncoding /WinAnsiEncoding /Differences [65 /eacute /uni263A /f_i] >> >>")
+	p.stream("", []byte("BT /F1 12 Tf (ABCD) Tj ET"))
+
+	doc, err := ParsePDF(p.bytes("/Root 1 0 R"))
+	if err != nil {
+		t.Fatalf("ParsePDF() error = %v", err)
+	}
+	// A multi-character glyph cannot live in a single-byte encoding, so
+	// /f_i keeps the base encoding's C.
+	if got := doc.Text(); got != "é☺CD" {
+		t.Errorf("text = %q, want %q", got, "é☺CD")
+	}
+}
+
+// TestParsePDF_Encrypted opens a file protected with RC4 40-bit and an
+// empty user password, as written by "no copy" settings.
+func TestParsePDF_Encrypted(t *testing.T) {
+	id := []byte("0123456789abcdef")
+	owner := bytes.Repeat([]byte{0x42}, 32)
+	h := md5.New()
+	h.Write(pdfPadding)
+	h.Write(owner)
+	h.Write([]byte{0xfc, 0xff, 0xff, 0xff}) // P = -4
+	h.Write(id)
+	key := h.Sum(nil)[:5]
+	objKey := func(num int) []byte {
+		sum := md5.Sum(append(append([]byte(nil), key...), byte(num), 0, 0, 0, 0))
+		return sum[:10]
+	}
+
+	p := &testPDF{}
+	p.add("<< /Type /Catalog /Pages 2 0 R >>")
+	p.add("<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 << /Subtype /Type1 >> >> >> >>")
+	p.add("<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>")
+	p.stream("", rc4Crypt(objKey(4), []byte("BT /F1 12 Tf (Secret plans) Tj ET")))
+	p.add(fmt.Sprintf("<< /Title <%x> >>", rc4Crypt(objKey(5), []byte("Classified"))))
+	p.add(fmt.Sprintf("<< /Filter /Standard /V 1 /R 2 /O <%x> /U <%x> /P -4 >>", owner, rc4Crypt(key, pdfPadding)))
+
+	doc, err := ParsePDF(p.bytes(fmt.Sprintf("/Root 1 0 R /Info 5 0 R /Encrypt 6 0 R /ID [<%x> <%x>]", id, id)))
+	if err != nil {
+		t.Fatalf("ParsePDF() error = %v", err)
+	}
+	if doc.Text() != "Secret plans" || doc.Info.Title != "Classified" {
+		t.Errorf("got %q, title %q", doc.Text(), doc.Info.Title)
+	}
+
+	wrong := fmt.Sprintf("/Root 1 0 R /Encrypt 6 0 R /ID [<%x> <%x>]", "other", "other")
+	if _, err := ParsePDF(p.bytes(wrong)); err != ErrPDFPassword {
+		t.Errorf("mismatched ID: got %v, want ErrPDFPassword", err)
+	}
+}
+
+func TestParsePDF_NotPDF(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("hello"), []byte("%PDF-1.4\ngarbage")} {
+		if _, err := ParsePDF(data); err == nil {
+			t.Errorf("ParsePDF(%q) succeeded", data)
+		}
+	}
+}
+
+func TestParsePDFDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"D:20240315103000Z", time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)},
+		{"D:20240315103000-05'30'", time.Date(2024, 3, 15, 16, 0, 0, 0, time.UTC)},
+		{"D:2023", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"20231201", time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"yesterday", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := parsePDFDate(tt.in); !got.Equal(tt.want) {
+			t.Errorf("parsePDFDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
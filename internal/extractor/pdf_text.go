@@ -0,0 +1,360 @@
+package extractor
+
+import (
+	"bytes"
+	"math"
+	"strings"
+)
+
+type pdfMatrix [6]float64
+
+var identityMatrix = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n.
+func (m pdfMatrix) mul(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func matrixFrom(operands []interface{}) (pdfMatrix, bool) {
+	var m pdfMatrix
+	if len(operands) < 6 {
+		return m, false
+	}
+	for i, v := range operands[len(operands)-6:] {
+		n, ok := pdfNumber(v)
+		if !ok {
+			return m, false
+		}
+		m[i] = n
+	}
+	return m, true
+}
+
+type gState struct {
+	ctm     pdfMatrix
+	font    *pdfFont
+	size    float64
+	charSp  float64
+	wordSp  float64
+	hScale  float64
+	leading float64
+	rise    float64
+}
+
+// textWriter lays out glyphs as text. Glyphs on the same baseline are
+// joined, with a space when they are visibly apart; a change of baseline
+// starts a new line.
+type textWriter struct {
+	buf          []byte
+	started      bool
+	lastX, lastY float64
+	lastH        float64
+}
+
+func (w *textWriter) glyph(text string, x, y, h float64) {
+	if h <= 0 {
+		h = 1
+	}
+	if w.started {
+		dx, dy := x-w.lastX, math.Abs(y-w.lastY)
+		switch {
+		case dy > 0.5*math.Max(h, w.lastH):
+			w.newline()
+		case dx > 0.15*h || dx < -2*h:
+			w.space()
+		}
+	}
+	if text == " " {
+		w.space()
+	} else {
+		w.buf = append(w.buf, text...)
+	}
+	w.started = true
+	w.lastY, w.lastH = y, h
+}
+
+// advance records where the last glyph ended.
+func (w *textWriter) advance(x float64) {
+	w.lastX = x
+}
+
+func (w *textWriter) space() {
+	if n := len(w.buf); n > 0 && w.buf[n-1] != ' ' && w.buf[n-1] != '\n' {
+		w.buf = append(w.buf, ' ')
+	}
+}
+
+func (w *textWriter) newline() {
+	w.buf = bytes.TrimRight(w.buf, " ")
+	if len(w.buf) > 0 {
+		w.buf = append(w.buf, '\n')
+	}
+}
+
+func (w *textWriter) String() string {
+	return strings.TrimSpace(string(w.buf))
+}
+
+// contentText interprets a page's content streams, writing the text they
+// show. Only operators that affect text placement are honoured.
+type contentText struct {
+	r     *pdfReader
+	w     *textWriter
+	fonts map[pdfRef]*pdfFont
+	forms map[*pdfStream]bool
+}
+
+const maxFormDepth = 12
+
+func (r *pdfReader) pageText(page pdfDict) string {
+	ct := &contentText{r: r, w: &textWriter{}, fonts: map[pdfRef]*pdfFont{}, forms: map[*pdfStream]bool{}}
+	var data [][]byte
+	switch c := r.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		if d, err := r.decodeStream(c); err == nil {
+			data = append(data, d)
+		}
+	case pdfArray:
+		for _, v := range c {
+			if s, ok := r.resolve(v).(*pdfStream); ok {
+				if d, err := r.decodeStream(s); err == nil {
+					data = append(data, d)
+				}
+			}
+		}
+	}
+	res, _ := r.resolve(page["Resources"]).(pdfDict)
+	ct.run(bytes.Join(data, []byte("\n")), res, gState{ctm: identityMatrix, hScale: 1}, 0)
+	return ct.w.String()
+}
+
+func (ct *contentText) font(res pdfDict, name pdfName) *pdfFont {
+	fonts, _ := ct.r.resolve(res["Font"]).(pdfDict)
+	ref, ok := fonts[name].(pdfRef)
+	if !ok {
+		return ct.r.loadFont(fonts[name])
+	}
+	if f, ok := ct.fonts[ref]; ok {
+		return f
+	}
+	f := ct.r.loadFont(ref)
+	ct.fonts[ref] = f
+	return f
+}
+
+func (ct *contentText) run(data []byte, res pdfDict, gs gState, depth int) {
+	l := newPDFLexer(data, 0)
+	l.noRefs = true
+	var stack []gState
+	var tm, tlm pdfMatrix
+	var operands []interface{}
+
+	num := func(i int) float64 {
+		if i < len(operands) {
+			n, _ := pdfNumber(operands[i])
+			return n
+		}
+		return 0
+	}
+	moveLine := func(tx, ty float64) {
+		tlm = pdfMatrix{1, 0, 0, 1, tx, ty}.mul(tlm)
+		tm = tlm
+	}
+	show := func(s pdfString) {
+		if gs.font == nil {
+			gs.font = ct.r.loadFont(nil)
+		}
+		for _, g := range gs.font.decode(s) {
+			trm := pdfMatrix{gs.size * gs.hScale, 0, 0, gs.size, 0, gs.rise}.mul(tm).mul(gs.ctm)
+			h := math.Hypot(trm[2], trm[3])
+			if g.text != "" {
+				ct.w.glyph(g.text, trm[4], trm[5], h)
+			}
+			tx := g.width/1000*gs.size + gs.charSp
+			if g.space {
+				tx += gs.wordSp
+			}
+			tm = pdfMatrix{1, 0, 0, 1, tx * gs.hScale, 0}.mul(tm)
+			if g.text != "" {
+				end := pdfMatrix{1, 0, 0, 1, 0, gs.rise}.mul(tm).mul(gs.ctm)
+				ct.w.advance(end[4])
+			}
+		}
+	}
+
+	for {
+		obj, err := l.object()
+		if err == errPDFEOF {
+			return
+		}
+		if err != nil {
+			operands = operands[:0]
+			continue
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			if len(operands) < 64 {
+				operands = append(operands, obj)
+			}
+			continue
+		}
+
+		switch op {
+		case "q":
+			if len(stack) < 256 {
+				stack = append(stack, gs)
+			}
+		case "Q":
+			if len(stack) > 0 {
+				gs = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if m, ok := matrixFrom(operands); ok {
+				gs.ctm = m.mul(gs.ctm)
+			}
+		case "BT":
+			tm, tlm = identityMatrix, identityMatrix
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					gs.font = ct.font(res, name)
+				}
+				gs.size = num(len(operands) - 1)
+			}
+		case "Tc":
+			gs.charSp = num(0)
+		case "Tw":
+			gs.wordSp = num(0)
+		case "Tz":
+			gs.hScale = num(0) / 100
+		case "TL":
+			gs.leading = num(0)
+		case "Ts":
+			gs.rise = num(0)
+		case "Td":
+			moveLine(num(0), num(1))
+		case "TD":
+			gs.leading = -num(1)
+			moveLine(num(0), num(1))
+		case "Tm":
+			if m, ok := matrixFrom(operands); ok {
+				tm, tlm = m, m
+			}
+		case "T*":
+			moveLine(0, -gs.leading)
+		case "Tj":
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "'":
+			moveLine(0, -gs.leading)
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "\"":
+			if len(operands) >= 3 {
+				gs.wordSp, gs.charSp = num(0), num(1)
+				moveLine(0, -gs.leading)
+				if s, ok := operands[2].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			arr, _ := operands[len(operands)-1].(pdfArray)
+			for _, v := range arr {
+				switch x := v.(type) {
+				case pdfString:
+					show(x)
+				default:
+					if n, ok := pdfNumber(x); ok {
+						tm = pdfMatrix{1, 0, 0, 1, -n / 1000 * gs.size * gs.hScale, 0}.mul(tm)
+					}
+				}
+			}
+		case "Do":
+			if len(operands) > 0 && depth < maxFormDepth {
+				if name, ok := operands[len(operands)-1].(pdfName); ok {
+					ct.form(res, name, gs, depth)
+				}
+			}
+		case "BI":
+			skipInlineImage(l)
+		}
+		operands = operands[:0]
+	}
+}
+
+// form runs the content of a form XObject, such as a stamped header or a
+// slide template.
+func (ct *contentText) form(res pdfDict, name pdfName, gs gState, depth int) {
+	xobjects, _ := ct.r.resolve(res["XObject"]).(pdfDict)
+	s, ok := ct.r.resolve(xobjects[name]).(*pdfStream)
+	if !ok || s.dict.name("Subtype") != "Form" || ct.forms[s] {
+		return
+	}
+	data, err := ct.r.decodeStream(s)
+	if err != nil {
+		return
+	}
+	if m, ok := ct.r.resolve(s.dict["Matrix"]).(pdfArray); ok {
+		vals := make([]interface{}, len(m))
+		for i, v := range m {
+			vals[i] = ct.r.resolve(v)
+		}
+		if fm, ok := matrixFrom(vals); ok {
+			gs.ctm = fm.mul(gs.ctm)
+		}
+	}
+	formRes, ok := ct.r.resolve(s.dict["Resources"]).(pdfDict)
+	if !ok {
+		formRes = res
+	}
+	ct.forms[s] = true
+	ct.run(data, formRes, gs, depth+1)
+	delete(ct.forms, s)
+}
+
+// skipInlineImage moves past the data of an inline image, which is raw
+// binary between "ID" and "EI".
+func skipInlineImage(l *pdfLexer) {
+	for {
+		obj, err := l.object()
+		if err == errPDFEOF {
+			return
+		}
+		if obj == pdfKeyword("ID") {
+			break
+		}
+	}
+	start := l.pos + 1
+	for start < len(l.data) {
+		i := bytes.Index(l.data[start:], []byte("EI"))
+		if i < 0 {
+			break
+		}
+		end := start + i
+		before := end == 0 || isPDFSpace(l.data[end-1])
+		after := end+2 >= len(l.data) || isPDFSpace(l.data[end+2]) || isPDFDelim(l.data[end+2])
+		if before && after {
+			l.pos = end + 2
+			return
+		}
+		start = end + 2
+	}
+	l.pos = len(l.data)
+}
@@ -0,0 +1,148 @@
+package extractor
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Document is the result of extracting a file: its text, plus metadata
+// for the Document node.
+type Document struct {
+	Text  string
+	Props map[string]interface{}
+	// Structure is set by formats with headings and sections; it is nil
+	// for flat text.
+	Structure *Structure
+	// Links are the document's outgoing hyperlinks.
+	Links []Link
+	// Email is set for email messages.
+	Email *Email
+	// Code is the outline of a source file.
+	Code *Code
+	// Parts are documents packed inside this one, such as the messages
+	// of a mailbox. Each is indexed as a Document of its own.
+	Parts []Part
+}
+
+// Part is a document inside another. Its path is the container's path,
+// "!/" and Name, as in "inbox.mbox!/3".
+type Part struct {
+	Name     string
+	Content  []byte
+	Document *Document
+}
+
+// Link is a hyperlink and its anchor text. URL is absolute if the
+// document gave a base for it, else as written.
+type Link struct {
+	URL  string
+	Text string
+}
+
+// ExtractFunc turns the content of a file into a Document. path is only
+// a hint; content is all there is.
+type ExtractFunc func(path string, content []byte) (*Document, error)
+
+// Format describes a file format the extractor understands.
+type Format struct {
+	// Name is the file type stored on documents, such as "pdf".
+	Name string
+	// Extensions are matched case-insensitively and include the dot.
+	Extensions []string
+	// MIMETypes lists the format's media types, preferred one first.
+	MIMETypes []string
+	// Text marks formats stored as text. Binary content under one of
+	// their extensions is rejected unless its magic bytes identify
+	// another format.
+	Text bool
+	// Sniff recognises the format from its content. It may be nil.
+	Sniff func(content []byte) bool
+	// Extract may be nil for formats that are recognised but whose text
+	// cannot be extracted; such files are not indexed.
+	Extract ExtractFunc
+}
+
+var registry = struct {
+	sync.RWMutex
+	formats []*Format
+	byExt   map[string]*Format
+	byMIME  map[string]*Format
+}{
+	byExt:  map[string]*Format{},
+	byMIME: map[string]*Format{},
+}
+
+// Register adds a format, taking over any extensions and MIME types
+// already claimed by an earlier one. Call it during startup, before
+// files are indexed.
+func Register(f Format) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	p := &f
+	registry.formats = append(registry.formats, p)
+	for _, ext := range f.Extensions {
+		registry.byExt[strings.ToLower(ext)] = p
+	}
+	for _, mime := range f.MIMETypes {
+		registry.byMIME[strings.ToLower(mime)] = p
+	}
+}
+
+// Formats returns the registered formats in registration order.
+func Formats() []Format {
+	registry.RLock()
+	defer registry.RUnlock()
+	out := make([]Format, 0, len(registry.formats))
+	for _, f := range registry.formats {
+		out = append(out, *f)
+	}
+	return out
+}
+
+// ForPath returns the format registered for the extension of path.
+func ForPath(path string) (Format, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	if f, ok := registry.byExt[strings.ToLower(filepath.Ext(path))]; ok {
+		return *f, true
+	}
+	return Format{}, false
+}
+
+// ForMIME returns the format registered for a media type. Parameters
+// such as "; charset=utf-8" are ignored.
+func ForMIME(mime string) (Format, bool) {
+	if i := strings.IndexByte(mime, ';'); i >= 0 {
+		mime = mime[:i]
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	if f, ok := registry.byMIME[strings.ToLower(strings.TrimSpace(mime))]; ok {
+		return *f, true
+	}
+	return Format{}, false
+}
+
+// Detect returns the format of a file. The extension decides unless the
+// content contradicts it: a file whose bytes carry another format's
+// signature, such as a PDF saved as .txt, is detected by its content.
+// Files with an unknown extension are identified by sniffing alone.
+func Detect(path string, content []byte) (Format, bool) {
+	f, ok := ForPath(path)
+	if ok && f.Sniff != nil && f.Sniff(content) {
+		return f, true
+	}
+	if sniffed, found := sniffFormat(content, !ok || !f.Text); found {
+		return sniffed, true
+	}
+	return f, ok
+}
+
+// Indexable reports whether files at path have a format with an
+// extraction function.
+func Indexable(path string) bool {
+	f, ok := ForPath(path)
+	return ok && f.Extract != nil
+}
@@ -0,0 +1,98 @@
+package extractor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_BuiltinsAgree(t *testing.T) {
+	ext := New()
+	tests := []struct {
+		path, fileType, contentType string
+		indexable                   bool
+	}{
+		{"notes.md", "markdown", "text/markdown", true},
+		{"app.LOG", "log", "text/plain", true},
+		{"report.pdf", "pdf", "application/pdf", true},
+		{"letter.docx", "word", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", true},
+		{"old.doc", "word", "application/msword", false},
+		{"sheet.XLSX", "excel", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", true},
+		{"talk.odp", "odp", "application/vnd.oasis.opendocument.presentation", true},
+		{"novel.epub", "epub", "application/epub+zip", true},
+		{"note.eml", "email", "message/rfc822", true},
+		{"archive.mbox", "mbox", "application/mbox", true},
+		{"main.go", "go", "text/x-go", true},
+		{"view.TSX", "typescript", "application/typescript", true},
+		{"build.sh", "shell", "application/x-sh", true},
+		{"export.TSV", "tsv", "text/tab-separated-values", true},
+		{"image.png", "unknown", "application/octet-stream", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ext.GetFileType(tt.path); got != tt.fileType {
+				t.Errorf("GetFileType() = %q, want %q", got, tt.fileType)
+			}
+			if got := GetFileTypeSimple(tt.path); got != tt.fileType {
+				t.Errorf("GetFileTypeSimple() = %q, want %q", got, tt.fileType)
+			}
+			if got := ext.GetContentType(tt.path); got != tt.contentType {
+				t.Errorf("GetContentType() = %q, want %q", got, tt.contentType)
+			}
+			if got := Indexable(tt.path); got != tt.indexable {
+				t.Errorf("Indexable() = %v, want %v", got, tt.indexable)
+			}
+		})
+	}
+
+	if f, ok := ForMIME("text/plain; charset=utf-8"); !ok || f.Name != "text" {
+		t.Errorf("ForMIME(text/plain) = %q, %v", f.Name, ok)
+	}
+}
+
+func TestRegistry_Sniff(t *testing.T) {
+	pdf := simplePDF().bytes("/Root 1 0 R")
+	if f, ok := Detect("scan-0001", pdf); !ok || f.Name != "pdf" {
+		t.Fatalf("Detect() = %q, %v; want pdf", f.Name, ok)
+	}
+	text, err := New().Extract("scan-0001", pdf)
+	if err != nil || !strings.HasPrefix(text, "Hello World") {
+		t.Errorf("Extract() = %q, %v", text, err)
+	}
+	if f, ok := Detect("page", []byte("  <!DOCTYPE html><p>hi</p>")); !ok || f.Name != "html" {
+		t.Errorf("Detect(html) = %q, %v", f.Name, ok)
+	}
+	// Magic bytes override a text extension; text heuristics do not.
+	if f, _ := Detect("data.txt", pdf); f.Name != "pdf" {
+		t.Errorf("Detect(misnamed pdf) = %q, want pdf", f.Name)
+	}
+	if f, _ := Detect("snippet.txt", []byte("<html><p>example</p></html>")); f.Name != "text" {
+		t.Errorf("Detect(snippet.txt) = %q, want text", f.Name)
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	Register(Format{
+		Name:       "shout",
+		Extensions: []string{".shout"},
+		MIMETypes:  []string{"text/x-shout"},
+		Sniff:      func(content []byte) bool { return strings.HasPrefix(string(content), "SHOUT:") },
+		Extract: func(path string, content []byte) (*Document, error) {
+			return &Document{
+				Text:  strings.ToLower(strings.TrimPrefix(string(content), "SHOUT:")),
+				Props: map[string]interface{}{"loud": true},
+			}, nil
+		},
+	})
+
+	ext := New()
+	doc, err := ext.ExtractDocument("memo.SHOUT", []byte("SHOUT:HELLO"))
+	if err != nil || doc.Text != "hello" || doc.Props["loud"] != true {
+		t.Fatalf("ExtractDocument() = %+v, %v", doc, err)
+	}
+	if text, _ := ext.Extract("memo", []byte("SHOUT:SNIFFED")); text != "sniffed" {
+		t.Errorf("sniffed Extract() = %q", text)
+	}
+	if ext.GetFileType("memo.shout") != "shout" || ext.GetContentType("memo.shout") != "text/x-shout" || !Indexable("memo.shout") {
+		t.Error("registered format not visible to all lookups")
+	}
+}
@@ -0,0 +1,105 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrBinary is returned for binary content that no registered format
+// can extract.
+var ErrBinary = errors.New("binary content cannot be indexed")
+
+// Signatures net/http does not know about.
+var extraSignatures = []struct {
+	offset int
+	magic  string
+	mime   string
+}{
+	{0, "\x7fELF", "application/x-executable"},
+	{0, "\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\xce\xfa\xed\xfe", "application/x-mach-binary"},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{0, "BZh", "application/x-bzip2"},
+	{0, "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "application/x-ole-storage"},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3"},
+	{0, "{\\rtf", "application/rtf"},
+	{257, "ustar", "application/x-tar"},
+}
+
+// SniffMIME returns the media type of content from its leading bytes,
+// following net/http.DetectContentType with extra signatures for
+// executables, archives and databases. Registered formats are consulted
+// first, so a DOCX is reported as such rather than as a zip. Text gets
+// the charset DecodeText would use.
+func SniffMIME(content []byte) string {
+	if f, ok := sniffFormat(content, true); ok && len(f.MIMETypes) > 0 {
+		return f.MIMETypes[0]
+	}
+	for _, sig := range extraSignatures {
+		if len(content) >= sig.offset+len(sig.magic) && string(content[sig.offset:sig.offset+len(sig.magic)]) == sig.magic {
+			return sig.mime
+		}
+	}
+	mime := http.DetectContentType(content)
+	if strings.HasPrefix(mime, "text/plain") {
+		if IsBinary(content) {
+			return "application/octet-stream"
+		}
+		_, charset := DecodeText(content[:min(len(content), 8192)])
+		return "text/plain; charset=" + charset
+	}
+	return mime
+}
+
+// sniffFormat finds a registered format whose sniffer recognises content,
+// preferring later registrations. Text formats, whose sniffers are
+// heuristics rather than magic numbers, are skipped unless withText.
+func sniffFormat(content []byte, withText bool) (Format, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for i := len(registry.formats) - 1; i >= 0; i-- {
+		f := registry.formats[i]
+		if f.Sniff != nil && (withText || !f.Text) && f.Sniff(content) {
+			return *f, true
+		}
+	}
+	return Format{}, false
+}
+
+// DetectContentType is GetContentType for a file whose content is at
+// hand; content wins over a misleading extension.
+func (e *Extractor) DetectContentType(path string, content []byte) string {
+	if f, ok := Detect(path, content); ok && len(f.MIMETypes) > 0 {
+		return f.MIMETypes[0]
+	}
+	return SniffMIME(content)
+}
+
+// DetectFileType is GetFileType for a file whose content is at hand.
+func (e *Extractor) DetectFileType(path string, content []byte) string {
+	if f, ok := Detect(path, content); ok {
+		return f.Name
+	}
+	if IsBinary(content) {
+		return "binary"
+	}
+	return "unknown"
+}
+
+func sniffHTML(content []byte) bool {
+	head := bytes.ToLower(bytes.TrimLeft(content[:min(len(content), 512)], "\xef\xbb\xbf \t\r\n"))
+	if bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html")) {
+		return true
+	}
+	// XHTML starts with an XML declaration.
+	return bytes.HasPrefix(head, []byte("<?xml")) && bytes.Contains(head, []byte("<html"))
+}
+
+// sniffZip reports whether content is a zip archive holding the named
+// member. The name is stored uncompressed in the archive's headers.
+func sniffZip(content []byte, member string) bool {
+	return bytes.HasPrefix(content, []byte("PK\x03\x04")) && bytes.Contains(content, []byte(member))
+}
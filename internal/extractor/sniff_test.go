@@ -0,0 +1,75 @@
+package extractor
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		want    string
+		charset string
+	}{
+		{"utf-8", []byte("naïve"), "naïve", "utf-8"},
+		{"utf-8 bom", []byte("\xef\xbb\xbfhello"), "hello", "utf-8"},
+		{"utf-16le bom", []byte("\xff\xfeh\x00i\x00"), "hi", "utf-16le"},
+		{"utf-16be bom", []byte("\xfe\xff\x00h\x00i"), "hi", "utf-16be"},
+		{"utf-16le", []byte("c\x00a\x00f\x00\xe9\x00 \x00o\x00k\x00"), "café ok", "utf-16le"},
+		{"utf-32le bom", []byte("\xff\xfe\x00\x00h\x00\x00\x00"), "h", "utf-32le"},
+		{"windows-1252", []byte("caf\xe9 \x93quoted\x94 \x80"), "café “quoted” €", "windows-1252"},
+		{"latin-1", []byte("gar\xe7on"), "garçon", "iso-8859-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, charset := DecodeText(tt.in)
+			if got != tt.want || charset != tt.charset {
+				t.Errorf("DecodeText() = %q, %q; want %q, %q", got, charset, tt.want, tt.charset)
+			}
+		})
+	}
+}
+
+func TestSniffMIME(t *testing.T) {
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"elf", []byte("\x7fELF\x02\x01\x01\x00"), "application/x-executable"},
+		{"tar", tar, "application/x-tar"},
+		{"pdf", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"html", []byte("<!DOCTYPE html><title>x</title>"), "text/html"},
+		{"latin-1 text", []byte("gar\xe7on"), "text/plain; charset=iso-8859-1"},
+		{"utf-16 text", []byte("\xff\xfeh\x00i\x00"), "text/plain; charset=utf-16le"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SniffMIME(tt.in); got != tt.want {
+				t.Errorf("SniffMIME() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract_RejectsBinary(t *testing.T) {
+	ext := New()
+	elf := []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	for _, path := range []string{"program", "notes.txt", "data.json"} {
+		if _, err := ext.Extract(path, elf); !errors.Is(err, ErrBinary) {
+			t.Errorf("Extract(%s) error = %v, want ErrBinary", path, err)
+		}
+	}
+	if got := ext.DetectFileType("program", elf); got != "binary" {
+		t.Errorf("DetectFileType() = %q, want binary", got)
+	}
+
+	doc, err := ext.ExtractDocument("legacy.txt", []byte("\xff\xfeo\x00k\x00"))
+	if err != nil || doc.Text != "ok" || doc.Props["charset"] != "utf-16le" {
+		t.Errorf("ExtractDocument(utf-16) = %+v, %v", doc, err)
+	}
+}
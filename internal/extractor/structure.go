@@ -0,0 +1,143 @@
+package extractor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// BlockKind identifies the type of a Block.
+type BlockKind string
+
+const (
+	BlockHeading   BlockKind = "heading"
+	BlockParagraph BlockKind = "paragraph"
+	BlockList      BlockKind = "list"
+	BlockTable     BlockKind = "table"
+	BlockCode      BlockKind = "code"
+)
+
+// Block is one element of a structured document.
+type Block struct {
+	Kind BlockKind
+	// Level is the heading level, 1 to 6.
+	Level int
+	// Text holds the text of headings, paragraphs and code blocks.
+	Text string
+	// Items holds list items; nested lists are flattened into them.
+	Items   []string
+	Ordered bool
+	// Rows holds table cells, header row first.
+	Rows [][]string
+	// Lang is the language of a code block, if given.
+	Lang string
+	// Offset and End delimit the block in the source it was parsed
+	// from: the decoded text of Markdown, HTML and source files,
+	// word/document.xml of a DOCX. Formats assembled from several parts
+	// leave them zero.
+	Offset, End int
+}
+
+// String renders the block as plain text.
+func (b Block) String() string {
+	switch b.Kind {
+	case BlockList:
+		var s strings.Builder
+		for n, item := range b.Items {
+			if n > 0 {
+				s.WriteByte('\n')
+			}
+			if b.Ordered {
+				s.WriteString(strconv.Itoa(n+1) + ". ")
+			} else {
+				s.WriteString("- ")
+			}
+			s.WriteString(item)
+		}
+		return s.String()
+	case BlockTable:
+		rows := make([]string, len(b.Rows))
+		for n, row := range b.Rows {
+			rows[n] = strings.Join(row, " | ")
+		}
+		return strings.Join(rows, "\n")
+	}
+	return b.Text
+}
+
+// Structure is the document model of formats with headings, such as
+// Markdown, HTML and DOCX.
+type Structure struct {
+	Title  string
+	Blocks []Block
+}
+
+// Text renders the blocks as plain text separated by blank lines.
+func (s *Structure) Text() string {
+	parts := make([]string, 0, len(s.Blocks))
+	for _, b := range s.Blocks {
+		if text := b.String(); strings.TrimSpace(text) != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Section is a heading and the blocks up to the next heading. Content
+// before the first heading forms a section with an empty Breadcrumb.
+type Section struct {
+	// Breadcrumb lists the enclosing headings, outermost first, ending
+	// with the section's own.
+	Breadcrumb []string
+	Level      int
+	Blocks     []Block
+}
+
+// Sections splits the document at its headings.
+func (s *Structure) Sections() []Section {
+	var sections []Section
+	var trail []Block
+	current := Section{}
+	for _, b := range s.Blocks {
+		if b.Kind == BlockHeading {
+			if len(current.Blocks) > 0 {
+				sections = append(sections, current)
+			}
+			for len(trail) > 0 && trail[len(trail)-1].Level >= b.Level {
+				trail = trail[:len(trail)-1]
+			}
+			trail = append(trail, b)
+			crumb := make([]string, len(trail))
+			for n, h := range trail {
+				crumb[n] = h.Text
+			}
+			current = Section{Breadcrumb: crumb, Level: b.Level}
+		}
+		current.Blocks = append(current.Blocks, b)
+	}
+	if len(current.Blocks) > 0 {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// titleFromHeadings returns the first level-1 heading, for formats
+// without a separate title.
+func titleFromHeadings(blocks []Block) string {
+	for _, b := range blocks {
+		if b.Kind == BlockHeading && b.Level == 1 {
+			return b.Text
+		}
+	}
+	return ""
+}
+
+// structuredDocument wraps a Structure as an extraction result.
+func structuredDocument(s *Structure, props map[string]interface{}) *Document {
+	if s.Title != "" {
+		if props == nil {
+			props = map[string]interface{}{}
+		}
+		props["title"] = s.Title
+	}
+	return &Document{Text: s.Text(), Props: props, Structure: s}
+}
@@ -0,0 +1,173 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func kinds(s *Structure) []BlockKind {
+	var out []BlockKind
+	for _, b := range s.Blocks {
+		out = append(out, b.Kind)
+	}
+	return out
+}
+
+func TestParseMarkdown(t *testing.T) {
+	src := "---\ntitle: \"Runbook\"\n---\n" +
+		"# Deploy\n\nShip it\ncarefully.\n\n" +
+		"## Steps\n\n1. Build\n2. Push\n   to registry\n- Verify\n\n" +
+		"```sh\nmake deploy\n\n```\n\n" +
+		"| Env | Host |\n|-----|:----:|\n| prod | a\\|b |\n\n" +
+		"Rollback\n--------\n\n    git revert HEAD\n\n> Call on-call\n"
+	s := ParseMarkdown(src)
+
+	if s.Title != "Runbook" {
+		t.Errorf("Title = %q", s.Title)
+	}
+	want := []BlockKind{BlockHeading, BlockParagraph, BlockHeading, BlockList, BlockCode, BlockTable, BlockHeading, BlockCode, BlockParagraph}
+	if got := kinds(s); !reflect.DeepEqual(got, want) {
+		t.Fatalf("kinds = %v, want %v", got, want)
+	}
+	b := s.Blocks
+	if b[1].Text != "Ship it\ncarefully." {
+		t.Errorf("paragraph = %q", b[1].Text)
+	}
+	if !reflect.DeepEqual(b[3].Items, []string{"Build", "Push to registry", "Verify"}) || !b[3].Ordered {
+		t.Errorf("list = %q ordered=%v", b[3].Items, b[3].Ordered)
+	}
+	if b[4].Lang != "sh" || b[4].Text != "make deploy\n" {
+		t.Errorf("code = %q %q", b[4].Lang, b[4].Text)
+	}
+	if !reflect.DeepEqual(b[5].Rows, [][]string{{"Env", "Host"}, {"prod", "a|b"}}) {
+		t.Errorf("table = %q", b[5].Rows)
+	}
+	if b[6].Text != "Rollback" || b[6].Level != 2 || b[7].Text != "git revert HEAD" {
+		t.Errorf("setext/indented = %+v %+v", b[6], b[7])
+	}
+	for _, blk := range b {
+		if !strings.Contains(src[blk.Offset:blk.End], strings.Fields(blk.String())[0]) {
+			t.Errorf("block %s offsets %d-%d do not cover %q", blk.Kind, blk.Offset, blk.End, blk.String())
+		}
+	}
+
+	var crumbs []string
+	for _, sec := range s.Sections() {
+		crumbs = append(crumbs, strings.Join(sec.Breadcrumb, " > "))
+	}
+	if want := []string{"Deploy", "Deploy > Steps", "Deploy > Rollback"}; !reflect.DeepEqual(crumbs, want) {
+		t.Errorf("breadcrumbs = %q, want %q", crumbs, want)
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	src := `<!DOCTYPE html><html><head><title>Guide &amp; FAQ</title>
+<style>p { color: red }</style><script>if (a<b) alert("x")</script></head>
+<body><nav><ul><li>Home</li></ul></nav>
+<h1>Intro</h1><p>Fish&nbsp;&amp; chips<br>are <b>great</b>.</p>
+<h2>Menu</h2><ol><li>Cod<ul><li>battered</li></ul></li><li>Chips</li></ol>
+<table><tr><th>Item</th><th>Price</th></tr><tr><td>Cod</td><td>5</td></tr></table>
+<pre><code class="language-go">fmt.Println("a < b")
+</code></pre><p>1 < 2 is true</p><!-- hidden --></body></html>`
+	s := ParseHTML(src)
+
+	if s.Title != "Guide & FAQ" {
+		t.Errorf("Title = %q", s.Title)
+	}
+	want := []BlockKind{BlockList, BlockHeading, BlockParagraph, BlockHeading, BlockList, BlockTable, BlockCode, BlockParagraph}
+	if got := kinds(s); !reflect.DeepEqual(got, want) {
+		t.Fatalf("kinds = %v, want %v", got, want)
+	}
+	b := s.Blocks
+	if b[2].Text != "Fish & chips\nare great." {
+		t.Errorf("paragraph = %q", b[2].Text)
+	}
+	if !reflect.DeepEqual(b[4].Items, []string{"Cod", "battered", "Chips"}) || !b[4].Ordered {
+		t.Errorf("list = %q", b[4].Items)
+	}
+	if !reflect.DeepEqual(b[5].Rows, [][]string{{"Item", "Price"}, {"Cod", "5"}}) {
+		t.Errorf("table = %q", b[5].Rows)
+	}
+	if b[6].Lang != "go" || b[6].Text != `fmt.Println("a < b")` {
+		t.Errorf("code = %q %q", b[6].Lang, b[6].Text)
+	}
+	if b[7].Text != "1 < 2 is true" {
+		t.Errorf("paragraph = %q", b[7].Text)
+	}
+	text := s.Text()
+	if strings.Contains(text, "color") || strings.Contains(text, "alert") || strings.Contains(text, "hidden") {
+		t.Errorf("non-content text leaked: %q", text)
+	}
+	if src[b[1].Offset:b[1].End] != "<h1>Intro</h1>" {
+		t.Errorf("heading source = %q", src[b[1].Offset:b[1].End])
+	}
+}
+
+// testDOCX builds a minimal Word document from a body fragment.
+func testDOCX(t *testing.T, body string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := map[string]string{
+		"word/document.xml": `<?xml version="1.0"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + body + `</w:body></w:document>`,
+		"word/styles.xml": `<?xml version="1.0"?><w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+			`<w:style w:styleId="Titel"><w:name w:val="Title"/></w:style>` +
+			`<w:style w:styleId="berschrift1"><w:name w:val="heading 1"/></w:style>` +
+			`<w:style w:styleId="Heading2"><w:name w:val="heading 2"/></w:style>` +
+			`<w:style w:styleId="Code"><w:name w:val="Code"/></w:style></w:styles>`,
+	}
+	for name, data := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestParseDOCX(t *testing.T) {
+	p := func(style, text string) string {
+		ppr := ""
+		if style != "" {
+			ppr = `<w:pPr><w:pStyle w:val="` + style + `"/></w:pPr>`
+		}
+		return `<w:p>` + ppr + `<w:r><w:t>` + text + `</w:t></w:r></w:p>`
+	}
+	item := func(text string) string {
+		return `<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>` + text + `</w:t></w:r></w:p>`
+	}
+	body := p("Titel", "Handbook") + p("berschrift1", "Setup") + p("", "Install the tools.") +
+		item("Go") + item("Git") + p("Heading2", "Config") + p("Code", "a = 1") + p("Code", "b = 2") +
+		`<w:tbl><w:tr><w:tc>` + p("", "Key") + `</w:tc><w:tc>` + p("", "Value") + `</w:tc></w:tr></w:tbl>`
+
+	s, err := ParseDOCX(testDOCX(t, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Title != "Handbook" {
+		t.Errorf("Title = %q", s.Title)
+	}
+	want := []BlockKind{BlockHeading, BlockHeading, BlockParagraph, BlockList, BlockHeading, BlockCode, BlockTable}
+	if got := kinds(s); !reflect.DeepEqual(got, want) {
+		t.Fatalf("kinds = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(s.Blocks[3].Items, []string{"Go", "Git"}) || s.Blocks[5].Text != "a = 1\nb = 2" {
+		t.Errorf("list = %q, code = %q", s.Blocks[3].Items, s.Blocks[5].Text)
+	}
+	if !reflect.DeepEqual(s.Blocks[6].Rows, [][]string{{"Key", "Value"}}) {
+		t.Errorf("table = %q", s.Blocks[6].Rows)
+	}
+	secs := s.Sections()
+	if last := secs[len(secs)-1].Breadcrumb; !reflect.DeepEqual(last, []string{"Setup", "Config"}) {
+		t.Errorf("breadcrumb = %q", last)
+	}
+
+	doc, err := New().ExtractDocument("handbook.docx", testDOCX(t, body))
+	if err != nil || doc.Structure == nil || doc.Props["title"] != "Handbook" || !strings.Contains(doc.Text, "Install the tools.") {
+		t.Errorf("ExtractDocument() = %+v, %v", doc, err)
+	}
+}
@@ -0,0 +1,751 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	AlgoPageRank    = "pagerank"
+	AlgoDegree      = "degree"
+	AlgoBetweenness = "betweenness"
+	AlgoComponents  = "components"
+	AlgoLouvain     = "louvain"
+)
+
+var AllAlgorithms = []string{AlgoPageRank, AlgoDegree, AlgoBetweenness, AlgoComponents, AlgoLouvain}
+
+// betweennessSampleSize is the number of BFS sources used to approximate
+// betweenness on graphs larger than this.
+const betweennessSampleSize = 500
+
+var ErrAnalyticsRunning = errors.New("an analytics job is already running")
+
+type AnalyticsOptions struct {
+	Algorithms []string `json:"algorithms"`
+	NodeTypes  []string `json:"node_types,omitempty"`
+	EdgeTypes  []string `json:"edge_types,omitempty"`
+}
+
+type RankedNode struct {
+	ID    string  `json:"id"`
+	Label string  `json:"label"`
+	Score float64 `json:"score"`
+}
+
+type AnalyticsSummary struct {
+	Nodes       int              `json:"nodes"`
+	Edges       int              `json:"edges"`
+	TopPageRank []RankedNode     `json:"top_pagerank,omitempty"`
+	TopDegree   []RankedNode     `json:"top_degree,omitempty"`
+	TopBetween  []RankedNode     `json:"top_betweenness,omitempty"`
+	Components  int              `json:"components,omitempty"`
+	Communities int              `json:"communities,omitempty"`
+	Modularity  float64          `json:"modularity,omitempty"`
+	Sizes       map[string][]int `json:"sizes,omitempty"`
+}
+
+type AnalyticsJob struct {
+	ID         string            `json:"id"`
+	Status     string            `json:"status"`
+	Options    AnalyticsOptions  `json:"options"`
+	Stage      string            `json:"stage"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Summary    *AnalyticsSummary `json:"summary,omitempty"`
+}
+
+// Analytics runs graph algorithms as background jobs and writes their
+// results back onto the nodes as props.
+type Analytics struct {
+	store *Store
+	mu    sync.Mutex
+	jobs  []*AnalyticsJob
+}
+
+func NewAnalytics(store *Store) *Analytics {
+	return &Analytics{store: store}
+}
+
+func (a *Analytics) Start(opts AnalyticsOptions) (*AnalyticsJob, error) {
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = AllAlgorithms
+	}
+	for _, algo := range opts.Algorithms {
+		if !validAlgorithm(algo) {
+			return nil, fmt.Errorf("unknown algorithm %q", algo)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, job := range a.jobs {
+		if job.Status == "running" {
+			return nil, ErrAnalyticsRunning
+		}
+	}
+
+	job := &AnalyticsJob{
+		ID:        time.Now().Format("20060102150405.000"),
+		Status:    "running",
+		Options:   opts,
+		Stage:     "loading",
+		StartedAt: time.Now(),
+	}
+	a.jobs = append(a.jobs, job)
+	if len(a.jobs) > 20 {
+		a.jobs = a.jobs[len(a.jobs)-20:]
+	}
+
+	go a.run(job)
+	return a.snapshot(job), nil
+}
+
+// Jobs returns copies of the recent jobs, newest first.
+func (a *Analytics) Jobs() []*AnalyticsJob {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	jobs := make([]*AnalyticsJob, 0, len(a.jobs))
+	for i := len(a.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, a.snapshot(a.jobs[i]))
+	}
+	return jobs
+}
+
+func (a *Analytics) Job(id string) *AnalyticsJob {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, job := range a.jobs {
+		if job.ID == id {
+			return a.snapshot(job)
+		}
+	}
+	return nil
+}
+
+// Wait blocks until no job is running. It is meant for tests and shutdown.
+func (a *Analytics) Wait() {
+	for {
+		running := false
+		for _, job := range a.Jobs() {
+			if job.Status == "running" {
+				running = true
+			}
+		}
+		if !running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (a *Analytics) snapshot(job *AnalyticsJob) *AnalyticsJob {
+	copied := *job
+	return &copied
+}
+
+func (a *Analytics) setStage(job *AnalyticsJob, stage string) {
+	a.mu.Lock()
+	job.Stage = stage
+	a.mu.Unlock()
+}
+
+func (a *Analytics) run(job *AnalyticsJob) {
+	summary, err := a.compute(job)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Stage = ""
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		return
+	}
+	job.Status = "done"
+	job.Summary = summary
+}
+
+func (a *Analytics) compute(job *AnalyticsJob) (*AnalyticsSummary, error) {
+	g, err := a.store.loadAnalyticsGraph(job.Options.NodeTypes, job.Options.EdgeTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &AnalyticsSummary{Nodes: len(g.ids), Edges: g.edgeCount, Sizes: make(map[string][]int)}
+	props := make([]map[string]interface{}, len(g.ids))
+	for i := range props {
+		props[i] = make(map[string]interface{})
+	}
+
+	for _, algo := range job.Options.Algorithms {
+		a.setStage(job, algo)
+		switch algo {
+		case AlgoPageRank:
+			scores := g.pageRank(0.85, 100, 1e-9)
+			for i, v := range scores {
+				props[i]["pagerank"] = v
+			}
+			summary.TopPageRank = g.top(scores, 10)
+		case AlgoDegree:
+			scores := g.degrees()
+			for i, v := range scores {
+				props[i]["degree"] = v
+			}
+			summary.TopDegree = g.top(scores, 10)
+		case AlgoBetweenness:
+			scores := g.betweenness(betweennessSampleSize)
+			for i, v := range scores {
+				props[i]["betweenness"] = v
+			}
+			summary.TopBetween = g.top(scores, 10)
+		case AlgoComponents:
+			comp, sizes := g.components()
+			for i, c := range comp {
+				props[i]["component"] = c
+			}
+			summary.Components = len(sizes)
+			summary.Sizes["components"] = firstN(sizes, 10)
+		case AlgoLouvain:
+			comm, q := g.louvain()
+			sizes := relabelBySize(comm)
+			for i, c := range comm {
+				props[i]["community"] = c
+			}
+			summary.Communities = len(sizes)
+			summary.Modularity = q
+			summary.Sizes["communities"] = firstN(sizes, 10)
+		}
+	}
+
+	a.setStage(job, "writing")
+	updates := make(map[string]map[string]interface{}, len(g.ids))
+	for i, id := range g.ids {
+		updates[id] = props[i]
+	}
+	if err := a.store.UpdateNodeProps(updates); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func validAlgorithm(algo string) bool {
+	for _, a := range AllAlgorithms {
+		if a == algo {
+			return true
+		}
+	}
+	return false
+}
+
+func firstN(values []int, n int) []int {
+	if len(values) > n {
+		return values[:n]
+	}
+	return values
+}
+
+// UpdateNodeProps merges props into the stored nodes, keeping the
+// secondary indexes in sync. Missing nodes are skipped.
+func (s *Store) UpdateNodeProps(updates map[string]map[string]interface{}) error {
+	ids := make([]string, 0, len(updates))
+	for id := range updates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	const batchSize = 200
+	for start := 0; start < len(ids); start += batchSize {
+		end := start + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+		err := s.update(func(txn *badger.Txn) error {
+			for _, id := range batch {
+				old, err := getNodeTxn(txn, id)
+				if errors.Is(err, badger.ErrKeyNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				node := *old
+				node.Props = make(map[string]interface{}, len(old.Props)+len(updates[id]))
+				for k, v := range old.Props {
+					node.Props[k] = v
+				}
+				for k, v := range updates[id] {
+					node.Props[k] = v
+				}
+				// Round-trip so index keys see the same float64 values a
+				// later read would.
+				data, err := json.Marshal(&node)
+				if err != nil {
+					return err
+				}
+				var stored Node
+				if err := json.Unmarshal(data, &stored); err != nil {
+					return err
+				}
+				if err := putNodeTxn(txn, old, &stored); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// analyticsGraph is an in-memory snapshot of the graph with dense node
+// indexes. out and in hold weighted directed adjacency; und merges both.
+type analyticsGraph struct {
+	ids       []string
+	labels    []string
+	out       []map[int]float64
+	in        []map[int]float64
+	und       []map[int]float64
+	edgeCount int
+}
+
+func (s *Store) loadAnalyticsGraph(nodeTypes, edgeTypes []string) (*analyticsGraph, error) {
+	allowedEdges := make(map[string]bool)
+	for _, t := range edgeTypes {
+		allowedEdges[t] = true
+	}
+
+	g := &analyticsGraph{}
+	index := make(map[string]int)
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		var ids []string
+		if len(nodeTypes) > 0 {
+			for _, t := range nodeTypes {
+				ids = append(ids, collectIndexIDs(txn, typeIndexPrefix+t+keySep, 0)...)
+			}
+		} else {
+			it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+			prefix := []byte("node:")
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				ids = append(ids, string(it.Item().Key()[len(prefix):]))
+			}
+			it.Close()
+		}
+
+		for _, id := range ids {
+			if _, ok := index[id]; ok {
+				continue
+			}
+			node, err := getNodeTxn(txn, id)
+			if err != nil {
+				continue
+			}
+			index[id] = len(g.ids)
+			g.ids = append(g.ids, id)
+			g.labels = append(g.labels, node.Label)
+		}
+
+		n := len(g.ids)
+		g.out = make([]map[int]float64, n)
+		g.in = make([]map[int]float64, n)
+		g.und = make([]map[int]float64, n)
+		for i := 0; i < n; i++ {
+			g.out[i] = make(map[int]float64)
+			g.in[i] = make(map[int]float64)
+			g.und[i] = make(map[int]float64)
+		}
+
+		for from, id := range g.ids {
+			edges, err := adjacentEdges(txn, id, DirOut)
+			if err != nil {
+				return err
+			}
+			for _, edge := range edges {
+				if len(allowedEdges) > 0 && !allowedEdges[edge.Type] {
+					continue
+				}
+				to, ok := index[edge.To]
+				if !ok || to == from {
+					continue
+				}
+				w := float64(edge.Weight)
+				if w <= 0 {
+					w = 1
+				}
+				g.out[from][to] += w
+				g.in[to][from] += w
+				g.und[from][to] += w
+				g.und[to][from] += w
+				g.edgeCount++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *analyticsGraph) top(scores []float64, k int) []RankedNode {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if len(order) > k {
+		order = order[:k]
+	}
+	ranked := make([]RankedNode, len(order))
+	for i, idx := range order {
+		ranked[i] = RankedNode{ID: g.ids[idx], Label: g.labels[idx], Score: scores[idx]}
+	}
+	return ranked
+}
+
+// pageRank runs weighted power iteration. Rank held by dangling nodes is
+// spread uniformly over all nodes.
+func (g *analyticsGraph) pageRank(damping float64, maxIter int, tol float64) []float64 {
+	n := len(g.ids)
+	if n == 0 {
+		return nil
+	}
+	outWeight := make([]float64, n)
+	for i, nbrs := range g.out {
+		for _, w := range nbrs {
+			outWeight[i] += w
+		}
+	}
+
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	next := make([]float64, n)
+
+	for iter := 0; iter < maxIter; iter++ {
+		dangling := 0.0
+		for i := 0; i < n; i++ {
+			if outWeight[i] == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+		for i, nbrs := range g.out {
+			if outWeight[i] == 0 {
+				continue
+			}
+			share := damping * rank[i] / outWeight[i]
+			for j, w := range nbrs {
+				next[j] += share * w
+			}
+		}
+
+		diff := 0.0
+		for i := range rank {
+			diff += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if diff < tol {
+			break
+		}
+	}
+	return rank
+}
+
+// degrees returns the undirected degree (distinct neighbours) of each node.
+func (g *analyticsGraph) degrees() []float64 {
+	deg := make([]float64, len(g.ids))
+	for i, nbrs := range g.und {
+		deg[i] = float64(len(nbrs))
+	}
+	return deg
+}
+
+// betweenness computes normalised undirected betweenness centrality with
+// Brandes' algorithm. Graphs with more than sample nodes use sample random
+// sources and scale the result.
+func (g *analyticsGraph) betweenness(sample int) []float64 {
+	n := len(g.ids)
+	cb := make([]float64, n)
+	if n < 3 {
+		return cb
+	}
+
+	sources := make([]int, n)
+	for i := range sources {
+		sources[i] = i
+	}
+	scale := 1.0
+	if sample > 0 && n > sample {
+		rng := rand.New(rand.NewSource(1))
+		rng.Shuffle(n, func(a, b int) { sources[a], sources[b] = sources[b], sources[a] })
+		sources = sources[:sample]
+		scale = float64(n) / float64(sample)
+	}
+
+	sigma := make([]float64, n)
+	dist := make([]int, n)
+	delta := make([]float64, n)
+	pred := make([][]int, n)
+
+	for _, s := range sources {
+		for i := 0; i < n; i++ {
+			sigma[i] = 0
+			dist[i] = -1
+			delta[i] = 0
+			pred[i] = pred[i][:0]
+		}
+		sigma[s] = 1
+		dist[s] = 0
+		queue := []int{s}
+		var stack []int
+
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for w := range g.und[v] {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					pred[w] = append(pred[w], v)
+				}
+			}
+		}
+
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range pred[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				cb[w] += delta[w]
+			}
+		}
+	}
+
+	// Each undirected path is counted from both ends.
+	norm := scale / 2 / (float64(n-1) * float64(n-2) / 2)
+	for i := range cb {
+		cb[i] *= norm
+	}
+	return cb
+}
+
+// components labels weakly connected components, numbered by size with
+// 0 the largest, and returns the component sizes in that order.
+func (g *analyticsGraph) components() ([]int, []int) {
+	n := len(g.ids)
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(x int) int {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+	for i, nbrs := range g.und {
+		for j := range nbrs {
+			ri, rj := find(i), find(j)
+			if ri != rj {
+				parent[ri] = rj
+			}
+		}
+	}
+
+	comp := make([]int, n)
+	for i := range comp {
+		comp[i] = find(i)
+	}
+	return comp, relabelBySize(comp)
+}
+
+// relabelBySize renumbers labels in place so that 0 is the most common
+// label, and returns the group sizes in that order.
+func relabelBySize(labels []int) []int {
+	counts := make(map[int]int)
+	for _, l := range labels {
+		counts[l]++
+	}
+	keys := make([]int, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if counts[keys[a]] != counts[keys[b]] {
+			return counts[keys[a]] > counts[keys[b]]
+		}
+		return keys[a] < keys[b]
+	})
+	mapping := make(map[int]int, len(keys))
+	sizes := make([]int, len(keys))
+	for i, k := range keys {
+		mapping[k] = i
+		sizes[i] = counts[k]
+	}
+	for i, l := range labels {
+		labels[i] = mapping[l]
+	}
+	return sizes
+}
+
+// louvain detects communities on the undirected weighted graph by
+// repeated local moving and aggregation, returning each node's community
+// and the modularity of the final partition.
+func (g *analyticsGraph) louvain() ([]int, float64) {
+	n := len(g.ids)
+	membership := make([]int, n)
+	for i := range membership {
+		membership[i] = i
+	}
+	if n == 0 {
+		return membership, 0
+	}
+
+	adj := make([]map[int]float64, n)
+	for i, nbrs := range g.und {
+		adj[i] = make(map[int]float64, len(nbrs))
+		for j, w := range nbrs {
+			adj[i][j] = w
+		}
+	}
+
+	for level := 0; level < 20; level++ {
+		comm, moved := louvainLocalMoving(adj)
+		if !moved {
+			break
+		}
+		dense := make(map[int]int)
+		for i, c := range comm {
+			if _, ok := dense[c]; !ok {
+				dense[c] = len(dense)
+			}
+			comm[i] = dense[c]
+		}
+		for i := range membership {
+			membership[i] = comm[membership[i]]
+		}
+
+		agg := make([]map[int]float64, len(dense))
+		for i := range agg {
+			agg[i] = make(map[int]float64)
+		}
+		for i, nbrs := range adj {
+			for j, w := range nbrs {
+				agg[comm[i]][comm[j]] += w
+			}
+		}
+		adj = agg
+		if len(adj) == 1 {
+			break
+		}
+	}
+
+	return membership, modularity(g.und, membership)
+}
+
+func louvainLocalMoving(adj []map[int]float64) ([]int, bool) {
+	n := len(adj)
+	comm := make([]int, n)
+	k := make([]float64, n)
+	tot := make([]float64, n)
+	m2 := 0.0
+	for i, nbrs := range adj {
+		comm[i] = i
+		for _, w := range nbrs {
+			k[i] += w
+		}
+		tot[i] = k[i]
+		m2 += k[i]
+	}
+	if m2 == 0 {
+		return comm, false
+	}
+
+	movedAny := false
+	for pass := 0; pass < 50; pass++ {
+		moved := false
+		for i := 0; i < n; i++ {
+			ci := comm[i]
+			links := make(map[int]float64)
+			for j, w := range adj[i] {
+				if j != i {
+					links[comm[j]] += w
+				}
+			}
+
+			tot[ci] -= k[i]
+			best := ci
+			bestGain := links[ci] - tot[ci]*k[i]/m2
+			candidates := make([]int, 0, len(links))
+			for c := range links {
+				candidates = append(candidates, c)
+			}
+			sort.Ints(candidates)
+			for _, c := range candidates {
+				gain := links[c] - tot[c]*k[i]/m2
+				if gain > bestGain+1e-12 {
+					best, bestGain = c, gain
+				}
+			}
+			tot[best] += k[i]
+			if best != ci {
+				comm[i] = best
+				moved = true
+				movedAny = true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+	return comm, movedAny
+}
+
+func modularity(adj []map[int]float64, comm []int) float64 {
+	m2 := 0.0
+	in := make(map[int]float64)
+	tot := make(map[int]float64)
+	for i, nbrs := range adj {
+		for j, w := range nbrs {
+			m2 += w
+			tot[comm[i]] += w
+			if comm[i] == comm[j] {
+				in[comm[i]] += w
+			}
+		}
+	}
+	if m2 == 0 {
+		return 0
+	}
+	q := 0.0
+	for c, t := range tot {
+		q += in[c]/m2 - (t/m2)*(t/m2)
+	}
+	return q
+}
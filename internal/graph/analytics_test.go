@@ -0,0 +1,143 @@
+package graph
+
+import (
+	"math"
+	"testing"
+)
+
+// newAnalyticsTestStore builds two triangles joined by a single bridge
+// (a3 -> b1) plus an isolated node, with every edge pointing towards a1
+// or b1 so that those are the PageRank sinks of their clusters.
+func newAnalyticsTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	for _, id := range []string{"a1", "a2", "a3", "b1", "b2", "b3", "lonely"} {
+		if err := store.AddNode(&Node{ID: id, Type: "Entity", Label: id}); err != nil {
+			t.Fatalf("AddNode() error = %v", err)
+		}
+	}
+	edges := [][2]string{
+		{"a2", "a1"}, {"a3", "a1"}, {"a2", "a3"},
+		{"b2", "b1"}, {"b3", "b1"}, {"b2", "b3"},
+		{"a3", "b1"},
+	}
+	for _, e := range edges {
+		if err := store.AddEdge(&Edge{From: e[0], To: e[1], Type: "RELATED", Weight: 1}); err != nil {
+			t.Fatalf("AddEdge() error = %v", err)
+		}
+	}
+	return store
+}
+
+func TestAnalytics_Algorithms(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	store := newAnalyticsTestStore(t)
+	defer store.Close()
+
+	g, err := store.loadAnalyticsGraph(nil, nil)
+	if err != nil {
+		t.Fatalf("loadAnalyticsGraph() error = %v", err)
+	}
+	index := make(map[string]int)
+	for i, id := range g.ids {
+		index[id] = i
+	}
+
+	pr := g.pageRank(0.85, 100, 1e-9)
+	sum := 0.0
+	for _, v := range pr {
+		sum += v
+	}
+	if math.Abs(sum-1) > 1e-6 {
+		t.Errorf("PageRank sums to %f, want 1", sum)
+	}
+	if pr[index["b1"]] <= pr[index["b2"]] || pr[index["a1"]] <= pr[index["a2"]] {
+		t.Errorf("expected sinks to outrank sources, got %v", pr)
+	}
+
+	bc := g.betweenness(0)
+	if bc[index["a3"]] <= bc[index["a1"]] || bc[index["b1"]] <= bc[index["b2"]] {
+		t.Errorf("expected bridge ends to have highest betweenness, got %v", bc)
+	}
+
+	comp, sizes := g.components()
+	if len(sizes) != 2 || sizes[0] != 6 || sizes[1] != 1 {
+		t.Errorf("components sizes = %v, want [6 1]", sizes)
+	}
+	if comp[index["a1"]] != comp[index["b3"]] || comp[index["lonely"]] == comp[index["a1"]] {
+		t.Errorf("unexpected component labels %v", comp)
+	}
+
+	comm, q := g.louvain()
+	if comm[index["a1"]] != comm[index["a2"]] || comm[index["a1"]] == comm[index["b1"]] {
+		t.Errorf("expected one community per triangle, got %v", comm)
+	}
+	if q <= 0.2 {
+		t.Errorf("modularity = %f, want > 0.2", q)
+	}
+}
+
+func TestAnalytics_JobWritesProps(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	store := newAnalyticsTestStore(t)
+	defer store.Close()
+
+	analytics := NewAnalytics(store)
+	if _, err := analytics.Start(AnalyticsOptions{Algorithms: []string{"bogus"}}); err == nil {
+		t.Error("expected error for unknown algorithm")
+	}
+	job, err := analytics.Start(AnalyticsOptions{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	analytics.Wait()
+
+	done := analytics.Job(job.ID)
+	if done == nil || done.Status != "done" {
+		t.Fatalf("job = %+v, want status done", done)
+	}
+	if done.Summary.Nodes != 7 || done.Summary.Components != 2 {
+		t.Errorf("unexpected summary %+v", done.Summary)
+	}
+
+	node, err := store.GetNode("b1")
+	if err != nil {
+		t.Fatalf("GetNode() error = %v", err)
+	}
+	for _, prop := range RankProps {
+		if _, ok := node.Props[prop]; !ok {
+			t.Errorf("node missing %q prop: %v", prop, node.Props)
+		}
+	}
+
+	top := store.SearchNodesSorted("Entity", "", "pagerank", false, 2)
+	if len(top) != 2 || top[0].ID != "b1" {
+		t.Errorf("top pagerank = %v, want b1 first", nodeIDs(top))
+	}
+	bottom := store.SearchNodesSorted("", "", "degree", true, 1)
+	if len(bottom) != 1 || bottom[0].ID != "lonely" {
+		t.Errorf("lowest degree = %v, want lonely", nodeIDs(bottom))
+	}
+	matched := store.SearchNodesSorted("", "a", "betweenness", false, 3)
+	if len(matched) != 3 || matched[0].ID != "a3" {
+		t.Errorf("sorted label search = %v, want a3 first", nodeIDs(matched))
+	}
+}
+
+func nodeIDs(nodes []*Node) []string {
+	ids := make([]string, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	return ids
+}
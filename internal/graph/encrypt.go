@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"mindy/internal/crypt"
+)
+
+func dbOptions(dir string, key crypt.Key) badger.Options {
+	opts := badger.DefaultOptions(dir)
+	opts.IndexCacheSize = 100 << 20
+	if key != nil {
+		opts = opts.WithEncryptionKey(key)
+	}
+	return opts
+}
+
+// openDB opens the graph database, encrypted with key if it is set. A
+// plaintext database from before encryption was enabled is converted on
+// first open.
+func openDB(dir string, key crypt.Key) (*badger.DB, error) {
+	db, err := badger.Open(dbOptions(dir, key))
+	if err == nil || !errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return db, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("graph: %w", crypt.ErrNoKey)
+	}
+	if err := encryptDB(dir, key); err != nil {
+		return nil, fmt.Errorf("encrypting graph: %w", err)
+	}
+	return badger.Open(dbOptions(dir, key))
+}
+
+// encryptDB copies the plaintext database in dir into an encrypted one
+// and swaps it into place.
+func encryptDB(dir string, key crypt.Key) error {
+	plain, err := badger.Open(dbOptions(dir, nil))
+	if err != nil {
+		// Not plaintext either: the key is wrong.
+		return crypt.ErrWrongKey
+	}
+	tmpDir := dir + ".encrypting"
+	os.RemoveAll(tmpDir)
+	enc, err := badger.Open(dbOptions(tmpDir, key))
+	if err != nil {
+		plain.Close()
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := plain.Backup(pw, 0)
+		pw.CloseWithError(err)
+	}()
+	err = enc.Load(pr, 256)
+	pr.Close()
+	plain.Close()
+	if cerr := enc.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	oldDir := dir + ".plaintext"
+	if err := os.Rename(dir, oldDir); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		os.Rename(oldDir, dir)
+		return err
+	}
+	return os.RemoveAll(oldDir)
+}
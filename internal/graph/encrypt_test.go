@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"mindy/internal/crypt"
+)
+
+func TestStore_EncryptsPlaintextGraph(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+	defer crypt.SetKey(nil)
+	tmpDir := t.TempDir()
+
+	store, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if err := store.AddNode(&Node{ID: "test:1", Type: "Test", Label: "Before"}); err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	store.Close()
+
+	crypt.SetKey(bytes.Repeat([]byte{5}, crypt.KeySize))
+	store, err = NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("open with key: %v", err)
+	}
+	if node, err := store.GetNode("test:1"); err != nil || node.Label != "Before" {
+		t.Fatalf("node lost in migration: %v", err)
+	}
+	if err := store.AddNode(&Node{ID: "test:2", Type: "Test", Label: "After"}); err != nil {
+		t.Fatalf("add node: %v", err)
+	}
+	store.Close()
+
+	crypt.SetKey(nil)
+	if _, err := NewStore(tmpDir); !errors.Is(err, crypt.ErrNoKey) {
+		t.Fatalf("open without key: got %v, want ErrNoKey", err)
+	}
+
+	crypt.SetKey(bytes.Repeat([]byte{6}, crypt.KeySize))
+	if _, err := NewStore(tmpDir); err == nil {
+		t.Fatal("open with the wrong key should fail")
+	}
+
+	crypt.SetKey(bytes.Repeat([]byte{5}, crypt.KeySize))
+	store, err = NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	if node, err := store.GetNode("test:2"); err != nil || node.Label != "After" {
+		t.Errorf("node written encrypted not found: %v", err)
+	}
+}
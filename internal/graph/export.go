@@ -0,0 +1,512 @@
+package graph
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type ExportFormat string
+
+const (
+	FormatGraphML ExportFormat = "graphml"
+	FormatGEXF    ExportFormat = "gexf"
+	FormatDOT     ExportFormat = "dot"
+	FormatJSONLD  ExportFormat = "jsonld"
+)
+
+var ExportFormats = []ExportFormat{FormatGraphML, FormatGEXF, FormatDOT, FormatJSONLD}
+
+type ExportOptions struct {
+	Format    ExportFormat
+	NodeTypes []string
+	Seed      string
+	Depth     int
+}
+
+type Subgraph struct {
+	Nodes []*Node
+	Edges []*Edge
+}
+
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch strings.ToLower(s) {
+	case "graphml", "xml":
+		return FormatGraphML, nil
+	case "gexf":
+		return FormatGEXF, nil
+	case "dot", "gv", "graphviz":
+		return FormatDOT, nil
+	case "jsonld", "json-ld":
+		return FormatJSONLD, nil
+	}
+	return "", fmt.Errorf("unknown export format %q", s)
+}
+
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case FormatGraphML:
+		return "application/graphml+xml"
+	case FormatGEXF:
+		return "application/gexf+xml"
+	case FormatDOT:
+		return "text/vnd.graphviz"
+	case FormatJSONLD:
+		return "application/ld+json"
+	}
+	return "application/octet-stream"
+}
+
+func (f ExportFormat) Extension() string {
+	switch f {
+	case FormatDOT:
+		return "dot"
+	case FormatJSONLD:
+		return "jsonld"
+	}
+	return string(f)
+}
+
+// CollectSubgraph gathers the nodes selected by opts and every edge whose
+// endpoints are both selected. With a seed, nodes are collected breadth-first
+// in both edge directions up to opts.Depth hops; the walk passes through
+// nodes of any type, and the type filter applies to the nodes reached.
+func (s *Store) CollectSubgraph(opts *ExportOptions) (*Subgraph, error) {
+	allowed := make(map[string]bool)
+	for _, t := range opts.NodeTypes {
+		allowed[t] = true
+	}
+	typeOK := func(n *Node) bool {
+		return len(allowed) == 0 || allowed[n.Type] || n.ID == opts.Seed
+	}
+
+	sub := &Subgraph{}
+	selected := make(map[string]bool)
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		if opts.Seed != "" {
+			seed, err := getNodeTxn(txn, opts.Seed)
+			if err != nil {
+				return fmt.Errorf("seed node %s: %w", opts.Seed, err)
+			}
+			depth := opts.Depth
+			if depth <= 0 {
+				depth = 1
+			}
+			selected[seed.ID] = true
+			sub.Nodes = append(sub.Nodes, seed)
+			frontier := []string{seed.ID}
+			for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+				var next []string
+				for _, id := range frontier {
+					edges, err := adjacentEdges(txn, id, DirBoth)
+					if err != nil {
+						return err
+					}
+					for _, edge := range edges {
+						other := edge.To
+						if other == id {
+							other = edge.From
+						}
+						if selected[other] {
+							continue
+						}
+						node, err := getNodeTxn(txn, other)
+						if err != nil {
+							continue
+						}
+						selected[other] = true
+						sub.Nodes = append(sub.Nodes, node)
+						next = append(next, other)
+					}
+				}
+				frontier = next
+			}
+			kept := sub.Nodes[:0]
+			for _, node := range sub.Nodes {
+				if typeOK(node) {
+					kept = append(kept, node)
+				} else {
+					delete(selected, node.ID)
+				}
+			}
+			sub.Nodes = kept
+		} else if len(allowed) > 0 {
+			for _, t := range opts.NodeTypes {
+				for _, id := range collectIndexIDs(txn, typeIndexPrefix+t+keySep, 0) {
+					if selected[id] {
+						continue
+					}
+					node, err := getNodeTxn(txn, id)
+					if err != nil {
+						continue
+					}
+					selected[id] = true
+					sub.Nodes = append(sub.Nodes, node)
+				}
+			}
+		} else {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+			prefix := []byte("node:")
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				var node Node
+				if err := it.Item().Value(func(val []byte) error {
+					return json.Unmarshal(val, &node)
+				}); err != nil {
+					continue
+				}
+				selected[node.ID] = true
+				sub.Nodes = append(sub.Nodes, &node)
+			}
+		}
+
+		for _, node := range sub.Nodes {
+			edges, err := adjacentEdges(txn, node.ID, DirOut)
+			if err != nil {
+				return err
+			}
+			for _, edge := range edges {
+				if selected[edge.To] {
+					sub.Edges = append(sub.Edges, edge)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *Store) Export(w io.Writer, opts *ExportOptions) error {
+	sub, err := s.CollectSubgraph(opts)
+	if err != nil {
+		return err
+	}
+	return sub.Write(w, opts.Format)
+}
+
+func (g *Subgraph) Write(w io.Writer, format ExportFormat) error {
+	switch format {
+	case FormatGraphML:
+		return g.WriteGraphML(w)
+	case FormatGEXF:
+		return g.WriteGEXF(w)
+	case FormatDOT:
+		return g.WriteDOT(w)
+	case FormatJSONLD:
+		return g.WriteJSONLD(w)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+type attrKey struct {
+	name string
+	kind string
+}
+
+// propKeys lists every property key used by the given prop maps together
+// with a type that fits all of its values.
+func propKeys(props []map[string]interface{}) []attrKey {
+	kinds := make(map[string]string)
+	for _, p := range props {
+		for k, v := range p {
+			kind := "string"
+			switch v.(type) {
+			case float64, float32, int, int64:
+				kind = "double"
+			case bool:
+				kind = "boolean"
+			}
+			if prev, ok := kinds[k]; ok && prev != kind {
+				kind = "string"
+			}
+			kinds[k] = kind
+		}
+	}
+	keys := make([]attrKey, 0, len(kinds))
+	for k, kind := range kinds {
+		keys = append(keys, attrKey{name: k, kind: kind})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].name < keys[j].name })
+	return keys
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case bool:
+		return strconv.FormatBool(val)
+	case nil:
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (g *Subgraph) nodeProps() []map[string]interface{} {
+	props := make([]map[string]interface{}, len(g.Nodes))
+	for i, n := range g.Nodes {
+		props[i] = n.Props
+	}
+	return props
+}
+
+func (g *Subgraph) edgeProps() []map[string]interface{} {
+	props := make([]map[string]interface{}, len(g.Edges))
+	for i, e := range g.Edges {
+		props[i] = e.Props
+	}
+	return props
+}
+
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
+
+func (g *Subgraph) WriteGraphML(w io.Writer) error {
+	ew := &errWriter{w: w}
+	nodeKeys := propKeys(g.nodeProps())
+	edgeKeys := propKeys(g.edgeProps())
+
+	ew.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	ew.printf("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	ew.printf("  <key id=\"n_label\" for=\"node\" attr.name=\"label\" attr.type=\"string\"/>\n")
+	ew.printf("  <key id=\"n_type\" for=\"node\" attr.name=\"type\" attr.type=\"string\"/>\n")
+	ew.printf("  <key id=\"n_blob_ref\" for=\"node\" attr.name=\"blob_ref\" attr.type=\"string\"/>\n")
+	ew.printf("  <key id=\"n_created_at\" for=\"node\" attr.name=\"created_at\" attr.type=\"long\"/>\n")
+	// Key IDs are numbered: property names need not be valid NMTOKENs.
+	for i, k := range nodeKeys {
+		ew.printf("  <key id=\"np%d\" for=\"node\" attr.name=\"%s\" attr.type=\"%s\"/>\n", i, xmlEscape(k.name), k.kind)
+	}
+	ew.printf("  <key id=\"e_type\" for=\"edge\" attr.name=\"type\" attr.type=\"string\"/>\n")
+	ew.printf("  <key id=\"e_label\" for=\"edge\" attr.name=\"label\" attr.type=\"string\"/>\n")
+	ew.printf("  <key id=\"e_weight\" for=\"edge\" attr.name=\"weight\" attr.type=\"double\"/>\n")
+	for i, k := range edgeKeys {
+		ew.printf("  <key id=\"ep%d\" for=\"edge\" attr.name=\"%s\" attr.type=\"%s\"/>\n", i, xmlEscape(k.name), k.kind)
+	}
+
+	ew.printf("  <graph id=\"mindy\" edgedefault=\"directed\">\n")
+	for _, n := range g.Nodes {
+		ew.printf("    <node id=\"%s\">\n", xmlEscape(n.ID))
+		ew.printf("      <data key=\"n_label\">%s</data>\n", xmlEscape(n.Label))
+		ew.printf("      <data key=\"n_type\">%s</data>\n", xmlEscape(n.Type))
+		if n.BlobRef != "" {
+			ew.printf("      <data key=\"n_blob_ref\">%s</data>\n", xmlEscape(n.BlobRef))
+		}
+		ew.printf("      <data key=\"n_created_at\">%d</data>\n", n.CreateAt)
+		for i, k := range nodeKeys {
+			if v, ok := n.Props[k.name]; ok {
+				ew.printf("      <data key=\"np%d\">%s</data>\n", i, xmlEscape(formatValue(v)))
+			}
+		}
+		ew.printf("    </node>\n")
+	}
+	for i, e := range g.Edges {
+		ew.printf("    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", i, xmlEscape(e.From), xmlEscape(e.To))
+		ew.printf("      <data key=\"e_type\">%s</data>\n", xmlEscape(e.Type))
+		if e.Label != "" {
+			ew.printf("      <data key=\"e_label\">%s</data>\n", xmlEscape(e.Label))
+		}
+		if e.Weight != 0 {
+			ew.printf("      <data key=\"e_weight\">%s</data>\n", formatValue(e.Weight))
+		}
+		for i, k := range edgeKeys {
+			if v, ok := e.Props[k.name]; ok {
+				ew.printf("      <data key=\"ep%d\">%s</data>\n", i, xmlEscape(formatValue(v)))
+			}
+		}
+		ew.printf("    </edge>\n")
+	}
+	ew.printf("  </graph>\n")
+	ew.printf("</graphml>\n")
+	return ew.err
+}
+
+func (g *Subgraph) WriteGEXF(w io.Writer) error {
+	ew := &errWriter{w: w}
+	nodeKeys := propKeys(g.nodeProps())
+	edgeKeys := propKeys(g.edgeProps())
+
+	ew.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	ew.printf("<gexf xmlns=\"http://gexf.net/1.3\" version=\"1.3\">\n")
+	ew.printf("  <meta lastmodifieddate=\"%s\">\n", time.Now().Format("2006-01-02"))
+	ew.printf("    <creator>Mindy</creator>\n")
+	ew.printf("  </meta>\n")
+	ew.printf("  <graph mode=\"static\" defaultedgetype=\"directed\">\n")
+
+	ew.printf("    <attributes class=\"node\">\n")
+	ew.printf("      <attribute id=\"type\" title=\"type\" type=\"string\"/>\n")
+	ew.printf("      <attribute id=\"blob_ref\" title=\"blob_ref\" type=\"string\"/>\n")
+	ew.printf("      <attribute id=\"created_at\" title=\"created_at\" type=\"long\"/>\n")
+	for i, k := range nodeKeys {
+		ew.printf("      <attribute id=\"p%d\" title=\"%s\" type=\"%s\"/>\n", i, xmlEscape(k.name), k.kind)
+	}
+	ew.printf("    </attributes>\n")
+	ew.printf("    <attributes class=\"edge\">\n")
+	ew.printf("      <attribute id=\"type\" title=\"type\" type=\"string\"/>\n")
+	for i, k := range edgeKeys {
+		ew.printf("      <attribute id=\"p%d\" title=\"%s\" type=\"%s\"/>\n", i, xmlEscape(k.name), k.kind)
+	}
+	ew.printf("    </attributes>\n")
+
+	ew.printf("    <nodes>\n")
+	for _, n := range g.Nodes {
+		ew.printf("      <node id=\"%s\" label=\"%s\">\n", xmlEscape(n.ID), xmlEscape(n.Label))
+		ew.printf("        <attvalues>\n")
+		ew.printf("          <attvalue for=\"type\" value=\"%s\"/>\n", xmlEscape(n.Type))
+		if n.BlobRef != "" {
+			ew.printf("          <attvalue for=\"blob_ref\" value=\"%s\"/>\n", xmlEscape(n.BlobRef))
+		}
+		ew.printf("          <attvalue for=\"created_at\" value=\"%d\"/>\n", n.CreateAt)
+		for i, k := range nodeKeys {
+			if v, ok := n.Props[k.name]; ok {
+				ew.printf("          <attvalue for=\"p%d\" value=\"%s\"/>\n", i, xmlEscape(formatValue(v)))
+			}
+		}
+		ew.printf("        </attvalues>\n")
+		ew.printf("      </node>\n")
+	}
+	ew.printf("    </nodes>\n")
+
+	ew.printf("    <edges>\n")
+	for i, e := range g.Edges {
+		weight := ""
+		if e.Weight != 0 {
+			weight = fmt.Sprintf(" weight=\"%s\"", formatValue(e.Weight))
+		}
+		ew.printf("      <edge id=\"%d\" source=\"%s\" target=\"%s\" label=\"%s\"%s>\n", i, xmlEscape(e.From), xmlEscape(e.To), xmlEscape(e.Type), weight)
+		ew.printf("        <attvalues>\n")
+		ew.printf("          <attvalue for=\"type\" value=\"%s\"/>\n", xmlEscape(e.Type))
+		for i, k := range edgeKeys {
+			if v, ok := e.Props[k.name]; ok {
+				ew.printf("          <attvalue for=\"p%d\" value=\"%s\"/>\n", i, xmlEscape(formatValue(v)))
+			}
+		}
+		ew.printf("        </attvalues>\n")
+		ew.printf("      </edge>\n")
+	}
+	ew.printf("    </edges>\n")
+	ew.printf("  </graph>\n")
+	ew.printf("</gexf>\n")
+	return ew.err
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+var dotShapes = map[string]string{
+	NodeDocument: "box",
+	NodeChunk:    "note",
+	NodeEntity:   "ellipse",
+}
+
+func (g *Subgraph) WriteDOT(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("digraph mindy {\n")
+	ew.printf("  node [fontname=\"Helvetica\"];\n")
+	for _, n := range g.Nodes {
+		label := n.Label
+		if label == "" {
+			label = n.ID
+		}
+		shape := dotShapes[n.Type]
+		if shape == "" {
+			shape = "ellipse"
+		}
+		ew.printf("  %s [label=%s, type=%s, shape=%s];\n", dotQuote(n.ID), dotQuote(label), dotQuote(n.Type), shape)
+	}
+	for _, e := range g.Edges {
+		attrs := "label=" + dotQuote(e.Type)
+		if e.Weight != 0 {
+			attrs += ", weight=" + formatValue(e.Weight)
+		}
+		ew.printf("  %s -> %s [%s];\n", dotQuote(e.From), dotQuote(e.To), attrs)
+	}
+	ew.printf("}\n")
+	return ew.err
+}
+
+const jsonLDVocab = "https://mindy.local/schema#"
+
+func (g *Subgraph) WriteJSONLD(w io.Writer) error {
+	outgoing := make(map[string][]*Edge)
+	for _, e := range g.Edges {
+		outgoing[e.From] = append(outgoing[e.From], e)
+	}
+
+	items := make([]map[string]interface{}, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		item := map[string]interface{}{
+			"@id":   n.ID,
+			"@type": n.Type,
+			"label": n.Label,
+		}
+		if n.BlobRef != "" {
+			item["blobRef"] = n.BlobRef
+		}
+		if n.CreateAt != 0 {
+			item["createdAt"] = time.Unix(n.CreateAt, 0).UTC().Format(time.RFC3339)
+		}
+		for k, v := range n.Props {
+			if _, reserved := item[k]; !reserved {
+				item[k] = v
+			}
+		}
+		for _, e := range outgoing[n.ID] {
+			ref := map[string]interface{}{"@id": e.To}
+			if e.Weight != 0 {
+				ref["weight"] = e.Weight
+			}
+			if existing, ok := item[e.Type].([]interface{}); ok {
+				item[e.Type] = append(existing, ref)
+			} else {
+				item[e.Type] = []interface{}{ref}
+			}
+		}
+		items = append(items, item)
+	}
+
+	doc := map[string]interface{}{
+		"@context": map[string]interface{}{
+			"@vocab": jsonLDVocab,
+			"label":  "http://www.w3.org/2000/01/rdf-schema#label",
+		},
+		"@graph": items,
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,136 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStore_ExportFormats(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	store := newQueryTestStore(t)
+	defer store.Close()
+
+	for _, format := range ExportFormats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := store.Export(&buf, &ExportOptions{Format: format}); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			out := buf.String()
+
+			switch format {
+			case FormatGraphML, FormatGEXF:
+				var doc struct{}
+				if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+					t.Fatalf("invalid XML: %v", err)
+				}
+				if strings.Count(out, "<node ") != 7 || strings.Count(out, "<edge ") != 6 {
+					t.Errorf("unexpected node/edge count in:\n%s", out)
+				}
+			case FormatDOT:
+				if !strings.HasPrefix(out, "digraph") || strings.Count(out, " -> ") != 6 {
+					t.Errorf("unexpected DOT output:\n%s", out)
+				}
+			case FormatJSONLD:
+				var doc struct {
+					Graph []map[string]interface{} `json:"@graph"`
+				}
+				if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+					t.Fatalf("invalid JSON-LD: %v", err)
+				}
+				if len(doc.Graph) != 7 {
+					t.Errorf("got %d graph items, want 7", len(doc.Graph))
+				}
+			}
+		})
+	}
+}
+
+func TestStore_CollectSubgraph(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	store := newQueryTestStore(t)
+	defer store.Close()
+
+	sub, err := store.CollectSubgraph(&ExportOptions{NodeTypes: []string{"Entity"}})
+	if err != nil {
+		t.Fatalf("CollectSubgraph() error = %v", err)
+	}
+	if len(sub.Nodes) != 3 || len(sub.Edges) != 0 {
+		t.Errorf("type filter: got %d nodes, %d edges", len(sub.Nodes), len(sub.Edges))
+	}
+
+	sub, err = store.CollectSubgraph(&ExportOptions{Seed: "doc:2", Depth: 2})
+	if err != nil {
+		t.Fatalf("CollectSubgraph() error = %v", err)
+	}
+	if len(sub.Nodes) != 4 || len(sub.Edges) != 3 {
+		t.Errorf("seed subgraph: got %d nodes, %d edges", len(sub.Nodes), len(sub.Edges))
+	}
+
+	sub, err = store.CollectSubgraph(&ExportOptions{Seed: "entity:mindy", Depth: 2, NodeTypes: []string{"Document", "Chunk"}})
+	if err != nil {
+		t.Fatalf("CollectSubgraph() error = %v", err)
+	}
+	if len(sub.Nodes) != 5 {
+		t.Errorf("filtered seed subgraph: got %d nodes, want 5", len(sub.Nodes))
+	}
+
+	// The walk passes through chunks to reach co-occurring entities.
+	sub, err = store.CollectSubgraph(&ExportOptions{Seed: "entity:mindy", Depth: 2, NodeTypes: []string{"Entity"}})
+	if err != nil {
+		t.Fatalf("CollectSubgraph() error = %v", err)
+	}
+	if len(sub.Nodes) != 3 || len(sub.Edges) != 0 {
+		t.Errorf("entity seed subgraph: got %d nodes, %d edges", len(sub.Nodes), len(sub.Edges))
+	}
+
+	if _, err := store.CollectSubgraph(&ExportOptions{Seed: "missing"}); err == nil {
+		t.Error("expected error for missing seed")
+	}
+}
+
+func TestSubgraph_WriteKeyIDs(t *testing.T) {
+	sub := &Subgraph{Nodes: []*Node{{ID: "row:1", Type: "Row", Props: map[string]interface{}{"first name": "Ada", "a&b": 1.0}}}}
+	valid := regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+	for _, format := range []ExportFormat{FormatGraphML, FormatGEXF} {
+		var buf bytes.Buffer
+		if err := sub.Write(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		dec := xml.NewDecoder(&buf)
+		names := map[string]bool{}
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				break
+			}
+			el, ok := tok.(xml.StartElement)
+			if !ok || (el.Name.Local != "key" && el.Name.Local != "attribute") {
+				continue
+			}
+			for _, attr := range el.Attr {
+				switch attr.Name.Local {
+				case "id":
+					if !valid.MatchString(attr.Value) {
+						t.Errorf("%s: invalid key id %q", format, attr.Value)
+					}
+				case "attr.name", "title":
+					names[attr.Value] = true
+				}
+			}
+		}
+		if !names["first name"] || !names["a&b"] {
+			t.Errorf("%s: property names = %v", format, names)
+		}
+	}
+}
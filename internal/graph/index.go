@@ -0,0 +1,495 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Secondary index layout. All index keys carry the node ID after a NUL
+// separator so prefix scans never bleed into neighbouring terms.
+//
+//	idx:type:<Type>\x00<id>      node type membership
+//	idx:label:<term>\x00<id>     lowercased label, name, aliases and their words
+//	idx:tri:<trigram>\x00<id>    trigrams of lowercased label, name and id
+//	idx:rank:<prop>\x00<score>\x00<id>  nodes ordered by an analytics score
+//	count:type:<Type>            uint64 node count per type
+const (
+	typeIndexPrefix  = "idx:type:"
+	labelIndexPrefix = "idx:label:"
+	triIndexPrefix   = "idx:tri:"
+	rankIndexPrefix  = "idx:rank:"
+	typeCountPrefix  = "count:type:"
+	indexVersionKey  = "meta:index_version"
+
+	indexVersion = "2"
+	keySep       = "\x00"
+
+	maxSortCandidates = 1000
+	// maxShortScan caps the nodes examined for queries too short to have
+	// trigrams.
+	maxShortScan = 20000
+)
+
+func typeIndexKey(nodeType, id string) []byte {
+	return []byte(typeIndexPrefix + nodeType + keySep + id)
+}
+
+func typeCountKey(nodeType string) []byte {
+	return []byte(typeCountPrefix + nodeType)
+}
+
+func idFromIndexKey(key []byte) string {
+	if i := bytes.LastIndexByte(key, 0); i >= 0 {
+		return string(key[i+1:])
+	}
+	return ""
+}
+
+func nodeSearchTexts(node *Node) []string {
+	texts := []string{strings.ToLower(node.Label)}
+	if name, ok := node.Props["name"].(string); ok && name != "" {
+		texts = append(texts, strings.ToLower(name))
+	}
+	for _, alias := range aliasList(node.Props["aliases"]) {
+		texts = append(texts, strings.ToLower(alias))
+	}
+	return texts
+}
+
+func nodeIndexKeys(node *Node) map[string]struct{} {
+	keys := make(map[string]struct{})
+	keys[string(typeIndexKey(node.Type, node.ID))] = struct{}{}
+
+	texts := nodeSearchTexts(node)
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		keys[labelIndexPrefix+text+keySep+node.ID] = struct{}{}
+		for _, word := range strings.FieldsFunc(text, isWordSeparator) {
+			keys[labelIndexPrefix+word+keySep+node.ID] = struct{}{}
+		}
+	}
+
+	for _, text := range append(texts, strings.ToLower(node.ID)) {
+		for _, tri := range trigrams(text) {
+			keys[triIndexPrefix+tri+keySep+node.ID] = struct{}{}
+		}
+	}
+
+	for _, prop := range RankProps {
+		if v, ok := toFloat(node.Props[prop]); ok {
+			keys[rankIndexPrefix+prop+keySep+encodeScore(v)+keySep+node.ID] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// RankProps are the numeric node properties that can be used as sort keys
+// in graph search. They are written by the analytics jobs.
+var RankProps = []string{"pagerank", "degree", "betweenness", "component", "community"}
+
+func IsRankProp(prop string) bool {
+	for _, p := range RankProps {
+		if p == prop {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeScore maps a float to a fixed-width hex string whose byte order
+// matches numeric order.
+func encodeScore(v float64) string {
+	bits := math.Float64bits(v)
+	if v >= 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return fmt.Sprintf("%016x", bits)
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+func trigrams(text string) []string {
+	runes := []rune(text)
+	if len(runes) < 3 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for i := 0; i+3 <= len(runes); i++ {
+		tri := string(runes[i : i+3])
+		if !seen[tri] {
+			seen[tri] = true
+			out = append(out, tri)
+		}
+	}
+	return out
+}
+
+// updateNodeIndexes rewrites the index entries of a node inside txn.
+// old is the previously stored version of the node, or nil.
+func updateNodeIndexes(txn *badger.Txn, old, node *Node) error {
+	newKeys := nodeIndexKeys(node)
+	oldKeys := make(map[string]struct{})
+	if old != nil {
+		oldKeys = nodeIndexKeys(old)
+		for key := range oldKeys {
+			if _, ok := newKeys[key]; ok {
+				continue
+			}
+			if err := txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+	}
+	for key := range newKeys {
+		if _, ok := oldKeys[key]; ok {
+			continue
+		}
+		if err := txn.Set([]byte(key), nil); err != nil {
+			return err
+		}
+	}
+
+	if old == nil {
+		return addTypeCount(txn, node.Type, 1)
+	}
+	if old.Type != node.Type {
+		if err := addTypeCount(txn, old.Type, -1); err != nil {
+			return err
+		}
+		return addTypeCount(txn, node.Type, 1)
+	}
+	return nil
+}
+
+func removeNodeIndexes(txn *badger.Txn, node *Node) error {
+	for key := range nodeIndexKeys(node) {
+		if err := txn.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return addTypeCount(txn, node.Type, -1)
+}
+
+func addTypeCount(txn *badger.Txn, nodeType string, delta int64) error {
+	key := typeCountKey(nodeType)
+	current, err := readCount(txn, key)
+	if err != nil {
+		return err
+	}
+	next := int64(current) + delta
+	if next <= 0 {
+		return txn.Delete(key)
+	}
+	return txn.Set(key, encodeCount(uint64(next)))
+}
+
+func readCount(txn *badger.Txn, key []byte) (uint64, error) {
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	err = item.Value(func(val []byte) error {
+		if len(val) == 8 {
+			count = binary.BigEndian.Uint64(val)
+		}
+		return nil
+	})
+	return count, err
+}
+
+func encodeCount(n uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, n)
+	return buf
+}
+
+func getNodeTxn(txn *badger.Txn, id string) (*Node, error) {
+	item, err := txn.Get([]byte("node:" + id))
+	if err != nil {
+		return nil, err
+	}
+	var node Node
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &node)
+	}); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+func hasKey(txn *badger.Txn, key []byte) bool {
+	_, err := txn.Get(key)
+	return err == nil
+}
+
+// ensureIndexes rebuilds the secondary indexes when the store was written
+// by a version that did not maintain them.
+func (s *Store) ensureIndexes() error {
+	current := ""
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(indexVersionKey))
+		if err != nil {
+			return nil
+		}
+		val, err := item.ValueCopy(nil)
+		current = string(val)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if current == indexVersion {
+		return nil
+	}
+	return s.RebuildIndexes()
+}
+
+func (s *Store) RebuildIndexes() error {
+	for _, prefix := range []string{"idx:", "count:"} {
+		if err := s.db.DropPrefix([]byte(prefix)); err != nil {
+			return err
+		}
+	}
+
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	counts := make(map[string]uint64)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("node:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var node Node
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &node)
+			}); err != nil {
+				continue
+			}
+			for key := range nodeIndexKeys(&node) {
+				if err := wb.Set([]byte(key), nil); err != nil {
+					return err
+				}
+			}
+			counts[node.Type]++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for nodeType, n := range counts {
+		if err := wb.Set(typeCountKey(nodeType), encodeCount(n)); err != nil {
+			return err
+		}
+	}
+	if err := wb.Set([]byte(indexVersionKey), []byte(indexVersion)); err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+// TypeCounts returns the maintained node count for every node type.
+func (s *Store) TypeCounts() map[string]int {
+	counts := make(map[string]int)
+	s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte(typeCountPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			nodeType := strings.TrimPrefix(string(item.Key()), typeCountPrefix)
+			item.Value(func(val []byte) error {
+				if len(val) == 8 {
+					counts[nodeType] = int(binary.BigEndian.Uint64(val))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return counts
+}
+
+// NodeIDsByType lists node IDs of the given type from the type index.
+func (s *Store) NodeIDsByType(nodeType string, limit int) []string {
+	var ids []string
+	s.db.View(func(txn *badger.Txn) error {
+		ids = collectIndexIDs(txn, typeIndexPrefix+nodeType+keySep, limit)
+		return nil
+	})
+	return ids
+}
+
+// searchIndexed answers label queries from the label and trigram indexes.
+// Label and word prefix matches come first, followed by substring matches
+// found through trigram intersection.
+func (s *Store) searchIndexed(txn *badger.Txn, nodeType, labelQuery string, limit int) []*Node {
+	query := strings.ToLower(labelQuery)
+	seen := make(map[string]bool)
+	var results []*Node
+
+	accept := func(id string, verify bool) bool {
+		if seen[id] {
+			return false
+		}
+		seen[id] = true
+		if nodeType != "" && !hasKey(txn, typeIndexKey(nodeType, id)) {
+			return false
+		}
+		node, err := getNodeTxn(txn, id)
+		if err != nil {
+			return false
+		}
+		if verify && !nodeMatches(node, query) {
+			return false
+		}
+		results = append(results, node)
+		return len(results) >= limit
+	}
+
+	opts := badger.IteratorOptions{PrefetchValues: false}
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := []byte(labelIndexPrefix + query)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if accept(idFromIndexKey(it.Item().Key()), false) {
+			return results
+		}
+	}
+
+	tris := trigrams(query)
+	if len(tris) == 0 {
+		// Too short for the trigram index: scan for substring matches
+		// ("db" in "MongoDB"), within maxShortScan nodes.
+		scan := []byte("node:")
+		if nodeType != "" {
+			scan = []byte(typeIndexPrefix + nodeType + keySep)
+		}
+		examined := 0
+		for it.Seek(scan); it.ValidForPrefix(scan) && examined < maxShortScan; it.Next() {
+			examined++
+			key := it.Item().Key()
+			id := string(key[len(scan):])
+			if nodeType != "" {
+				id = idFromIndexKey(key)
+			}
+			if accept(id, true) {
+				return results
+			}
+		}
+		return results
+	}
+
+	first := []byte(triIndexPrefix + tris[0] + keySep)
+	for it.Seek(first); it.ValidForPrefix(first); it.Next() {
+		id := idFromIndexKey(it.Item().Key())
+		if seen[id] {
+			continue
+		}
+		candidate := true
+		for _, tri := range tris[1:] {
+			if !hasKey(txn, []byte(triIndexPrefix+tri+keySep+id)) {
+				candidate = false
+				break
+			}
+		}
+		if candidate && accept(id, true) {
+			return results
+		}
+	}
+	return results
+}
+
+func nodeMatches(node *Node, query string) bool {
+	if strings.Contains(strings.ToLower(node.ID), query) {
+		return true
+	}
+	for _, text := range nodeSearchTexts(node) {
+		if strings.Contains(text, query) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchNodesSorted is SearchNodes ordered by one of RankProps. Without a
+// label query the rank index is walked directly; otherwise up to
+// maxSortCandidates matches are collected and sorted in memory.
+func (s *Store) SearchNodesSorted(nodeType, labelQuery, sortKey string, ascending bool, limit int) []*Node {
+	var results []*Node
+
+	s.db.View(func(txn *badger.Txn) error {
+		if labelQuery != "" {
+			results = s.searchIndexed(txn, nodeType, labelQuery, maxSortCandidates)
+			return nil
+		}
+
+		opts := badger.IteratorOptions{PrefetchValues: false, Reverse: !ascending}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte(rankIndexPrefix + sortKey + keySep)
+		start := prefix
+		if !ascending {
+			start = append(append([]byte{}, prefix...), 0xff)
+		}
+		for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+			id := idFromIndexKey(it.Item().Key())
+			if nodeType != "" && !hasKey(txn, typeIndexKey(nodeType, id)) {
+				continue
+			}
+			node, err := getNodeTxn(txn, id)
+			if err != nil {
+				continue
+			}
+			results = append(results, node)
+			if len(results) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	if labelQuery != "" {
+		sort.SliceStable(results, func(a, b int) bool {
+			c := compareValues(results[a].Props[sortKey], results[b].Props[sortKey])
+			if ascending {
+				return c < 0
+			}
+			if results[a].Props[sortKey] == nil || results[b].Props[sortKey] == nil {
+				return c < 0
+			}
+			return c > 0
+		})
+		if len(results) > limit {
+			results = results[:limit]
+		}
+	}
+	return results
+}
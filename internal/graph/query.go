@@ -0,0 +1,762 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed graph query. The language is a small Cypher subset:
+//
+//	MATCH (d:Document)-[:HAS_CHUNK]->(c:Chunk)-[:HAS_ENTITY]->(e:Entity {name: "Mindy"})
+//	WHERE d.modified >= 1700000000 AND NOT e.name STARTS WITH "The"
+//	RETURN DISTINCT d.path AS path, e
+//	ORDER BY path DESC
+//	LIMIT 20
+type Query struct {
+	Patterns []*PathPattern
+	Where    Expr
+	Distinct bool
+	Return   []ReturnItem
+	OrderBy  []OrderItem
+	// Limit is the most rows returned, or NoLimit.
+	Limit int
+}
+
+// NoLimit is the Limit of a query without LIMIT.
+const NoLimit = -1
+
+type PathPattern struct {
+	Nodes []*NodePattern
+	Rels  []*RelPattern
+}
+
+type NodePattern struct {
+	Var   string
+	Type  string
+	Props map[string]interface{}
+}
+
+type RelDirection int
+
+const (
+	DirOut RelDirection = iota
+	DirIn
+	DirBoth
+)
+
+type RelPattern struct {
+	Var   string
+	Types []string
+	Dir   RelDirection
+	Props map[string]interface{}
+}
+
+type ReturnItem struct {
+	Expr  Expr
+	Alias string
+}
+
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+type Expr interface {
+	vars(into map[string]bool)
+}
+
+type VarExpr struct {
+	Name string
+}
+
+type PropExpr struct {
+	Var  string
+	Prop string
+}
+
+type LiteralExpr struct {
+	Value interface{}
+}
+
+type ListExpr struct {
+	Items []Expr
+}
+
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+type NotExpr struct {
+	Expr Expr
+}
+
+type CountExpr struct{}
+
+func (e *VarExpr) vars(into map[string]bool)     { into[e.Name] = true }
+func (e *PropExpr) vars(into map[string]bool)    { into[e.Var] = true }
+func (e *LiteralExpr) vars(into map[string]bool) {}
+func (e *CountExpr) vars(into map[string]bool)   {}
+
+func (e *ListExpr) vars(into map[string]bool) {
+	for _, item := range e.Items {
+		item.vars(into)
+	}
+}
+
+func (e *BinaryExpr) vars(into map[string]bool) {
+	e.Left.vars(into)
+	e.Right.vars(into)
+}
+
+func (e *NotExpr) vars(into map[string]bool) { e.Expr.vars(into) }
+
+func exprName(e Expr) string {
+	switch v := e.(type) {
+	case *VarExpr:
+		return v.Name
+	case *PropExpr:
+		return v.Var + "." + v.Prop
+	case *CountExpr:
+		return "count(*)"
+	case *LiteralExpr:
+		return fmt.Sprint(v.Value)
+	default:
+		return "expr"
+	}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lexQuery(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[start:i]), start})
+		case r == '`':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != '`' {
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated identifier at %d", start)
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[start+1 : i]), start})
+			i++
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]) && lastAllowsSign(tokens)):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, string(runes[start:i]), start})
+		case r == '"' || r == '\'':
+			start := i
+			quote := r
+			i++
+			var sb strings.Builder
+			for i < len(runes) && runes[i] != quote {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					default:
+						sb.WriteRune(runes[i])
+					}
+				} else {
+					sb.WriteRune(runes[i])
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokString, sb.String(), start})
+		default:
+			start := i
+			two := ""
+			if i+1 < len(runes) {
+				two = string(runes[i : i+2])
+			}
+			switch two {
+			case "<>", "!=", "<=", ">=", "->", "<-":
+				tokens = append(tokens, token{tokPunct, two, start})
+				i += 2
+				continue
+			}
+			if !strings.ContainsRune("()[]{}:,.-<>=*|", r) {
+				return nil, fmt.Errorf("unexpected character %q at %d", r, start)
+			}
+			tokens = append(tokens, token{tokPunct, string(r), start})
+			i++
+		}
+	}
+	tokens = append(tokens, token{tokEOF, "", len(runes)})
+	return tokens, nil
+}
+
+// lastAllowsSign reports whether a '-' at this point starts a negative
+// number rather than a relationship dash.
+func lastAllowsSign(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	if last.kind == tokPunct {
+		switch last.text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=", ",", "(", "[", ":":
+			return true
+		}
+		return false
+	}
+	if last.kind == tokIdent {
+		switch strings.ToUpper(last.text) {
+		case "AND", "OR", "NOT", "IN", "LIMIT", "WITH", "CONTAINS":
+			return true
+		}
+	}
+	return false
+}
+
+type queryParser struct {
+	tokens []token
+	pos    int
+	anon   int
+}
+
+func ParseQuery(input string) (*Query, error) {
+	tokens, err := lexQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	return p.parseQuery()
+}
+
+func (p *queryParser) peek() token { return p.tokens[p.pos] }
+
+func (p *queryParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *queryParser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.errorf("expected %s", kw)
+	}
+	return nil
+}
+
+func (p *queryParser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == s
+}
+
+func (p *queryParser) acceptPunct(s string) bool {
+	if p.isPunct(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expectPunct(s string) error {
+	if !p.acceptPunct(s) {
+		return p.errorf("expected %q", s)
+	}
+	return nil
+}
+
+func (p *queryParser) expectIdent() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return "", p.errorf("expected identifier")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := t.text
+	if t.kind == tokEOF {
+		found = "end of query"
+	}
+	return fmt.Errorf("%s at position %d (found %q)", fmt.Sprintf(format, args...), t.pos, found)
+}
+
+func (p *queryParser) parseQuery() (*Query, error) {
+	q := &Query{Limit: NoLimit}
+	if err := p.expectKeyword("MATCH"); err != nil {
+		return nil, err
+	}
+	for {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		q.Patterns = append(q.Patterns, path)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("WHERE") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		q.Where = expr
+	}
+
+	if err := p.expectKeyword("RETURN"); err != nil {
+		return nil, err
+	}
+	q.Distinct = p.acceptKeyword("DISTINCT")
+	for {
+		expr, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		item := ReturnItem{Expr: expr, Alias: exprName(expr)}
+		if p.acceptKeyword("AS") {
+			alias, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			item.Alias = alias
+		}
+		q.Return = append(q.Return, item)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			item := OrderItem{Expr: expr}
+			if p.acceptKeyword("DESC") {
+				item.Desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			q.OrderBy = append(q.OrderBy, item)
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != tokNumber || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid LIMIT %q", t.text)
+		}
+		q.Limit = n
+	}
+
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	return q, nil
+}
+
+func (p *queryParser) parsePath() (*PathPattern, error) {
+	path := &PathPattern{}
+	node, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	path.Nodes = append(path.Nodes, node)
+
+	for p.isPunct("-") || p.isPunct("<-") {
+		rel, err := p.parseRel()
+		if err != nil {
+			return nil, err
+		}
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		path.Rels = append(path.Rels, rel)
+		path.Nodes = append(path.Nodes, node)
+	}
+	return path, nil
+}
+
+func (p *queryParser) parseNode() (*NodePattern, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	node := &NodePattern{}
+	if p.peek().kind == tokIdent {
+		node.Var = p.next().text
+	}
+	if p.acceptPunct(":") {
+		nodeType, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		node.Type = nodeType
+	}
+	if p.isPunct("{") {
+		props, err := p.parseProps()
+		if err != nil {
+			return nil, err
+		}
+		node.Props = props
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+	if node.Var == "" {
+		node.Var = fmt.Sprintf("_n%d", p.anon)
+		p.anon++
+	}
+	return node, nil
+}
+
+func (p *queryParser) parseRel() (*RelPattern, error) {
+	rel := &RelPattern{Dir: DirBoth}
+	incoming := false
+	if p.acceptPunct("<-") {
+		incoming = true
+	} else if err := p.expectPunct("-"); err != nil {
+		return nil, err
+	}
+
+	if p.acceptPunct("[") {
+		if p.peek().kind == tokIdent {
+			rel.Var = p.next().text
+		}
+		if p.acceptPunct(":") {
+			for {
+				relType, err := p.expectIdent()
+				if err != nil {
+					return nil, err
+				}
+				rel.Types = append(rel.Types, relType)
+				if !p.acceptPunct("|") {
+					break
+				}
+				p.acceptPunct(":")
+			}
+		}
+		if p.isPunct("{") {
+			props, err := p.parseProps()
+			if err != nil {
+				return nil, err
+			}
+			rel.Props = props
+		}
+		if p.isPunct("*") {
+			return nil, p.errorf("variable-length relationships are not supported")
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return nil, err
+		}
+	}
+
+	outgoing := false
+	if p.acceptPunct("->") {
+		outgoing = true
+	} else if err := p.expectPunct("-"); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case incoming && outgoing:
+		return nil, p.errorf("relationship cannot point both ways")
+	case incoming:
+		rel.Dir = DirIn
+	case outgoing:
+		rel.Dir = DirOut
+	}
+	if rel.Var == "" {
+		rel.Var = fmt.Sprintf("_r%d", p.anon)
+		p.anon++
+	}
+	return rel, nil
+}
+
+func (p *queryParser) parseProps() (map[string]interface{}, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	props := make(map[string]interface{})
+	if p.acceptPunct("}") {
+		return props, nil
+	}
+	for {
+		key, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		lit, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		props[key] = lit.Value
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	if err := p.expectPunct("}"); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func (p *queryParser) parseLiteral() (*LiteralExpr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokString:
+		p.pos++
+		return &LiteralExpr{Value: t.text}, nil
+	case tokNumber:
+		p.pos++
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return &LiteralExpr{Value: f}, nil
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			p.pos++
+			return &LiteralExpr{Value: true}, nil
+		case "false":
+			p.pos++
+			return &LiteralExpr{Value: false}, nil
+		case "null":
+			p.pos++
+			return &LiteralExpr{Value: nil}, nil
+		}
+	}
+	return nil, p.errorf("expected literal")
+}
+
+func (p *queryParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (Expr, error) {
+	if p.acceptPunct("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	var op string
+	switch {
+	case p.acceptPunct("="):
+		op = "="
+	case p.acceptPunct("<>"), p.acceptPunct("!="):
+		op = "<>"
+	case p.acceptPunct("<="):
+		op = "<="
+	case p.acceptPunct(">="):
+		op = ">="
+	case p.acceptPunct("<"):
+		op = "<"
+	case p.acceptPunct(">"):
+		op = ">"
+	case p.acceptKeyword("CONTAINS"):
+		op = "CONTAINS"
+	case p.acceptKeyword("IN"):
+		op = "IN"
+	case p.acceptKeyword("STARTS"):
+		if err := p.expectKeyword("WITH"); err != nil {
+			return nil, err
+		}
+		op = "STARTS WITH"
+	case p.acceptKeyword("ENDS"):
+		if err := p.expectKeyword("WITH"); err != nil {
+			return nil, err
+		}
+		op = "ENDS WITH"
+	case p.acceptKeyword("IS"):
+		negate := p.acceptKeyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		expr := Expr(&BinaryExpr{Op: "=", Left: left, Right: &LiteralExpr{Value: nil}})
+		if negate {
+			expr = &NotExpr{Expr: expr}
+		}
+		return expr, nil
+	default:
+		return left, nil
+	}
+
+	var right Expr
+	if op == "IN" {
+		right, err = p.parseList()
+	} else {
+		right, err = p.parseOperand()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{Op: op, Left: left, Right: right}, nil
+}
+
+func (p *queryParser) parseList() (Expr, error) {
+	if err := p.expectPunct("["); err != nil {
+		return nil, err
+	}
+	list := &ListExpr{}
+	if p.acceptPunct("]") {
+		return list, nil
+	}
+	for {
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, item)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	if err := p.expectPunct("]"); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (p *queryParser) parseOperand() (Expr, error) {
+	t := p.peek()
+	if t.kind == tokIdent {
+		lower := strings.ToLower(t.text)
+		if lower == "true" || lower == "false" || lower == "null" {
+			return p.parseLiteral()
+		}
+		if lower == "count" && p.tokens[p.pos+1].text == "(" {
+			p.pos += 2
+			if err := p.expectPunct("*"); err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			return &CountExpr{}, nil
+		}
+		p.pos++
+		if p.acceptPunct(".") {
+			prop, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			return &PropExpr{Var: t.text, Prop: prop}, nil
+		}
+		return &VarExpr{Name: t.text}, nil
+	}
+	return p.parseLiteral()
+}
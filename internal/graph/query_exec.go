@@ -0,0 +1,921 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// MaxQueryRows bounds the number of intermediate rows a query may produce
+// before ORDER BY, DISTINCT or count(*) are applied.
+const MaxQueryRows = 100000
+
+var ErrQueryTooBroad = errors.New("query matches too many rows; add constraints or a LIMIT")
+
+type QueryResult struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	Plan    []string        `json:"plan"`
+}
+
+type stepKind int
+
+const (
+	stepScan stepKind = iota
+	stepExpand
+	stepCheck
+)
+
+type scanMode int
+
+const (
+	scanByID scanMode = iota
+	scanByLabel
+	scanByType
+	scanAll
+)
+
+type planStep struct {
+	kind    stepKind
+	node    *NodePattern
+	rel     *RelPattern
+	from    string
+	to      string
+	dir     RelDirection
+	mode    scanMode
+	filters []Expr
+}
+
+type relBinding struct {
+	rel   *RelPattern
+	left  string
+	right string
+}
+
+func (s *Store) RunQuery(text string) (*QueryResult, error) {
+	q, err := ParseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	return s.Query(q)
+}
+
+func (s *Store) Query(q *Query) (*QueryResult, error) {
+	steps, err := s.planQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{Rows: [][]interface{}{}}
+	for _, item := range q.Return {
+		result.Columns = append(result.Columns, item.Alias)
+	}
+	for _, step := range steps {
+		result.Plan = append(result.Plan, step.String())
+	}
+
+	aggregate := false
+	for _, item := range q.Return {
+		if _, ok := item.Expr.(*CountExpr); ok {
+			aggregate = true
+		}
+	}
+	streaming := !aggregate && !q.Distinct && len(q.OrderBy) == 0
+
+	var collected []map[string]interface{}
+	err = s.db.View(func(txn *badger.Txn) error {
+		ex := &queryExec{txn: txn, steps: steps, row: make(map[string]interface{}), used: make(map[string]bool)}
+		return ex.run(0, func(row map[string]interface{}) (bool, error) {
+			snapshot := make(map[string]interface{}, len(row))
+			for k, v := range row {
+				snapshot[k] = v
+			}
+			collected = append(collected, snapshot)
+			if streaming && q.Limit != NoLimit && len(collected) >= q.Limit {
+				return true, nil
+			}
+			if len(collected) > MaxQueryRows {
+				return true, ErrQueryTooBroad
+			}
+			return false, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type outRow struct {
+		values []interface{}
+		keys   []interface{}
+	}
+	var out []*outRow
+	groups := make(map[string]*outRow)
+	seen := make(map[string]bool)
+
+	for _, row := range collected {
+		values := make([]interface{}, len(q.Return))
+		for i, item := range q.Return {
+			if _, ok := item.Expr.(*CountExpr); ok {
+				continue
+			}
+			values[i] = evalExpr(item.Expr, row)
+		}
+
+		key := rowKey(values)
+		if aggregate {
+			if g, ok := groups[key]; ok {
+				for i, item := range q.Return {
+					if _, ok := item.Expr.(*CountExpr); ok {
+						g.values[i] = g.values[i].(int) + 1
+					}
+				}
+				continue
+			}
+			for i, item := range q.Return {
+				if _, ok := item.Expr.(*CountExpr); ok {
+					values[i] = 1
+				}
+			}
+		} else if q.Distinct {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+
+		r := &outRow{values: values}
+		for _, order := range q.OrderBy {
+			r.keys = append(r.keys, orderValue(q, order.Expr, values, row))
+		}
+		if aggregate {
+			groups[key] = r
+		}
+		out = append(out, r)
+	}
+
+	if len(q.OrderBy) > 0 {
+		if aggregate {
+			for _, r := range out {
+				for i, order := range q.OrderBy {
+					r.keys[i] = orderValue(q, order.Expr, r.values, nil)
+				}
+			}
+		}
+		sort.SliceStable(out, func(a, b int) bool {
+			for i, order := range q.OrderBy {
+				c := compareValues(out[a].keys[i], out[b].keys[i])
+				if c == 0 {
+					continue
+				}
+				if order.Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	for _, r := range out {
+		if q.Limit != NoLimit && len(result.Rows) >= q.Limit {
+			break
+		}
+		result.Rows = append(result.Rows, r.values)
+	}
+	return result, nil
+}
+
+func orderValue(q *Query, expr Expr, values []interface{}, row map[string]interface{}) interface{} {
+	name := exprName(expr)
+	for i, item := range q.Return {
+		if item.Alias == name || exprName(item.Expr) == name {
+			return values[i]
+		}
+	}
+	if row == nil {
+		return nil
+	}
+	return evalExpr(expr, row)
+}
+
+func rowKey(values []interface{}) string {
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+func (s *Store) planQuery(q *Query) ([]*planStep, error) {
+	nodes := make(map[string]*NodePattern)
+	var order []string
+	var rels []relBinding
+	relVars := make(map[string]bool)
+
+	for _, path := range q.Patterns {
+		for _, n := range path.Nodes {
+			if existing, ok := nodes[n.Var]; ok {
+				if n.Type != "" && existing.Type != "" && n.Type != existing.Type {
+					return nil, fmt.Errorf("variable %s used with conflicting types %s and %s", n.Var, existing.Type, n.Type)
+				}
+				if existing.Type == "" {
+					existing.Type = n.Type
+				}
+				for k, v := range n.Props {
+					if existing.Props == nil {
+						existing.Props = make(map[string]interface{})
+					}
+					existing.Props[k] = v
+				}
+				continue
+			}
+			copied := *n
+			nodes[n.Var] = &copied
+			order = append(order, n.Var)
+		}
+		for i, r := range path.Rels {
+			if relVars[r.Var] {
+				return nil, fmt.Errorf("relationship variable %s used more than once", r.Var)
+			}
+			if _, ok := nodes[r.Var]; ok {
+				return nil, fmt.Errorf("variable %s used for both a node and a relationship", r.Var)
+			}
+			relVars[r.Var] = true
+			rels = append(rels, relBinding{rel: r, left: path.Nodes[i].Var, right: path.Nodes[i+1].Var})
+		}
+	}
+
+	known := func(v string) bool {
+		_, isNode := nodes[v]
+		return isNode || relVars[v]
+	}
+	for _, item := range q.Return {
+		vars := make(map[string]bool)
+		item.Expr.vars(vars)
+		for v := range vars {
+			if !known(v) {
+				return nil, fmt.Errorf("unknown variable %s in RETURN", v)
+			}
+		}
+	}
+
+	var conjuncts []Expr
+	if q.Where != nil {
+		conjuncts = splitConjuncts(q.Where)
+	}
+	for _, c := range conjuncts {
+		vars := make(map[string]bool)
+		c.vars(vars)
+		for v := range vars {
+			if !known(v) {
+				return nil, fmt.Errorf("unknown variable %s in WHERE", v)
+			}
+		}
+	}
+
+	counts := s.TypeCounts()
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+
+	bound := make(map[string]bool)
+	boundNodes := 0
+	relDone := make([]bool, len(rels))
+	var steps []*planStep
+
+	for boundNodes < len(nodes) {
+		var step *planStep
+		for i, rb := range rels {
+			if relDone[i] {
+				continue
+			}
+			switch {
+			case bound[rb.left] && !bound[rb.right]:
+				step = &planStep{kind: stepExpand, rel: rb.rel, from: rb.left, to: rb.right, dir: rb.rel.Dir, node: nodes[rb.right]}
+			case bound[rb.right] && !bound[rb.left]:
+				step = &planStep{kind: stepExpand, rel: rb.rel, from: rb.right, to: rb.left, dir: reverseDir(rb.rel.Dir), node: nodes[rb.left]}
+			default:
+				continue
+			}
+			relDone[i] = true
+			break
+		}
+
+		if step == nil {
+			bestCost := -1
+			for _, v := range order {
+				if bound[v] {
+					continue
+				}
+				mode, cost := s.scanCost(nodes[v], counts, total)
+				if bestCost < 0 || cost < bestCost {
+					bestCost = cost
+					step = &planStep{kind: stepScan, node: nodes[v], to: v, mode: mode}
+				}
+			}
+		}
+
+		steps = append(steps, step)
+		bound[step.to] = true
+		boundNodes++
+		if step.rel != nil {
+			bound[step.rel.Var] = true
+		}
+
+		for i, rb := range rels {
+			if !relDone[i] && bound[rb.left] && bound[rb.right] {
+				relDone[i] = true
+				steps = append(steps, &planStep{kind: stepCheck, rel: rb.rel, from: rb.left, to: rb.right, dir: rb.rel.Dir})
+				bound[rb.rel.Var] = true
+			}
+		}
+	}
+
+	pending := conjuncts
+	boundSoFar := make(map[string]bool)
+	for _, step := range steps {
+		boundSoFar[step.to] = true
+		if step.rel != nil {
+			boundSoFar[step.rel.Var] = true
+		}
+		var remaining []Expr
+		for _, c := range pending {
+			vars := make(map[string]bool)
+			c.vars(vars)
+			ready := true
+			for v := range vars {
+				if !boundSoFar[v] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				step.filters = append(step.filters, c)
+			} else {
+				remaining = append(remaining, c)
+			}
+		}
+		pending = remaining
+	}
+	if len(steps) > 0 {
+		last := steps[len(steps)-1]
+		last.filters = append(last.filters, pending...)
+	}
+
+	return steps, nil
+}
+
+func (s *Store) scanCost(n *NodePattern, counts map[string]int, total int) (scanMode, int) {
+	if _, ok := n.Props["id"].(string); ok {
+		return scanByID, 1
+	}
+
+	mode, cost := scanAll, total
+	if n.Type != "" {
+		mode, cost = scanByType, counts[n.Type]
+	}
+	if label, ok := labelConstraint(n); ok {
+		if labelCost := s.countIndexEntries(labelIndexPrefix+label+keySep, cost); labelCost < cost {
+			mode, cost = scanByLabel, labelCost
+		}
+	}
+	return mode, cost
+}
+
+// countIndexEntries counts keys under prefix, stopping once max is reached.
+func (s *Store) countIndexEntries(prefix string, max int) int {
+	n := 0
+	s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+		defer it.Close()
+		p := []byte(prefix)
+		for it.Seek(p); it.ValidForPrefix(p) && n < max; it.Next() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+func labelConstraint(n *NodePattern) (string, bool) {
+	for _, key := range []string{"label", "name"} {
+		if v, ok := n.Props[key].(string); ok && v != "" {
+			return strings.ToLower(v), true
+		}
+	}
+	return "", false
+}
+
+func reverseDir(d RelDirection) RelDirection {
+	switch d {
+	case DirOut:
+		return DirIn
+	case DirIn:
+		return DirOut
+	}
+	return DirBoth
+}
+
+func splitConjuncts(e Expr) []Expr {
+	if b, ok := e.(*BinaryExpr); ok && b.Op == "AND" {
+		return append(splitConjuncts(b.Left), splitConjuncts(b.Right)...)
+	}
+	return []Expr{e}
+}
+
+func (st *planStep) String() string {
+	var desc string
+	switch st.kind {
+	case stepScan:
+		modes := map[scanMode]string{scanByID: "id lookup", scanByLabel: "label index", scanByType: "type index", scanAll: "full scan"}
+		desc = fmt.Sprintf("scan %s (%s)", st.to, modes[st.mode])
+		if st.node.Type != "" {
+			desc = fmt.Sprintf("scan %s:%s (%s)", st.to, st.node.Type, modes[st.mode])
+		}
+	case stepExpand:
+		desc = fmt.Sprintf("expand %s %s %s via %s", st.from, dirArrow(st.dir), st.to, relTypesString(st.rel))
+	case stepCheck:
+		desc = fmt.Sprintf("check %s %s %s via %s", st.from, dirArrow(st.dir), st.to, relTypesString(st.rel))
+	}
+	if len(st.filters) > 0 {
+		desc += fmt.Sprintf(" + %d filter(s)", len(st.filters))
+	}
+	return desc
+}
+
+func dirArrow(d RelDirection) string {
+	switch d {
+	case DirOut:
+		return "->"
+	case DirIn:
+		return "<-"
+	}
+	return "--"
+}
+
+func relTypesString(r *RelPattern) string {
+	if len(r.Types) == 0 {
+		return "any"
+	}
+	return strings.Join(r.Types, "|")
+}
+
+type queryExec struct {
+	txn   *badger.Txn
+	steps []*planStep
+	row   map[string]interface{}
+	used  map[string]bool
+}
+
+type emitFunc func(row map[string]interface{}) (stop bool, err error)
+
+func (ex *queryExec) run(i int, emit emitFunc) error {
+	_, err := ex.step(i, emit)
+	return err
+}
+
+func (ex *queryExec) step(i int, emit emitFunc) (bool, error) {
+	if i == len(ex.steps) {
+		return emit(ex.row)
+	}
+	st := ex.steps[i]
+
+	switch st.kind {
+	case stepScan:
+		ids, err := ex.scanCandidates(st)
+		if err != nil {
+			return false, err
+		}
+		for _, id := range ids {
+			node, err := getNodeTxn(ex.txn, id)
+			if err != nil || !nodeMatchesPattern(node, st.node) {
+				continue
+			}
+			stop, err := ex.bind(i, st, st.to, node, "", nil, emit)
+			if stop || err != nil {
+				return stop, err
+			}
+		}
+
+	case stepExpand:
+		from := ex.row[st.from].(*Node)
+		edges, err := adjacentEdges(ex.txn, from.ID, st.dir)
+		if err != nil {
+			return false, err
+		}
+		for _, edge := range edges {
+			key := edgeKey(edge)
+			if ex.used[key] || !edgeMatchesPattern(edge, st.rel) {
+				continue
+			}
+			otherID := edge.To
+			if edge.From != from.ID {
+				otherID = edge.From
+			}
+			node, err := getNodeTxn(ex.txn, otherID)
+			if err != nil || !nodeMatchesPattern(node, st.node) {
+				continue
+			}
+			stop, err := ex.bind(i, st, st.to, node, key, edge, emit)
+			if stop || err != nil {
+				return stop, err
+			}
+		}
+
+	case stepCheck:
+		from := ex.row[st.from].(*Node)
+		to := ex.row[st.to].(*Node)
+		edges, err := adjacentEdges(ex.txn, from.ID, st.dir)
+		if err != nil {
+			return false, err
+		}
+		for _, edge := range edges {
+			key := edgeKey(edge)
+			if ex.used[key] || !edgeMatchesPattern(edge, st.rel) {
+				continue
+			}
+			if !edgeConnects(edge, from.ID, to.ID, st.dir) {
+				continue
+			}
+			ex.row[st.rel.Var] = edge
+			ex.used[key] = true
+			stop, err := ex.afterBind(i, st, emit)
+			delete(ex.used, key)
+			delete(ex.row, st.rel.Var)
+			if stop || err != nil {
+				return stop, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func (ex *queryExec) bind(i int, st *planStep, v string, node *Node, key string, edge *Edge, emit emitFunc) (bool, error) {
+	ex.row[v] = node
+	if edge != nil {
+		ex.row[st.rel.Var] = edge
+		ex.used[key] = true
+	}
+	stop, err := ex.afterBind(i, st, emit)
+	if edge != nil {
+		delete(ex.used, key)
+		delete(ex.row, st.rel.Var)
+	}
+	delete(ex.row, v)
+	return stop, err
+}
+
+func (ex *queryExec) afterBind(i int, st *planStep, emit emitFunc) (bool, error) {
+	for _, f := range st.filters {
+		if !truthy(evalExpr(f, ex.row)) {
+			return false, nil
+		}
+	}
+	return ex.step(i+1, emit)
+}
+
+func (ex *queryExec) scanCandidates(st *planStep) ([]string, error) {
+	switch st.mode {
+	case scanByID:
+		return []string{st.node.Props["id"].(string)}, nil
+	case scanByLabel:
+		label, _ := labelConstraint(st.node)
+		return collectIndexIDs(ex.txn, labelIndexPrefix+label+keySep, 0), nil
+	case scanByType:
+		return collectIndexIDs(ex.txn, typeIndexPrefix+st.node.Type+keySep, 0), nil
+	}
+	var ids []string
+	it := ex.txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+	defer it.Close()
+	prefix := []byte("node:")
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		ids = append(ids, strings.TrimPrefix(string(it.Item().Key()), "node:"))
+	}
+	return ids, nil
+}
+
+// collectIndexIDs returns the node IDs under an index prefix, at most
+// limit of them if limit is positive.
+func collectIndexIDs(txn *badger.Txn, prefix string, limit int) []string {
+	var ids []string
+	it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+	defer it.Close()
+	p := []byte(prefix)
+	for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+		ids = append(ids, idFromIndexKey(it.Item().Key()))
+		if limit > 0 && len(ids) >= limit {
+			break
+		}
+	}
+	return ids
+}
+
+func edgeKey(edge *Edge) string {
+	return fmt.Sprintf("edge:%s:%s:%s", edge.From, edge.Type, edge.To)
+}
+
+func edgeConnects(edge *Edge, from, to string, dir RelDirection) bool {
+	switch dir {
+	case DirOut:
+		return edge.From == from && edge.To == to
+	case DirIn:
+		return edge.From == to && edge.To == from
+	}
+	return (edge.From == from && edge.To == to) || (edge.From == to && edge.To == from)
+}
+
+// adjacentEdges reads a node's edges from the out: and in: adjacency lists.
+func adjacentEdges(txn *badger.Txn, nodeID string, dir RelDirection) ([]*Edge, error) {
+	var lists []string
+	switch dir {
+	case DirOut:
+		lists = []string{"out:"}
+	case DirIn:
+		lists = []string{"in:"}
+	default:
+		lists = []string{"out:", "in:"}
+	}
+
+	seen := make(map[string]bool)
+	var edges []*Edge
+	for _, list := range lists {
+		item, err := txn.Get([]byte(list + nodeID))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range splitKeys(val) {
+			if seen[string(key)] {
+				continue
+			}
+			seen[string(key)] = true
+			edgeItem, err := txn.Get(key)
+			if err != nil {
+				continue
+			}
+			var edge Edge
+			if err := edgeItem.Value(func(v []byte) error {
+				return json.Unmarshal(v, &edge)
+			}); err != nil {
+				continue
+			}
+			edges = append(edges, &edge)
+		}
+	}
+	return edges, nil
+}
+
+func nodeMatchesPattern(node *Node, p *NodePattern) bool {
+	if p.Type != "" && node.Type != p.Type {
+		return false
+	}
+	for k, v := range p.Props {
+		if compareValues(nodeProperty(node, k), v) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func edgeMatchesPattern(edge *Edge, p *RelPattern) bool {
+	if len(p.Types) > 0 {
+		match := false
+		for _, t := range p.Types {
+			if edge.Type == t {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	for k, v := range p.Props {
+		if compareValues(edgeProperty(edge, k), v) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func nodeProperty(node *Node, key string) interface{} {
+	switch key {
+	case "id":
+		return node.ID
+	case "type":
+		return node.Type
+	case "label":
+		return node.Label
+	case "blob_ref":
+		return node.BlobRef
+	case "created_at":
+		return node.CreateAt
+	case "source":
+		return node.Source
+	}
+	return node.Props[key]
+}
+
+func edgeProperty(edge *Edge, key string) interface{} {
+	switch key {
+	case "from":
+		return edge.From
+	case "to":
+		return edge.To
+	case "type":
+		return edge.Type
+	case "label":
+		return edge.Label
+	case "weight":
+		return edge.Weight
+	case "source":
+		return edge.Source
+	}
+	return edge.Props[key]
+}
+
+func evalExpr(e Expr, row map[string]interface{}) interface{} {
+	switch v := e.(type) {
+	case *LiteralExpr:
+		return v.Value
+	case *VarExpr:
+		return row[v.Name]
+	case *PropExpr:
+		switch bound := row[v.Var].(type) {
+		case *Node:
+			return nodeProperty(bound, v.Prop)
+		case *Edge:
+			return edgeProperty(bound, v.Prop)
+		}
+		return nil
+	case *ListExpr:
+		items := make([]interface{}, len(v.Items))
+		for i, item := range v.Items {
+			items[i] = evalExpr(item, row)
+		}
+		return items
+	case *NotExpr:
+		return !truthy(evalExpr(v.Expr, row))
+	case *BinaryExpr:
+		return evalBinary(v, row)
+	}
+	return nil
+}
+
+func evalBinary(b *BinaryExpr, row map[string]interface{}) interface{} {
+	switch b.Op {
+	case "AND":
+		return truthy(evalExpr(b.Left, row)) && truthy(evalExpr(b.Right, row))
+	case "OR":
+		return truthy(evalExpr(b.Left, row)) || truthy(evalExpr(b.Right, row))
+	}
+
+	left := evalExpr(b.Left, row)
+	right := evalExpr(b.Right, row)
+
+	switch b.Op {
+	case "=":
+		return compareValues(left, right) == 0
+	case "<>":
+		return compareValues(left, right) != 0
+	case "IN":
+		items, _ := right.([]interface{})
+		for _, item := range items {
+			if compareValues(left, item) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	if left == nil || right == nil {
+		return false
+	}
+
+	switch b.Op {
+	case "<":
+		return orderable(left, right) && compareValues(left, right) < 0
+	case "<=":
+		return orderable(left, right) && compareValues(left, right) <= 0
+	case ">":
+		return orderable(left, right) && compareValues(left, right) > 0
+	case ">=":
+		return orderable(left, right) && compareValues(left, right) >= 0
+	}
+
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if !lok || !rok {
+		return false
+	}
+	switch b.Op {
+	case "CONTAINS":
+		return strings.Contains(ls, rs)
+	case "STARTS WITH":
+		return strings.HasPrefix(ls, rs)
+	case "ENDS WITH":
+		return strings.HasSuffix(ls, rs)
+	}
+	return false
+}
+
+func truthy(v interface{}) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func orderable(a, b interface{}) bool {
+	_, af := toFloat(a)
+	_, bf := toFloat(b)
+	if af && bf {
+		return true
+	}
+	_, as := a.(string)
+	_, bs := b.(string)
+	return as && bs
+}
+
+// compareValues orders numbers before strings before everything else,
+// with nil sorting last.
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1
+		default:
+			return -1
+		}
+	}
+
+	af, aNum := toFloat(a)
+	bf, bNum := toFloat(b)
+	if aNum && bNum {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	if aNum {
+		return -1
+	}
+	if bNum {
+		return 1
+	}
+
+	as, aStr := a.(string)
+	bs, bStr := b.(string)
+	if aStr && bStr {
+		return strings.Compare(as, bs)
+	}
+	if aStr {
+		return -1
+	}
+	if bStr {
+		return 1
+	}
+
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			switch {
+			case ab == bb:
+				return 0
+			case !ab:
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(rowKey([]interface{}{a}), rowKey([]interface{}{b}))
+}
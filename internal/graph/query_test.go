@@ -0,0 +1,148 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func newQueryTestStore(t *testing.T) *Store {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	store.AddNode(&Node{ID: "doc:1", Type: "Document", Label: "old.md", Props: map[string]interface{}{"modified": 100}})
+	store.AddNode(&Node{ID: "doc:2", Type: "Document", Label: "new.md", Props: map[string]interface{}{"modified": 200}})
+	store.AddNode(&Node{ID: "chunk:1:0", Type: "Chunk", Label: "Chunk 0"})
+	store.AddNode(&Node{ID: "chunk:2:0", Type: "Chunk", Label: "Chunk 0"})
+	store.AddNode(&Node{ID: "entity:mindy", Type: "Entity", Label: "Mindy", Props: map[string]interface{}{"name": "Mindy"}})
+	store.AddNode(&Node{ID: "entity:badger", Type: "Entity", Label: "Badger", Props: map[string]interface{}{"name": "Badger"}})
+	store.AddNode(&Node{ID: "entity:chi", Type: "Entity", Label: "Chi", Props: map[string]interface{}{"name": "Chi"}})
+
+	store.AddEdge(&Edge{From: "doc:1", To: "chunk:1:0", Type: "HAS_CHUNK"})
+	store.AddEdge(&Edge{From: "doc:2", To: "chunk:2:0", Type: "HAS_CHUNK"})
+	store.AddEdge(&Edge{From: "chunk:1:0", To: "entity:mindy", Type: "HAS_ENTITY"})
+	store.AddEdge(&Edge{From: "chunk:1:0", To: "entity:chi", Type: "HAS_ENTITY"})
+	store.AddEdge(&Edge{From: "chunk:2:0", To: "entity:mindy", Type: "HAS_ENTITY"})
+	store.AddEdge(&Edge{From: "chunk:2:0", To: "entity:badger", Type: "HAS_ENTITY"})
+
+	return store
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(`MATCH (d:Document)-[:HAS_CHUNK]->(c)-[r:HAS_ENTITY]->(e:Entity {name: "Mindy"})
+		WHERE d.modified >= -5 AND NOT e.label STARTS WITH 'The' RETURN DISTINCT d.label AS name, e ORDER BY name DESC LIMIT 5`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if len(q.Patterns) != 1 || len(q.Patterns[0].Nodes) != 3 || len(q.Patterns[0].Rels) != 2 {
+		t.Fatalf("unexpected pattern shape: %+v", q.Patterns)
+	}
+	if q.Patterns[0].Rels[1].Var != "r" || q.Patterns[0].Rels[1].Dir != DirOut {
+		t.Errorf("unexpected relationship: %+v", q.Patterns[0].Rels[1])
+	}
+	if !q.Distinct || q.Limit != 5 || len(q.OrderBy) != 1 || !q.OrderBy[0].Desc {
+		t.Errorf("unexpected clauses: %+v", q)
+	}
+	if q.Return[0].Alias != "name" {
+		t.Errorf("alias = %q, want name", q.Return[0].Alias)
+	}
+
+	bad := []string{
+		"RETURN n",
+		"MATCH (n RETURN n",
+		"MATCH (a)<-[:X]->(b) RETURN a",
+		"MATCH (a)-[:X*1..3]->(b) RETURN a",
+		`MATCH (n) WHERE n.name = "open RETURN n`,
+	}
+	for _, input := range bad {
+		if _, err := ParseQuery(input); err == nil {
+			t.Errorf("ParseQuery(%q) expected error", input)
+		}
+	}
+}
+
+func TestStore_QueryCoMentions(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	store := newQueryTestStore(t)
+	defer store.Close()
+
+	result, err := store.RunQuery(`MATCH (d:Document)-[:HAS_CHUNK]->(c:Chunk)-[:HAS_ENTITY]->(x:Entity {name: "Mindy"}),
+		(c)-[:HAS_ENTITY]->(other:Entity)
+		WHERE d.modified > 150
+		RETURN other.name AS name, d.label`)
+	if err != nil {
+		t.Fatalf("RunQuery() error = %v", err)
+	}
+
+	if len(result.Rows) != 1 {
+		t.Fatalf("got %d rows, want 1: %v", len(result.Rows), result.Rows)
+	}
+	if result.Rows[0][0] != "Badger" || result.Rows[0][1] != "new.md" {
+		t.Errorf("unexpected row: %v", result.Rows[0])
+	}
+	if result.Columns[0] != "name" || result.Columns[1] != "d.label" {
+		t.Errorf("unexpected columns: %v", result.Columns)
+	}
+	if !strings.Contains(result.Plan[0], "x:Entity") {
+		t.Errorf("planner should start from the selective entity pattern: %v", result.Plan)
+	}
+}
+
+func TestStore_QueryAggregateAndOrder(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	store := newQueryTestStore(t)
+	defer store.Close()
+
+	result, err := store.RunQuery(`MATCH (c:Chunk)-[:HAS_ENTITY]->(e:Entity)
+		RETURN e.name AS name, count(*) AS mentions ORDER BY mentions DESC, name LIMIT 2`)
+	if err != nil {
+		t.Fatalf("RunQuery() error = %v", err)
+	}
+	if len(result.Rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(result.Rows))
+	}
+	if result.Rows[0][0] != "Mindy" || result.Rows[0][1] != 2 {
+		t.Errorf("first row = %v, want [Mindy 2]", result.Rows[0])
+	}
+	if result.Rows[1][0] != "Badger" {
+		t.Errorf("second row = %v, want Badger", result.Rows[1])
+	}
+
+	result, err = store.RunQuery(`MATCH (e:Entity)<-[:HAS_ENTITY]-(c)
+		WHERE e.name IN ["Chi", "Badger"] RETURN DISTINCT e.name ORDER BY e.name`)
+	if err != nil {
+		t.Fatalf("RunQuery() error = %v", err)
+	}
+	if len(result.Rows) != 2 || result.Rows[0][0] != "Badger" || result.Rows[1][0] != "Chi" {
+		t.Errorf("unexpected rows: %v", result.Rows)
+	}
+
+	// LIMIT 0 returns no rows, streamed or sorted; no LIMIT returns all.
+	for _, query := range []string{
+		`MATCH (e:Entity) RETURN e.name LIMIT 0`,
+		`MATCH (e:Entity) RETURN e.name ORDER BY e.name LIMIT 0`,
+	} {
+		result, err = store.RunQuery(query)
+		if err != nil || len(result.Rows) != 0 {
+			t.Errorf("%s: rows = %v, %v", query, result, err)
+		}
+	}
+	if q, _ := ParseQuery(`MATCH (e:Entity) RETURN e`); q.Limit != NoLimit {
+		t.Errorf("Limit without LIMIT = %d, want NoLimit", q.Limit)
+	}
+	result, err = store.RunQuery(`MATCH (e:Entity) RETURN e.name`)
+	if err != nil || len(result.Rows) < 3 {
+		t.Errorf("unlimited rows = %v, %v", result, err)
+	}
+
+	if _, err := store.RunQuery(`MATCH (e:Entity) RETURN z`); err == nil {
+		t.Error("expected error for unknown variable")
+	}
+}
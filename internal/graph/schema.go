@@ -0,0 +1,479 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Node and edge types written by the indexer.
+const (
+	NodeDocument = "Document"
+	NodeChunk    = "Chunk"
+	NodeEntity   = "Entity"
+	NodeSymbol   = "Symbol"
+
+	EdgeHasChunk  = "HAS_CHUNK"
+	EdgeHasEntity = "HAS_ENTITY"
+	EdgeCoOccurs  = "CO_OCCURS"
+	EdgeLinksTo   = "LINKS_TO"
+	EdgeContains  = "CONTAINS"
+	EdgeSentBy    = "SENT_BY"
+	EdgeSentTo    = "SENT_TO"
+	EdgeReplyTo   = "REPLY_TO"
+	EdgeInThread  = "IN_THREAD"
+	EdgeDefines   = "DEFINES"
+	EdgeImports   = "IMPORTS"
+	EdgeCalls     = "CALLS"
+)
+
+type PropType string
+
+const (
+	PropString     PropType = "string"
+	PropInt        PropType = "int"
+	PropFloat      PropType = "float"
+	PropBool       PropType = "bool"
+	PropStringList PropType = "string[]"
+	PropAny        PropType = "any"
+)
+
+type PropertySpec struct {
+	Name        string   `json:"name"`
+	Type        PropType `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// NodeTypeSpec declares a node type. Open types accept props that are not
+// declared; closed types reject them.
+type NodeTypeSpec struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Properties  []PropertySpec `json:"properties,omitempty"`
+	Open        bool           `json:"open,omitempty"`
+	Derived     bool           `json:"derived,omitempty"`
+}
+
+// EdgeTypeSpec declares an edge type. Empty From or To allow any node type
+// at that end.
+type EdgeTypeSpec struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	From        []string       `json:"from,omitempty"`
+	To          []string       `json:"to,omitempty"`
+	Properties  []PropertySpec `json:"properties,omitempty"`
+	Open        bool           `json:"open,omitempty"`
+	Derived     bool           `json:"derived,omitempty"`
+}
+
+type SchemaSnapshot struct {
+	NodeTypes   []NodeTypeSpec `json:"node_types"`
+	EdgeTypes   []EdgeTypeSpec `json:"edge_types"`
+	GlobalProps []PropertySpec `json:"global_props"`
+}
+
+const (
+	schemaNodePrefix = "schema:node:"
+	schemaEdgePrefix = "schema:edge:"
+)
+
+// globalProps may appear on any node regardless of its type.
+var globalProps = []PropertySpec{
+	{Name: "pagerank", Type: PropFloat, Description: "PageRank from graph analytics"},
+	{Name: "degree", Type: PropFloat, Description: "Undirected degree from graph analytics"},
+	{Name: "betweenness", Type: PropFloat, Description: "Betweenness centrality from graph analytics"},
+	{Name: "component", Type: PropInt, Description: "Connected component, 0 is the largest"},
+	{Name: "community", Type: PropInt, Description: "Louvain community, 0 is the largest"},
+}
+
+var builtinNodeTypes = []NodeTypeSpec{
+	{
+		Name:        NodeDocument,
+		Description: "An indexed file version, keyed by content hash",
+		Open:        true,
+		Derived:     true,
+		Properties: []PropertySpec{
+			{Name: "path", Type: PropString},
+			{Name: "size", Type: PropInt},
+			{Name: "modified", Type: PropInt},
+			{Name: "content_type", Type: PropString},
+			{Name: "file_type", Type: PropString},
+			{Name: "previous_version", Type: PropString, Description: "Document ID this version replaced"},
+		},
+	},
+	{
+		Name:        NodeChunk,
+		Description: "A text chunk of a document",
+		Open:        true,
+		Derived:     true,
+		Properties: []PropertySpec{
+			{Name: "text", Type: PropString},
+			{Name: "index", Type: PropInt},
+			{Name: "doc_id", Type: PropString},
+			{Name: "breadcrumb", Type: PropStringList, Description: "Headings of the section the chunk is from, outermost first"},
+		},
+	},
+	{
+		Name:        NodeEntity,
+		Description: "A named entity extracted from chunks",
+		Open:        true,
+		Derived:     true,
+		Properties: []PropertySpec{
+			{Name: "name", Type: PropString},
+			{Name: "aliases", Type: PropStringList, Description: "Labels of merged duplicates"},
+		},
+	},
+	{
+		Name:        NodeSymbol,
+		Description: "A declaration in a source file, or a package it imports",
+		Open:        true,
+		Derived:     true,
+		Properties: []PropertySpec{
+			{Name: "kind", Type: PropString, Description: "function, method, type, class, const, package..."},
+			{Name: "language", Type: PropString},
+			{Name: "package", Type: PropString, Description: "Package or module the symbol is declared in"},
+			{Name: "signature", Type: PropString},
+			{Name: "doc", Type: PropString, Description: "Doc comment"},
+			{Name: "calls", Type: PropStringList, Description: "Callees as written in the body"},
+			{Name: "line", Type: PropInt},
+			{Name: "end_line", Type: PropInt},
+			{Name: "doc_id", Type: PropString},
+		},
+	},
+}
+
+var builtinEdgeTypes = []EdgeTypeSpec{
+	{Name: EdgeHasChunk, Description: "Document contains chunk", From: []string{NodeDocument}, To: []string{NodeChunk}, Open: true, Derived: true},
+	{Name: EdgeHasEntity, Description: "Chunk mentions entity", From: []string{NodeChunk}, To: []string{NodeEntity}, Open: true, Derived: true},
+	{Name: EdgeCoOccurs, Description: "Entities share a chunk; weight counts shared chunks", From: []string{NodeEntity}, To: []string{NodeEntity}, Open: true, Derived: true},
+	{Name: EdgeLinksTo, Description: "Hyperlink from a document to a URL or email entity or another document; label is the anchor text", Open: true, Derived: true},
+	{Name: EdgeContains, Description: "Container document holds a part, such as a mailbox message; label is the part name", From: []string{NodeDocument}, To: []string{NodeDocument}, Open: true, Derived: true},
+	{Name: EdgeSentBy, Description: "Email message was sent by the address entity; label is the display name", From: []string{NodeDocument}, To: []string{NodeEntity}, Open: true, Derived: true},
+	{Name: EdgeSentTo, Description: "Email message was addressed to the address entity; label is to, cc or bcc", From: []string{NodeDocument}, To: []string{NodeEntity}, Open: true, Derived: true},
+	{Name: EdgeReplyTo, Description: "Email message answers another", From: []string{NodeDocument}, To: []string{NodeDocument}, Open: true, Derived: true},
+	{Name: EdgeInThread, Description: "Email message belongs to the thread entity", From: []string{NodeDocument}, To: []string{NodeEntity}, Open: true, Derived: true},
+	{Name: EdgeDefines, Description: "Source file declares the symbol", From: []string{NodeDocument}, To: []string{NodeSymbol}, Open: true, Derived: true},
+	{Name: EdgeImports, Description: "Source file imports the package symbol; label is the local name, if renamed", From: []string{NodeDocument}, To: []string{NodeSymbol}, Open: true, Derived: true},
+	{Name: EdgeCalls, Description: "Function or method calls another", From: []string{NodeSymbol}, To: []string{NodeSymbol}, Open: true, Derived: true},
+}
+
+// Schema is the registry of declared node and edge types: the built-in
+// derived types plus user types stored under schema:node: and schema:edge:.
+// Writes of declared types are validated against it; undeclared types are
+// accepted by the low-level store methods but not by the user API.
+type Schema struct {
+	mu    sync.RWMutex
+	nodes map[string]NodeTypeSpec
+	edges map[string]EdgeTypeSpec
+}
+
+func newSchema() *Schema {
+	sc := &Schema{
+		nodes: make(map[string]NodeTypeSpec),
+		edges: make(map[string]EdgeTypeSpec),
+	}
+	for _, spec := range builtinNodeTypes {
+		sc.nodes[spec.Name] = spec
+	}
+	for _, spec := range builtinEdgeTypes {
+		sc.edges[spec.Name] = spec
+	}
+	return sc
+}
+
+func (s *Store) loadSchema() error {
+	s.schema = newSchema()
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for _, prefix := range []string{schemaNodePrefix, schemaEdgePrefix} {
+			p := []byte(prefix)
+			for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+				err := it.Item().Value(func(val []byte) error {
+					if prefix == schemaNodePrefix {
+						var spec NodeTypeSpec
+						if err := json.Unmarshal(val, &spec); err != nil {
+							return err
+						}
+						s.schema.nodes[spec.Name] = spec
+						return nil
+					}
+					var spec EdgeTypeSpec
+					if err := json.Unmarshal(val, &spec); err != nil {
+						return err
+					}
+					s.schema.edges[spec.Name] = spec
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Schema returns the declared node and edge types, sorted by name.
+func (s *Store) Schema() *SchemaSnapshot {
+	s.schema.mu.RLock()
+	defer s.schema.mu.RUnlock()
+
+	snap := &SchemaSnapshot{GlobalProps: globalProps}
+	for _, spec := range s.schema.nodes {
+		snap.NodeTypes = append(snap.NodeTypes, spec)
+	}
+	for _, spec := range s.schema.edges {
+		snap.EdgeTypes = append(snap.EdgeTypes, spec)
+	}
+	sort.Slice(snap.NodeTypes, func(a, b int) bool { return snap.NodeTypes[a].Name < snap.NodeTypes[b].Name })
+	sort.Slice(snap.EdgeTypes, func(a, b int) bool { return snap.EdgeTypes[a].Name < snap.EdgeTypes[b].Name })
+	return snap
+}
+
+func (s *Store) NodeType(name string) (NodeTypeSpec, bool) {
+	s.schema.mu.RLock()
+	defer s.schema.mu.RUnlock()
+	spec, ok := s.schema.nodes[name]
+	return spec, ok
+}
+
+func (s *Store) EdgeType(name string) (EdgeTypeSpec, bool) {
+	s.schema.mu.RLock()
+	defer s.schema.mu.RUnlock()
+	spec, ok := s.schema.edges[name]
+	return spec, ok
+}
+
+// DefineNodeType declares or replaces a user node type. Built-in types
+// cannot be redefined.
+func (s *Store) DefineNodeType(spec NodeTypeSpec) error {
+	if !nodeTypePattern.MatchString(spec.Name) {
+		return invalidf("node type %q must be PascalCase letters, digits or _", spec.Name)
+	}
+	if existing, ok := s.NodeType(spec.Name); ok && existing.Derived {
+		return fmt.Errorf("node type %s is %w", spec.Name, ErrDerived)
+	}
+	if err := validatePropertySpecs(spec.Properties); err != nil {
+		return err
+	}
+	spec.Derived = false
+	return s.saveSchemaEntry(schemaNodePrefix+spec.Name, &spec, func() {
+		s.schema.nodes[spec.Name] = spec
+	})
+}
+
+// DefineEdgeType declares or replaces a user edge type. Endpoint types
+// must already be declared.
+func (s *Store) DefineEdgeType(spec EdgeTypeSpec) error {
+	if !edgeTypePattern.MatchString(spec.Name) {
+		return invalidf("edge type %q must be UPPER_SNAKE_CASE", spec.Name)
+	}
+	if existing, ok := s.EdgeType(spec.Name); ok && existing.Derived {
+		return fmt.Errorf("edge type %s is %w", spec.Name, ErrDerived)
+	}
+	for _, t := range append(append([]string{}, spec.From...), spec.To...) {
+		if _, ok := s.NodeType(t); !ok {
+			return invalidf("endpoint type %q is not declared", t)
+		}
+	}
+	if err := validatePropertySpecs(spec.Properties); err != nil {
+		return err
+	}
+	spec.Derived = false
+	return s.saveSchemaEntry(schemaEdgePrefix+spec.Name, &spec, func() {
+		s.schema.edges[spec.Name] = spec
+	})
+}
+
+// DeleteNodeType removes a user node type that no node uses any more.
+func (s *Store) DeleteNodeType(name string) error {
+	spec, ok := s.NodeType(name)
+	if !ok {
+		return fmt.Errorf("node type %s: %w", name, ErrNodeNotFound)
+	}
+	if spec.Derived {
+		return fmt.Errorf("node type %s is %w", name, ErrDerived)
+	}
+	if n := s.CountNodes(name); n > 0 {
+		return invalidf("node type %s is still used by %d nodes", name, n)
+	}
+	return s.deleteSchemaEntry(schemaNodePrefix+name, func() {
+		delete(s.schema.nodes, name)
+	})
+}
+
+// DeleteEdgeType removes a user edge type. Existing edges of the type are
+// kept but no longer validated.
+func (s *Store) DeleteEdgeType(name string) error {
+	spec, ok := s.EdgeType(name)
+	if !ok {
+		return fmt.Errorf("edge type %s: %w", name, ErrEdgeNotFound)
+	}
+	if spec.Derived {
+		return fmt.Errorf("edge type %s is %w", name, ErrDerived)
+	}
+	return s.deleteSchemaEntry(schemaEdgePrefix+name, func() {
+		delete(s.schema.edges, name)
+	})
+}
+
+func (s *Store) saveSchemaEntry(key string, spec interface{}, apply func()) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	s.schema.mu.Lock()
+	defer s.schema.mu.Unlock()
+	if err := s.update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), data)
+	}); err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+func (s *Store) deleteSchemaEntry(key string, apply func()) error {
+	s.schema.mu.Lock()
+	defer s.schema.mu.Unlock()
+	if err := s.update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	}); err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+func validatePropertySpecs(props []PropertySpec) error {
+	seen := make(map[string]bool)
+	for _, p := range props {
+		if p.Name == "" {
+			return invalidf("property names must not be empty")
+		}
+		if seen[p.Name] {
+			return invalidf("property %q declared twice", p.Name)
+		}
+		seen[p.Name] = true
+		switch p.Type {
+		case PropString, PropInt, PropFloat, PropBool, PropStringList, PropAny:
+		default:
+			return invalidf("property %q has unknown type %q", p.Name, p.Type)
+		}
+	}
+	return nil
+}
+
+// validateNode checks a node of a declared type against its spec.
+// Undeclared types pass.
+func (sc *Schema) validateNode(node *Node) error {
+	sc.mu.RLock()
+	spec, ok := sc.nodes[node.Type]
+	sc.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return validatePropValues(node.Type, spec.Properties, spec.Open, node.Props)
+}
+
+// validateEdge checks an edge of a declared type against its spec, given
+// the types of its endpoints. Undeclared types pass.
+func (sc *Schema) validateEdge(edge *Edge, fromType, toType string) error {
+	sc.mu.RLock()
+	spec, ok := sc.edges[edge.Type]
+	sc.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if len(spec.From) > 0 && !containsString(spec.From, fromType) {
+		return invalidf("%s edges cannot start at %s nodes", edge.Type, fromType)
+	}
+	if len(spec.To) > 0 && !containsString(spec.To, toType) {
+		return invalidf("%s edges cannot end at %s nodes", edge.Type, toType)
+	}
+	return validatePropValues(edge.Type, spec.Properties, spec.Open, edge.Props)
+}
+
+func validatePropValues(typeName string, specs []PropertySpec, open bool, props map[string]interface{}) error {
+	declared := make(map[string]PropType, len(specs))
+	for _, p := range specs {
+		declared[p.Name] = p.Type
+		if v, ok := props[p.Name]; p.Required && (!ok || v == nil) {
+			return invalidf("%s requires property %q", typeName, p.Name)
+		}
+	}
+	for _, p := range globalProps {
+		if _, ok := declared[p.Name]; !ok {
+			declared[p.Name] = p.Type
+		}
+	}
+	for k, v := range props {
+		t, ok := declared[k]
+		if !ok {
+			if !open {
+				return invalidf("%s does not declare property %q", typeName, k)
+			}
+			continue
+		}
+		if v != nil && !propMatches(t, v) {
+			return invalidf("property %q of %s must be %s", k, typeName, t)
+		}
+	}
+	return nil
+}
+
+func propMatches(t PropType, v interface{}) bool {
+	switch t {
+	case PropAny:
+		return true
+	case PropString:
+		_, ok := v.(string)
+		return ok
+	case PropBool:
+		_, ok := v.(bool)
+		return ok
+	case PropInt:
+		switch n := v.(type) {
+		case int, int32, int64, uint, uint32, uint64:
+			return true
+		case float64:
+			return n == math.Trunc(n)
+		case float32:
+			return float64(n) == math.Trunc(float64(n))
+		}
+		return false
+	case PropFloat:
+		_, ok := toFloat(v)
+		return ok
+	case PropStringList:
+		switch list := v.(type) {
+		case []string:
+			return true
+		case []interface{}:
+			for _, item := range list {
+				if _, ok := item.(string); !ok {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStore_Schema(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	if _, ok := store.NodeType(NodeDocument); !ok {
+		t.Fatal("built-in Document type should be declared")
+	}
+	if err := store.DefineNodeType(NodeTypeSpec{Name: NodeEntity}); !errors.Is(err, ErrDerived) {
+		t.Errorf("redefining Entity error = %v, want ErrDerived", err)
+	}
+	if err := store.DefineEdgeType(EdgeTypeSpec{Name: "OWNS", From: []string{"Person"}}); err == nil {
+		t.Error("edge type with undeclared endpoint should be rejected")
+	}
+
+	err = store.DefineNodeType(NodeTypeSpec{
+		Name: "Person",
+		Properties: []PropertySpec{
+			{Name: "email", Type: PropString, Required: true},
+			{Name: "age", Type: PropInt},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DefineNodeType() error = %v", err)
+	}
+	if err := store.DefineEdgeType(EdgeTypeSpec{Name: "AUTHORED", From: []string{"Person"}, To: []string{NodeDocument}}); err != nil {
+		t.Fatalf("DefineEdgeType() error = %v", err)
+	}
+
+	invalid := []map[string]interface{}{
+		{},
+		{"email": 42},
+		{"email": "a@b.c", "age": 1.5},
+		{"email": "a@b.c", "nickname": "al"},
+	}
+	for _, props := range invalid {
+		var verr *ValidationError
+		if _, err := store.CreateUserNode(&Node{Type: "Person", Label: "Al", Props: props}); !errors.As(err, &verr) {
+			t.Errorf("CreateUserNode(%v) error = %v, want ValidationError", props, err)
+		}
+	}
+	person, err := store.CreateUserNode(&Node{Type: "Person", Label: "Al", Props: map[string]interface{}{"email": "a@b.c", "age": float64(40)}})
+	if err != nil {
+		t.Fatalf("CreateUserNode() error = %v", err)
+	}
+
+	store.AddNode(&Node{ID: "doc:1", Type: NodeDocument, Label: "a.md"})
+	store.AddNode(&Node{ID: "chunk:1", Type: NodeChunk, Label: "Chunk 0"})
+	if _, err := store.CreateUserEdge(&Edge{From: person.ID, To: "chunk:1", Type: "AUTHORED"}); err == nil {
+		t.Error("AUTHORED must end at a Document")
+	}
+	if _, err := store.CreateUserEdge(&Edge{From: person.ID, To: "doc:1", Type: "AUTHORED"}); err != nil {
+		t.Errorf("CreateUserEdge() error = %v", err)
+	}
+	if err := store.AddEdge(&Edge{From: "chunk:1", To: "doc:1", Type: EdgeHasChunk}); err == nil {
+		t.Error("HAS_CHUNK must start at a Document")
+	}
+
+	if err := store.DeleteNodeType("Person"); err == nil {
+		t.Error("deleting a node type still in use should fail")
+	}
+
+	store.Close()
+	store, err = NewStore(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	spec, ok := store.NodeType("Person")
+	if !ok || len(spec.Properties) != 2 || !spec.Properties[0].Required {
+		t.Errorf("Person type not persisted: %+v", spec)
+	}
+	if _, ok := store.EdgeType("AUTHORED"); !ok {
+		t.Error("AUTHORED type not persisted")
+	}
+
+	snap := store.Schema()
+	if len(snap.NodeTypes) != 5 || len(snap.EdgeTypes) != 13 {
+		t.Errorf("Schema() = %d node types, %d edge types; want 5 and 13", len(snap.NodeTypes), len(snap.EdgeTypes))
+	}
+}
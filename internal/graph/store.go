@@ -2,12 +2,13 @@ package graph
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/dgraph-io/badger/v4"
+
+	"mindy/internal/crypt"
 )
 
 type Node struct {
@@ -17,6 +18,7 @@ type Node struct {
 	Props    map[string]interface{} `json:"props,omitempty"`
 	BlobRef  string                 `json:"blob_ref,omitempty"`
 	CreateAt int64                  `json:"created_at"`
+	Source   string                 `json:"source,omitempty"`
 }
 
 type Edge struct {
@@ -26,40 +28,88 @@ type Edge struct {
 	Label    string `json:"label,omitempty"`
 	Props    map[string]interface{} `json:"props,omitempty"`
 	Weight   float32 `json:"weight,omitempty"`
+	Source   string `json:"source,omitempty"`
 }
 
 type Store struct {
-	db *badger.DB
+	db     *badger.DB
+	schema *Schema
 }
 
+const maxTxnRetries = 10
+
 func NewStore(dataDir string) (*Store, error) {
 	baseDir := filepath.Join(dataDir, "graph")
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, err
 	}
 
-	opts := badger.DefaultOptions(baseDir)
-	opts.IndexCacheSize = 100 << 20
-
-	db, err := badger.Open(opts)
+	db, err := openDB(baseDir, crypt.ActiveKey())
 	if err != nil {
 		return nil, err
 	}
 
-	return &Store{db: db}, nil
+	store := &Store{db: db}
+	if err := store.ensureIndexes(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := store.ensureHistory(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := store.loadSchema(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
 }
 
+// update runs fn in a read-write transaction, retrying when it conflicts
+// with a concurrent writer touching the same index or adjacency keys.
+func (s *Store) update(fn func(txn *badger.Txn) error) error {
+	for attempt := 0; ; attempt++ {
+		err := s.db.Update(fn)
+		if errors.Is(err, badger.ErrConflict) && attempt < maxTxnRetries {
+			continue
+		}
+		return err
+	}
+}
+
+// AddNode creates or replaces a node. A replaced node keeps its original
+// CreateAt, and the previous state is kept as a closed version.
 func (s *Store) AddNode(node *Node) error {
-	return s.db.Update(func(txn *badger.Txn) error {
-		data, err := json.Marshal(node)
-		if err != nil {
+	if err := s.schema.validateNode(node); err != nil {
+		return err
+	}
+	return s.update(func(txn *badger.Txn) error {
+		old, err := getNodeTxn(txn, node.ID)
+		if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
 			return err
 		}
-		key := []byte("node:" + node.ID)
-		return txn.Set(key, data)
+		stored := *node
+		if old != nil && old.CreateAt != 0 {
+			stored.CreateAt = old.CreateAt
+		}
+		return putNodeTxn(txn, old, &stored)
 	})
 }
 
+func putNodeTxn(txn *badger.Txn, old, node *Node) error {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	if err := txn.Set([]byte("node:"+node.ID), data); err != nil {
+		return err
+	}
+	if err := updateNodeIndexes(txn, old, node); err != nil {
+		return err
+	}
+	return recordNodeVersion(txn, old, node)
+}
+
 func (s *Store) GetNode(id string) (*Node, error) {
 	var node Node
 	err := s.db.View(func(txn *badger.Txn) error {
@@ -78,54 +128,327 @@ func (s *Store) GetNode(id string) (*Node, error) {
 }
 
 func (s *Store) AddEdge(edge *Edge) error {
-	return s.db.Update(func(txn *badger.Txn) error {
-		data, err := json.Marshal(edge)
-		if err != nil {
-			return err
-		}
-		edgeKey := fmt.Sprintf("edge:%s:%s:%s", edge.From, edge.Type, edge.To)
-		if err := txn.Set([]byte(edgeKey), data); err != nil {
+	return s.update(func(txn *badger.Txn) error {
+		if err := s.validateEdgeTxn(txn, edge); err != nil {
 			return err
 		}
+		return addEdgeTxn(txn, edge)
+	})
+}
 
-		fromEdgesKey := []byte("out:" + edge.From)
-		var fromEdges []byte
-		item, err := txn.Get(fromEdgesKey)
-		if err == nil {
-			err = item.Value(func(val []byte) error {
-				fromEdges = make([]byte, len(val))
-				copy(fromEdges, val)
-				return nil
-			})
-			if err != nil && err.Error() != "Key not found" {
+// validateEdgeTxn checks an edge of a declared type against the schema,
+// which requires both endpoints to exist.
+func (s *Store) validateEdgeTxn(txn *badger.Txn, edge *Edge) error {
+	if _, ok := s.EdgeType(edge.Type); !ok {
+		return nil
+	}
+	from, err := getNodeTxn(txn, edge.From)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return invalidf("%s edge start %s does not exist", edge.Type, edge.From)
+	}
+	if err != nil {
+		return err
+	}
+	to, err := getNodeTxn(txn, edge.To)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return invalidf("%s edge end %s does not exist", edge.Type, edge.To)
+	}
+	if err != nil {
+		return err
+	}
+	return s.schema.validateEdge(edge, from.Type, to.Type)
+}
+
+// IncrementEdges adds each edge's Weight to the stored weight of the same
+// edge, creating missing edges. Edges whose weight drops to zero or below
+// are deleted. All updates happen in a single transaction.
+func (s *Store) IncrementEdges(edges []*Edge) error {
+	return s.update(func(txn *badger.Txn) error {
+		for _, delta := range edges {
+			edge := *delta
+			existing, err := getEdgeTxn(txn, edgeKey(&edge))
+			if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+			if existing != nil {
+				existing.Weight += delta.Weight
+				for k, v := range delta.Props {
+					if existing.Props == nil {
+						existing.Props = make(map[string]interface{})
+					}
+					existing.Props[k] = v
+				}
+				edge = *existing
+			} else if err := s.validateEdgeTxn(txn, &edge); err != nil {
+				return err
+			}
+			if edge.Weight <= 0 {
+				if existing != nil {
+					if err := deleteEdgeTxn(txn, &edge); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := addEdgeTxn(txn, &edge); err != nil {
 				return err
 			}
 		}
-		fromEdges = append(fromEdges, []byte(edgeKey+"\n")...)
-		if err := txn.Set(fromEdgesKey, fromEdges); err != nil {
+		return nil
+	})
+}
+
+func (s *Store) DeleteEdge(from, edgeType, to string) error {
+	return s.update(func(txn *badger.Txn) error {
+		return deleteEdgeTxn(txn, &Edge{From: from, Type: edgeType, To: to})
+	})
+}
+
+func (s *Store) GetEdge(from, edgeType, to string) (*Edge, error) {
+	var edge *Edge
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		edge, err = getEdgeTxn(txn, edgeKey(&Edge{From: from, Type: edgeType, To: to}))
+		return err
+	})
+	return edge, err
+}
+
+// GetEdges returns the outgoing, incoming or all edges of a node.
+func (s *Store) GetEdges(nodeID string, dir RelDirection) ([]*Edge, error) {
+	var edges []*Edge
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		edges, err = adjacentEdges(txn, nodeID, dir)
+		return err
+	})
+	return edges, err
+}
+
+// DeleteNode removes a node together with all of its edges.
+func (s *Store) DeleteNode(id string) error {
+	return s.update(func(txn *badger.Txn) error {
+		return deleteNodeTxn(txn, id)
+	})
+}
+
+func deleteNodeTxn(txn *badger.Txn, id string) error {
+	node, err := getNodeTxn(txn, id)
+	if err != nil {
+		return err
+	}
+	edges, err := adjacentEdges(txn, id, DirBoth)
+	if err != nil {
+		return err
+	}
+	for _, edge := range edges {
+		if err := deleteEdgeTxn(txn, edge); err != nil {
 			return err
 		}
+	}
+	if err := removeNodeIndexes(txn, node); err != nil {
+		return err
+	}
+	if err := closeNodeVersion(txn, id, timeNow().Unix()); err != nil {
+		return err
+	}
+	return txn.Delete([]byte("node:" + id))
+}
 
-		toEdgesKey := []byte("in:" + edge.To)
-		var toEdges []byte
-		item2, err := txn.Get(toEdgesKey)
-		if err == nil {
-			err = item2.Value(func(val []byte) error {
-				toEdges = make([]byte, len(val))
-				copy(toEdges, val)
-				return nil
-			})
-			if err != nil && err.Error() != "Key not found" {
+// MergeNodes folds duplicates into the canonical node. Their edges are
+// rewired onto the canonical node, summing weights where the rewired edge
+// already exists and dropping edges that would become self-loops. The
+// duplicates' labels are appended to the canonical node's "aliases" prop
+// and the duplicate nodes are deleted.
+func (s *Store) MergeNodes(canonicalID string, duplicateIDs []string) (*Node, error) {
+	var merged *Node
+	err := s.update(func(txn *badger.Txn) error {
+		canonical, err := getNodeTxn(txn, canonicalID)
+		if err != nil {
+			return err
+		}
+		old := *canonical
+		node := *canonical
+		node.Props = make(map[string]interface{}, len(canonical.Props)+1)
+		for k, v := range canonical.Props {
+			node.Props[k] = v
+		}
+		aliases := aliasList(node.Props["aliases"])
+
+		for _, dupID := range duplicateIDs {
+			if dupID == canonicalID {
+				continue
+			}
+			dup, err := getNodeTxn(txn, dupID)
+			if err != nil {
 				return err
 			}
+			edges, err := adjacentEdges(txn, dupID, DirBoth)
+			if err != nil {
+				return err
+			}
+			for _, edge := range edges {
+				rewired := *edge
+				if rewired.From == dupID {
+					rewired.From = canonicalID
+				}
+				if rewired.To == dupID {
+					rewired.To = canonicalID
+				}
+				if rewired.From == rewired.To {
+					continue
+				}
+				existing, err := getEdgeTxn(txn, edgeKey(&rewired))
+				if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+					return err
+				}
+				if existing != nil {
+					existing.Weight += rewired.Weight
+					rewired = *existing
+				}
+				if err := addEdgeTxn(txn, &rewired); err != nil {
+					return err
+				}
+			}
+			if err := deleteNodeTxn(txn, dupID); err != nil {
+				return err
+			}
+			aliases = appendAlias(aliases, dup.Label)
+			for _, a := range aliasList(dup.Props["aliases"]) {
+				aliases = appendAlias(aliases, a)
+			}
+		}
+
+		if len(aliases) > 0 {
+			node.Props["aliases"] = aliases
 		}
-		toEdges = append(toEdges, []byte(edgeKey+"\n")...)
-		if err := txn.Set(toEdgesKey, toEdges); err != nil {
+		if err := putNodeTxn(txn, &old, &node); err != nil {
 			return err
 		}
-
+		merged = &node
 		return nil
 	})
+	return merged, err
+}
+
+func aliasList(v interface{}) []string {
+	var aliases []string
+	switch list := v.(type) {
+	case []string:
+		aliases = append(aliases, list...)
+	case []interface{}:
+		for _, a := range list {
+			if s, ok := a.(string); ok {
+				aliases = append(aliases, s)
+			}
+		}
+	}
+	return aliases
+}
+
+func appendAlias(aliases []string, alias string) []string {
+	if alias == "" {
+		return aliases
+	}
+	for _, a := range aliases {
+		if a == alias {
+			return aliases
+		}
+	}
+	return append(aliases, alias)
+}
+
+func addEdgeTxn(txn *badger.Txn, edge *Edge) error {
+	data, err := json.Marshal(edge)
+	if err != nil {
+		return err
+	}
+	key := edgeKey(edge)
+	existed := hasKey(txn, []byte(key))
+	if err := txn.Set([]byte(key), data); err != nil {
+		return err
+	}
+	if existed {
+		return nil
+	}
+	if err := appendToList(txn, "out:"+edge.From, key); err != nil {
+		return err
+	}
+	if err := appendToList(txn, "in:"+edge.To, key); err != nil {
+		return err
+	}
+	return openEdgeVersion(txn, edge)
+}
+
+func deleteEdgeTxn(txn *badger.Txn, edge *Edge) error {
+	key := edgeKey(edge)
+	existed := hasKey(txn, []byte(key))
+	if err := txn.Delete([]byte(key)); err != nil {
+		return err
+	}
+	if err := removeFromList(txn, "out:"+edge.From, key); err != nil {
+		return err
+	}
+	if err := removeFromList(txn, "in:"+edge.To, key); err != nil {
+		return err
+	}
+	if !existed {
+		return nil
+	}
+	return closeEdgeVersion(txn, edge)
+}
+
+func getEdgeTxn(txn *badger.Txn, key string) (*Edge, error) {
+	item, err := txn.Get([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	var edge Edge
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &edge)
+	}); err != nil {
+		return nil, err
+	}
+	return &edge, nil
+}
+
+func readList(txn *badger.Txn, listKey string) ([]byte, error) {
+	item, err := txn.Get([]byte(listKey))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func appendToList(txn *badger.Txn, listKey, key string) error {
+	list, err := readList(txn, listKey)
+	if err != nil {
+		return err
+	}
+	list = append(list, []byte(key+"\n")...)
+	return txn.Set([]byte(listKey), list)
+}
+
+func removeFromList(txn *badger.Txn, listKey, key string) error {
+	list, err := readList(txn, listKey)
+	if err != nil || list == nil {
+		return err
+	}
+	var kept []byte
+	for _, k := range splitKeys(list) {
+		if string(k) == key {
+			continue
+		}
+		kept = append(kept, k...)
+		kept = append(kept, '\n')
+	}
+	if len(kept) == 0 {
+		return txn.Delete([]byte(listKey))
+	}
+	return txn.Set([]byte(listKey), kept)
 }
 
 func (s *Store) GetNodeEdges(nodeID string) ([]*Edge, error) {
@@ -193,46 +516,34 @@ func (s *Store) Traverse(start string, edgeType string, depth int) ([]*Node, err
 
 func (s *Store) SearchNodes(nodeType string, labelQuery string, limit int) []*Node {
 	var results []*Node
-	
+
 	err := s.db.View(func(txn *badger.Txn) error {
-		opts := badger.IteratorOptions{}
-		opts.PrefetchValues = false
-		it := txn.NewIterator(opts)
+		if labelQuery != "" {
+			results = s.searchIndexed(txn, nodeType, labelQuery, limit)
+			return nil
+		}
+
+		if nodeType != "" {
+			for _, id := range collectIndexIDs(txn, typeIndexPrefix+nodeType+keySep, limit) {
+				if node, err := getNodeTxn(txn, id); err == nil {
+					results = append(results, node)
+				}
+			}
+			return nil
+		}
+
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 
 		prefix := []byte("node:")
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
 			var node Node
-			if err := item.Value(func(val []byte) error {
+			if err := it.Item().Value(func(val []byte) error {
 				return json.Unmarshal(val, &node)
 			}); err != nil {
 				continue
 			}
-
-			if nodeType != "" && node.Type != nodeType {
-				continue
-			}
-
-			if labelQuery != "" {
-				match := false
-				if strings.Contains(strings.ToLower(node.Label), strings.ToLower(labelQuery)) {
-					match = true
-				} else if strings.Contains(strings.ToLower(node.ID), strings.ToLower(labelQuery)) {
-					match = true
-				}
-				if name, ok := node.Props["name"].(string); ok {
-					if strings.Contains(strings.ToLower(name), strings.ToLower(labelQuery)) {
-						match = true
-					}
-				}
-				if !match {
-					continue
-				}
-			}
-
 			results = append(results, &node)
-
 			if len(results) >= limit {
 				break
 			}
@@ -247,32 +558,39 @@ func (s *Store) SearchNodes(nodeType string, labelQuery string, limit int) []*No
 }
 
 func (s *Store) CountNodes(nodeType string) int {
-	count := 0
-	
-	s.db.View(func(txn *badger.Txn) error {
-		opts := badger.IteratorOptions{}
-		opts.PrefetchValues = false
-		it := txn.NewIterator(opts)
+	counts := s.TypeCounts()
+	if nodeType != "" {
+		return counts[nodeType]
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+// BlobRefs counts, per blob hash, the nodes whose BlobRef points at it.
+func (s *Store) BlobRefs() (map[string]int, error) {
+	refs := make(map[string]int)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 
 		prefix := []byte("node:")
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
 			var node Node
-			if err := item.Value(func(val []byte) error {
+			if err := it.Item().Value(func(val []byte) error {
 				return json.Unmarshal(val, &node)
 			}); err != nil {
-				continue
+				return err
 			}
-
-			if nodeType == "" || node.Type == nodeType {
-				count++
+			if node.BlobRef != "" {
+				refs[node.BlobRef]++
 			}
 		}
 		return nil
 	})
-
-	return count
+	return refs, err
 }
 
 func (s *Store) Close() error {
@@ -107,6 +107,160 @@ func TestStore_Traverse(t *testing.T) {
 	}
 }
 
+func TestStore_SearchNodesIndexed(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	store, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	store.AddNode(&Node{ID: "entity:kubernetes", Type: "Entity", Label: "Kubernetes", CreateAt: 123})
+	store.AddNode(&Node{ID: "entity:kube_proxy", Type: "Entity", Label: "Kube Proxy", CreateAt: 123})
+	store.AddNode(&Node{ID: "doc:1", Type: "Document", Label: "kubernetes-notes.md", CreateAt: 123})
+
+	nodes := store.SearchNodes("", "kube", 10)
+	if len(nodes) != 3 {
+		t.Errorf("prefix search: got %d nodes, want 3", len(nodes))
+	}
+
+	nodes = store.SearchNodes("Entity", "kube", 10)
+	if len(nodes) != 2 {
+		t.Errorf("typed prefix search: got %d nodes, want 2", len(nodes))
+	}
+
+	nodes = store.SearchNodes("", "ernet", 10)
+	if len(nodes) != 2 {
+		t.Errorf("contains search: got %d nodes, want 2", len(nodes))
+	}
+
+	nodes = store.SearchNodes("", "proxy", 10)
+	if len(nodes) != 1 || nodes[0].ID != "entity:kube_proxy" {
+		t.Errorf("word prefix search: got %v", nodes)
+	}
+
+	nodes = store.SearchNodes("", "netes-n", 10)
+	if len(nodes) != 1 || nodes[0].ID != "doc:1" {
+		t.Errorf("contains search across words: got %v", nodes)
+	}
+
+	store.AddNode(&Node{ID: "entity:mongodb", Type: "Entity", Label: "MongoDB", CreateAt: 123})
+	nodes = store.SearchNodes("", "db", 10)
+	if len(nodes) != 1 || nodes[0].ID != "entity:mongodb" {
+		t.Errorf("short contains search: got %v", nodes)
+	}
+	nodes = store.SearchNodes("Document", "db", 10)
+	if len(nodes) != 0 {
+		t.Errorf("typed short contains search: got %v", nodes)
+	}
+}
+
+func TestStore_CountNodes(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	store, err := NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	store.AddNode(&Node{ID: "a", Type: "Entity", Label: "Alpha", CreateAt: 123})
+	store.AddNode(&Node{ID: "b", Type: "Entity", Label: "Beta", CreateAt: 123})
+	store.AddNode(&Node{ID: "c", Type: "Document", Label: "Gamma", CreateAt: 123})
+	store.AddNode(&Node{ID: "a", Type: "Entity", Label: "Alpha", CreateAt: 456})
+	store.AddNode(&Node{ID: "b", Type: "Document", Label: "Beta v2", CreateAt: 456})
+
+	if got := store.CountNodes("Entity"); got != 1 {
+		t.Errorf("CountNodes(Entity) = %d, want 1", got)
+	}
+	if got := store.CountNodes("Document"); got != 2 {
+		t.Errorf("CountNodes(Document) = %d, want 2", got)
+	}
+	if got := store.CountNodes(""); got != 3 {
+		t.Errorf("CountNodes() = %d, want 3", got)
+	}
+
+	if nodes := store.SearchNodes("", "beta v2", 10); len(nodes) != 1 {
+		t.Errorf("relabelled node not found: got %d", len(nodes))
+	}
+	if nodes := store.SearchNodes("Entity", "beta", 10); len(nodes) != 0 {
+		t.Errorf("stale type index entry: got %d", len(nodes))
+	}
+
+	store.Close()
+
+	store, err = NewStore(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.RebuildIndexes(); err != nil {
+		t.Fatalf("failed to rebuild indexes: %v", err)
+	}
+	if got := store.CountNodes(""); got != 3 {
+		t.Errorf("CountNodes() after rebuild = %d, want 3", got)
+	}
+}
+
+func TestStore_MergeNodes(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	store.AddNode(&Node{ID: "entity:kubernetes", Type: "Entity", Label: "Kubernetes"})
+	store.AddNode(&Node{ID: "entity:k8s", Type: "Entity", Label: "K8s"})
+	store.AddNode(&Node{ID: "chunk:1", Type: "Chunk", Label: "Chunk 1"})
+	store.AddNode(&Node{ID: "chunk:2", Type: "Chunk", Label: "Chunk 2"})
+	store.AddEdge(&Edge{From: "chunk:1", To: "entity:kubernetes", Type: "HAS_ENTITY", Weight: 1})
+	store.AddEdge(&Edge{From: "chunk:1", To: "entity:k8s", Type: "HAS_ENTITY", Weight: 1})
+	store.AddEdge(&Edge{From: "chunk:2", To: "entity:k8s", Type: "HAS_ENTITY", Weight: 1})
+	store.AddEdge(&Edge{From: "entity:k8s", To: "entity:kubernetes", Type: "SAME_AS"})
+
+	node, err := store.MergeNodes("entity:kubernetes", []string{"entity:k8s"})
+	if err != nil {
+		t.Fatalf("MergeNodes() error = %v", err)
+	}
+	if aliases := aliasList(node.Props["aliases"]); len(aliases) != 1 || aliases[0] != "K8s" {
+		t.Errorf("aliases = %v, want [K8s]", aliases)
+	}
+
+	if _, err := store.GetNode("entity:k8s"); err == nil {
+		t.Error("duplicate node should be deleted")
+	}
+	edge, err := store.GetEdge("chunk:1", "HAS_ENTITY", "entity:kubernetes")
+	if err != nil || edge.Weight != 2 {
+		t.Errorf("expected summed edge weight 2, got %v, %v", edge, err)
+	}
+	if _, err := store.GetEdge("chunk:2", "HAS_ENTITY", "entity:kubernetes"); err != nil {
+		t.Errorf("expected rewired edge: %v", err)
+	}
+	edges, _ := store.GetEdges("entity:kubernetes", DirBoth)
+	if len(edges) != 2 {
+		t.Errorf("expected 2 edges without self-loop, got %d", len(edges))
+	}
+	if got := store.CountNodes("Entity"); got != 1 {
+		t.Errorf("CountNodes(Entity) = %d, want 1", got)
+	}
+	if nodes := store.SearchNodes("Entity", "k8s", 10); len(nodes) != 1 || nodes[0].ID != "entity:kubernetes" {
+		t.Errorf("alias search should find canonical node, got %d results", len(nodes))
+	}
+}
+
 func hasDiskSpace() bool {
 	tmp := os.TempDir()
 	var stat os.FileInfo
@@ -0,0 +1,451 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Version history layout. The node:/edge: keys always hold the current
+// state; every change also leaves a version record with the interval
+// [valid_from, valid_to) in which it was current, in Unix seconds.
+//
+//	hist:node:<id>\x00<from>                 NodeVersion
+//	hist:adj:<id>\x00<edge key>\x00<from>    EdgeVersion, under both endpoints
+//
+// A version opened and closed within the same second is kept with
+// valid_to == valid_from so history stays complete; later versions from
+// that second get a \x00<seq> suffix on the key. As-of reads skip such
+// zero-length versions.
+//
+// Edge versions track existence only; weight changes on a live edge do not
+// open a new version. Changes to analytics props (RankProps) do not open a
+// new node version either.
+const (
+	histNodePrefix = "hist:node:"
+	histAdjPrefix  = "hist:adj:"
+
+	historyVersionKey = "meta:history_version"
+	historyVersion    = "1"
+)
+
+// timeNow is the clock used for version timestamps.
+var timeNow = time.Now
+
+type NodeVersion struct {
+	Node      *Node `json:"node"`
+	ValidFrom int64 `json:"valid_from"`
+	ValidTo   int64 `json:"valid_to,omitempty"`
+}
+
+type EdgeVersion struct {
+	Edge      *Edge `json:"edge"`
+	ValidFrom int64 `json:"valid_from"`
+	ValidTo   int64 `json:"valid_to,omitempty"`
+}
+
+func (v *NodeVersion) validAt(t int64) bool {
+	return v.ValidFrom <= t && (v.ValidTo == 0 || t < v.ValidTo)
+}
+
+func (v *EdgeVersion) validAt(t int64) bool {
+	return v.ValidFrom <= t && (v.ValidTo == 0 || t < v.ValidTo)
+}
+
+func encodeTimestamp(t int64) string {
+	return fmt.Sprintf("%016x", uint64(t))
+}
+
+func histNodeKey(id string, from int64) []byte {
+	return []byte(histNodePrefix + id + keySep + encodeTimestamp(from))
+}
+
+func histAdjKey(nodeID, edgeKey string, from int64) []byte {
+	return []byte(histAdjPrefix + nodeID + keySep + edgeKey + keySep + encodeTimestamp(from))
+}
+
+// sameNodeContent reports whether two node states differ only in
+// CreateAt or analytics props.
+func sameNodeContent(a, b *Node) bool {
+	strip := func(n *Node) ([]byte, error) {
+		c := *n
+		c.CreateAt = 0
+		c.Props = make(map[string]interface{}, len(n.Props))
+		for k, v := range n.Props {
+			if !IsRankProp(k) {
+				c.Props[k] = v
+			}
+		}
+		return json.Marshal(&c)
+	}
+	da, errA := strip(a)
+	db, errB := strip(b)
+	return errA == nil && errB == nil && string(da) == string(db)
+}
+
+// recordNodeVersion closes the open version of a node and opens a new one
+// for node, unless its content is unchanged since old.
+func recordNodeVersion(txn *badger.Txn, old, node *Node) error {
+	if old != nil && sameNodeContent(old, node) {
+		return nil
+	}
+	now := timeNow().Unix()
+	if err := closeNodeVersion(txn, node.ID, now); err != nil {
+		return err
+	}
+	key, err := freeVersionKey(txn, histNodeKey(node.ID, now))
+	if err != nil {
+		return err
+	}
+	return putVersion(txn, key, &NodeVersion{Node: node, ValidFrom: now})
+}
+
+func closeNodeVersion(txn *badger.Txn, id string, now int64) error {
+	var open *NodeVersion
+	key, err := lastVersion(txn, []byte(histNodePrefix+id+keySep), &open)
+	if err != nil || open == nil || open.ValidTo != 0 {
+		return err
+	}
+	open.ValidTo = now
+	return putVersion(txn, key, open)
+}
+
+func openEdgeVersion(txn *badger.Txn, edge *Edge) error {
+	now := timeNow().Unix()
+	key := edgeKey(edge)
+	version := &EdgeVersion{Edge: edge, ValidFrom: now}
+	for _, id := range edgeEndpoints(edge) {
+		vkey, err := freeVersionKey(txn, histAdjKey(id, key, now))
+		if err != nil {
+			return err
+		}
+		if err := putVersion(txn, vkey, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func closeEdgeVersion(txn *badger.Txn, edge *Edge) error {
+	now := timeNow().Unix()
+	key := edgeKey(edge)
+	for _, id := range edgeEndpoints(edge) {
+		var open *EdgeVersion
+		vkey, err := lastVersion(txn, []byte(histAdjPrefix+id+keySep+key+keySep), &open)
+		if err != nil {
+			return err
+		}
+		if open == nil || open.ValidTo != 0 {
+			continue
+		}
+		open.ValidTo = now
+		if err := putVersion(txn, vkey, open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func edgeEndpoints(edge *Edge) []string {
+	if edge.From == edge.To {
+		return []string{edge.From}
+	}
+	return []string{edge.From, edge.To}
+}
+
+// freeVersionKey returns key, or key with the lowest \x00<seq> suffix not
+// yet taken when an earlier version opened in the same second.
+func freeVersionKey(txn *badger.Txn, key []byte) ([]byte, error) {
+	candidate := key
+	for seq := 1; ; seq++ {
+		_, err := txn.Get(candidate)
+		if err == badger.ErrKeyNotFound {
+			return candidate, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		candidate = []byte(fmt.Sprintf("%s%s%08x", key, keySep, seq))
+	}
+}
+
+func putVersion(txn *badger.Txn, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return txn.Set(key, data)
+}
+
+// lastVersion decodes the newest record under prefix into out and returns
+// its key. out is left nil when there is none.
+func lastVersion(txn *badger.Txn, prefix []byte, out interface{}) ([]byte, error) {
+	it := txn.NewIterator(badger.IteratorOptions{Reverse: true})
+	defer it.Close()
+
+	seek := append(append([]byte{}, prefix...), 0xff)
+	it.Seek(seek)
+	if !it.ValidForPrefix(prefix) {
+		return nil, nil
+	}
+	item := it.Item()
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, out)
+	}); err != nil {
+		return nil, err
+	}
+	return item.KeyCopy(nil), nil
+}
+
+// ensureHistory seeds version records for stores written before history
+// was kept. Nodes open at their CreateAt, edges at the later of their
+// endpoints' CreateAt.
+func (s *Store) ensureHistory() error {
+	var version string
+	s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(historyVersionKey))
+		if err != nil {
+			return nil
+		}
+		val, _ := item.ValueCopy(nil)
+		version = string(val)
+		return nil
+	})
+	if version == historyVersion {
+		return nil
+	}
+
+	created := make(map[string]int64)
+	var nodes []*Node
+	var edges []*Edge
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for _, prefix := range []string{"node:", "edge:"} {
+			p := []byte(prefix)
+			for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+				err := it.Item().Value(func(val []byte) error {
+					if prefix == "node:" {
+						var node Node
+						if err := json.Unmarshal(val, &node); err != nil {
+							return nil
+						}
+						created[node.ID] = node.CreateAt
+						nodes = append(nodes, &node)
+						return nil
+					}
+					var edge Edge
+					if err := json.Unmarshal(val, &edge); err == nil {
+						edges = append(edges, &edge)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, node := range nodes {
+		data, err := json.Marshal(&NodeVersion{Node: node, ValidFrom: node.CreateAt})
+		if err != nil {
+			return err
+		}
+		if err := wb.Set(histNodeKey(node.ID, node.CreateAt), data); err != nil {
+			return err
+		}
+	}
+	for _, edge := range edges {
+		from := created[edge.From]
+		if created[edge.To] > from {
+			from = created[edge.To]
+		}
+		data, err := json.Marshal(&EdgeVersion{Edge: edge, ValidFrom: from})
+		if err != nil {
+			return err
+		}
+		for _, id := range edgeEndpoints(edge) {
+			if err := wb.Set(histAdjKey(id, edgeKey(edge), from), data); err != nil {
+				return err
+			}
+		}
+	}
+	if err := wb.Set([]byte(historyVersionKey), []byte(historyVersion)); err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+// NodeHistory returns every recorded version of a node, oldest first.
+func (s *Store) NodeHistory(id string) ([]*NodeVersion, error) {
+	var versions []*NodeVersion
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(histNodePrefix + id + keySep)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var v NodeVersion
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &v)
+			}); err != nil {
+				return err
+			}
+			versions = append(versions, &v)
+		}
+		return nil
+	})
+	return versions, err
+}
+
+// GetNodeAsOf returns the node as it was at Unix time t.
+func (s *Store) GetNodeAsOf(id string, t int64) (*Node, error) {
+	var node *Node
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		node, err = nodeAsOfTxn(txn, id, t)
+		return err
+	})
+	return node, err
+}
+
+func nodeAsOfTxn(txn *badger.Txn, id string, t int64) (*Node, error) {
+	it := txn.NewIterator(badger.IteratorOptions{Reverse: true})
+	defer it.Close()
+
+	prefix := []byte(histNodePrefix + id + keySep)
+	for it.Seek(append(histNodeKey(id, t), 0xff)); it.ValidForPrefix(prefix); it.Next() {
+		var v NodeVersion
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &v)
+		}); err != nil {
+			return nil, err
+		}
+		if v.validAt(t) {
+			return v.Node, nil
+		}
+		if v.ValidFrom <= t && v.ValidTo != v.ValidFrom {
+			break
+		}
+	}
+	return nil, badger.ErrKeyNotFound
+}
+
+// GetEdgesAsOf returns the outgoing, incoming or all edges of a node that
+// existed at Unix time t.
+func (s *Store) GetEdgesAsOf(nodeID string, dir RelDirection, t int64) ([]*Edge, error) {
+	var edges []*Edge
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		edges, err = edgesAsOfTxn(txn, nodeID, dir, t)
+		return err
+	})
+	return edges, err
+}
+
+func edgesAsOfTxn(txn *badger.Txn, nodeID string, dir RelDirection, t int64) ([]*Edge, error) {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	var edges []*Edge
+	prefix := []byte(histAdjPrefix + nodeID + keySep)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var v EdgeVersion
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &v)
+		}); err != nil {
+			return nil, err
+		}
+		if !v.validAt(t) {
+			continue
+		}
+		if (dir == DirOut && v.Edge.From != nodeID) || (dir == DirIn && v.Edge.To != nodeID) {
+			continue
+		}
+		edges = append(edges, v.Edge)
+	}
+	return edges, nil
+}
+
+// TraverseAsOf is Traverse over the graph as it was at Unix time t.
+func (s *Store) TraverseAsOf(start string, edgeType string, depth int, t int64) ([]*Node, error) {
+	visited := make(map[string]bool)
+	var result []*Node
+	queue := []string{start}
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		for len(queue) > 0 && depth > 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			if visited[current] {
+				continue
+			}
+			visited[current] = true
+
+			if node, err := nodeAsOfTxn(txn, current, t); err == nil {
+				result = append(result, node)
+			}
+
+			edges, err := edgesAsOfTxn(txn, current, DirOut, t)
+			if err != nil {
+				return err
+			}
+			for _, edge := range edges {
+				if edgeType == "" || edge.Type == edgeType {
+					queue = append(queue, edge.To)
+				}
+			}
+			depth--
+		}
+		return nil
+	})
+	return result, err
+}
+
+// SearchNodesAsOf is SearchNodes over the nodes that existed at Unix time
+// t. The secondary indexes only describe the current graph, so this scans
+// the version history.
+func (s *Store) SearchNodesAsOf(nodeType, labelQuery string, t int64, limit int) []*Node {
+	query := strings.ToLower(labelQuery)
+	var results []*Node
+
+	s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(histNodePrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var v NodeVersion
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &v)
+			}); err != nil {
+				continue
+			}
+			if !v.validAt(t) {
+				continue
+			}
+			if nodeType != "" && v.Node.Type != nodeType {
+				continue
+			}
+			if query != "" && !nodeMatches(v.Node, query) {
+				continue
+			}
+			results = append(results, v.Node)
+			if len(results) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return results
+}
@@ -0,0 +1,182 @@
+package graph
+
+import (
+	"testing"
+	"time"
+)
+
+func setClock(t *testing.T, unix *int64) {
+	t.Helper()
+	timeNow = func() time.Time { return time.Unix(*unix, 0) }
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
+func TestStore_NodeVersions(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	var now int64 = 1000
+	setClock(t, &now)
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	store.AddNode(&Node{ID: "doc:1", Type: "Document", Label: "draft.md", CreateAt: 1000})
+
+	now = 2000
+	store.AddNode(&Node{ID: "doc:1", Type: "Document", Label: "final.md", CreateAt: 2000})
+
+	now = 2500
+	store.AddNode(&Node{ID: "doc:1", Type: "Document", Label: "final.md", CreateAt: 2500})
+	store.UpdateNodeProps(map[string]map[string]interface{}{"doc:1": {"pagerank": 0.5}})
+
+	current, _ := store.GetNode("doc:1")
+	if current.CreateAt != 1000 {
+		t.Errorf("CreateAt = %d, want first appearance 1000", current.CreateAt)
+	}
+
+	history, err := store.NodeHistory("doc:1")
+	if err != nil {
+		t.Fatalf("NodeHistory() error = %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(history))
+	}
+	if history[0].ValidTo != 2000 || history[1].ValidTo != 0 {
+		t.Errorf("unexpected version intervals: %+v %+v", history[0], history[1])
+	}
+
+	if node, err := store.GetNodeAsOf("doc:1", 1500); err != nil || node.Label != "draft.md" {
+		t.Errorf("as of 1500 = %v, %v; want draft.md", node, err)
+	}
+	if node, err := store.GetNodeAsOf("doc:1", 2000); err != nil || node.Label != "final.md" {
+		t.Errorf("as of 2000 = %v, %v; want final.md", node, err)
+	}
+	if _, err := store.GetNodeAsOf("doc:1", 999); err == nil {
+		t.Error("node should not exist before it was created")
+	}
+
+	now = 3000
+	if err := store.DeleteNode("doc:1"); err != nil {
+		t.Fatalf("DeleteNode() error = %v", err)
+	}
+	if _, err := store.GetNodeAsOf("doc:1", 3000); err == nil {
+		t.Error("node should not exist after deletion")
+	}
+	if node, err := store.GetNodeAsOf("doc:1", 2999); err != nil || node.Label != "final.md" {
+		t.Errorf("as of 2999 = %v, %v; want final.md", node, err)
+	}
+
+	if nodes := store.SearchNodesAsOf("Document", "draft", 1500, 10); len(nodes) != 1 {
+		t.Errorf("SearchNodesAsOf(draft, 1500) = %d results, want 1", len(nodes))
+	}
+	if nodes := store.SearchNodesAsOf("Document", "draft", 2500, 10); len(nodes) != 0 {
+		t.Errorf("SearchNodesAsOf(draft, 2500) = %d results, want 0", len(nodes))
+	}
+}
+
+func TestStore_SameSecondVersions(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	var now int64 = 1000
+	setClock(t, &now)
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	store.AddNode(&Node{ID: "doc:1", Type: "Document", Label: "draft.md", CreateAt: 1000})
+	store.AddNode(&Node{ID: "doc:1", Type: "Document", Label: "final.md", CreateAt: 1000})
+	store.AddNode(&Node{ID: "doc:2", Type: "Document", Label: "scratch.md", CreateAt: 1000})
+	store.AddEdge(&Edge{From: "doc:1", To: "doc:2", Type: "LINKS_TO"})
+	store.DeleteNode("doc:2")
+
+	history, err := store.NodeHistory("doc:1")
+	if err != nil {
+		t.Fatalf("NodeHistory() error = %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(history))
+	}
+	if history[0].Node.Label != "draft.md" || history[0].ValidTo != 1000 || history[1].ValidTo != 0 {
+		t.Errorf("unexpected versions: %+v %+v", history[0], history[1])
+	}
+	if node, err := store.GetNodeAsOf("doc:1", 1000); err != nil || node.Label != "final.md" {
+		t.Errorf("as of 1000 = %v, %v; want final.md", node, err)
+	}
+
+	if history, _ := store.NodeHistory("doc:2"); len(history) != 1 || history[0].ValidTo != 1000 {
+		t.Errorf("deleted node should keep a zero-length version, got %+v", history)
+	}
+	if _, err := store.GetNodeAsOf("doc:2", 1000); err == nil {
+		t.Error("zero-length version should not be visible as of 1000")
+	}
+	if edges, _ := store.GetEdgesAsOf("doc:1", DirOut, 1000); len(edges) != 0 {
+		t.Errorf("GetEdgesAsOf(doc:1, out, 1000) = %d edges, want 0", len(edges))
+	}
+
+	now = 2000
+	store.AddEdge(&Edge{From: "doc:1", To: "doc:1", Type: "LINKS_TO"})
+	store.DeleteEdge("doc:1", "LINKS_TO", "doc:1")
+	store.AddEdge(&Edge{From: "doc:1", To: "doc:1", Type: "LINKS_TO"})
+	if edges, _ := store.GetEdgesAsOf("doc:1", DirOut, 2000); len(edges) != 1 {
+		t.Errorf("edge reopened in the same second should be visible, got %d edges", len(edges))
+	}
+}
+
+func TestStore_EdgeVersions(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	var now int64 = 1000
+	setClock(t, &now)
+
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	store.AddNode(&Node{ID: "doc:1", Type: "Document", Label: "notes.md", CreateAt: 1000})
+	store.AddNode(&Node{ID: "chunk:1", Type: "Chunk", Label: "Chunk 0", CreateAt: 1000})
+	store.AddNode(&Node{ID: "entity:go", Type: "Entity", Label: "Go", CreateAt: 1000})
+	store.AddEdge(&Edge{From: "doc:1", To: "chunk:1", Type: "HAS_CHUNK"})
+	store.AddEdge(&Edge{From: "chunk:1", To: "entity:go", Type: "HAS_ENTITY"})
+
+	now = 2000
+	store.DeleteEdge("chunk:1", "HAS_ENTITY", "entity:go")
+	store.IncrementEdges([]*Edge{{From: "doc:1", To: "chunk:1", Type: "HAS_CHUNK", Weight: 1}})
+
+	if nodes, _ := store.TraverseAsOf("doc:1", "", 3, 1500); len(nodes) != 3 {
+		t.Errorf("TraverseAsOf(1500) = %d nodes, want 3", len(nodes))
+	}
+	if nodes, _ := store.TraverseAsOf("doc:1", "", 3, 2500); len(nodes) != 2 {
+		t.Errorf("TraverseAsOf(2500) = %d nodes, want 2", len(nodes))
+	}
+	if edges, _ := store.GetEdgesAsOf("entity:go", DirIn, 1500); len(edges) != 1 {
+		t.Errorf("GetEdgesAsOf(entity:go, in, 1500) = %d edges, want 1", len(edges))
+	}
+	if edges, _ := store.GetEdgesAsOf("doc:1", DirOut, 2500); len(edges) != 1 {
+		t.Errorf("weight change should not close the edge version, got %d edges", len(edges))
+	}
+
+	store.Close()
+	store, err = NewStore(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if history, _ := store.NodeHistory("doc:1"); len(history) != 1 {
+		t.Errorf("reopening should not add versions, got %d", len(history))
+	}
+}
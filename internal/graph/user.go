@@ -0,0 +1,320 @@
+package graph
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// SourceUser marks nodes and edges created through the API rather than
+// derived by the indexer. Derived data leaves Source empty.
+const SourceUser = "user"
+
+var (
+	ErrNodeNotFound = errors.New("node not found")
+	ErrEdgeNotFound = errors.New("edge not found")
+	ErrExists       = errors.New("already exists")
+	ErrDerived      = errors.New("derived by the indexer and cannot be changed")
+)
+
+// ValidationError reports a user node or edge that does not fit the schema.
+type ValidationError struct {
+	Msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return &ValidationError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// derivedIDPrefixes are the ID namespaces the indexer writes into.
+var derivedIDPrefixes = []string{"doc:", "chunk:", "entity:", "symbol:"}
+
+var (
+	nodeTypePattern = regexp.MustCompile(`^[A-Z][A-Za-z0-9_]{0,63}$`)
+	edgeTypePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,63}$`)
+)
+
+// validateUserNode checks a node submitted through the API. Its type must
+// be declared in the schema and not derived, it needs a label, and its
+// props must match the type's declared properties.
+func (s *Store) validateUserNode(node *Node) error {
+	spec, ok := s.NodeType(node.Type)
+	if !ok {
+		return invalidf("node type %q is not declared in the schema", node.Type)
+	}
+	if spec.Derived {
+		return invalidf("node type %q is reserved for indexed data", node.Type)
+	}
+	if strings.TrimSpace(node.Label) == "" {
+		return invalidf("label is required")
+	}
+	if strings.ContainsAny(node.ID, "\x00\n") {
+		return invalidf("id must not contain NUL or newline")
+	}
+	for _, prefix := range derivedIDPrefixes {
+		if strings.HasPrefix(node.ID, prefix) {
+			return invalidf("id prefix %q is reserved for indexed data", prefix)
+		}
+	}
+	if err := validateProps(node.Props); err != nil {
+		return err
+	}
+	return s.schema.validateNode(node)
+}
+
+// validateUserEdge checks the parts of a user edge that do not depend on
+// its endpoints; the schema check runs once they are loaded.
+func (s *Store) validateUserEdge(edge *Edge) error {
+	if edge.From == "" || edge.To == "" {
+		return invalidf("from and to are required")
+	}
+	spec, ok := s.EdgeType(edge.Type)
+	if !ok {
+		return invalidf("edge type %q is not declared in the schema", edge.Type)
+	}
+	if spec.Derived {
+		return invalidf("edge type %q is reserved for indexed data", edge.Type)
+	}
+	if edge.From == edge.To {
+		return invalidf("self-loops are not allowed")
+	}
+	return validateProps(edge.Props)
+}
+
+func validateProps(props map[string]interface{}) error {
+	for k, v := range props {
+		if k == "" {
+			return invalidf("property names must not be empty")
+		}
+		if !isScalar(v) {
+			list, ok := v.([]interface{})
+			if !ok {
+				return invalidf("property %q must be a string, number, boolean or list of those", k)
+			}
+			for _, item := range list {
+				if !isScalar(item) || item == nil {
+					return invalidf("property %q must be a string, number, boolean or list of those", k)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case nil, string, bool, float64, float32, int, int64:
+		return true
+	}
+	return false
+}
+
+// CreateUserNode validates and stores a new user node. An empty ID is
+// replaced by "<type>:<random>" in lower case.
+func (s *Store) CreateUserNode(node *Node) (*Node, error) {
+	created := *node
+	created.Source = SourceUser
+	created.CreateAt = time.Now().Unix()
+	if created.ID == "" {
+		created.ID = strings.ToLower(created.Type) + ":" + randomID()
+	}
+	if err := s.validateUserNode(&created); err != nil {
+		return nil, err
+	}
+
+	err := s.update(func(txn *badger.Txn) error {
+		if hasKey(txn, []byte("node:"+created.ID)) {
+			return fmt.Errorf("node %s %w", created.ID, ErrExists)
+		}
+		return putNodeTxn(txn, nil, &created)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateUserNode changes the label and merges props into a user node. A nil
+// prop value removes that prop.
+func (s *Store) UpdateUserNode(id string, label string, props map[string]interface{}) (*Node, error) {
+	var updated *Node
+	err := s.update(func(txn *badger.Txn) error {
+		old, err := userNodeTxn(txn, id)
+		if err != nil {
+			return err
+		}
+		node := *old
+		if label != "" {
+			node.Label = label
+		}
+		node.Props = make(map[string]interface{}, len(old.Props)+len(props))
+		for k, v := range old.Props {
+			node.Props[k] = v
+		}
+		for k, v := range props {
+			if v == nil {
+				delete(node.Props, k)
+			} else {
+				node.Props[k] = v
+			}
+		}
+		if err := s.validateUserNode(&node); err != nil {
+			return err
+		}
+		if err := putNodeTxn(txn, old, &node); err != nil {
+			return err
+		}
+		updated = &node
+		return nil
+	})
+	return updated, err
+}
+
+// DeleteUserNode removes a user node and all of its edges.
+func (s *Store) DeleteUserNode(id string) error {
+	return s.update(func(txn *badger.Txn) error {
+		if _, err := userNodeTxn(txn, id); err != nil {
+			return err
+		}
+		return deleteNodeTxn(txn, id)
+	})
+}
+
+func userNodeTxn(txn *badger.Txn, id string) (*Node, error) {
+	node, err := getNodeTxn(txn, id)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%s: %w", id, ErrNodeNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if node.Source != SourceUser {
+		return nil, fmt.Errorf("node %s is %w", id, ErrDerived)
+	}
+	return node, nil
+}
+
+// CreateUserEdge validates and stores a user edge between two existing
+// nodes, which may be derived ones.
+func (s *Store) CreateUserEdge(edge *Edge) (*Edge, error) {
+	created := *edge
+	created.Source = SourceUser
+	if err := s.validateUserEdge(&created); err != nil {
+		return nil, err
+	}
+
+	err := s.update(func(txn *badger.Txn) error {
+		for _, id := range []string{created.From, created.To} {
+			if !hasKey(txn, []byte("node:"+id)) {
+				return fmt.Errorf("%s: %w", id, ErrNodeNotFound)
+			}
+		}
+		if err := s.validateEdgeTxn(txn, &created); err != nil {
+			return err
+		}
+		if hasKey(txn, []byte(edgeKey(&created))) {
+			return fmt.Errorf("edge %s %w", edgeKey(&created), ErrExists)
+		}
+		return addEdgeTxn(txn, &created)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateUserEdge changes the label and weight of a user edge and merges
+// props into it. Empty label and nil weight leave those unchanged.
+func (s *Store) UpdateUserEdge(from, edgeType, to, label string, weight *float32, props map[string]interface{}) (*Edge, error) {
+	var updated *Edge
+	err := s.update(func(txn *badger.Txn) error {
+		edge, err := userEdgeTxn(txn, from, edgeType, to)
+		if err != nil {
+			return err
+		}
+		if label != "" {
+			edge.Label = label
+		}
+		if weight != nil {
+			edge.Weight = *weight
+		}
+		if edge.Props == nil && len(props) > 0 {
+			edge.Props = make(map[string]interface{})
+		}
+		for k, v := range props {
+			if v == nil {
+				delete(edge.Props, k)
+			} else {
+				edge.Props[k] = v
+			}
+		}
+		if err := s.validateUserEdge(edge); err != nil {
+			return err
+		}
+		if err := s.validateEdgeTxn(txn, edge); err != nil {
+			return err
+		}
+		if err := addEdgeTxn(txn, edge); err != nil {
+			return err
+		}
+		updated = edge
+		return nil
+	})
+	return updated, err
+}
+
+func (s *Store) DeleteUserEdge(from, edgeType, to string) error {
+	return s.update(func(txn *badger.Txn) error {
+		edge, err := userEdgeTxn(txn, from, edgeType, to)
+		if err != nil {
+			return err
+		}
+		return deleteEdgeTxn(txn, edge)
+	})
+}
+
+func userEdgeTxn(txn *badger.Txn, from, edgeType, to string) (*Edge, error) {
+	key := edgeKey(&Edge{From: from, Type: edgeType, To: to})
+	edge, err := getEdgeTxn(txn, key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%s: %w", key, ErrEdgeNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if edge.Source != SourceUser {
+		return nil, fmt.Errorf("edge %s is %w", key, ErrDerived)
+	}
+	return edge, nil
+}
+
+// UserEdges returns the user-made edges touching a node.
+func (s *Store) UserEdges(nodeID string) ([]*Edge, error) {
+	edges, err := s.GetEdges(nodeID, DirBoth)
+	if err != nil {
+		return nil, err
+	}
+	var user []*Edge
+	for _, edge := range edges {
+		if edge.Source == SourceUser {
+			user = append(user, edge)
+		}
+	}
+	return user, nil
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,103 @@
+package graph
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStore_UserNodesAndEdges(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	store.AddNode(&Node{ID: "doc:1", Type: "Document", Label: "v1.md"})
+	store.AddNode(&Node{ID: "doc:2", Type: "Document", Label: "v2.md"})
+
+	store.DefineNodeType(NodeTypeSpec{Name: "Project", Open: true})
+	store.DefineEdgeType(EdgeTypeSpec{Name: "SUPERSEDES", From: []string{NodeDocument}, To: []string{NodeDocument}, Open: true})
+	store.DefineEdgeType(EdgeTypeSpec{Name: "PART_OF", To: []string{"Project"}})
+
+	project, err := store.CreateUserNode(&Node{Type: "Project", Label: "Mindy", Props: map[string]interface{}{"owner": "team"}})
+	if err != nil {
+		t.Fatalf("CreateUserNode() error = %v", err)
+	}
+	if project.Source != SourceUser || project.ID == "" {
+		t.Errorf("unexpected created node %+v", project)
+	}
+
+	invalid := []*Node{
+		{Type: "Document", Label: "fake"},
+		{Type: "Team", Label: "undeclared"},
+		{Type: "Project", Label: ""},
+		{ID: "doc:3", Type: "Project", Label: "reserved id"},
+		{Type: "Project", Label: "nested", Props: map[string]interface{}{"x": map[string]interface{}{}}},
+	}
+	for _, n := range invalid {
+		var verr *ValidationError
+		if _, err := store.CreateUserNode(n); !errors.As(err, &verr) {
+			t.Errorf("CreateUserNode(%+v) error = %v, want ValidationError", n, err)
+		}
+	}
+	if _, err := store.CreateUserNode(&Node{ID: project.ID, Type: "Project", Label: "again"}); !errors.Is(err, ErrExists) {
+		t.Errorf("duplicate id error = %v, want ErrExists", err)
+	}
+
+	updated, err := store.UpdateUserNode(project.ID, "Mindy v2", map[string]interface{}{"owner": nil, "status": "active"})
+	if err != nil {
+		t.Fatalf("UpdateUserNode() error = %v", err)
+	}
+	if updated.Label != "Mindy v2" || updated.Props["owner"] != nil || updated.Props["status"] != "active" {
+		t.Errorf("unexpected updated node %+v", updated)
+	}
+	if _, err := store.UpdateUserNode("doc:1", "hacked", nil); !errors.Is(err, ErrDerived) {
+		t.Errorf("updating derived node error = %v, want ErrDerived", err)
+	}
+
+	if _, err := store.CreateUserEdge(&Edge{From: "doc:2", To: "doc:1", Type: "SUPERSEDES"}); err != nil {
+		t.Fatalf("CreateUserEdge() error = %v", err)
+	}
+	if _, err := store.CreateUserEdge(&Edge{From: "doc:1", To: project.ID, Type: "PART_OF"}); err != nil {
+		t.Fatalf("CreateUserEdge() error = %v", err)
+	}
+	if _, err := store.CreateUserEdge(&Edge{From: "doc:1", To: "doc:2", Type: "HAS_CHUNK"}); err == nil {
+		t.Error("derived edge type should be rejected")
+	}
+	if _, err := store.CreateUserEdge(&Edge{From: project.ID, To: "doc:1", Type: "PART_OF"}); err == nil {
+		t.Error("PART_OF must end at a Project")
+	}
+	if _, err := store.CreateUserEdge(&Edge{From: "doc:1", To: "missing", Type: "PART_OF"}); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("missing endpoint error = %v, want ErrNodeNotFound", err)
+	}
+
+	weight := float32(2)
+	edge, err := store.UpdateUserEdge("doc:2", "SUPERSEDES", "doc:1", "replaces", &weight, map[string]interface{}{"reason": "rewrite"})
+	if err != nil {
+		t.Fatalf("UpdateUserEdge() error = %v", err)
+	}
+	if edge.Label != "replaces" || edge.Weight != 2 || edge.Props["reason"] != "rewrite" {
+		t.Errorf("unexpected updated edge %+v", edge)
+	}
+
+	if edges, _ := store.UserEdges("doc:1"); len(edges) != 2 {
+		t.Errorf("UserEdges(doc:1) = %d, want 2", len(edges))
+	}
+
+	if err := store.DeleteUserEdge("doc:2", "SUPERSEDES", "doc:1"); err != nil {
+		t.Fatalf("DeleteUserEdge() error = %v", err)
+	}
+	if err := store.DeleteUserNode(project.ID); err != nil {
+		t.Fatalf("DeleteUserNode() error = %v", err)
+	}
+	if edges, _ := store.GetEdges("doc:1", DirBoth); len(edges) != 0 {
+		t.Errorf("expected no edges left on doc:1, got %d", len(edges))
+	}
+	if err := store.DeleteUserNode("doc:1"); !errors.Is(err, ErrDerived) {
+		t.Errorf("deleting derived node error = %v, want ErrDerived", err)
+	}
+}
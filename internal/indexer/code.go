@@ -0,0 +1,246 @@
+package indexer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mindy/internal/extractor"
+	"mindy/internal/graph"
+)
+
+// addCode records the outline of a source file: a Symbol node for each
+// declaration with a DEFINES edge from the document, IMPORTS edges to the
+// shared Symbol nodes of the packages it imports, and CALLS edges to the
+// callees that resolve. Callers in sibling files of the same package are
+// linked too, so calls resolve whichever file is indexed first.
+func (i *Indexer) addCode(docID, path string, code *extractor.Code) {
+	prefix := symbolPrefix(docID)
+	local := make(map[string]string, len(code.Symbols))
+	ids := make([]string, len(code.Symbols))
+	used := map[string]bool{}
+	for n, sym := range code.Symbols {
+		id := prefix + sym.Name
+		for k := 2; used[id]; k++ {
+			id = fmt.Sprintf("%s%s#%d", prefix, sym.Name, k)
+		}
+		used[id] = true
+		ids[n] = id
+		if _, ok := local[sym.Name]; !ok {
+			local[sym.Name] = id
+		}
+
+		node := &graph.Node{
+			ID:    id,
+			Type:  graph.NodeSymbol,
+			Label: sym.Name,
+			Props: map[string]interface{}{
+				"kind":     sym.Kind,
+				"language": code.Language,
+				"line":     sym.Line,
+				"end_line": sym.EndLine,
+				"doc_id":   docID,
+			},
+			CreateAt: time.Now().Unix(),
+		}
+		for k, v := range map[string]string{"package": code.Package, "signature": sym.Signature, "doc": sym.Doc} {
+			if v != "" {
+				node.Props[k] = v
+			}
+		}
+		if len(sym.Calls) > 0 {
+			node.Props["calls"] = sym.Calls
+		}
+		if err := i.graphStore.AddNode(node); err != nil {
+			fmt.Printf("Warning: failed to add symbol %s: %v\n", sym.Name, err)
+			continue
+		}
+		i.graphStore.AddEdge(&graph.Edge{From: docID, To: id, Type: graph.EdgeDefines})
+	}
+
+	for _, imp := range code.Imports {
+		id := "symbol:" + code.Language + ":" + imp.Path
+		if _, err := i.graphStore.GetNode(id); err != nil {
+			i.graphStore.AddNode(&graph.Node{
+				ID:       id,
+				Type:     graph.NodeSymbol,
+				Label:    imp.Path,
+				Props:    map[string]interface{}{"kind": "package", "language": code.Language},
+				CreateAt: time.Now().Unix(),
+			})
+		}
+		i.graphStore.AddEdge(&graph.Edge{From: docID, To: id, Type: graph.EdgeImports, Label: imp.Name})
+	}
+
+	for n, sym := range code.Symbols {
+		for _, call := range sym.Calls {
+			if to := i.resolveCall(docID, code, call, local); to != "" && to != ids[n] {
+				i.graphStore.AddEdge(&graph.Edge{From: ids[n], To: to, Type: graph.EdgeCalls})
+			}
+		}
+	}
+	i.linkCallers(docID, path, code, local)
+}
+
+// symbolPrefix is the ID prefix of the symbols a document declares.
+func symbolPrefix(docID string) string {
+	return "symbol:" + strings.TrimPrefix(docID, "doc:") + ":"
+}
+
+// resolveCall finds the Symbol node a call names: a declaration in the
+// same file, a method of the file called on some value if only one has
+// that name, a declaration in an imported package ("fmt.Println"), one in
+// the same package ("helper" in Go), or the one symbol of the language
+// with that qualified name ("Point.new"), preferring the file's package.
+// It returns "" for calls it cannot pin down.
+func (i *Indexer) resolveCall(docID string, code *extractor.Code, call string, local map[string]string) string {
+	if id, ok := local[call]; ok {
+		return id
+	}
+	if method, ok := strings.CutPrefix(call, "."); ok {
+		found := ""
+		for name, id := range local {
+			if strings.HasSuffix(name, "."+method) {
+				if found != "" {
+					return ""
+				}
+				found = id
+			}
+		}
+		return found
+	}
+	if qualifier, name, ok := strings.Cut(call, "."); ok {
+		for _, imp := range code.Imports {
+			module := importModule(imp.Path)
+			if qualifier == imp.Name || (imp.Name == "" && qualifier == module) {
+				return i.findSymbol(docID, code.Language, module, name)
+			}
+		}
+		if id := i.findSymbol(docID, code.Language, code.Package, call); id != "" {
+			return id
+		}
+		return i.findSymbol(docID, code.Language, "", call)
+	}
+	if code.Package != "" {
+		return i.findSymbol(docID, code.Language, code.Package, call)
+	}
+	return ""
+}
+
+// findSymbol returns the only declaration labelled name in another
+// document, or "" if there is none or several. An empty pkg matches any
+// package.
+func (i *Indexer) findSymbol(docID, language, pkg, name string) string {
+	found := ""
+	for _, node := range i.graphStore.SearchNodes(graph.NodeSymbol, name, 50) {
+		if node.Label != name || node.Props["language"] != language || node.Props["doc_id"] == docID || node.Props["kind"] == "package" {
+			continue
+		}
+		if pkg != "" && node.Props["package"] != pkg {
+			continue
+		}
+		if found != "" {
+			return ""
+		}
+		found = node.ID
+	}
+	return found
+}
+
+// importModule is the name an import path is known by in code: its last
+// element, without a file extension.
+func importModule(path string) string {
+	if k := strings.LastIndexAny(path, `/\`); k >= 0 {
+		base := path[k+1:]
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return path[strings.LastIndexAny(path, ".:")+1:]
+}
+
+// linkCallers adds CALLS edges to the file's declarations from the symbols
+// of other files in its directory and package that call them by name.
+func (i *Indexer) linkCallers(docID, path string, code *extractor.Code, local map[string]string) {
+	if path == "" {
+		return
+	}
+	for _, other := range i.fileTracker.InDir(filepath.Dir(path), path) {
+		otherDoc := "doc:" + other.BlobRef
+		if otherDoc == docID {
+			continue
+		}
+		edges, _ := i.graphStore.GetEdges(otherDoc, graph.DirOut)
+		for _, edge := range edges {
+			if edge.Type != graph.EdgeDefines {
+				continue
+			}
+			caller, err := i.graphStore.GetNode(edge.To)
+			if err != nil || caller.Props["language"] != code.Language || caller.Props["package"] != code.Package {
+				continue
+			}
+			for _, call := range propStrings(caller.Props["calls"]) {
+				if id, ok := local[call]; ok {
+					i.graphStore.AddEdge(&graph.Edge{From: caller.ID, To: id, Type: graph.EdgeCalls})
+				}
+			}
+		}
+	}
+}
+
+// incomingCalls returns the CALLS edges other documents' symbols have to
+// the declarations of a document version, so they can follow the file to
+// its next version.
+func (i *Indexer) incomingCalls(docID string) []*graph.Edge {
+	prefix := symbolPrefix(docID)
+	defines, _ := i.graphStore.GetEdges(docID, graph.DirOut)
+	var calls []*graph.Edge
+	for _, def := range defines {
+		if def.Type != graph.EdgeDefines {
+			continue
+		}
+		edges, _ := i.graphStore.GetEdges(def.To, graph.DirIn)
+		for _, edge := range edges {
+			if edge.Type == graph.EdgeCalls && !strings.HasPrefix(edge.From, prefix) {
+				calls = append(calls, edge)
+			}
+		}
+	}
+	return calls
+}
+
+// restoreCalls re-points calls into an old document version at the
+// declarations of the same name in the new one, dropping those whose
+// callee is gone.
+func (i *Indexer) restoreCalls(calls []*graph.Edge, oldDocID, newDocID string) {
+	oldPrefix, newPrefix := symbolPrefix(oldDocID), symbolPrefix(newDocID)
+	for _, edge := range calls {
+		to := newPrefix + strings.TrimPrefix(edge.To, oldPrefix)
+		if _, err := i.graphStore.GetNode(to); err != nil {
+			continue
+		}
+		if _, err := i.graphStore.GetNode(edge.From); err != nil {
+			continue
+		}
+		moved := *edge
+		moved.To = to
+		i.graphStore.AddEdge(&moved)
+	}
+}
+
+// propStrings reads a string list prop, which comes back from the store
+// as []interface{}.
+func propStrings(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
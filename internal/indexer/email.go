@@ -0,0 +1,95 @@
+package indexer
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"mindy/internal/extractor"
+	"mindy/internal/graph"
+)
+
+// replyPrefix matches the "Re:" and "Fwd:" prefixes replies add to a
+// subject, in a few languages.
+var replyPrefix = regexp.MustCompile(`(?i)^\s*((re|fwd?|aw|wg|sv|vs|antw)(\[\d+\])?\s*:\s*)+`)
+
+// addEmail records the envelope of a message: SENT_BY and SENT_TO edges
+// to the email entities of its sender and recipients, IN_THREAD to its
+// thread entity, and REPLY_TO between it and the message it answers,
+// whichever of the two is indexed first.
+func (i *Indexer) addEmail(docID string, e *extractor.Email) {
+	for _, a := range e.From {
+		if id := i.linkEntity("email:" + a.Address); id != "" {
+			i.graphStore.AddEdge(&graph.Edge{From: docID, To: id, Type: graph.EdgeSentBy, Label: a.Name})
+		}
+	}
+	for _, field := range []struct {
+		label string
+		addrs []*mail.Address
+	}{{"to", e.To}, {"cc", e.Cc}, {"bcc", e.Bcc}} {
+		for _, a := range field.addrs {
+			if id := i.linkEntity("email:" + a.Address); id != "" {
+				i.graphStore.AddEdge(&graph.Edge{From: docID, To: id, Type: graph.EdgeSentTo, Label: field.label})
+			}
+		}
+	}
+
+	thread := i.threadEntity(e.ThreadID(), e.Subject)
+	if thread == "" {
+		return
+	}
+	i.graphStore.AddEdge(&graph.Edge{From: docID, To: thread, Type: graph.EdgeInThread})
+
+	// A message whose References were trimmed lands in a thread named
+	// after its parent, so that thread and the one named after this
+	// message are searched too.
+	parent := e.Parent()
+	seen := map[string]bool{}
+	for _, id := range []string{thread, i.threadID(parent), i.threadID(e.MessageID)} {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		edges, _ := i.graphStore.GetEdges(id, graph.DirIn)
+		for _, edge := range edges {
+			if edge.Type != graph.EdgeInThread || edge.From == docID {
+				continue
+			}
+			other, err := i.graphStore.GetNode(edge.From)
+			if err != nil {
+				continue
+			}
+			if parent != "" && other.Props["message_id"] == parent {
+				i.graphStore.AddEdge(&graph.Edge{From: docID, To: other.ID, Type: graph.EdgeReplyTo})
+			}
+			if e.MessageID != "" && other.Props["in_reply_to"] == e.MessageID {
+				i.graphStore.AddEdge(&graph.Edge{From: other.ID, To: docID, Type: graph.EdgeReplyTo})
+			}
+		}
+	}
+}
+
+// threadEntity returns the entity of a thread, creating it labelled with
+// the subject without its reply prefixes.
+func (i *Indexer) threadEntity(threadID, subject string) string {
+	if threadID == "" {
+		return ""
+	}
+	id, label, ok := i.resolver.Resolve("thread:" + threadID)
+	if !ok {
+		return ""
+	}
+	if subject = strings.TrimSpace(replyPrefix.ReplaceAllString(subject, "")); subject != "" {
+		label = subject
+	}
+	i.ensureEntity(id, label)
+	return id
+}
+
+func (i *Indexer) threadID(messageID string) string {
+	if messageID == "" {
+		return ""
+	}
+	id, _, _ := i.resolver.Resolve("thread:" + messageID)
+	return id
+}
@@ -0,0 +1,257 @@
+package indexer
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"mindy/internal/blob"
+	"mindy/internal/graph"
+)
+
+var ErrFsckRunning = errors.New("an integrity check is already running")
+
+type FsckOptions struct {
+	// Repair restores corrupt or missing blobs from their original files
+	// when those still hash to the blob's name.
+	Repair bool `json:"repair"`
+}
+
+type FsckIssue struct {
+	Hash     string   `json:"hash"`
+	Problem  string   `json:"problem"`
+	Error    string   `json:"error,omitempty"`
+	Nodes    int      `json:"nodes,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	Repaired bool     `json:"repaired,omitempty"`
+}
+
+type FsckReport struct {
+	Status        string      `json:"status"`
+	Phase         string      `json:"phase"`
+	Options       FsckOptions `json:"options"`
+	Checked       int         `json:"checked"`
+	Total         int         `json:"total"`
+	Corrupt       []FsckIssue `json:"corrupt"`
+	Missing       []FsckIssue `json:"missing"`
+	Orphaned      []string    `json:"orphaned"`
+	OrphanedBytes int64       `json:"orphaned_bytes"`
+	Repaired      int         `json:"repaired"`
+	StartedAt     time.Time   `json:"started_at"`
+	FinishedAt    *time.Time  `json:"finished_at,omitempty"`
+	Error         string      `json:"error,omitempty"`
+}
+
+type fsckState struct {
+	mu     sync.Mutex
+	report *FsckReport
+}
+
+// StartFsck checks the blob store against the graph and file tracker in
+// the background. Progress is available from FsckStatus.
+func (i *Indexer) StartFsck(opts FsckOptions) (*FsckReport, error) {
+	i.fsck.mu.Lock()
+	defer i.fsck.mu.Unlock()
+	if i.fsck.report != nil && i.fsck.report.Status == "running" {
+		return nil, ErrFsckRunning
+	}
+
+	i.fsck.report = &FsckReport{
+		Status:    "running",
+		Phase:     "blobs",
+		Options:   opts,
+		Corrupt:   []FsckIssue{},
+		Missing:   []FsckIssue{},
+		Orphaned:  []string{},
+		StartedAt: time.Now(),
+	}
+	snapshot := *i.fsck.report
+	go i.runFsck(opts)
+	return &snapshot, nil
+}
+
+// FsckStatus returns a copy of the latest integrity report, or nil.
+func (i *Indexer) FsckStatus() *FsckReport {
+	i.fsck.mu.Lock()
+	defer i.fsck.mu.Unlock()
+	if i.fsck.report == nil {
+		return nil
+	}
+	r := *i.fsck.report
+	r.Corrupt = append([]FsckIssue(nil), r.Corrupt...)
+	r.Missing = append([]FsckIssue(nil), r.Missing...)
+	r.Orphaned = append([]string(nil), r.Orphaned...)
+	return &r
+}
+
+// Fsck runs an integrity check and waits for the result.
+func (i *Indexer) Fsck(opts FsckOptions) (*FsckReport, error) {
+	if _, err := i.StartFsck(opts); err != nil {
+		return nil, err
+	}
+	for {
+		if r := i.FsckStatus(); r.Status != "running" {
+			return r, nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (i *Indexer) updateFsck(fn func(r *FsckReport)) {
+	i.fsck.mu.Lock()
+	defer i.fsck.mu.Unlock()
+	fn(i.fsck.report)
+}
+
+func (i *Indexer) runFsck(opts FsckOptions) {
+	err := i.checkIntegrity(opts)
+	i.updateFsck(func(r *FsckReport) {
+		now := time.Now()
+		r.FinishedAt = &now
+		r.Phase = ""
+		if err != nil {
+			r.Status = "failed"
+			r.Error = err.Error()
+		} else {
+			r.Status = "done"
+		}
+	})
+}
+
+func (i *Indexer) checkIntegrity(opts FsckOptions) error {
+	sizes := make(map[string]int64)
+	if err := i.blobStore.Walk(func(hash string, info blob.ObjectInfo) error {
+		sizes[hash] = info.Size
+		return nil
+	}); err != nil {
+		return err
+	}
+	hashes := make([]string, 0, len(sizes))
+	for hash := range sizes {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	i.updateFsck(func(r *FsckReport) { r.Total = len(hashes) })
+
+	var corrupt []FsckIssue
+	for n, hash := range hashes {
+		// Blobs collected since the walk are not corrupt.
+		if err := i.blobStore.Verify(hash); err != nil && !errors.Is(err, os.ErrNotExist) {
+			corrupt = append(corrupt, FsckIssue{Hash: hash, Problem: "corrupt", Error: err.Error()})
+		}
+		if n%50 == 0 || n == len(hashes)-1 {
+			i.updateFsck(func(r *FsckReport) { r.Checked = n + 1 })
+		}
+	}
+
+	i.updateFsck(func(r *FsckReport) { r.Phase = "references" })
+	nodeRefs, err := i.graphStore.BlobRefs()
+	if err != nil {
+		return err
+	}
+	paths := i.blobPaths()
+
+	var missing []FsckIssue
+	referenced := make(map[string]bool)
+	for hash := range nodeRefs {
+		referenced[hash] = true
+	}
+	for hash := range paths {
+		referenced[hash] = true
+	}
+	for hash := range referenced {
+		if _, ok := sizes[hash]; !ok {
+			missing = append(missing, FsckIssue{Hash: hash, Problem: "missing"})
+		}
+	}
+	sort.Slice(missing, func(a, b int) bool { return missing[a].Hash < missing[b].Hash })
+
+	var orphaned []string
+	var orphanedBytes int64
+	for _, hash := range hashes {
+		if !referenced[hash] {
+			orphaned = append(orphaned, hash)
+			orphanedBytes += sizes[hash]
+		}
+	}
+
+	for _, issues := range [][]FsckIssue{corrupt, missing} {
+		for n := range issues {
+			issues[n].Nodes = nodeRefs[issues[n].Hash]
+			issues[n].Paths = paths[issues[n].Hash]
+		}
+	}
+
+	repaired := 0
+	if opts.Repair {
+		i.updateFsck(func(r *FsckReport) { r.Phase = "repair" })
+		for _, issues := range [][]FsckIssue{corrupt, missing} {
+			for n := range issues {
+				if i.restoreBlob(issues[n].Hash, issues[n].Paths) {
+					issues[n].Repaired = true
+					repaired++
+				}
+			}
+		}
+	}
+
+	i.updateFsck(func(r *FsckReport) {
+		r.Corrupt = append(r.Corrupt, corrupt...)
+		r.Missing = append(r.Missing, missing...)
+		r.Orphaned = append(r.Orphaned, orphaned...)
+		r.OrphanedBytes = orphanedBytes
+		r.Repaired = repaired
+	})
+	return nil
+}
+
+// blobPaths maps each blob to the files it came from: tracked files and
+// the paths recorded on document nodes, which cover older versions.
+func (i *Indexer) blobPaths() map[string][]string {
+	paths := make(map[string][]string)
+	add := func(hash, path string) {
+		for _, p := range paths[hash] {
+			if p == path {
+				return
+			}
+		}
+		paths[hash] = append(paths[hash], path)
+	}
+	for path, info := range i.fileTracker.Snapshot() {
+		if info.BlobRef != "" {
+			add(info.BlobRef, path)
+		}
+	}
+	for _, id := range i.graphStore.NodeIDsByType(graph.NodeDocument, 0) {
+		doc, err := i.graphStore.GetNode(id)
+		if err != nil || doc.BlobRef == "" {
+			continue
+		}
+		if path, ok := doc.Props["path"].(string); ok && path != "" {
+			add(doc.BlobRef, path)
+		}
+	}
+	for hash := range paths {
+		sort.Strings(paths[hash])
+	}
+	return paths
+}
+
+// restoreBlob re-reads the first candidate file whose content still hashes
+// to hash and writes it back into the blob store.
+func (i *Indexer) restoreBlob(hash string, paths []string) bool {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		err = i.blobStore.Restore(hash, f)
+		f.Close()
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
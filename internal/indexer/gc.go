@@ -0,0 +1,47 @@
+package indexer
+
+import (
+	"mindy/internal/blob"
+)
+
+// BlobRefs counts the references to each blob from tracked files and from
+// graph nodes (documents and their chunks).
+func (i *Indexer) BlobRefs() (map[string]int, error) {
+	refs, err := i.graphStore.BlobRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range i.fileTracker.Snapshot() {
+		if info.BlobRef != "" {
+			refs[info.BlobRef]++
+		}
+	}
+	return refs, nil
+}
+
+// CollectGarbage marks every referenced blob and sweeps the rest from the
+// blob store. With opts.DryRun it only reports what would be reclaimed.
+func (i *Indexer) CollectGarbage(opts blob.GCOptions) (*blob.GCReport, error) {
+	refs, err := i.BlobRefs()
+	if err != nil {
+		return nil, err
+	}
+	return i.blobStore.GC(func(hash string) bool {
+		return refs[hash] > 0
+	}, opts)
+}
+
+// RemoveFile stops tracking a file. Its document leaves the graph unless
+// another tracked file has the same content or an indexed container, such
+// as a mailbox, holds it, so the blob becomes garbage.
+func (i *Indexer) RemoveFile(path string) bool {
+	info, ok := i.fileTracker.Get(path)
+	if !ok {
+		return false
+	}
+	i.fileTracker.Remove(path)
+	if info.BlobRef != "" && !i.fileTracker.HasBlobRef(info.BlobRef, path) && !i.isPart("doc:"+info.BlobRef) {
+		i.retireDocument("doc:" + info.BlobRef)
+	}
+	return true
+}
@@ -1,17 +1,21 @@
 package indexer
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"mindy/internal/blob"
+	"mindy/internal/crypt"
 	"mindy/internal/extractor"
 	"mindy/internal/graph"
 	"mindy/internal/vector"
@@ -19,20 +23,27 @@ import (
 )
 
 type Indexer struct {
-	blobStore    *blob.Store
+	blobStore    blob.BlobStore
 	vectorIndex  *vector.Index
 	graphStore   *graph.Store
 	embedder     *embedder.TFIDF
 	dataDir      string
 	extractor    *extractor.Extractor
 	fileTracker  *FileTracker
+	resolver     *EntityResolver
+	fsck         fsckState
 	needsReindex bool
 }
 
-const IndexerVersion = "2.0.0"
+const IndexerVersion = "3.0.0"
+
+// maxExtractSize bounds the bytes of a file held in memory for extraction.
+// Larger files are stored in full but extracted from their beginning.
+var maxExtractSize = 64 << 20
 
 type FileTracker struct {
 	dataDir       string
+	mu            sync.RWMutex
 	files         map[string]FileInfo
 	indexerVersion string
 }
@@ -45,7 +56,7 @@ type FileInfo struct {
 	ChunkCount int    `json:"chunk_count"`
 }
 
-func New(blobStore *blob.Store, vectorIndex *vector.Index, graphStore *graph.Store, dataDir string) *Indexer {
+func New(blobStore blob.BlobStore, vectorIndex *vector.Index, graphStore *graph.Store, dataDir string) *Indexer {
 	tfidf, _ := embedder.NewTFIDF(dataDir)
 	tracker := NewFileTracker(dataDir)
 	
@@ -59,6 +70,7 @@ func New(blobStore *blob.Store, vectorIndex *vector.Index, graphStore *graph.Sto
 		dataDir:      dataDir,
 		extractor:    extractor.New(),
 		fileTracker:  tracker,
+		resolver:     NewEntityResolver(dataDir),
 		needsReindex: needsReindex,
 	}
 	
@@ -81,7 +93,7 @@ func NewFileTracker(dataDir string) *FileTracker {
 
 func (ft *FileTracker) load() {
 	path := filepath.Join(ft.dataDir, "file_tracker.json")
-	data, err := os.ReadFile(path)
+	data, err := crypt.ReadFile(path)
 	if err != nil {
 		return
 	}
@@ -106,25 +118,71 @@ func (ft *FileTracker) save() {
 		IndexerVersion: IndexerVersion,
 	}
 	data, _ := json.Marshal(meta)
-	os.WriteFile(path, data, 0644)
+	crypt.WriteFile(path, data, 0644)
 }
 
 func (ft *FileTracker) Get(path string) (FileInfo, bool) {
+	ft.mu.RLock()
+	defer ft.mu.RUnlock()
 	info, ok := ft.files[path]
 	return info, ok
 }
 
 func (ft *FileTracker) Set(path string, info FileInfo) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
 	ft.files[path] = info
 	ft.save()
 }
 
 func (ft *FileTracker) Remove(path string) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
 	delete(ft.files, path)
 	ft.save()
 }
 
+// Snapshot returns a copy of the tracked files that is safe to range over
+// while indexing continues.
+func (ft *FileTracker) Snapshot() map[string]FileInfo {
+	ft.mu.RLock()
+	defer ft.mu.RUnlock()
+	files := make(map[string]FileInfo, len(ft.files))
+	for path, info := range ft.files {
+		files[path] = info
+	}
+	return files
+}
+
+// InDir returns the tracked files directly in dir, other than exceptPath.
+func (ft *FileTracker) InDir(dir, exceptPath string) []FileInfo {
+	ft.mu.RLock()
+	defer ft.mu.RUnlock()
+	var files []FileInfo
+	for path, info := range ft.files {
+		if path != exceptPath && filepath.Dir(path) == dir {
+			files = append(files, info)
+		}
+	}
+	return files
+}
+
+// HasBlobRef reports whether any tracked file other than exceptPath
+// references blobRef.
+func (ft *FileTracker) HasBlobRef(blobRef, exceptPath string) bool {
+	ft.mu.RLock()
+	defer ft.mu.RUnlock()
+	for path, info := range ft.files {
+		if path != exceptPath && info.BlobRef == blobRef {
+			return true
+		}
+	}
+	return false
+}
+
 func (ft *FileTracker) Count() int {
+	ft.mu.RLock()
+	defer ft.mu.RUnlock()
 	return len(ft.files)
 }
 
@@ -133,43 +191,72 @@ func (i *Indexer) GetEmbedder() *embedder.TFIDF {
 }
 
 func (i *Indexer) IndexFile(path string) error {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
-	}
+	return i.indexFile(path, false)
+}
 
+// indexFile indexes a file unless it is unchanged since it was last
+// indexed. With rebuild set, unchanged files and the parts they contain
+// are indexed again too.
+func (i *Indexer) indexFile(path string, rebuild bool) error {
 	stat, err := os.Stat(path)
 	if err != nil {
 		return fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	currentHash := sha256ToString(content)
-	
-	if info, ok := i.fileTracker.Get(path); ok {
-		if info.Hash == currentHash && info.Modified == stat.ModTime().Unix() {
+	if info, ok := i.fileTracker.Get(path); ok && !rebuild && info.Modified == stat.ModTime().Unix() {
+		if hash, err := hashFile(path); err == nil && hash == info.Hash {
 			return nil
 		}
 	}
 
-	blobHash, err := i.blobStore.Put(content)
+	// Stream the file into the blob store, keeping its first bytes for
+	// extraction on the way, so they match blobHash even if the file
+	// changes meanwhile.
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	head := &headBuffer{limit: maxExtractSize}
+	blobHash, err := i.blobStore.PutReader(io.TeeReader(f, head))
+	f.Close()
 	if err != nil {
 		return fmt.Errorf("failed to store blob: %w", err)
 	}
+	currentHash := blobHash
+	content := head.Bytes()
+
+	extracted, err := i.extractHead(path, content, head.truncated)
+	if err != nil {
+		return fmt.Errorf("failed to extract text: %w", err)
+	}
+
+	previousDoc := ""
+	retirePrevious := false
+	var userEdges, inLinks, inCalls []*graph.Edge
+	if info, ok := i.fileTracker.Get(path); ok && info.BlobRef != "" && info.BlobRef != blobHash {
+		previousDoc = "doc:" + info.BlobRef
+		if !i.fileTracker.HasBlobRef(info.BlobRef, path) && !i.isPart(previousDoc) {
+			userEdges = i.documentUserEdges(previousDoc)
+			inLinks = i.incomingLinks(previousDoc)
+			inCalls = i.incomingCalls(previousDoc)
+			retirePrevious = true
+		}
+	}
 
 	docID := fmt.Sprintf("doc:%s", blobHash)
 	
-	existingDoc, _ := i.graphStore.GetNode(docID)
-	if existingDoc != nil {
-		i.removeDocumentFromIndex(docID)
+	var restore func()
+	if existingDoc, _ := i.graphStore.GetNode(docID); existingDoc != nil {
+		restore = i.resetDocument(docID)
 	}
 
 	metadata, _ := extractor.ExtractMetadata(path, content)
-	metadata["content_type"] = i.extractor.GetContentType(path)
-	metadata["file_type"] = i.extractor.GetFileType(path)
+	metadata["content_type"] = i.extractor.DetectContentType(path, content)
+	metadata["file_type"] = i.extractor.DetectFileType(path, content)
 
 	docNode := &graph.Node{
 		ID:       docID,
-		Type:     "Document",
+		Type:     graph.NodeDocument,
 		Label:    filepath.Base(path),
 		BlobRef:  blobHash,
 		Props: map[string]interface{}{
@@ -181,26 +268,74 @@ func (i *Indexer) IndexFile(path string) error {
 		},
 		CreateAt: time.Now().Unix(),
 	}
-
-	if err := i.graphStore.AddNode(docNode); err != nil {
-		return fmt.Errorf("failed to add document node: %w", err)
+	if previousDoc != "" {
+		docNode.Props["previous_version"] = previousDoc
+	}
+	for k, v := range extracted.Props {
+		if _, ok := docNode.Props[k]; !ok {
+			docNode.Props[k] = v
+		}
 	}
 
-	text, err := i.extractor.Extract(path, content)
+	chunkCount, err := i.addDocument(docNode, extracted)
 	if err != nil {
-		return fmt.Errorf("failed to extract text: %w", err)
+		return err
+	}
+	if restore != nil {
+		restore()
+	}
+	i.addParts(docID, path, stat.ModTime().Unix(), extracted.Parts, rebuild)
+	// Retire the old version only now, so parts it shares with the new
+	// one, such as the earlier messages of a grown mailbox, are kept.
+	if retirePrevious {
+		i.retireDocument(previousDoc)
+	}
+
+	if len(userEdges) > 0 {
+		i.restoreUserEdges(userEdges, previousDoc, docID)
+	}
+	for _, link := range inLinks {
+		link.To = docID
+		if link.From != docID {
+			i.graphStore.AddEdge(link)
+		}
+	}
+	i.restoreCalls(inCalls, previousDoc, docID)
+
+	i.fileTracker.Set(path, FileInfo{
+		Hash:       currentHash,
+		Modified:   stat.ModTime().Unix(),
+		IndexedAt:  time.Now().Unix(),
+		BlobRef:    blobHash,
+		ChunkCount: chunkCount,
+	})
+
+	i.vectorIndex.Save()
+
+	return nil
+}
+
+// addDocument stores a Document node with its chunks, the entities they
+// mention, its links, email relations and code symbols. It returns the chunk count.
+func (i *Indexer) addDocument(docNode *graph.Node, extracted *extractor.Document) (int, error) {
+	docID, blobHash := docNode.ID, docNode.BlobRef
+	path, _ := docNode.Props["path"].(string)
+
+	if err := i.graphStore.AddNode(docNode); err != nil {
+		return 0, fmt.Errorf("failed to add document node: %w", err)
 	}
 
 	if i.embedder != nil {
-		if err := i.embedder.AddDocument(docID, text); err != nil {
+		if err := i.embedder.AddDocument(docID, extracted.Text); err != nil {
 			fmt.Printf("Warning: failed to add document to TF-IDF: %v\n", err)
 		}
 	}
 
-	chunks := chunkText(text, 512)
+	chunks := chunkDocument(extracted, 512)
 	chunkCount := 0
 
-	for idx, chunk := range chunks {
+	for idx, c := range chunks {
+		chunk := c.text
 		chunkID := fmt.Sprintf("chunk:%s:%d", blobHash, idx)
 		chunkHash := sha256ToString([]byte(chunk))
 
@@ -216,7 +351,7 @@ func (i *Indexer) IndexFile(path string) error {
 
 		chunkNode := &graph.Node{
 			ID:       chunkID,
-			Type:     "Chunk",
+			Type:     graph.NodeChunk,
 			Label:    fmt.Sprintf("Chunk %d", idx),
 			BlobRef:  blobHash,
 			Props: map[string]interface{}{
@@ -226,57 +361,96 @@ func (i *Indexer) IndexFile(path string) error {
 			},
 			CreateAt: time.Now().Unix(),
 		}
+		if len(c.breadcrumb) > 0 {
+			chunkNode.Props["breadcrumb"] = c.breadcrumb
+		}
 		i.graphStore.AddNode(chunkNode)
 
 		i.graphStore.AddEdge(&graph.Edge{
 			From:  docID,
 			To:    chunkID,
-			Type:  "HAS_CHUNK",
+			Type:  graph.EdgeHasChunk,
 			Label: "",
 		})
 
 		entities := extractEntities(chunk)
+		var entityIDs []string
+		seenEntities := make(map[string]bool)
 		for _, entity := range entities {
-			entityID := fmt.Sprintf("entity:%s", strings.ToLower(strings.ReplaceAll(entity, " ", "_")))
-			entityNode := &graph.Node{
-				ID:    entityID,
-				Type:  "Entity",
-				Label: entity,
-				Props: map[string]interface{}{
-					"name": entity,
-				},
-				CreateAt: time.Now().Unix(),
+			entityID, label, ok := i.resolver.Resolve(entity)
+			if !ok || seenEntities[entityID] {
+				continue
 			}
-			i.graphStore.AddNode(entityNode)
+			seenEntities[entityID] = true
+			entityIDs = append(entityIDs, entityID)
+			i.ensureEntity(entityID, label)
 
 			i.graphStore.AddEdge(&graph.Edge{
 				From:  chunkID,
 				To:    entityID,
-				Type:  "HAS_ENTITY",
+				Type:  graph.EdgeHasEntity,
 				Label: "mentions",
 			})
 		}
+		if err := i.addCoOccurrences(entityIDs, 1); err != nil {
+			fmt.Printf("Warning: failed to update co-occurrence edges: %v\n", err)
+		}
 		chunkCount++
 	}
 
-	i.fileTracker.Set(path, FileInfo{
-		Hash:       currentHash,
-		Modified:   stat.ModTime().Unix(),
-		IndexedAt:  time.Now().Unix(),
-		BlobRef:    blobHash,
-		ChunkCount: chunkCount,
-	})
+	i.addLinks(docID, path, extracted.Links)
+	if extracted.Email != nil {
+		i.addEmail(docID, extracted.Email)
+	}
+	if extracted.Code != nil {
+		i.addCode(docID, path, extracted.Code)
+	}
+	return chunkCount, nil
+}
 
-	i.vectorIndex.Save()
+// extractHead extracts a file from the bytes kept of it. A file cut short
+// at maxExtractSize is marked truncated and, unless it is text, indexed by
+// its metadata alone.
+func (i *Indexer) extractHead(path string, head []byte, truncated bool) (*extractor.Document, error) {
+	if !truncated {
+		return i.extractor.ExtractDocument(path, head)
+	}
+	doc := &extractor.Document{}
+	if f, ok := extractor.Detect(path, head); !ok || f.Text {
+		var err error
+		if doc, err = i.extractor.ExtractDocument(path, head); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Props == nil {
+		doc.Props = map[string]interface{}{}
+	}
+	doc.Props["truncated"] = true
+	return doc, nil
+}
 
-	return nil
+// headBuffer keeps the first limit bytes written to it and discards the
+// rest.
+type headBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.Buffer.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
 }
 
 func (i *Indexer) removeDocumentFromIndex(docID string) {
 	edges, _ := i.graphStore.GetNodeEdges(docID)
 	
 	for _, edge := range edges {
-		if edge.Type == "HAS_CHUNK" {
+		if edge.Type == graph.EdgeHasChunk {
 			chunkID := edge.To
 			chunkNode, _ := i.graphStore.GetNode(chunkID)
 			if chunkNode != nil {
@@ -284,6 +458,93 @@ func (i *Indexer) removeDocumentFromIndex(docID string) {
 					i.embedder.AddDocument(chunkID+"_removed", text)
 				}
 			}
+			i.removeChunkEntities(chunkID)
+		}
+	}
+}
+
+// resetDocument clears a document that is indexed again from the same
+// blob: its entities, chunks and symbols are removed, so none are left
+// over from the last extraction. The returned function puts back the user
+// edges and incoming calls once the document has been added again.
+func (i *Indexer) resetDocument(docID string) func() {
+	userEdges := i.documentUserEdges(docID)
+	inCalls := i.incomingCalls(docID)
+	i.removeDocumentFromIndex(docID)
+	edges, _ := i.graphStore.GetEdges(docID, graph.DirOut)
+	for _, edge := range edges {
+		if edge.Type == graph.EdgeHasChunk || edge.Type == graph.EdgeDefines {
+			i.graphStore.DeleteNode(edge.To)
+		}
+	}
+	return func() {
+		i.restoreUserEdges(userEdges, docID, docID)
+		i.restoreCalls(inCalls, docID, docID)
+	}
+}
+
+// retireDocument removes the nodes of a document version that no tracked
+// file points at any more. The graph keeps them as closed versions, so
+// as-of queries still see the old content.
+func (i *Indexer) retireDocument(docID string) {
+	i.removeDocumentEntities(docID)
+	edges, _ := i.graphStore.GetNodeEdges(docID)
+	var parts []string
+	for _, edge := range edges {
+		if edge.Type == graph.EdgeHasChunk || edge.Type == graph.EdgeDefines {
+			i.graphStore.DeleteNode(edge.To)
+		}
+		if edge.Type == graph.EdgeContains && edge.From == docID {
+			parts = append(parts, edge.To)
+		}
+	}
+	i.graphStore.DeleteNode(docID)
+	i.retireParts(parts)
+}
+
+// documentUserEdges collects the user-made edges of a document and its
+// chunks so they can be carried over to the document's next version.
+func (i *Indexer) documentUserEdges(docID string) []*graph.Edge {
+	edges, _ := i.graphStore.UserEdges(docID)
+	derived, _ := i.graphStore.GetNodeEdges(docID)
+	for _, edge := range derived {
+		if edge.Type == graph.EdgeHasChunk {
+			chunkEdges, _ := i.graphStore.UserEdges(edge.To)
+			edges = append(edges, chunkEdges...)
+		}
+	}
+	return edges
+}
+
+// restoreUserEdges re-attaches user edges from an old document version to
+// the new one. Edges on a chunk move to the chunk at the same position, or
+// to the document if the new version has fewer chunks.
+func (i *Indexer) restoreUserEdges(edges []*graph.Edge, oldDocID, newDocID string) {
+	oldChunk := "chunk:" + strings.TrimPrefix(oldDocID, "doc:") + ":"
+	newChunk := "chunk:" + strings.TrimPrefix(newDocID, "doc:") + ":"
+	remap := func(id string) string {
+		if id == oldDocID {
+			return newDocID
+		}
+		if strings.HasPrefix(id, oldChunk) {
+			chunkID := newChunk + strings.TrimPrefix(id, oldChunk)
+			if _, err := i.graphStore.GetNode(chunkID); err == nil {
+				return chunkID
+			}
+			return newDocID
+		}
+		return id
+	}
+
+	for _, edge := range edges {
+		moved := *edge
+		moved.From = remap(edge.From)
+		moved.To = remap(edge.To)
+		if moved.From == moved.To {
+			continue
+		}
+		if err := i.graphStore.AddEdge(&moved); err != nil {
+			fmt.Printf("Warning: failed to restore user edge %s -[%s]-> %s: %v\n", moved.From, moved.Type, moved.To, err)
 		}
 	}
 }
@@ -299,19 +560,34 @@ func (i *Indexer) GetStats() map[string]interface{} {
 	return stats
 }
 
+// ReindexAll indexes every tracked file again, whether or not it changed,
+// so output from an older indexer version is rebuilt.
 func (i *Indexer) ReindexAll() error {
-	for path := range i.fileTracker.files {
-		if err := i.IndexFile(path); err != nil {
+	for path := range i.fileTracker.Snapshot() {
+		if err := i.indexFile(path, true); err != nil {
 			fmt.Printf("Error reindexing %s: %v\n", path, err)
 		}
 	}
 	return nil
 }
 
+func (i *Indexer) EntityAliases() map[string]string {
+	return i.resolver.Aliases()
+}
+
 func (i *Indexer) GetFileCount() int {
 	return i.fileTracker.Count()
 }
 
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return blob.HashReader(f)
+}
+
 func sha256ToString(content []byte) string {
 	hash := sha256.Sum256(content)
 	return hex.EncodeToString(hash[:])
@@ -342,6 +618,60 @@ func chunkText(text string, size int) []string {
 	return chunks
 }
 
+// textChunk is a chunk of a document and the headings it falls under.
+type textChunk struct {
+	text       string
+	breadcrumb []string
+}
+
+// chunkDocument splits a document into chunks of about size bytes.
+// Structured documents are chunked along their sections, so no chunk
+// spans two of them; a section too long for one chunk is split between
+// blocks, or between the lines of a long block.
+func chunkDocument(doc *extractor.Document, size int) []textChunk {
+	var sections []extractor.Section
+	if doc.Structure != nil {
+		sections = doc.Structure.Sections()
+	}
+	if len(sections) == 0 {
+		var chunks []textChunk
+		for _, text := range chunkText(doc.Text, size) {
+			chunks = append(chunks, textChunk{text: text})
+		}
+		return chunks
+	}
+
+	var chunks []textChunk
+	for _, sec := range sections {
+		var current strings.Builder
+		flush := func() {
+			if current.Len() > 0 {
+				chunks = append(chunks, textChunk{text: current.String(), breadcrumb: sec.Breadcrumb})
+				current.Reset()
+			}
+		}
+		for _, block := range sec.Blocks {
+			parts := []string{block.String()}
+			if len(parts[0]) > size {
+				parts = strings.Split(parts[0], "\n")
+			}
+			sep := "\n\n"
+			for _, part := range parts {
+				if current.Len() > 0 && current.Len()+len(sep)+len(part) > size {
+					flush()
+				}
+				if current.Len() > 0 {
+					current.WriteString(sep)
+				}
+				current.WriteString(part)
+				sep = "\n"
+			}
+		}
+		flush()
+	}
+	return chunks
+}
+
 func extractEntities(text string) []string {
 	var entities []string
 	seen := make(map[string]bool)
@@ -395,6 +725,26 @@ func extractEntities(text string) []string {
 	return entities
 }
 
+func entityNodeID(entity string) string {
+	return fmt.Sprintf("entity:%s", strings.ToLower(strings.ReplaceAll(entity, " ", "_")))
+}
+
+// ensureEntity adds the entity node if it does not exist yet.
+func (i *Indexer) ensureEntity(id, label string) {
+	if _, err := i.graphStore.GetNode(id); err == nil {
+		return
+	}
+	i.graphStore.AddNode(&graph.Node{
+		ID:    id,
+		Type:  graph.NodeEntity,
+		Label: label,
+		Props: map[string]interface{}{
+			"name": label,
+		},
+		CreateAt: time.Now().Unix(),
+	})
+}
+
 func isCapitalized(word string) bool {
 	if len(word) == 0 {
 		return false
@@ -1,12 +1,17 @@
 package indexer
 
 import (
+	"archive/zip"
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"mindy/internal/blob"
+	"mindy/internal/extractor"
 	"mindy/internal/graph"
 	"mindy/internal/vector"
 )
@@ -40,7 +45,7 @@ func TestIndexer_ExtractText(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := extractText(tt.path, tt.content)
+			got, _ := extractor.New().Extract(tt.path, tt.content)
 			if tt.path == "test.md" {
 				if len(got) < 10 {
 					t.Errorf("extractText() too short: got %d chars", len(got))
@@ -61,6 +66,35 @@ func TestIndexer_ChunkText(t *testing.T) {
 	}
 }
 
+func TestIndexer_ChunkDocument(t *testing.T) {
+	src := "Preamble.\n\n# Guide\n\nIntro.\n\n## Install\n\n" + strings.Repeat("Run the installer again.\n", 30) + "\n## Use\n\nOpen it.\n"
+	doc, err := extractor.New().ExtractDocument("guide.md", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := chunkDocument(doc, 512)
+
+	var crumbs []string
+	for _, c := range chunks {
+		crumbs = append(crumbs, strings.Join(c.breadcrumb, " > "))
+		if len(c.text) > 512 {
+			t.Errorf("chunk under %q is %d bytes", crumbs[len(crumbs)-1], len(c.text))
+		}
+	}
+	want := []string{"", "Guide", "Guide > Install", "Guide > Install", "Guide > Use"}
+	if strings.Join(crumbs, "|") != strings.Join(want, "|") {
+		t.Errorf("breadcrumbs = %q, want %q", crumbs, want)
+	}
+	if chunks[4].text != "Use\n\nOpen it." {
+		t.Errorf("last chunk = %q", chunks[4].text)
+	}
+
+	flat := chunkDocument(&extractor.Document{Text: "plain text"}, 512)
+	if len(flat) != 1 || flat[0].text != "plain text" || flat[0].breadcrumb != nil {
+		t.Errorf("flat chunks = %+v", flat)
+	}
+}
+
 func TestIndexer_ExtractEntities(t *testing.T) {
 	text := "Contact John Doe at john@example.com or visit https://example.com. Call 555-1234."
 	entities := extractEntities(text)
@@ -103,6 +137,702 @@ func TestIndexer_IndexFile(t *testing.T) {
 	}
 }
 
+func TestIndexer_LargeFile(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+	defer func(n int) { maxExtractSize = n }(maxExtractSize)
+	maxExtractSize = 1 << 10
+
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	// Text past the limit is stored but not extracted; other formats are
+	// kept by their metadata.
+	logFile := filepath.Join(tmpDir, "app.log")
+	content := []byte(strings.Repeat("service started on port 8080\n", 200))
+	os.WriteFile(logFile, content, 0644)
+	pdfFile := filepath.Join(tmpDir, "report.pdf")
+	os.WriteFile(pdfFile, append([]byte("%PDF-1.4\n"), content...), 0644)
+	for _, path := range []string{logFile, pdfFile} {
+		if err := indexer.IndexFile(path); err != nil {
+			t.Fatalf("failed to index %s: %v", path, err)
+		}
+	}
+
+	info, _ := indexer.fileTracker.Get(logFile)
+	if stored, err := blobStore.Get(info.BlobRef); err != nil || len(stored) != len(content) {
+		t.Fatalf("stored %d bytes, want %d: %v", len(stored), len(content), err)
+	}
+	doc, err := graphStore.GetNode("doc:" + info.BlobRef)
+	if err != nil || doc.Props["truncated"] != true {
+		t.Errorf("log document = %+v, %v", doc, err)
+	}
+	if info.ChunkCount == 0 {
+		t.Error("the start of the log should be indexed")
+	}
+	info, _ = indexer.fileTracker.Get(pdfFile)
+	if chunk, err := graphStore.GetNode("chunk:" + info.BlobRef + ":0"); err == nil && strings.Contains(chunk.Props["text"].(string), "service") {
+		t.Errorf("truncated pdf should not be extracted, chunk = %q", chunk.Props["text"])
+	}
+}
+
+func TestIndexer_CoOccurrence(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	testFile := filepath.Join(tmpDir, "notes.txt")
+	os.WriteFile(testFile, []byte("Alice reviewed Badger storage with Carol.\nAlice prefers Badger."), 0644)
+	if err := indexer.IndexFile(testFile); err != nil {
+		t.Fatalf("failed to index file: %v", err)
+	}
+
+	edge, err := graphStore.GetEdge("entity:alice", "CO_OCCURS", "entity:badger")
+	if err != nil {
+		t.Fatalf("expected CO_OCCURS edge: %v", err)
+	}
+	if edge.Weight != 1 {
+		t.Errorf("weight = %v, want 1", edge.Weight)
+	}
+
+	related, err := indexer.RelatedEntities("entity:badger", 10, "count")
+	if err != nil {
+		t.Fatalf("RelatedEntities() error = %v", err)
+	}
+	if len(related) < 2 {
+		t.Fatalf("expected at least 2 related entities, got %d", len(related))
+	}
+
+	os.WriteFile(testFile, []byte("Alice reviewed Badger again."), 0644)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(testFile, future, future)
+	if err := indexer.IndexFile(testFile); err != nil {
+		t.Fatalf("failed to reindex file: %v", err)
+	}
+
+	edge, err = graphStore.GetEdge("entity:alice", "CO_OCCURS", "entity:badger")
+	if err != nil {
+		t.Fatalf("expected CO_OCCURS edge after edit: %v", err)
+	}
+	if edge.Weight != 1 {
+		t.Errorf("weight after edit = %v, want 1", edge.Weight)
+	}
+	if _, err := graphStore.GetEdge("entity:badger", "CO_OCCURS", "entity:carol"); err == nil {
+		t.Error("stale CO_OCCURS edge should be removed after edit")
+	}
+
+	// Past the cap, taking counts back in another order undoes exactly
+	// the pairs that were added.
+	var many []string
+	for n := 0; n < maxCoOccurEntities+10; n++ {
+		id := fmt.Sprintf("entity:many_%02d", n)
+		graphStore.AddNode(&graph.Node{ID: id, Type: graph.NodeEntity, Label: id})
+		many = append(many, id)
+	}
+	indexer.addCoOccurrences(many, 1)
+	reversed := make([]string, len(many))
+	for n, id := range many {
+		reversed[len(many)-1-n] = id
+	}
+	indexer.addCoOccurrences(reversed, -1)
+	for _, id := range many {
+		edges, _ := graphStore.GetEdges(id, graph.DirBoth)
+		for _, edge := range edges {
+			if edge.Type == graph.EdgeCoOccurs {
+				t.Fatalf("CO_OCCURS %s -> %s left with weight %v", edge.From, edge.To, edge.Weight)
+			}
+		}
+	}
+}
+
+func TestIndexer_NormalizeEntity(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"Kubernetes,", "Kubernetes", true},
+		{"Mindy's", "Mindy", true},
+		{"The", "", false},
+		{"However", "", false},
+		{"2024", "", false},
+		{"email:Bob@X.com", "email:bob@x.com", true},
+		{"url:HTTPS://Example.com/Docs/).", "url:https://example.com/Docs", true},
+		{"phone:(555) 123-4567", "phone:5551234567", true},
+		{"phone:555-12", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeEntity(tt.raw)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeEntity(%q) = %q, %v; want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	r := NewEntityResolver(t.TempDir())
+	if id, label, _ := r.Resolve("K8s"); id != "entity:kubernetes" || label != "Kubernetes" {
+		t.Errorf("Resolve(K8s) = %q, %q; want entity:kubernetes", id, label)
+	}
+}
+
+func TestIndexer_MergeEntities(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	files := map[string]string{
+		"a.txt": "Alice deployed Kubernetes with Badger.",
+		"b.txt": "The Kubernetess cluster runs Badger.",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		if err := indexer.IndexFile(path); err != nil {
+			t.Fatalf("failed to index %s: %v", name, err)
+		}
+	}
+	if _, err := graphStore.GetNode("entity:the"); err == nil {
+		t.Error("stopword should not become an entity")
+	}
+
+	candidates := indexer.MergeCandidates(10)
+	found := false
+	for _, c := range candidates {
+		for _, d := range c.Duplicates {
+			if d.ID == "entity:kubernetess" || c.Canonical.ID == "entity:kubernetess" {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected kubernetes/kubernetess candidate, got %+v", candidates)
+	}
+
+	node, err := indexer.MergeEntities("entity:kubernetes", []string{"entity:kubernetess"})
+	if err != nil {
+		t.Fatalf("MergeEntities() error = %v", err)
+	}
+	if aliases, _ := node.Props["aliases"].([]string); len(aliases) != 1 || aliases[0] != "Kubernetess" {
+		t.Errorf("aliases = %v, want [Kubernetess]", node.Props["aliases"])
+	}
+	if _, err := graphStore.GetNode("entity:kubernetess"); err == nil {
+		t.Error("duplicate should be deleted")
+	}
+	edge, err := graphStore.GetEdge("entity:badger", "CO_OCCURS", "entity:kubernetes")
+	if err != nil || edge.Weight != 2 {
+		t.Errorf("expected rewired CO_OCCURS with weight 2, got %v, %v", edge, err)
+	}
+	if n := indexer.mentionCount("entity:kubernetes"); n != 2 {
+		t.Errorf("mentions = %d, want 2", n)
+	}
+
+	if id, _, _ := indexer.resolver.Resolve("Kubernetess"); id != "entity:kubernetes" {
+		t.Errorf("alias should resolve to canonical, got %q", id)
+	}
+}
+
+func TestIndexer_UserEdgesSurviveReindex(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	testFile := filepath.Join(tmpDir, "plan.txt")
+	os.WriteFile(testFile, []byte("Roadmap for Mindy."), 0644)
+	if err := indexer.IndexFile(testFile); err != nil {
+		t.Fatalf("failed to index file: %v", err)
+	}
+	info, _ := indexer.fileTracker.Get(testFile)
+	oldDoc := "doc:" + info.BlobRef
+
+	graphStore.DefineNodeType(graph.NodeTypeSpec{Name: "Project"})
+	graphStore.DefineEdgeType(graph.EdgeTypeSpec{Name: "PART_OF", To: []string{"Project"}})
+	graphStore.DefineEdgeType(graph.EdgeTypeSpec{Name: "TAGGED", From: []string{graph.NodeChunk}})
+
+	project, err := graphStore.CreateUserNode(&graph.Node{Type: "Project", Label: "Mindy"})
+	if err != nil {
+		t.Fatalf("CreateUserNode() error = %v", err)
+	}
+	graphStore.CreateUserEdge(&graph.Edge{From: oldDoc, To: project.ID, Type: "PART_OF"})
+	graphStore.CreateUserEdge(&graph.Edge{From: "chunk:" + info.BlobRef + ":0", To: project.ID, Type: "TAGGED"})
+
+	os.WriteFile(testFile, []byte("Updated roadmap for Mindy."), 0644)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(testFile, future, future)
+	if err := indexer.IndexFile(testFile); err != nil {
+		t.Fatalf("failed to reindex file: %v", err)
+	}
+	info, _ = indexer.fileTracker.Get(testFile)
+
+	if _, err := graphStore.GetNode(oldDoc); err == nil {
+		t.Error("old document version should be retired")
+	}
+	if _, err := graphStore.GetEdge("doc:"+info.BlobRef, "PART_OF", project.ID); err != nil {
+		t.Errorf("PART_OF edge should move to the new document: %v", err)
+	}
+	if _, err := graphStore.GetEdge("chunk:"+info.BlobRef+":0", "TAGGED", project.ID); err != nil {
+		t.Errorf("TAGGED edge should move to the new chunk: %v", err)
+	}
+
+	// A full reindex rebuilds the unchanged file, dropping chunks an
+	// earlier extraction left, and keeps the user edges.
+	stale := "chunk:" + info.BlobRef + ":9"
+	graphStore.AddNode(&graph.Node{ID: stale, Type: graph.NodeChunk, Label: "stale"})
+	graphStore.AddEdge(&graph.Edge{From: "doc:" + info.BlobRef, To: stale, Type: graph.EdgeHasChunk})
+	if err := indexer.ReindexAll(); err != nil {
+		t.Fatalf("ReindexAll() error = %v", err)
+	}
+	if _, err := graphStore.GetNode(stale); err == nil {
+		t.Error("stale chunk should be removed by a full reindex")
+	}
+	if _, err := graphStore.GetEdge("doc:"+info.BlobRef, "PART_OF", project.ID); err != nil {
+		t.Errorf("PART_OF edge lost in a full reindex: %v", err)
+	}
+	if _, err := graphStore.GetEdge("chunk:"+info.BlobRef+":0", "TAGGED", project.ID); err != nil {
+		t.Errorf("TAGGED edge lost in a full reindex: %v", err)
+	}
+}
+
+func TestIndexer_Links(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	target := filepath.Join(tmpDir, "docs", "setup.md")
+	page := filepath.Join(tmpDir, "index.html")
+	os.MkdirAll(filepath.Dir(target), 0755)
+	os.WriteFile(target, []byte("# Setup\n\nInstall it."), 0644)
+	os.WriteFile(page, []byte(`<html><head><title>Home</title><meta name="description" content="Start here"></head>
+<body><p>See <a href="docs/setup.md#install">the setup guide</a>, <a href="https://Example.com/faq">the FAQ</a>
+and <a href="mailto:Help@Example.com?subject=hi">support</a>.</p><script>var x = "secret";</script></body></html>`), 0644)
+	for _, path := range []string{target, page} {
+		if err := indexer.IndexFile(path); err != nil {
+			t.Fatalf("failed to index %s: %v", path, err)
+		}
+	}
+
+	pageInfo, _ := indexer.fileTracker.Get(page)
+	targetInfo, _ := indexer.fileTracker.Get(target)
+	pageDoc := "doc:" + pageInfo.BlobRef
+	node, _ := graphStore.GetNode(pageDoc)
+	if node.Props["title"] != "Home" || node.Props["description"] != "Start here" {
+		t.Errorf("page props = %v", node.Props)
+	}
+	for _, to := range []string{"doc:" + targetInfo.BlobRef, "entity:url:https://example.com/faq", "entity:email:help@example.com"} {
+		if _, err := graphStore.GetEdge(pageDoc, graph.EdgeLinksTo, to); err != nil {
+			t.Errorf("expected LINKS_TO %s: %v", to, err)
+		}
+	}
+	if edge, _ := graphStore.GetEdge(pageDoc, graph.EdgeLinksTo, "doc:"+targetInfo.BlobRef); edge != nil && edge.Label != "the setup guide" {
+		t.Errorf("link label = %q", edge.Label)
+	}
+	if chunk, err := graphStore.GetNode("chunk:" + pageInfo.BlobRef + ":0"); err != nil || strings.Contains(chunk.Props["text"].(string), "secret") {
+		t.Errorf("chunk = %+v, %v; script text should be skipped", chunk, err)
+	}
+
+	os.WriteFile(target, []byte("# Setup\n\nInstall it twice."), 0644)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(target, future, future)
+	if err := indexer.IndexFile(target); err != nil {
+		t.Fatalf("failed to reindex: %v", err)
+	}
+	targetInfo, _ = indexer.fileTracker.Get(target)
+	if _, err := graphStore.GetEdge(pageDoc, graph.EdgeLinksTo, "doc:"+targetInfo.BlobRef); err != nil {
+		t.Errorf("link should follow the edited file: %v", err)
+	}
+}
+
+func TestIndexer_Mailbox(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	first := "From alice@example.com Mon Jan  1 00:00:00 2024\n" +
+		"From: Alice <alice@example.com>\nTo: bob@example.com\nSubject: Launch plan\n" +
+		"Message-ID: <1@example.com>\nDate: Mon, 1 Jan 2024 10:00:00 +0000\n\nShall we launch Friday?\n\n"
+	reply := "From bob@example.com Mon Jan  1 01:00:00 2024\n" +
+		"From: Bob <bob@example.com>\nTo: alice@example.com\nCc: Carol <carol@example.com>\nSubject: Re: Launch plan\n" +
+		"Message-ID: <2@example.com>\nIn-Reply-To: <1@example.com>\nReferences: <1@example.com>\n\nYes.\n\n"
+	mbox := filepath.Join(tmpDir, "inbox.mbox")
+	os.WriteFile(mbox, []byte(reply), 0644)
+	if err := indexer.IndexFile(mbox); err != nil {
+		t.Fatalf("failed to index mbox: %v", err)
+	}
+	// The parent arrives later; the reply must still be linked to it.
+	os.WriteFile(mbox, []byte(reply+first), 0644)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(mbox, future, future)
+	if err := indexer.IndexFile(mbox); err != nil {
+		t.Fatalf("failed to reindex mbox: %v", err)
+	}
+
+	info, _ := indexer.fileTracker.Get(mbox)
+	edges, _ := graphStore.GetEdges("doc:"+info.BlobRef, graph.DirOut)
+	msgs := map[string]string{}
+	for _, edge := range edges {
+		if edge.Type == graph.EdgeContains {
+			node, _ := graphStore.GetNode(edge.To)
+			msgs[node.Label] = node.ID
+			if node.Props["path"] != mbox+"!/"+edge.Label {
+				t.Errorf("path = %v", node.Props["path"])
+			}
+		}
+	}
+	if len(msgs) != 2 || msgs["Launch plan"] == "" || msgs["Re: Launch plan"] == "" {
+		t.Fatalf("contained messages = %v", msgs)
+	}
+	root, answer := msgs["Launch plan"], msgs["Re: Launch plan"]
+	for _, e := range []struct{ from, typ, to, label string }{
+		{root, graph.EdgeSentBy, "entity:email:alice@example.com", "Alice"},
+		{answer, graph.EdgeSentTo, "entity:email:carol@example.com", "cc"},
+		{answer, graph.EdgeReplyTo, root, ""},
+		{answer, graph.EdgeInThread, "entity:thread:1@example.com", ""},
+		{root, graph.EdgeInThread, "entity:thread:1@example.com", ""},
+	} {
+		edge, err := graphStore.GetEdge(e.from, e.typ, e.to)
+		if err != nil || edge.Label != e.label {
+			t.Errorf("%s -[%s]-> %s: %+v, %v", e.from, e.typ, e.to, edge, err)
+		}
+	}
+	if thread, _ := graphStore.GetNode("entity:thread:1@example.com"); thread == nil || thread.Label != "Launch plan" {
+		t.Errorf("thread = %+v", thread)
+	}
+
+	indexer.RemoveFile(mbox)
+	if _, err := graphStore.GetNode(answer); err == nil {
+		t.Error("messages should be retired with their mailbox")
+	}
+}
+
+func TestIndexer_Archive(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	zipOf := func(files ...string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for n := 0; n+1 < len(files); n += 2 {
+			w, _ := zw.Create(files[n])
+			w.Write([]byte(files[n+1]))
+		}
+		zw.Close()
+		return buf.Bytes()
+	}
+	inner := zipOf("spec.md", "# Spec\n\nThe quokka protocol.")
+	archive := filepath.Join(tmpDir, "bundle.zip")
+	os.WriteFile(archive, zipOf("docs/readme.md", "# Readme\n\nContact admin@example.com.", "inner.zip", string(inner)), 0644)
+	if err := indexer.IndexFile(archive); err != nil {
+		t.Fatalf("failed to index archive: %v", err)
+	}
+
+	paths := map[string]string{}
+	var walk func(id string)
+	walk = func(id string) {
+		edges, _ := graphStore.GetEdges(id, graph.DirOut)
+		for _, edge := range edges {
+			if edge.Type == graph.EdgeContains {
+				node, _ := graphStore.GetNode(edge.To)
+				paths[node.Props["path"].(string)] = node.ID
+				walk(node.ID)
+			}
+		}
+	}
+	info, _ := indexer.fileTracker.Get(archive)
+	walk("doc:" + info.BlobRef)
+	readme, spec := paths[archive+"!/docs/readme.md"], paths[archive+"!/inner.zip!/spec.md"]
+	if len(paths) != 3 || readme == "" || spec == "" || paths[archive+"!/inner.zip"] == "" {
+		t.Fatalf("contained paths = %v", paths)
+	}
+	if node, _ := graphStore.GetNode(readme); node.Label != "readme.md" || node.Props["file_type"] != "markdown" {
+		t.Errorf("readme = %+v", node)
+	}
+	chunked := false
+	edges, _ := graphStore.GetEdges(readme, graph.DirOut)
+	for _, edge := range edges {
+		chunked = chunked || edge.Type == graph.EdgeHasChunk
+	}
+	if !chunked {
+		t.Error("readme should be chunked")
+	}
+
+	indexer.RemoveFile(archive)
+	if _, err := graphStore.GetNode(spec); err == nil {
+		t.Error("members should be retired with their archive")
+	}
+}
+
+func TestIndexer_Code(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	os.MkdirAll(filepath.Join(tmpDir, "store"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "app"), 0755)
+	store := filepath.Join(tmpDir, "store", "store.go")
+	util := filepath.Join(tmpDir, "store", "util.go")
+	app := filepath.Join(tmpDir, "app", "main.go")
+	storeSrc := "package store\n\nimport \"fmt\"\n\n// Store keeps things.\ntype Store struct{}\n\n" +
+		"// New makes a Store.\nfunc New() *Store { return &Store{} }\n\n" +
+		"func (s *Store) Get(key string) {\n\ts.check(key)\n\tvalidate(key)\n\tfmt.Println(key)\n}\n\n" +
+		"func (s *Store) check(key string) {}\n"
+	os.WriteFile(store, []byte(storeSrc), 0644)
+	os.WriteFile(util, []byte("package store\n\nfunc validate(key string) {}\n"), 0644)
+	os.WriteFile(app, []byte("package main\n\nimport \"example.com/store\"\n\nfunc main() {\n\tstore.New().Get(\"a\")\n}\n"), 0644)
+	// util.go comes last, so Get's call to validate is only linked when
+	// its callee appears.
+	for _, path := range []string{store, app, util} {
+		if err := indexer.IndexFile(path); err != nil {
+			t.Fatalf("failed to index %s: %v", path, err)
+		}
+	}
+
+	sym := func(path, name string) string {
+		info, _ := indexer.fileTracker.Get(path)
+		return "symbol:" + info.BlobRef + ":" + name
+	}
+	storeInfo, _ := indexer.fileTracker.Get(store)
+	appInfo, _ := indexer.fileTracker.Get(app)
+	for _, e := range []struct{ from, typ, to string }{
+		{"doc:" + storeInfo.BlobRef, graph.EdgeDefines, sym(store, "Store.Get")},
+		{"doc:" + storeInfo.BlobRef, graph.EdgeImports, "symbol:go:fmt"},
+		{"doc:" + appInfo.BlobRef, graph.EdgeImports, "symbol:go:example.com/store"},
+		{sym(store, "Store.Get"), graph.EdgeCalls, sym(store, "Store.check")},
+		{sym(store, "Store.Get"), graph.EdgeCalls, sym(util, "validate")},
+		{sym(app, "main"), graph.EdgeCalls, sym(store, "New")},
+	} {
+		if _, err := graphStore.GetEdge(e.from, e.typ, e.to); err != nil {
+			t.Errorf("%s -[%s]-> %s: %v", e.from, e.typ, e.to, err)
+		}
+	}
+	node, err := graphStore.GetNode(sym(store, "New"))
+	if err != nil || node.Type != graph.NodeSymbol || node.Props["kind"] != "function" || node.Props["doc"] != "New makes a Store." || node.Props["package"] != "store" {
+		t.Errorf("New = %+v, %v", node, err)
+	}
+
+	// Calls into the file follow it to its next version.
+	oldNew := sym(store, "New")
+	os.WriteFile(store, []byte(storeSrc+"\nfunc (s *Store) Put() {}\n"), 0644)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(store, future, future)
+	if err := indexer.IndexFile(store); err != nil {
+		t.Fatalf("failed to reindex %s: %v", store, err)
+	}
+	if _, err := graphStore.GetNode(oldNew); err == nil {
+		t.Error("symbols of the old version should be retired")
+	}
+	if _, err := graphStore.GetEdge(sym(app, "main"), graph.EdgeCalls, sym(store, "New")); err != nil {
+		t.Errorf("call to New not carried over: %v", err)
+	}
+
+	// A full reindex keeps them too.
+	indexer.ReindexAll()
+	if _, err := graphStore.GetEdge(sym(app, "main"), graph.EdgeCalls, sym(store, "New")); err != nil {
+		t.Errorf("call to New lost in a full reindex: %v", err)
+	}
+}
+
+func TestIndexer_CollectGarbage(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	edited := filepath.Join(tmpDir, "edited.txt")
+	removed := filepath.Join(tmpDir, "removed.txt")
+	kept := filepath.Join(tmpDir, "kept.txt")
+	os.WriteFile(edited, []byte("First draft."), 0644)
+	os.WriteFile(removed, []byte("Soon gone."), 0644)
+	os.WriteFile(kept, []byte("Stays around."), 0644)
+	for _, path := range []string{edited, removed, kept} {
+		if err := indexer.IndexFile(path); err != nil {
+			t.Fatalf("failed to index %s: %v", path, err)
+		}
+	}
+	draft, _ := indexer.fileTracker.Get(edited)
+	gone, _ := indexer.fileTracker.Get(removed)
+
+	os.WriteFile(edited, []byte("Final version."), 0644)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(edited, future, future)
+	indexer.IndexFile(edited)
+
+	if !indexer.RemoveFile(removed) {
+		t.Fatal("RemoveFile() should report the tracked file")
+	}
+	if _, err := graphStore.GetNode("doc:" + gone.BlobRef); err == nil {
+		t.Error("removed file's document should leave the graph")
+	}
+
+	// Age every blob past blob.MinGracePeriod.
+	old := time.Now().Add(-48 * time.Hour)
+	blobStore.Walk(func(hash string, _ blob.ObjectInfo) error {
+		return os.Chtimes(blobStore.Path(hash), old, old)
+	})
+
+	report, err := indexer.CollectGarbage(blob.GCOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+	if report.Scanned != 4 || report.Reclaimable != 2 {
+		t.Errorf("unexpected dry run report: %+v", report)
+	}
+
+	report, _ = indexer.CollectGarbage(blob.GCOptions{})
+	if report.Deleted != 2 {
+		t.Errorf("expected 2 deleted blobs, got %+v", report)
+	}
+	for _, hash := range []string{draft.BlobRef, gone.BlobRef} {
+		if ok, _ := blobStore.Has(hash); ok {
+			t.Errorf("blob %s should be collected", hash)
+		}
+	}
+	info, _ := indexer.fileTracker.Get(kept)
+	if ok, _ := blobStore.Has(info.BlobRef); !ok {
+		t.Error("referenced blob should be kept")
+	}
+}
+
+func TestIndexer_Fsck(t *testing.T) {
+	if !hasDiskSpace() {
+		t.Skip("insufficient disk space")
+	}
+
+	tmpDir := t.TempDir()
+
+	blobStore, _ := blob.NewStore(tmpDir)
+	vectorIndex, _ := vector.NewIndex(tmpDir)
+	graphStore, _ := graph.NewStore(tmpDir)
+	defer graphStore.Close()
+
+	indexer := New(blobStore, vectorIndex, graphStore, tmpDir)
+
+	damaged := filepath.Join(tmpDir, "damaged.txt")
+	lost := filepath.Join(tmpDir, "lost.txt")
+	changed := filepath.Join(tmpDir, "changed.txt")
+	os.WriteFile(damaged, []byte("Content that will rot."), 0644)
+	os.WriteFile(lost, []byte("Content that will vanish."), 0644)
+	os.WriteFile(changed, []byte("Content edited after the blob vanished."), 0644)
+	for _, path := range []string{damaged, lost, changed} {
+		if err := indexer.IndexFile(path); err != nil {
+			t.Fatalf("failed to index %s: %v", path, err)
+		}
+	}
+	orphan, _ := blobStore.Put([]byte("nobody points here"))
+
+	refs := make(map[string]string)
+	for _, path := range []string{damaged, lost, changed} {
+		info, _ := indexer.fileTracker.Get(path)
+		refs[path] = info.BlobRef
+	}
+	os.WriteFile(blobStore.Path(refs[damaged]), []byte("garbage"), 0644)
+	os.Remove(blobStore.Path(refs[lost]))
+	os.Remove(blobStore.Path(refs[changed]))
+	os.WriteFile(changed, []byte("Different now."), 0644)
+
+	report, err := indexer.Fsck(FsckOptions{})
+	if err != nil {
+		t.Fatalf("Fsck() error = %v", err)
+	}
+	if report.Status != "done" || report.Checked != report.Total || report.Total != 2 {
+		t.Errorf("unexpected progress: %+v", report)
+	}
+	if len(report.Corrupt) != 1 || report.Corrupt[0].Hash != refs[damaged] {
+		t.Errorf("expected %s to be corrupt, got %+v", refs[damaged], report.Corrupt)
+	}
+	if len(report.Missing) != 2 {
+		t.Errorf("expected 2 missing blobs, got %+v", report.Missing)
+	}
+	if len(report.Orphaned) != 1 || report.Orphaned[0] != orphan {
+		t.Errorf("expected orphan %s, got %v", orphan, report.Orphaned)
+	}
+
+	report, _ = indexer.Fsck(FsckOptions{Repair: true})
+	if report.Repaired != 2 {
+		t.Errorf("expected 2 repaired blobs, got %+v", report)
+	}
+	for _, path := range []string{damaged, lost} {
+		if err := blobStore.Verify(refs[path]); err != nil {
+			t.Errorf("blob for %s not repaired: %v", path, err)
+		}
+	}
+	if ok, _ := blobStore.Has(refs[changed]); ok {
+		t.Error("blob of a changed file must not be restored")
+	}
+}
+
 func hasDiskSpace() bool {
 	tmp := os.TempDir()
 	var stat os.FileInfo
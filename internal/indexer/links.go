@@ -0,0 +1,85 @@
+package indexer
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"mindy/internal/extractor"
+	"mindy/internal/graph"
+)
+
+// addLinks records a document's hyperlinks as LINKS_TO edges labelled
+// with the anchor text. Web links point at their URL entity and mailto
+// links at the email entity; relative and file: links point at the
+// document of the file they name, if that file is indexed.
+func (i *Indexer) addLinks(docID, path string, links []extractor.Link) {
+	for _, link := range links {
+		target := i.linkTarget(path, link.URL)
+		if target == "" || target == docID {
+			continue
+		}
+		i.graphStore.AddEdge(&graph.Edge{
+			From:  docID,
+			To:    target,
+			Type:  graph.EdgeLinksTo,
+			Label: link.Text,
+		})
+	}
+}
+
+func (i *Indexer) linkTarget(path, href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return i.linkEntity("url:" + href)
+	case "mailto":
+		addr, _, _ := strings.Cut(u.Opaque, "?")
+		if addr, err := url.PathUnescape(addr); err == nil {
+			return i.linkEntity("email:" + addr)
+		}
+	case "file":
+		return i.linkedDocument(u.Path)
+	case "":
+		if u.Host == "" && u.Path != "" {
+			target := filepath.FromSlash(u.Path)
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), target)
+			}
+			return i.linkedDocument(target)
+		}
+	}
+	return ""
+}
+
+func (i *Indexer) linkEntity(mention string) string {
+	id, label, ok := i.resolver.Resolve(mention)
+	if !ok {
+		return ""
+	}
+	i.ensureEntity(id, label)
+	return id
+}
+
+func (i *Indexer) linkedDocument(path string) string {
+	if info, ok := i.fileTracker.Get(filepath.Clean(path)); ok && info.BlobRef != "" {
+		return "doc:" + info.BlobRef
+	}
+	return ""
+}
+
+// incomingLinks returns the LINKS_TO edges other documents have to a
+// document version, so they can follow the file to its next version.
+func (i *Indexer) incomingLinks(docID string) []*graph.Edge {
+	edges, _ := i.graphStore.GetEdges(docID, graph.DirIn)
+	var links []*graph.Edge
+	for _, edge := range edges {
+		if edge.Type == graph.EdgeLinksTo && edge.Source != graph.SourceUser {
+			links = append(links, edge)
+		}
+	}
+	return links
+}
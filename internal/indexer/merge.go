@@ -0,0 +1,224 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"mindy/internal/graph"
+)
+
+// maxFuzzyBucket bounds the pairwise edit-distance comparisons done per
+// bucket when looking for merge candidates.
+const maxFuzzyBucket = 500
+
+type MergeCandidate struct {
+	Canonical  *graph.Node   `json:"canonical"`
+	Duplicates []*graph.Node `json:"duplicates"`
+	Reason     string        `json:"reason"`
+	Mentions   int           `json:"mentions"`
+}
+
+// MergeEntities folds duplicate entities into canonicalID. Edges are
+// rewired onto the canonical node, CO_OCCURS counts are recomputed from the
+// chunks that mention it, and the duplicates' labels are recorded as
+// aliases so later indexing resolves them to the canonical entity.
+func (i *Indexer) MergeEntities(canonicalID string, duplicateIDs []string) (*graph.Node, error) {
+	canonical, err := i.graphStore.GetNode(canonicalID)
+	if err != nil || canonical.Type != graph.NodeEntity {
+		return nil, fmt.Errorf("entity %s not found", canonicalID)
+	}
+
+	var dups []string
+	var aliases []string
+	seen := map[string]bool{canonicalID: true}
+	for _, id := range duplicateIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		node, err := i.graphStore.GetNode(id)
+		if err != nil || node.Type != graph.NodeEntity {
+			return nil, fmt.Errorf("entity %s not found", id)
+		}
+		dups = append(dups, id)
+		aliases = append(aliases, node.Label)
+		if name, ok := node.Props["name"].(string); ok {
+			aliases = append(aliases, name)
+		}
+	}
+	if len(dups) == 0 {
+		return nil, fmt.Errorf("no duplicates to merge into %s", canonicalID)
+	}
+
+	// The chunks that mention any of the entities give back their
+	// co-occurrence counts now and add them again once they mention the
+	// canonical entity instead. Renaming an entity can move it across the
+	// maxCoOccurEntities cut, so every pair of those chunks is redone.
+	involved := append([]string{canonicalID}, dups...)
+	chunks := i.mentioningChunks(involved)
+	for _, chunkID := range chunks {
+		i.addCoOccurrences(i.chunkEntities(chunkID), -1)
+	}
+	for _, id := range involved {
+		edges, _ := i.graphStore.GetEdges(id, graph.DirBoth)
+		for _, edge := range edges {
+			if edge.Type == graph.EdgeCoOccurs {
+				i.graphStore.DeleteEdge(edge.From, edge.Type, edge.To)
+			}
+		}
+	}
+
+	merged, err := i.graphStore.MergeNodes(canonicalID, dups)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunkID := range chunks {
+		if err := i.addCoOccurrences(i.chunkEntities(chunkID), 1); err != nil {
+			return nil, err
+		}
+	}
+	i.resolver.AddAliases(canonicalID, aliases, dups)
+	return merged, nil
+}
+
+// mentioningChunks returns the chunks that mention any of the entities.
+func (i *Indexer) mentioningChunks(entityIDs []string) []string {
+	seen := make(map[string]bool)
+	var chunks []string
+	for _, id := range entityIDs {
+		edges, _ := i.graphStore.GetEdges(id, graph.DirIn)
+		for _, edge := range edges {
+			if edge.Type == graph.EdgeHasEntity && !seen[edge.From] {
+				seen[edge.From] = true
+				chunks = append(chunks, edge.From)
+			}
+		}
+	}
+	return chunks
+}
+
+// MergeCandidates suggests groups of entities that probably name the same
+// thing: first those whose labels agree once case and punctuation are
+// ignored, then those within edit distance 1 of each other, which catches
+// plurals and typos. The most mentioned entity of each group is proposed
+// as canonical.
+func (i *Indexer) MergeCandidates(limit int) []MergeCandidate {
+	groups := make(map[string][]*graph.Node)
+	var keys []string
+	for _, id := range i.graphStore.NodeIDsByType(graph.NodeEntity, 0) {
+		node, err := i.graphStore.GetNode(id)
+		if err != nil || isTypedEntity(node.Label) {
+			continue
+		}
+		key := squashEntity(node.Label)
+		if len(key) < 3 {
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], node)
+	}
+	sort.Strings(keys)
+
+	var candidates []MergeCandidate
+	for _, key := range keys {
+		if len(groups[key]) > 1 {
+			candidates = append(candidates, i.newMergeCandidate(groups[key], "normalized form"))
+		}
+	}
+
+	buckets := make(map[string][]string)
+	for _, key := range keys {
+		if len(key) >= 5 {
+			buckets[key[:2]] = append(buckets[key[:2]], key)
+		}
+	}
+	for _, bucket := range buckets {
+		if len(bucket) > maxFuzzyBucket {
+			continue
+		}
+		for a := 0; a < len(bucket); a++ {
+			for b := a + 1; b < len(bucket); b++ {
+				if editDistanceOne(bucket[a], bucket[b]) {
+					nodes := append(append([]*graph.Node{}, groups[bucket[a]]...), groups[bucket[b]]...)
+					candidates = append(candidates, i.newMergeCandidate(nodes, "edit distance 1"))
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].Mentions > candidates[b].Mentions
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+func (i *Indexer) newMergeCandidate(nodes []*graph.Node, reason string) MergeCandidate {
+	counts := make(map[string]int, len(nodes))
+	total := 0
+	for _, n := range nodes {
+		counts[n.ID] = i.mentionCount(n.ID)
+		total += counts[n.ID]
+	}
+	sort.SliceStable(nodes, func(a, b int) bool {
+		if counts[nodes[a].ID] != counts[nodes[b].ID] {
+			return counts[nodes[a].ID] > counts[nodes[b].ID]
+		}
+		return nodes[a].ID < nodes[b].ID
+	})
+	return MergeCandidate{Canonical: nodes[0], Duplicates: nodes[1:], Reason: reason, Mentions: total}
+}
+
+func isTypedEntity(label string) bool {
+	for _, kind := range []string{"email:", "url:", "phone:", "date:"} {
+		if strings.HasPrefix(label, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// squashEntity lowercases a label and keeps only letters and digits.
+func squashEntity(label string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(label) {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// editDistanceOne reports whether a and b differ by exactly one insertion,
+// deletion or substitution.
+func editDistanceOne(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(b)-len(a) > 1 || a == b {
+		return false
+	}
+	i, j, edits := 0, 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			i++
+			j++
+			continue
+		}
+		edits++
+		if edits > 1 {
+			return false
+		}
+		if len(a) == len(b) {
+			i++
+		}
+		j++
+	}
+	return edits+(len(b)-j)+(len(a)-i) <= 1
+}
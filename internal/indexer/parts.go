@@ -0,0 +1,105 @@
+package indexer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mindy/internal/extractor"
+	"mindy/internal/graph"
+)
+
+// addParts indexes the documents packed inside a container, such as the
+// messages of a mailbox, as Documents of their own with the virtual path
+// "container!/name", and links them to it with CONTAINS edges. Parts
+// already in the graph, such as messages kept from an earlier version of
+// the mailbox, are only linked unless rebuild is set.
+func (i *Indexer) addParts(containerID, path string, modified int64, parts []extractor.Part, rebuild bool) {
+	for _, part := range parts {
+		if part.Document == nil {
+			continue
+		}
+		hash, err := i.blobStore.Put(part.Content)
+		if err != nil {
+			fmt.Printf("Warning: failed to store %s!/%s: %v\n", path, part.Name, err)
+			continue
+		}
+		partID := "doc:" + hash
+		if partID == containerID {
+			continue
+		}
+		existing, _ := i.graphStore.GetNode(partID)
+		if existing == nil || rebuild {
+			var restore func()
+			if existing != nil {
+				restore = i.resetDocument(partID)
+			}
+			partPath := path + "!/" + part.Name
+			node := &graph.Node{
+				ID:      partID,
+				Type:    graph.NodeDocument,
+				Label:   partLabel(part),
+				BlobRef: hash,
+				Props: map[string]interface{}{
+					"path":         partPath,
+					"size":         len(part.Content),
+					"modified":     modified,
+					"content_type": i.extractor.DetectContentType(part.Name, part.Content),
+					"file_type":    i.extractor.DetectFileType(part.Name, part.Content),
+				},
+				CreateAt: time.Now().Unix(),
+			}
+			for k, v := range part.Document.Props {
+				if _, ok := node.Props[k]; !ok {
+					node.Props[k] = v
+				}
+			}
+			if _, err := i.addDocument(node, part.Document); err != nil {
+				fmt.Printf("Warning: failed to index %s: %v\n", partPath, err)
+				continue
+			}
+			if restore != nil {
+				restore()
+			}
+			i.addParts(partID, partPath, modified, part.Document.Parts, rebuild)
+		}
+		i.graphStore.AddEdge(&graph.Edge{
+			From:  containerID,
+			To:    partID,
+			Type:  graph.EdgeContains,
+			Label: part.Name,
+		})
+	}
+}
+
+// partLabel names a part's Document node: an email by its subject,
+// anything else by the last element of its name.
+func partLabel(part extractor.Part) string {
+	if e := part.Document.Email; e != nil && e.Subject != "" {
+		return e.Subject
+	}
+	return filepath.Base(filepath.FromSlash(part.Name))
+}
+
+// isPart reports whether a container still holds the document.
+func (i *Indexer) isPart(docID string) bool {
+	edges, _ := i.graphStore.GetEdges(docID, graph.DirIn)
+	for _, edge := range edges {
+		if edge.Type == graph.EdgeContains {
+			return true
+		}
+	}
+	return false
+}
+
+// retireParts retires the parts of a retired container that neither
+// another container nor a tracked file holds.
+func (i *Indexer) retireParts(parts []string) {
+	for _, partID := range parts {
+		if i.isPart(partID) || i.fileTracker.HasBlobRef(strings.TrimPrefix(partID, "doc:"), "") {
+			continue
+		}
+		i.retireDocument(partID)
+	}
+}
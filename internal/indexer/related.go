@@ -0,0 +1,160 @@
+package indexer
+
+import (
+	"math"
+	"sort"
+
+	"mindy/internal/graph"
+)
+
+// maxCoOccurEntities caps how many entities of a single chunk are paired
+// with each other, keeping CO_OCCURS updates quadratic in a small number.
+const maxCoOccurEntities = 25
+
+type RelatedEntity struct {
+	Node  *graph.Node `json:"node"`
+	Count int         `json:"count"`
+	PMI   float64     `json:"pmi"`
+	Score float64     `json:"score"`
+}
+
+// coOccurSet returns the distinct entities of a chunk that are paired with
+// each other: the first maxCoOccurEntities in ID order, so that counts
+// added for a chunk are taken back from exactly the same pairs whatever
+// order its edges come in.
+func coOccurSet(entityIDs []string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, id := range entityIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > maxCoOccurEntities {
+		ids = ids[:maxCoOccurEntities]
+	}
+	return ids
+}
+
+// addCoOccurrences adjusts the CO_OCCURS edge between every pair of the
+// given entities by delta. Each pair is stored once, from the lexically
+// smaller ID to the larger one.
+func (i *Indexer) addCoOccurrences(entityIDs []string, delta float32) error {
+	ids := coOccurSet(entityIDs)
+
+	var edges []*graph.Edge
+	for a := 0; a < len(ids); a++ {
+		for b := a + 1; b < len(ids); b++ {
+			edges = append(edges, &graph.Edge{
+				From:   ids[a],
+				To:     ids[b],
+				Type:   graph.EdgeCoOccurs,
+				Label:  "co-occurs with",
+				Weight: delta,
+			})
+		}
+	}
+	if len(edges) == 0 {
+		return nil
+	}
+	return i.graphStore.IncrementEdges(edges)
+}
+
+// chunkEntities returns the entities a chunk mentions.
+func (i *Indexer) chunkEntities(chunkID string) []string {
+	edges, _ := i.graphStore.GetEdges(chunkID, graph.DirOut)
+	var entityIDs []string
+	for _, edge := range edges {
+		if edge.Type == graph.EdgeHasEntity {
+			entityIDs = append(entityIDs, edge.To)
+		}
+	}
+	return entityIDs
+}
+
+// removeChunkEntities drops a chunk's HAS_ENTITY edges and takes back the
+// co-occurrence counts they contributed, so re-indexing does not inflate them.
+func (i *Indexer) removeChunkEntities(chunkID string) {
+	entityIDs := i.chunkEntities(chunkID)
+	for _, id := range entityIDs {
+		i.graphStore.DeleteEdge(chunkID, graph.EdgeHasEntity, id)
+	}
+	i.addCoOccurrences(entityIDs, -1)
+}
+
+func (i *Indexer) removeDocumentEntities(docID string) {
+	edges, _ := i.graphStore.GetNodeEdges(docID)
+	for _, edge := range edges {
+		if edge.Type == graph.EdgeHasChunk {
+			i.removeChunkEntities(edge.To)
+		}
+	}
+}
+
+// RelatedEntities ranks the CO_OCCURS neighbours of an entity. With rank
+// "pmi" neighbours are ordered by pointwise mutual information over chunks,
+// which favours specific associations over globally frequent entities;
+// otherwise they are ordered by raw co-occurrence count.
+func (i *Indexer) RelatedEntities(entityID string, limit int, rank string) ([]RelatedEntity, error) {
+	edges, err := i.graphStore.GetEdges(entityID, graph.DirBoth)
+	if err != nil {
+		return nil, err
+	}
+
+	totalChunks := float64(i.graphStore.CountNodes(graph.NodeChunk))
+	entityChunks := float64(i.mentionCount(entityID))
+
+	var related []RelatedEntity
+	for _, edge := range edges {
+		if edge.Type != graph.EdgeCoOccurs {
+			continue
+		}
+		otherID := edge.To
+		if otherID == entityID {
+			otherID = edge.From
+		}
+		node, err := i.graphStore.GetNode(otherID)
+		if err != nil {
+			continue
+		}
+
+		r := RelatedEntity{Node: node, Count: int(edge.Weight)}
+		otherChunks := float64(i.mentionCount(otherID))
+		if totalChunks > 0 && entityChunks > 0 && otherChunks > 0 {
+			r.PMI = math.Log2(float64(edge.Weight) * totalChunks / (entityChunks * otherChunks))
+		}
+		r.Score = float64(r.Count)
+		if rank == "pmi" {
+			r.Score = r.PMI
+		}
+		related = append(related, r)
+	}
+
+	sort.SliceStable(related, func(a, b int) bool {
+		if related[a].Score != related[b].Score {
+			return related[a].Score > related[b].Score
+		}
+		return related[a].Count > related[b].Count
+	})
+
+	if limit > 0 && len(related) > limit {
+		related = related[:limit]
+	}
+	return related, nil
+}
+
+func (i *Indexer) mentionCount(entityID string) int {
+	edges, err := i.graphStore.GetEdges(entityID, graph.DirIn)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, edge := range edges {
+		if edge.Type == graph.EdgeHasEntity {
+			n++
+		}
+	}
+	return n
+}
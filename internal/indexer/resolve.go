@@ -0,0 +1,208 @@
+package indexer
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"mindy/internal/crypt"
+)
+
+// builtinAliases maps lowercased spellings to the label of the entity they
+// stand for.
+var builtinAliases = map[string]string{
+	"k8s":      "Kubernetes",
+	"golang":   "Go",
+	"postgres": "PostgreSQL",
+	"psql":     "PostgreSQL",
+	"nodejs":   "Node.js",
+	"node.js":  "Node.js",
+	"gcp":      "Google Cloud",
+}
+
+// entityStopwords are common words that show up capitalized at the start
+// of sentences and headings but are not entities.
+var entityStopwords = toSet(`
+a about above after again against all also although am an and another any are as at
+be because been before being below between both but by can cannot could did do does doing
+done down during each either else even ever every example few for from further get gets
+had has have having he hello her here hers herself him himself his how however if in into
+is it its itself just let like many may maybe me might more most much must my myself
+neither never new next no nor not note now of off often on once one only or other our ours
+ourselves out over own please regards same see she should since so some such than thank
+thanks that the their theirs them themselves then there these they this those though through
+thus to today too two under until up upon us use used using very was we were what when where
+whether which while who whom whose why will with within without would yes yet you your
+yours yourself yourselves dear hi ok okay step first second third last finally
+monday tuesday wednesday thursday friday saturday sunday
+`)
+
+func toSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// EntityResolver turns raw entity mentions into canonical entity IDs. It
+// normalizes the mention, drops stopwords and applies the alias table, which
+// holds the built-in aliases plus those recorded by entity merges.
+type EntityResolver struct {
+	dataDir string
+	mu      sync.RWMutex
+	aliases map[string]string
+}
+
+func NewEntityResolver(dataDir string) *EntityResolver {
+	r := &EntityResolver{
+		dataDir: dataDir,
+		aliases: make(map[string]string),
+	}
+	r.load()
+	return r
+}
+
+func (r *EntityResolver) load() {
+	data, err := crypt.ReadFile(filepath.Join(r.dataDir, "entity_aliases.json"))
+	if err != nil {
+		return
+	}
+	var aliases map[string]string
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return
+	}
+	r.aliases = aliases
+}
+
+func (r *EntityResolver) save() {
+	data, _ := json.Marshal(r.aliases)
+	crypt.WriteFile(filepath.Join(r.dataDir, "entity_aliases.json"), data, 0644)
+}
+
+// Resolve returns the node ID and label for a raw mention, or ok=false if
+// the mention should not become an entity.
+func (r *EntityResolver) Resolve(raw string) (id, label string, ok bool) {
+	label, ok = normalizeEntity(raw)
+	if !ok {
+		return "", "", false
+	}
+	key := strings.ToLower(label)
+
+	r.mu.RLock()
+	target, found := r.aliases[key]
+	r.mu.RUnlock()
+	if found {
+		return target, label, true
+	}
+	if canonical, found := builtinAliases[key]; found {
+		return entityNodeID(canonical), canonical, true
+	}
+	return entityNodeID(label), label, true
+}
+
+// AddAliases points each alias at canonicalID and re-targets aliases that
+// pointed at any of the retired IDs.
+func (r *EntityResolver) AddAliases(canonicalID string, aliases []string, retiredIDs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	retired := make(map[string]bool)
+	for _, id := range retiredIDs {
+		retired[id] = true
+	}
+	for key, target := range r.aliases {
+		if retired[target] {
+			r.aliases[key] = canonicalID
+		}
+	}
+	for _, alias := range aliases {
+		if label, ok := normalizeEntity(alias); ok && entityNodeID(label) != canonicalID {
+			r.aliases[strings.ToLower(label)] = canonicalID
+		}
+	}
+	r.save()
+}
+
+func (r *EntityResolver) Aliases() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	aliases := make(map[string]string, len(r.aliases))
+	for k, v := range r.aliases {
+		aliases[k] = v
+	}
+	return aliases
+}
+
+// normalizeEntity cleans up a mention produced by extractEntities. Typed
+// mentions ("email:", "url:", "phone:", "date:", and "thread:" for email
+// threads) are normalized per kind; plain words lose surrounding
+// punctuation and possessives and are rejected if they are stopwords,
+// numbers or too short.
+func normalizeEntity(raw string) (string, bool) {
+	kind, value := "", strings.TrimSpace(raw)
+	if i := strings.Index(value, ":"); i > 0 {
+		switch value[:i] {
+		case "email", "url", "phone", "date", "thread":
+			kind, value = value[:i], value[i+1:]
+		}
+	}
+
+	switch kind {
+	case "email":
+		value = strings.ToLower(strings.TrimRight(value, "."))
+	case "url":
+		value = strings.TrimRight(value, ".,;:!?)]}'\"")
+		if u, err := url.Parse(value); err == nil && u.Host != "" {
+			u.Scheme = strings.ToLower(u.Scheme)
+			u.Host = strings.ToLower(u.Host)
+			value = u.String()
+		}
+		value = strings.TrimSuffix(value, "/")
+	case "phone":
+		var b strings.Builder
+		digits := 0
+		for i, c := range strings.TrimSpace(value) {
+			if c == '+' && i == 0 {
+				b.WriteRune(c)
+			} else if unicode.IsDigit(c) {
+				b.WriteRune(c)
+				digits++
+			}
+		}
+		if digits < 7 {
+			return "", false
+		}
+		value = b.String()
+	case "date":
+		value = strings.Join(strings.Fields(value), " ")
+	case "thread":
+		value = strings.Trim(value, "<> \t")
+	default:
+		value = strings.Trim(value, ".,!?;:\"'()[]{}<>*_`")
+		value = strings.TrimSuffix(strings.TrimSuffix(value, "'s"), "’s")
+		if len(value) < 3 || entityStopwords[strings.ToLower(value)] || isNumeric(value) {
+			return "", false
+		}
+	}
+
+	if value == "" {
+		return "", false
+	}
+	if kind != "" {
+		return kind + ":" + value, true
+	}
+	return value, true
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if !unicode.IsDigit(c) && c != '.' && c != ',' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -4,9 +4,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
+	"mindy/internal/extractor"
 	"mindy/internal/indexer"
 )
 
@@ -105,17 +105,5 @@ func (w *Watcher) processFile(path string) {
 }
 
 func isIndexable(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	indexableExts := map[string]bool{
-		".txt":     true,
-		".md":      true,
-		".markdown": true,
-		".html":    true,
-		".htm":     true,
-		".json":    true,
-		".xml":     true,
-		".csv":     true,
-		".log":     true,
-	}
-	return indexableExts[ext]
+	return extractor.Indexable(path)
 }
@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+
+	"mindy/internal/crypt"
 )
 
 const (
@@ -179,7 +181,7 @@ func (i *Index) initCentroids() [][]float32 {
 }
 
 func (i *Index) loadCentroids(path string) error {
-	data, err := os.ReadFile(path)
+	data, err := crypt.ReadFile(path)
 	if err != nil {
 		return err
 	}
@@ -200,23 +202,14 @@ func (i *Index) loadCentroids(path string) error {
 
 func (i *Index) Save() error {
 	centroidsFile := filepath.Join(i.dataDir, "centroids.bin")
-	f, err := os.Create(centroidsFile)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
+	var data []byte
 	for _, c := range i.centroids {
 		for _, v := range c {
-			buf := make([]byte, 4)
-			binary.LittleEndian.PutUint32(buf, math.Float32bits(v))
-			if _, err := f.Write(buf); err != nil {
-				return err
-			}
+			data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
 		}
 	}
 
-	return nil
+	return crypt.WriteFile(centroidsFile, data, 0644)
 }
 
 func (i *Index) Close() error {
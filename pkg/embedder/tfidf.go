@@ -12,6 +12,8 @@ import (
 	"strings"
 	"sync"
 	"unicode"
+
+	"mindy/internal/crypt"
 )
 
 var englishStopwords = map[string]bool{
@@ -675,7 +677,7 @@ func (t *TFIDF) normalize(vec []float32) {
 
 func (t *TFIDF) load() error {
 	vocabFile := filepath.Join(t.dataDir, "tfidf", "vocab.json")
-	data, err := os.ReadFile(vocabFile)
+	data, err := crypt.ReadFile(vocabFile)
 	if err != nil {
 		return err
 	}
@@ -684,7 +686,7 @@ func (t *TFIDF) load() error {
 	}
 
 	idfFile := filepath.Join(t.dataDir, "tfidf", "idf.json")
-	data, err = os.ReadFile(idfFile)
+	data, err = crypt.ReadFile(idfFile)
 	if err != nil {
 		return err
 	}
@@ -693,7 +695,7 @@ func (t *TFIDF) load() error {
 	}
 
 	vectorsFile := filepath.Join(t.dataDir, "tfidf", "vectors.json")
-	data, err = os.ReadFile(vectorsFile)
+	data, err = crypt.ReadFile(vectorsFile)
 	if err != nil {
 		return err
 	}
@@ -704,7 +706,7 @@ func (t *TFIDF) load() error {
 	t.vectors = vectors
 
 	metaFile := filepath.Join(t.dataDir, "tfidf", "meta.json")
-	data, err = os.ReadFile(metaFile)
+	data, err = crypt.ReadFile(metaFile)
 	if err != nil {
 		return err
 	}
@@ -737,7 +739,7 @@ func (t *TFIDF) save() error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(filepath.Join(dir, "vocab.json"), vocabData, 0644); err != nil {
+	if err := crypt.WriteFile(filepath.Join(dir, "vocab.json"), vocabData, 0644); err != nil {
 		return err
 	}
 
@@ -745,7 +747,7 @@ func (t *TFIDF) save() error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(filepath.Join(dir, "idf.json"), idfData, 0644); err != nil {
+	if err := crypt.WriteFile(filepath.Join(dir, "idf.json"), idfData, 0644); err != nil {
 		return err
 	}
 
@@ -753,7 +755,7 @@ func (t *TFIDF) save() error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(filepath.Join(dir, "vectors.json"), vectorsData, 0644); err != nil {
+	if err := crypt.WriteFile(filepath.Join(dir, "vectors.json"), vectorsData, 0644); err != nil {
 		return err
 	}
 
@@ -770,7 +772,7 @@ func (t *TFIDF) save() error {
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(filepath.Join(dir, "meta.json"), metaData, 0644); err != nil {
+	if err := crypt.WriteFile(filepath.Join(dir, "meta.json"), metaData, 0644); err != nil {
 		return err
 	}
 